@@ -1,14 +1,21 @@
 package main
 
 import (
+	"log"
+
 	"github.com/fitnis/api-gateway/proxy"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	auth, err := proxy.NewAuthenticatorFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+
 	router := gin.Default()
 	router.Use(cors.Default())
-	proxy.RegisterRoutes(router)
+	proxy.RegisterRoutes(router, auth)
 	router.Run(":8080") // Public API port
 }
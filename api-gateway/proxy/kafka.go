@@ -21,6 +21,10 @@ var topics = map[string]string{
 	"referrals":     "referral-requests",
 	"examinations":  "examination-requests",
 	"samples":       "sample-requests",
+	"practitioners": "practitioner-requests",
+	"appointments":  "appointment-requests",
+	"orders":        "order-requests",
+	"records":       "record-requests",
 }
 
 var responseTopics = map[string]string{
@@ -29,6 +33,10 @@ var responseTopics = map[string]string{
 	"referrals":     "referral-responses",
 	"examinations":  "examination-responses",
 	"samples":       "sample-responses",
+	"practitioners": "practitioner-responses",
+	"appointments":  "appointment-responses",
+	"orders":        "order-responses",
+	"records":       "record-responses",
 }
 
 // KafkaRequest represents a request to be sent to a microservice
@@ -5,13 +5,29 @@ import (
 	"encoding/hex"
 	"io"
 	"net/http"
+	pathpkg "path"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.Engine) {
-	r.Any("/api/:service/*path", handleRequest)
+// internalPaths are served by services only to each other. Reaching them from outside would skip
+// the flows that call them, such as the patient-service's erasure with its retention holds and
+// audit record, so the gateway answers them as unknown routes.
+var internalPaths = []string{
+	"/privacy",    // patient data export and erasure
+	"/deletion",   // cascades of patient and examination deletes
+	"/reassign",   // records moved by patient merges
+	"/references", // checks that referenced records exist, for services creating records
+}
+
+// identityHeaders carry the caller's identity to the services. They are never taken from the
+// client; they are set from the verified bearer token (see Authenticator).
+var identityHeaders = []string{"X-User-Id", "X-User-Role", "X-Purpose-Of-Use"}
+
+// RegisterRoutes proxies /api/:service/* to the services, authenticating callers with auth.
+func RegisterRoutes(r *gin.Engine, auth *Authenticator) {
+	r.Any("/api/:service/*path", auth.authenticate, handleRequest)
 }
 
 func handleRequest(c *gin.Context) {
@@ -19,6 +35,24 @@ func handleRequest(c *gin.Context) {
 	service := c.Param("service")
 	path := c.Param("path")
 
+	// The audit log is kept by the records-service
+	if service == "audit" {
+		service, path = "records", "/audit"+path
+	}
+
+	if isInternalPath(path) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+		return
+	}
+
+	// Patient summaries are composed here from several services
+	if service == "patients" && c.Request.Method == http.MethodGet {
+		if patientID, ok := summaryPatientID(path); ok {
+			handleSummary(c, patientID)
+			return
+		}
+	}
+
 	// Generate unique request ID
 	requestID := generateRequestID()
 
@@ -29,17 +63,19 @@ func handleRequest(c *gin.Context) {
 		return
 	}
 
-	// Convert headers
-	headers := make(map[string]string)
-	for key, values := range c.Request.Header {
-		headers[key] = strings.Join(values, ",")
+	headers := forwardHeaders(c)
+
+	// Forward the query string so services can filter and page
+	requestPath := path
+	if c.Request.URL.RawQuery != "" {
+		requestPath += "?" + c.Request.URL.RawQuery
 	}
 
 	// Create Kafka request
 	req := KafkaRequest{
 		RequestID:   requestID,
 		Method:      c.Request.Method,
-		Path:        path,
+		Path:        requestPath,
 		Headers:     headers,
 		Body:        body,
 		ServicePath: "/" + service + path,
@@ -57,8 +93,44 @@ func handleRequest(c *gin.Context) {
 		c.Header(key, value)
 	}
 
-	// Return response
-	c.Data(resp.StatusCode, resp.Headers["Content-Type"], resp.Body)
+	// Return response; bodies are passed through byte for byte so binary documents (e.g. PDFs) survive
+	contentType := resp.Headers["Content-Type"]
+	if contentType == "" && len(resp.Body) > 0 {
+		contentType = "application/octet-stream"
+	}
+	c.Data(resp.StatusCode, contentType, resp.Body)
+}
+
+// forwardHeaders converts the client's headers for a request to a service
+func forwardHeaders(c *gin.Context) map[string]string {
+	headers := make(map[string]string)
+	for key, values := range c.Request.Header {
+		headers[key] = strings.Join(values, ",")
+	}
+	for _, key := range identityHeaders {
+		delete(headers, key)
+	}
+	// The token has done its job here; services get the identity it vouched for instead
+	delete(headers, "Authorization")
+	for key, value := range identityHeaderValues(c) {
+		headers[key] = value
+	}
+	// Services record the client's address in the audit log. It is the connection's address,
+	// replacing any X-Source-Ip the client sent.
+	headers["X-Source-Ip"] = c.RemoteIP()
+	return headers
+}
+
+// isInternalPath reports whether a service path is one of the internal paths or below it.
+// The path is cleaned first, so "//privacy/./erase" is caught too.
+func isInternalPath(path string) bool {
+	clean := pathpkg.Clean("/" + path)
+	for _, internal := range internalPaths {
+		if clean == internal || strings.HasPrefix(clean, internal+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 // generateRequestID creates a unique request ID
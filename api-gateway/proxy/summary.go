@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How far a patient summary descends, chosen with ?depth=
+const (
+	DepthPatient      = 0 // the patient alone
+	DepthExaminations = 1 // and the patient's examinations
+	DepthRecords      = 2 // and each examination's samples, prescriptions and referrals (the default)
+)
+
+// summaryParallelism bounds the requests a summary has in flight at once
+const summaryParallelism = 8
+
+// recordSections are the per-examination sections, each read from the service of the same name
+var recordSections = []string{"samples", "prescriptions", "referrals"}
+
+// PatientSummary is a patient's chart composed from the services holding it. Sections that
+// could not be read are left out and reported in Errors, keyed by section: "patient",
+// "examinations", or "examinations.<id>.<samples|prescriptions|referrals>".
+type PatientSummary struct {
+	Depth        int                     `json:"depth"`
+	Patient      json.RawMessage         `json:"patient,omitempty"`
+	Examinations json.RawMessage         `json:"examinations,omitempty"` // each with its samples, prescriptions and referrals at DepthRecords
+	Errors       map[string]SectionError `json:"errors,omitempty"`
+}
+
+// SectionError is why a section of a summary is missing
+type SectionError struct {
+	Status int    `json:"status"` // the service's status, or 502 when it could not be reached
+	Error  string `json:"error"`
+}
+
+// section is the outcome of reading one section.
+type section struct {
+	body json.RawMessage
+	err  *SectionError
+}
+
+// summaryPatientID returns the patient ID of a /:id/summary path.
+func summaryPatientID(path string) (string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[1] != "summary" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// handleSummary handles GET /api/patients/:id/summary
+// It reads the patient and, depending on depth, the examinations and their records from the
+// services over Kafka in parallel. The patient's own 4xx replies, such as not found or a
+// refused consent, are passed through; every other failure is reported in its section.
+func handleSummary(c *gin.Context, patientID string) {
+	summarize(c, patientID, SendKafkaRequest)
+}
+
+// summarize composes the summary handleSummary serves, reading each section with send.
+func summarize(c *gin.Context, patientID string, send func(service string, req KafkaRequest) (KafkaResponse, error)) {
+	if _, err := strconv.ParseUint(patientID, 10, 32); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	depth := DepthRecords
+	if value := c.Query("depth"); value != "" {
+		d, err := strconv.Atoi(value)
+		if err != nil || d < DepthPatient || d > DepthRecords {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid depth: must be 0, 1 or 2"})
+			return
+		}
+		depth = d
+	}
+
+	f := &fetcher{send: send, headers: forwardHeaders(c), slots: make(chan struct{}, summaryParallelism)}
+	var patient, examinations section
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		patient = f.get("patients", "/"+patientID)
+	}()
+	if depth >= DepthExaminations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			examinations = f.get("examinations", "/patient/"+patientID)
+		}()
+	}
+	wg.Wait()
+
+	if patient.err != nil && patient.err.Status >= 400 && patient.err.Status < 500 {
+		c.JSON(patient.err.Status, gin.H{"error": patient.err.Error})
+		return
+	}
+
+	summary := PatientSummary{Depth: depth, Patient: patient.body, Errors: map[string]SectionError{}}
+	if patient.err != nil {
+		summary.Errors["patient"] = *patient.err
+	}
+	if depth >= DepthExaminations {
+		if examinations.err != nil {
+			summary.Errors["examinations"] = *examinations.err
+		} else {
+			summary.Examinations = f.withRecords(examinations.body, depth, summary.Errors)
+		}
+	}
+	if len(summary.Errors) == 0 {
+		summary.Errors = nil
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// fetcher reads summary sections with the client's headers, a bounded number at a time.
+type fetcher struct {
+	send    func(service string, req KafkaRequest) (KafkaResponse, error)
+	headers map[string]string
+	slots   chan struct{}
+}
+
+// get reads a section from a service.
+func (f *fetcher) get(service, path string) section {
+	f.slots <- struct{}{}
+	defer func() { <-f.slots }()
+
+	resp, err := f.send(service, KafkaRequest{
+		RequestID:   generateRequestID(),
+		Method:      http.MethodGet,
+		Path:        path,
+		Headers:     f.headers,
+		ServicePath: "/" + service + path,
+	})
+	if err != nil {
+		return section{err: &SectionError{Status: http.StatusBadGateway, Error: "Service communication error: " + err.Error()}}
+	}
+	if resp.StatusCode != http.StatusOK {
+		var reply struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(resp.Body, &reply) != nil || reply.Error == "" {
+			reply.Error = http.StatusText(resp.StatusCode)
+		}
+		return section{err: &SectionError{Status: resp.StatusCode, Error: reply.Error}}
+	}
+	if !json.Valid(resp.Body) {
+		return section{err: &SectionError{Status: http.StatusBadGateway, Error: "Invalid response from " + service}}
+	}
+	return section{body: resp.Body}
+}
+
+// withRecords drops the patient repeated in each examination and, at
+// DepthRecords, reads every examination's records in parallel and adds them to it. Sections
+// that fail are recorded in errs.
+func (f *fetcher) withRecords(body json.RawMessage, depth int, errs map[string]SectionError) json.RawMessage {
+	var exams []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &exams); err != nil {
+		errs["examinations"] = SectionError{Status: http.StatusBadGateway, Error: "Invalid response from examinations"}
+		return nil
+	}
+	for _, exam := range exams {
+		delete(exam, "patient")
+	}
+
+	if depth >= DepthRecords {
+		results := make([][]section, len(exams))
+		var wg sync.WaitGroup
+		for i, exam := range exams {
+			id := string(exam["id"])
+			results[i] = make([]section, len(recordSections))
+			for j, service := range recordSections {
+				wg.Add(1)
+				go func(i, j int, service string) {
+					defer wg.Done()
+					results[i][j] = f.get(service, "/examination/"+id)
+				}(i, j, service)
+			}
+		}
+		wg.Wait()
+
+		for i, exam := range exams {
+			for j, name := range recordSections {
+				if result := results[i][j]; result.err != nil {
+					delete(exam, name)
+					errs[fmt.Sprintf("examinations.%s.%s", exam["id"], name)] = *result.err
+				} else {
+					exam[name] = result.body
+				}
+			}
+		}
+	}
+
+	merged, err := json.Marshal(exams)
+	if err != nil {
+		errs["examinations"] = SectionError{Status: http.StatusInternalServerError, Error: err.Error()}
+		return nil
+	}
+	return merged
+}
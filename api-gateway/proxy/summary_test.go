@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeServices answers summary requests from canned replies keyed by service and path. Paths
+// without a reply answer an empty list; services in down fail to answer at all.
+type fakeServices struct {
+	replies map[string]KafkaResponse
+	down    map[string]bool
+	delay   time.Duration
+
+	mu             sync.Mutex
+	asked          []string
+	inFlight, peak int
+}
+
+func (f *fakeServices) send(service string, req KafkaRequest) (KafkaResponse, error) {
+	key := service + req.Path
+	f.mu.Lock()
+	f.asked = append(f.asked, key)
+	f.inFlight++
+	if f.inFlight > f.peak {
+		f.peak = f.inFlight
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(f.delay)
+	if f.down[key] {
+		return KafkaResponse{}, errors.New("timed out")
+	}
+	if resp, ok := f.replies[key]; ok {
+		return resp, nil
+	}
+	return KafkaResponse{StatusCode: http.StatusOK, Body: []byte(`[]`)}, nil
+}
+
+// reply is a canned reply with the given status and body.
+func reply(status int, body string) KafkaResponse {
+	return KafkaResponse{StatusCode: status, Body: []byte(body)}
+}
+
+// getSummary serves GET /api/patients/1/summary with the query and returns the recorder.
+func getSummary(services *fakeServices, query string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/patients/1/summary"+query, nil)
+	summarize(c, "1", services.send)
+	return w
+}
+
+// twoExaminations is a patient with examinations 4 and 5, each repeating the patient.
+func twoExaminations() *fakeServices {
+	return &fakeServices{replies: map[string]KafkaResponse{
+		"patients/1":             reply(http.StatusOK, `{"id":1}`),
+		"examinations/patient/1": reply(http.StatusOK, `[{"id":4,"patient":{"id":1}},{"id":5,"patient":{"id":1}}]`),
+		"samples/examination/4":  reply(http.StatusOK, `[{"id":40}]`),
+	}}
+}
+
+func TestSummaryComposesRecordsAndReportsFailedSections(t *testing.T) {
+	services := twoExaminations()
+	services.replies["prescriptions/examination/5"] = reply(http.StatusServiceUnavailable, `{"error":"database down"}`)
+	services.down = map[string]bool{"referrals/examination/4": true}
+
+	w := getSummary(services, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var summary struct {
+		Depth        int
+		Examinations []map[string]json.RawMessage
+		Errors       map[string]SectionError
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if summary.Depth != DepthRecords || len(summary.Examinations) != 2 {
+		t.Fatalf("summary = %s, want both examinations at DepthRecords", w.Body)
+	}
+
+	four, five := summary.Examinations[0], summary.Examinations[1]
+	if _, ok := four["patient"]; ok {
+		t.Error("examinations still repeat the patient")
+	}
+	if string(four["samples"]) != `[{"id":40}]` || string(five["referrals"]) != `[]` {
+		t.Errorf("records = %s and %s, want each examination's own", four["samples"], five["referrals"])
+	}
+	if _, ok := four["referrals"]; ok {
+		t.Error("a failed section was included")
+	}
+
+	want := map[string]SectionError{
+		"examinations.4.referrals":     {Status: http.StatusBadGateway, Error: "Service communication error: timed out"},
+		"examinations.5.prescriptions": {Status: http.StatusServiceUnavailable, Error: "database down"},
+	}
+	if len(summary.Errors) != len(want) {
+		t.Errorf("errors = %+v, want %+v", summary.Errors, want)
+	}
+	for key, err := range want {
+		if summary.Errors[key] != err {
+			t.Errorf("errors[%s] = %+v, want %+v", key, summary.Errors[key], err)
+		}
+	}
+}
+
+func TestSummaryDepth(t *testing.T) {
+	tests := []struct {
+		query  string
+		status int
+		asked  []string
+	}{
+		{query: "?depth=0", status: http.StatusOK, asked: []string{"patients/1"}},
+		{query: "?depth=1", status: http.StatusOK, asked: []string{"examinations/patient/1", "patients/1"}},
+		{query: "?depth=3", status: http.StatusBadRequest},
+		{query: "?depth=all", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			services := twoExaminations()
+			w := getSummary(services, tt.query)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			sort.Strings(services.asked)
+			if strings.Join(services.asked, " ") != strings.Join(tt.asked, " ") {
+				t.Errorf("asked %v, want %v", services.asked, tt.asked)
+			}
+		})
+	}
+}
+
+func TestSummaryPatientFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		patient KafkaResponse
+		down    bool
+		status  int
+	}{
+		{name: "not found is passed through", patient: reply(http.StatusNotFound, `{"error":"Patient not found"}`), status: http.StatusNotFound},
+		{name: "refused consent is passed through", patient: reply(http.StatusForbidden, `{"error":"no consent"}`), status: http.StatusForbidden},
+		{name: "server error is reported", patient: reply(http.StatusInternalServerError, `{"error":"boom"}`), status: http.StatusOK},
+		{name: "no answer is reported", down: true, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := twoExaminations()
+			services.replies["patients/1"] = tt.patient
+			services.down = map[string]bool{"patients/1": tt.down}
+
+			w := getSummary(services, "?depth=1")
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK && !strings.Contains(w.Body.String(), `"errors":{"patient":`) {
+				t.Errorf("body = %s, want the patient's failure reported", w.Body)
+			}
+		})
+	}
+}
+
+func TestSummaryBoundsRequestsInFlight(t *testing.T) {
+	var exams []string
+	for id := 1; id <= 10; id++ {
+		exams = append(exams, `{"id":`+strconv.Itoa(id)+`}`)
+	}
+	services := &fakeServices{delay: 5 * time.Millisecond, replies: map[string]KafkaResponse{
+		"patients/1":             reply(http.StatusOK, `{"id":1}`),
+		"examinations/patient/1": reply(http.StatusOK, "["+strings.Join(exams, ",")+"]"),
+	}}
+
+	if w := getSummary(services, ""); w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if len(services.asked) != 2+10*len(recordSections) {
+		t.Errorf("asked %d times, want %d", len(services.asked), 2+10*len(recordSections))
+	}
+	if services.peak > summaryParallelism || services.peak < 2 {
+		t.Errorf("%d requests in flight at most, want 2 to %d", services.peak, summaryParallelism)
+	}
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fitnis/appointment-service/services"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
+	"github.com/gin-gonic/gin"
+)
+
+// AppointmentHandler holds the appointment and slot services.
+type AppointmentHandler struct {
+	Service *services.AppointmentService
+	Slots   *services.SlotService
+}
+
+// NewAppointmentHandler creates a new AppointmentHandler.
+func NewAppointmentHandler(s *services.AppointmentService, slots *services.SlotService) *AppointmentHandler {
+	return &AppointmentHandler{Service: s, Slots: slots}
+}
+
+// AppointmentRequest books either a slot by ID, or the practitioner's slot at date and time
+// (the date/time/doctor form from openapi.yaml).
+type AppointmentRequest struct {
+	PatientID      uint   `json:"patientId" binding:"required"`
+	SlotID         uint   `json:"slotId"`
+	PractitionerID uint   `json:"practitionerId"`
+	Date           string `json:"date"` // "2006-01-02"
+	Time           string `json:"time"` // "15:04"
+	Reason         string `json:"reason"`
+}
+
+// RescheduleRequest picks the new slot the same way as AppointmentRequest;
+// practitionerId defaults to the appointment's practitioner
+type RescheduleRequest struct {
+	SlotID         uint   `json:"slotId"`
+	PractitionerID uint   `json:"practitionerId"`
+	Date           string `json:"date"`
+	Time           string `json:"time"`
+}
+
+type CompleteAppointmentRequest struct {
+	ExaminationID uint `json:"examinationId" binding:"required"`
+}
+
+// ReassignRequest moves appointments between patients
+type ReassignRequest struct {
+	FromPatientID  uint   `json:"fromPatientId" binding:"required"`
+	ToPatientID    uint   `json:"toPatientId" binding:"required"`
+	AppointmentIDs []uint `json:"appointmentIds"` // optional; all of the patient's appointments when empty
+}
+
+// GetAppointments handles GET /api/appointments/schedule?patientId=&practitionerId=&status=&from=&to=&sort=&limit=&offset=&cursor=
+func (h *AppointmentHandler) GetAppointments(c *gin.Context) {
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetAppointments(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointments: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetAppointment handles GET /api/appointments/schedule/:id
+func (h *AppointmentHandler) GetAppointment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	appointment, err := h.Service.GetAppointmentByID(uint(id))
+	if err != nil {
+		if err.Error() == "appointment not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointment: " + err.Error()})
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(appointment.Version))
+	c.JSON(http.StatusOK, appointment)
+}
+
+// ScheduleAppointment handles POST /api/appointments/schedule
+func (h *AppointmentHandler) ScheduleAppointment(c *gin.Context) {
+	var req AppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	slotID, err := h.resolveSlot(req.SlotID, req.PractitionerID, req.Date, req.Time)
+	if err != nil {
+		h.writeError(c, "Failed to schedule appointment", err)
+		return
+	}
+
+	appointment, err := h.Service.BookAppointment(req.PatientID, slotID, req.Reason)
+	if err != nil {
+		h.writeError(c, "Failed to schedule appointment", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(appointment.Version))
+	c.JSON(http.StatusCreated, appointment)
+}
+
+// CancelAppointment handles DELETE /api/appointments/schedule/:id?reason=
+// The If-Match header must hold the appointment's current ETag.
+func (h *AppointmentHandler) CancelAppointment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.Service.CancelAppointment(uint(id), version, c.Query("reason")); err != nil {
+		h.writeError(c, "Failed to cancel appointment", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RescheduleAppointment handles POST /api/appointments/schedule/:id/reschedule
+func (h *AppointmentHandler) RescheduleAppointment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req RescheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.SlotID == 0 && req.PractitionerID == 0 {
+		current, err := h.Service.GetAppointmentByID(uint(id))
+		if err != nil {
+			h.writeError(c, "Failed to reschedule appointment", err)
+			return
+		}
+		req.PractitionerID = current.PractitionerID
+	}
+	slotID, err := h.resolveSlot(req.SlotID, req.PractitionerID, req.Date, req.Time)
+	if err != nil {
+		h.writeError(c, "Failed to reschedule appointment", err)
+		return
+	}
+
+	appointment, err := h.Service.RescheduleAppointment(uint(id), slotID)
+	if err != nil {
+		h.writeError(c, "Failed to reschedule appointment", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(appointment.Version))
+	c.JSON(http.StatusCreated, appointment)
+}
+
+// CompleteAppointment handles POST /api/appointments/schedule/:id/complete
+func (h *AppointmentHandler) CompleteAppointment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req CompleteAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	appointment, err := h.Service.CompleteAppointment(uint(id), req.ExaminationID)
+	if err != nil {
+		h.writeError(c, "Failed to complete appointment", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(appointment.Version))
+	c.JSON(http.StatusOK, appointment)
+}
+
+// ReassignAppointments handles POST /api/appointments/reassign
+// It is used by the patient service when merging duplicate records and undoing merges.
+func (h *AppointmentHandler) ReassignAppointments(c *gin.Context) {
+	var req ReassignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	moved, err := h.Service.ReassignAppointments(req.FromPatientID, req.ToPatientID, req.AppointmentIDs)
+	if err != nil {
+		if err.Error() == "cannot reassign appointments to the same patient" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign appointments: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"appointmentIds": moved})
+}
+
+// resolveSlot returns slotID, or looks up the practitioner's slot at date and time.
+func (h *AppointmentHandler) resolveSlot(slotID, practitionerID uint, date, clock string) (uint, error) {
+	if slotID != 0 {
+		return slotID, nil
+	}
+	if practitionerID == 0 || date == "" || clock == "" {
+		return 0, errMissingSlot
+	}
+	start, err := time.ParseInLocation("2006-01-02 15:04", date+" "+clock, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("%w: date must be YYYY-MM-DD and time HH:MM", errInvalidInput)
+	}
+	slot, err := h.Slots.FindSlot(practitionerID, start)
+	if err != nil {
+		return 0, err
+	}
+	return slot.ID, nil
+}
+
+// writeError maps service errors to status codes.
+func (h *AppointmentHandler) writeError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, errMissingSlot), errors.Is(err, errInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err.Error() == "appointment not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSlotUnavailable), errors.Is(err, services.ErrPatientDoubleBooked), errors.Is(err, services.ErrNotScheduled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, etag.ErrMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case err.Error() == "slot not found", err.Error() == "examination belongs to a different patient",
+		errors.Is(err, references.ErrNotFound), errors.Is(err, references.ErrInactive):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, references.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": action + ": " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
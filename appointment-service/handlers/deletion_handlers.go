@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckDeletion handles POST /api/appointments/deletion/check
+// The patient service calls it before deleting patients.
+func (h *AppointmentHandler) CheckDeletion(c *gin.Context) {
+	h.handleDeletion(c, "check appointments", h.Service.CountDependents)
+}
+
+// DeleteDependents handles POST /api/appointments/deletion/delete
+// The patient service calls it when deleting patients.
+func (h *AppointmentHandler) DeleteDependents(c *gin.Context) {
+	h.handleDeletion(c, "delete appointments", h.Service.DeleteDependents)
+}
+
+// RestoreDependents handles POST /api/appointments/deletion/restore
+// The patient service calls it when restoring patients.
+func (h *AppointmentHandler) RestoreDependents(c *gin.Context) {
+	h.handleDeletion(c, "restore appointments", h.Service.RestoreDependents)
+}
+
+// handleDeletion runs a deletion request from another service and replies
+// with the number of appointments it concerned.
+func (h *AppointmentHandler) handleDeletion(c *gin.Context, action string, run func(deletion.Request) (int, error)) {
+	var req deletion.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	count, err := run(req)
+	if err != nil {
+		if errors.Is(err, deletion.ErrUnknownParent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + ": " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, deletion.Result{Count: count})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fitnis/appointment-service/services"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errMissingSlot  = errors.New("either slotId, or practitionerId with date and time, is required")
+	errInvalidInput = errors.New("invalid input")
+)
+
+// SlotHandler holds the slot service.
+type SlotHandler struct {
+	Service *services.SlotService
+}
+
+// NewSlotHandler creates a new SlotHandler.
+func NewSlotHandler(s *services.SlotService) *SlotHandler {
+	return &SlotHandler{Service: s}
+}
+
+type SlotRequest struct {
+	PractitionerID uint      `json:"practitionerId" binding:"required"`
+	StartTime      time.Time `json:"startTime" binding:"required"`
+	EndTime        time.Time `json:"endTime" binding:"required"`
+}
+
+// GenerateSlotsRequest fills a period from the practitioner's weekly availability
+type GenerateSlotsRequest struct {
+	PractitionerID  uint   `json:"practitionerId" binding:"required"`
+	From            string `json:"from" binding:"required"` // date or RFC 3339 time
+	To              string `json:"to" binding:"required"`
+	DurationMinutes int    `json:"durationMinutes"` // defaults to 30
+}
+
+// GetSlots handles GET /api/appointments/slots?practitionerId=&from=&to=&available=&sort=&limit=&offset=&cursor=
+func (h *SlotHandler) GetSlots(c *gin.Context) {
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetSlots(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve slots: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetCalendar handles GET /api/appointments/calendars/:practitionerId?from=&to=
+// The period defaults to the next seven days.
+func (h *SlotHandler) GetCalendar(c *gin.Context) {
+	practitionerID, err := strconv.ParseUint(c.Param("practitionerId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid practitioner ID format"})
+		return
+	}
+	from, err := queryTime(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := queryTime(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from == nil {
+		today := time.Now().Truncate(24 * time.Hour)
+		from = &today
+	}
+	if to == nil {
+		week := from.AddDate(0, 0, 7)
+		to = &week
+	}
+
+	calendar, err := h.Service.GetCalendar(uint(practitionerID), *from, *to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendar: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, calendar)
+}
+
+// CreateSlot handles POST /api/appointments/slots
+func (h *SlotHandler) CreateSlot(c *gin.Context) {
+	var req SlotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	slot, err := h.Service.CreateSlot(req.PractitionerID, req.StartTime, req.EndTime)
+	if err != nil {
+		writeSlotError(c, "Failed to create slot", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(slot.Version))
+	c.JSON(http.StatusCreated, slot)
+}
+
+// GenerateSlots handles POST /api/appointments/slots/generate
+func (h *SlotHandler) GenerateSlots(c *gin.Context) {
+	var req GenerateSlotsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	from, err := parseTime(req.From)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTime(req.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+		return
+	}
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = 30
+	}
+
+	slots, err := h.Service.GenerateSlots(req.PractitionerID, from, to, time.Duration(req.DurationMinutes)*time.Minute)
+	if err != nil {
+		writeSlotError(c, "Failed to generate slots", err)
+		return
+	}
+	c.JSON(http.StatusCreated, slots)
+}
+
+// DeleteSlot handles DELETE /api/appointments/slots/:id
+// The If-Match header must hold the slot's current ETag.
+func (h *SlotHandler) DeleteSlot(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	err = h.Service.DeleteSlot(uint(id), version)
+	if err != nil {
+		if err.Error() == "slot not found or already deleted" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Slot not found"})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		} else if errors.Is(err, services.ErrSlotBooked) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete slot: " + err.Error()})
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeSlotError maps slot service errors to status codes.
+func writeSlotError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, practitioners.ErrNotFound), errors.Is(err, practitioners.ErrInactive):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid practitioner: " + err.Error()})
+	case errors.Is(err, practitioners.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify practitioner: " + err.Error()})
+	case errors.Is(err, services.ErrSlotOverlap):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err.Error() == "slot end must be after its start", err.Error() == "slot length must be positive",
+		err.Error() == "'to' must be after 'from'":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
+
+// queryTime parses an optional date or RFC 3339 query parameter.
+func queryTime(c *gin.Context, key string) (*time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := parseTime(v)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %v", key, err)
+	}
+	return &t, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, time.Local)
+}
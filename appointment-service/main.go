@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/fitnis/appointment-service/handlers"
+	"github.com/fitnis/appointment-service/services"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/privacy"
+	"github.com/fitnis/shared/references"
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	// Initialize Database
+	database.InitDB()
+	db := database.DB
+
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "appointments")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
+	// Initialize services and handlers
+	slotService := services.NewSlotService(db)
+	slotService.Practitioners = practitioners.NewKafkaDirectory()
+	appointmentService := services.NewAppointmentService(db)
+	appointmentService.References = references.NewKafkaCheckerFromEnv()
+	appointmentHandler := handlers.NewAppointmentHandler(appointmentService, slotService)
+	slotHandler := handlers.NewSlotHandler(slotService)
+
+	// Purge appointments soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, appointmentService.PurgeDeleted)
+
+	// Start Kafka consumer
+	log.Println("Starting Kafka consumer")
+	kafka.StartKafkaConsumer("appointments", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
+		return handleKafkaRequest(req, appointmentHandler, slotHandler)
+	}))
+
+	// Block main goroutine
+	select {}
+}
+
+// handleKafkaRequest processes Kafka requests and returns responses.
+// Paths are /schedule[/:id[/reschedule|/complete]], /slots[/generate|/:id], /calendars/:practitionerId
+// and /reassign, which the patient service calls when merging patients, and /deletion/..., which it
+// calls when deleting and restoring patients.
+func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.AppointmentHandler, slotHandler *handlers.SlotHandler) kafka.KafkaResponse {
+	// Create a mock gin context to reuse our handler functions
+	c, w := createMockGinContext(req)
+
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
+	resource, idStr, action := splitPath(path)
+
+	// Patient data export and erasure have no appointment ID in the path
+	if path == privacy.ExportPath || path == privacy.ErasePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		if path == privacy.ExportPath {
+			handler.ExportPatientData(c)
+		} else {
+			handler.ErasePatientData(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Deletion requests from the patient service have no appointment ID in the path
+	if path == deletion.CheckPath || path == deletion.DeletePath || path == deletion.RestorePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		switch path {
+		case deletion.CheckPath:
+			handler.CheckDeletion(c)
+		case deletion.DeletePath:
+			handler.DeleteDependents(c)
+		default:
+			handler.RestoreDependents(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Extract ID from path if present
+	var id uint64
+	var err error
+	if idStr != "" && idStr != "generate" {
+		id, err = strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			return createErrorResponse(req.RequestID, http.StatusBadRequest, "Invalid ID format")
+		}
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+	}
+
+	// Route to appropriate handler
+	switch {
+	case resource == "schedule" && req.Method == "GET" && idStr == "":
+		handler.GetAppointments(c)
+	case resource == "schedule" && req.Method == "GET" && id > 0 && action == "":
+		handler.GetAppointment(c)
+	case resource == "schedule" && req.Method == "POST" && idStr == "":
+		handler.ScheduleAppointment(c)
+	case resource == "schedule" && req.Method == "DELETE" && id > 0 && action == "":
+		handler.CancelAppointment(c)
+	case resource == "schedule" && req.Method == "POST" && id > 0 && action == "reschedule":
+		handler.RescheduleAppointment(c)
+	case resource == "schedule" && req.Method == "POST" && id > 0 && action == "complete":
+		handler.CompleteAppointment(c)
+	case resource == "slots" && req.Method == "GET" && idStr == "":
+		slotHandler.GetSlots(c)
+	case resource == "slots" && req.Method == "POST" && idStr == "":
+		slotHandler.CreateSlot(c)
+	case resource == "slots" && req.Method == "POST" && idStr == "generate":
+		slotHandler.GenerateSlots(c)
+	case resource == "slots" && req.Method == "DELETE" && id > 0:
+		slotHandler.DeleteSlot(c)
+	case resource == "reassign" && req.Method == "POST" && idStr == "":
+		handler.ReassignAppointments(c)
+	case resource == "calendars" && req.Method == "GET" && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "practitionerId", Value: idStr})
+		slotHandler.GetCalendar(c)
+	default:
+		return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+	}
+
+	// Create response from the written data
+	return createResponse(req.RequestID, w)
+}
+
+// Helper functions
+
+func createMockGinContext(req kafka.KafkaRequest) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	httpReq, _ := http.NewRequest(req.Method, req.Path, bytes.NewReader(req.Body))
+
+	// Add headers
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+	return c, w
+}
+
+// splitPath splits /resource/id/action into its parts; missing parts are empty
+func splitPath(path string) (resource, id, action string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	resource = parts[0]
+	if len(parts) >= 2 {
+		id = parts[1]
+	}
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	return resource, id, action
+}
+
+func createResponse(requestID string, w *httptest.ResponseRecorder) kafka.KafkaResponse {
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
+func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
+	errorJSON, _ := json.Marshal(gin.H{"error": message})
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: errorJSON,
+	}
+}
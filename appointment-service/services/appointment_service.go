@@ -0,0 +1,266 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
+	"gorm.io/gorm"
+)
+
+// Appointment statuses.
+const (
+	StatusScheduled   = "scheduled"
+	StatusCancelled   = "cancelled"
+	StatusRescheduled = "rescheduled"
+	StatusCompleted   = "completed"
+)
+
+// ErrSlotUnavailable is returned when a slot is already booked, so the appointment would double-book it.
+var ErrSlotUnavailable = errors.New("slot is already booked")
+
+// ErrPatientDoubleBooked is returned when the patient already has an appointment overlapping the slot.
+var ErrPatientDoubleBooked = errors.New("patient already has an appointment at this time")
+
+// ErrNotScheduled is returned when cancelling, rescheduling or completing an appointment that is no longer scheduled.
+var ErrNotScheduled = errors.New("appointment is not scheduled")
+
+// AppointmentService handles database operations for appointments.
+type AppointmentService struct {
+	DB *gorm.DB
+
+	// References checks booked patients and completing examinations with the services owning them
+	References references.Checker
+}
+
+// NewAppointmentService creates a new AppointmentService.
+func NewAppointmentService(db *gorm.DB) *AppointmentService {
+	return &AppointmentService{DB: db}
+}
+
+// BookAppointment books a free slot for a patient, who must be one the patient service lets
+// new records reference; see references.Require. The slot is claimed with a conditional update
+// inside a transaction, so two concurrent bookings for the same slot cannot both succeed.
+func (s *AppointmentService) BookAppointment(patientID, slotID uint, reason string) (models.Appointment, error) {
+	if err := references.Require(s.References, references.Patients, patientID); err != nil {
+		return models.Appointment{}, fmt.Errorf("patient: %w", err)
+	}
+
+	var appointment models.Appointment
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		booked, err := book(tx, patientID, slotID, reason, 0)
+		appointment = booked
+		return err
+	})
+	return appointment, err
+}
+
+// appointmentQuery is the allow-list for listing appointments.
+var appointmentQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"patientId":      {Column: "patient_id", Kind: query.Int},
+		"practitionerId": {Column: "practitioner_id", Kind: query.Int},
+		"status":         {Column: "status"},
+		"from":           {Column: "start_time", Kind: query.Time, Op: query.Gte},
+		"to":             {Column: "start_time", Kind: query.Time, Op: query.Lte},
+	},
+	Sorts:       map[string]string{"startTime": "start_time"},
+	DefaultSort: "startTime",
+}
+
+// GetAppointments retrieves one page of appointments, earliest first by default.
+// Filters: patientId, practitionerId, status, and from and to (start time, inclusive).
+func (s *AppointmentService) GetAppointments(params query.Params) (query.Page[models.Appointment], error) {
+	return query.Find[models.Appointment](s.DB, appointmentQuery, params)
+}
+
+// GetAppointmentByID retrieves an appointment by its ID.
+func (s *AppointmentService) GetAppointmentByID(id uint) (models.Appointment, error) {
+	var appointment models.Appointment
+	result := s.DB.First(&appointment, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.Appointment{}, errors.New("appointment not found")
+		}
+		return models.Appointment{}, result.Error
+	}
+	return appointment, nil
+}
+
+// CancelAppointment cancels a scheduled appointment and frees its slot. It fails with
+// etag.ErrMismatch unless the appointment is still at the given version.
+func (s *AppointmentService) CancelAppointment(id, version uint, reason string) (models.Appointment, error) {
+	var appointment models.Appointment
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		appointment, err = scheduledAppointment(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := releaseSlot(tx, appointment); err != nil {
+			return err
+		}
+		appointment.Status = StatusCancelled
+		appointment.CancellationReason = reason
+		return etag.Expect(tx, version).Save(&appointment).Error
+	})
+	return appointment, err
+}
+
+// RescheduleAppointment moves a scheduled appointment to another slot.
+// The old appointment is kept as "rescheduled" and a new one is booked pointing back to it.
+func (s *AppointmentService) RescheduleAppointment(id, slotID uint) (models.Appointment, error) {
+	var rescheduled models.Appointment
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		original, err := scheduledAppointment(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := releaseSlot(tx, original); err != nil {
+			return err
+		}
+		original.Status = StatusRescheduled
+		if err := tx.Save(&original).Error; err != nil {
+			return err
+		}
+
+		rescheduled, err = book(tx, original.PatientID, slotID, original.Reason, original.ID)
+		return err
+	})
+	return rescheduled, err
+}
+
+// CompleteAppointment marks an appointment as completed and links it to the examination it produced.
+// The examination must belong to the appointment's patient. The slot stays booked.
+func (s *AppointmentService) CompleteAppointment(id, examinationID uint) (models.Appointment, error) {
+	examination, err := references.Lookup(s.References, references.Examinations, examinationID)
+	if err != nil {
+		return models.Appointment{}, fmt.Errorf("examination: %w", err)
+	}
+
+	var appointment models.Appointment
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		appointment, err = scheduledAppointment(tx, id)
+		if err != nil {
+			return err
+		}
+		// A reference let through unchecked by the fallback carries no patient to compare
+		if examination.Exists && examination.PatientID != appointment.PatientID {
+			return errors.New("examination belongs to a different patient")
+		}
+
+		now := time.Now()
+		appointment.Status = StatusCompleted
+		appointment.ExaminationID = &examinationID
+		appointment.CompletedAt = &now
+		return tx.Save(&appointment).Error
+	})
+	return appointment, err
+}
+
+// ReassignAppointments moves appointments from one patient to another, e.g. when duplicate
+// patient records are merged. With no IDs given, all of the patient's appointments move.
+// It returns the IDs that were moved.
+func (s *AppointmentService) ReassignAppointments(fromPatientID, toPatientID uint, appointmentIDs []uint) ([]uint, error) {
+	if fromPatientID == toPatientID {
+		return nil, errors.New("cannot reassign appointments to the same patient")
+	}
+	moved := []uint{}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		db := tx.Model(&models.Appointment{}).Where("patient_id = ?", fromPatientID)
+		if len(appointmentIDs) > 0 {
+			db = db.Where("id IN ?", appointmentIDs)
+		}
+		if err := db.Order("id").Pluck("id", &moved).Error; err != nil {
+			return err
+		}
+		if len(moved) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Appointment{}).Where("id IN ?", moved).Update("patient_id", toPatientID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// book claims a slot and creates the appointment within tx.
+func book(tx *gorm.DB, patientID, slotID uint, reason string, rescheduledFrom uint) (models.Appointment, error) {
+	var slot models.AppointmentSlot
+	if err := tx.First(&slot, slotID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Appointment{}, errors.New("slot not found")
+		}
+		return models.Appointment{}, err
+	}
+	if slot.AppointmentID != nil {
+		return models.Appointment{}, ErrSlotUnavailable
+	}
+
+	var overlapping int64
+	err := tx.Model(&models.Appointment{}).
+		Where("patient_id = ? AND status = ? AND start_time < ? AND end_time > ?", patientID, StatusScheduled, slot.EndTime, slot.StartTime).
+		Count(&overlapping).Error
+	if err != nil {
+		return models.Appointment{}, err
+	}
+	if overlapping > 0 {
+		return models.Appointment{}, ErrPatientDoubleBooked
+	}
+
+	appointment := models.Appointment{
+		PatientID:      patientID,
+		PractitionerID: slot.PractitionerID,
+		SlotID:         slot.ID,
+		StartTime:      slot.StartTime,
+		EndTime:        slot.EndTime,
+		Reason:         reason,
+		Status:         StatusScheduled,
+	}
+	if rescheduledFrom != 0 {
+		appointment.RescheduledFromID = &rescheduledFrom
+	}
+	if err := tx.Create(&appointment).Error; err != nil {
+		return models.Appointment{}, err
+	}
+
+	// Only one booking can claim the slot; a concurrent one sees no rows affected
+	result := tx.Model(&models.AppointmentSlot{}).
+		Where("id = ? AND appointment_id IS NULL", slot.ID).
+		Update("appointment_id", appointment.ID)
+	if result.Error != nil {
+		return models.Appointment{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Appointment{}, ErrSlotUnavailable
+	}
+	return appointment, nil
+}
+
+// scheduledAppointment loads an appointment that can still be changed.
+func scheduledAppointment(tx *gorm.DB, id uint) (models.Appointment, error) {
+	var appointment models.Appointment
+	if err := tx.First(&appointment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Appointment{}, errors.New("appointment not found")
+		}
+		return models.Appointment{}, err
+	}
+	if appointment.Status != StatusScheduled {
+		return models.Appointment{}, fmt.Errorf("%w: status is %s", ErrNotScheduled, appointment.Status)
+	}
+	return appointment, nil
+}
+
+// releaseSlot frees the slot held by an appointment.
+func releaseSlot(tx *gorm.DB, appointment models.Appointment) error {
+	return tx.Model(&models.AppointmentSlot{}).
+		Where("id = ? AND appointment_id = ?", appointment.SlotID, appointment.ID).
+		Update("appointment_id", nil).Error
+}
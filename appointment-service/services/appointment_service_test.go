@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/references"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// activeRecords answers every reference check with an active record.
+type activeRecords struct{}
+
+func (activeRecords) Check(service string, id uint) (references.Result, error) {
+	return references.Result{Exists: true, Active: true}, nil
+}
+
+var nine = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// newTestService opens an empty database with two 30-minute slots at 9:00, for practitioners
+// 1 and 2, and one at 9:30 for practitioner 1.
+func newTestService(t *testing.T) *AppointmentService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AppointmentSlot{}, &models.Appointment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, slot := range []models.AppointmentSlot{
+		{ID: 1, PractitionerID: 1, StartTime: nine, EndTime: nine.Add(30 * time.Minute)},
+		{ID: 2, PractitionerID: 2, StartTime: nine, EndTime: nine.Add(30 * time.Minute)},
+		{ID: 3, PractitionerID: 1, StartTime: nine.Add(30 * time.Minute), EndTime: nine.Add(time.Hour)},
+	} {
+		if err := db.Create(&slot).Error; err != nil {
+			t.Fatalf("create slot: %v", err)
+		}
+	}
+	s := NewAppointmentService(db)
+	s.References = activeRecords{}
+	return s
+}
+
+// slotHolder returns the appointment holding a slot, or 0 when it is free.
+func slotHolder(s *AppointmentService, slotID uint) uint {
+	var slot models.AppointmentSlot
+	s.DB.First(&slot, slotID)
+	if slot.AppointmentID == nil {
+		return 0
+	}
+	return *slot.AppointmentID
+}
+
+func TestBookClaimsSlot(t *testing.T) {
+	s := newTestService(t)
+
+	appointment, err := s.BookAppointment(10, 1, "check-up")
+	if err != nil {
+		t.Fatalf("BookAppointment: %v", err)
+	}
+	if appointment.PractitionerID != 1 || !appointment.StartTime.Equal(nine) || appointment.Status != StatusScheduled {
+		t.Errorf("got %+v, want a scheduled 9:00 appointment with practitioner 1", appointment)
+	}
+	if holder := slotHolder(s, 1); holder != appointment.ID {
+		t.Errorf("slot held by %d, want %d", holder, appointment.ID)
+	}
+
+	if _, err := s.BookAppointment(11, 1, ""); !errors.Is(err, ErrSlotUnavailable) {
+		t.Errorf("booking a booked slot: got %v, want ErrSlotUnavailable", err)
+	}
+	if _, err := s.BookAppointment(10, 2, ""); !errors.Is(err, ErrPatientDoubleBooked) {
+		t.Errorf("booking the patient twice at 9:00: got %v, want ErrPatientDoubleBooked", err)
+	}
+	if _, err := s.BookAppointment(10, 3, ""); err != nil {
+		t.Errorf("booking the patient at 9:30: %v", err)
+	}
+}
+
+func TestBookLosesConcurrentClaim(t *testing.T) {
+	s := newTestService(t)
+	// Another booking claims the slot after this one has read it as free
+	err := s.DB.Callback().Create().Before("gorm:create").Register("test:concurrent_claim", func(tx *gorm.DB) {
+		if tx.Statement.Table == "appointments" {
+			tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE appointment_slots SET appointment_id = 99 WHERE id = 1")
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if _, err := s.BookAppointment(10, 1, ""); !errors.Is(err, ErrSlotUnavailable) {
+		t.Fatalf("got %v, want ErrSlotUnavailable", err)
+	}
+	var count int64
+	s.DB.Model(&models.Appointment{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d appointments left by the failed booking, want 0", count)
+	}
+}
+
+func TestRescheduleMovesClaim(t *testing.T) {
+	s := newTestService(t)
+	original, err := s.BookAppointment(10, 1, "check-up")
+	if err != nil {
+		t.Fatalf("BookAppointment: %v", err)
+	}
+
+	rescheduled, err := s.RescheduleAppointment(original.ID, 3)
+	if err != nil {
+		t.Fatalf("RescheduleAppointment: %v", err)
+	}
+	if rescheduled.RescheduledFromID == nil || *rescheduled.RescheduledFromID != original.ID || rescheduled.Reason != "check-up" {
+		t.Errorf("got %+v, want a booking rescheduled from %d for the same reason", rescheduled, original.ID)
+	}
+	if slotHolder(s, 1) != 0 || slotHolder(s, 3) != rescheduled.ID {
+		t.Errorf("slots held by %d and %d, want free and %d", slotHolder(s, 1), slotHolder(s, 3), rescheduled.ID)
+	}
+	if _, err := s.RescheduleAppointment(original.ID, 2); !errors.Is(err, ErrNotScheduled) {
+		t.Errorf("rescheduling again: got %v, want ErrNotScheduled", err)
+	}
+}
+
+func TestBookWithoutReferenceChecker(t *testing.T) {
+	s := newTestService(t)
+	s.References = nil
+	if _, err := s.BookAppointment(10, 1, ""); !errors.Is(err, references.ErrUnavailable) {
+		t.Errorf("got %v, want references.ErrUnavailable", err)
+	}
+	if slotHolder(s, 1) != 0 {
+		t.Error("slot claimed without a patient check")
+	}
+}
+
+func TestDeletingPatientFreesSlotsAndRestoreReclaimsThem(t *testing.T) {
+	s := newTestService(t)
+	kept, _ := s.BookAppointment(10, 1, "check-up")
+	lost, _ := s.BookAppointment(10, 3, "follow-up")
+
+	at := deletion.Stamp()
+	req := deletion.Request{Parent: deletion.Patients, ParentIDs: []uint{10}, DeletedAt: at}
+	if n, err := s.DeleteDependents(req); err != nil || n != 2 {
+		t.Fatalf("DeleteDependents = %d, %v; want 2", n, err)
+	}
+	if slotHolder(s, 1) != 0 || slotHolder(s, 3) != 0 {
+		t.Fatal("the deleted appointments still hold their slots")
+	}
+	other, err := s.BookAppointment(11, 3, "walk-in")
+	if err != nil {
+		t.Fatalf("BookAppointment on a freed slot: %v", err)
+	}
+
+	if n, err := s.RestoreDependents(req); err != nil || n != 2 {
+		t.Fatalf("RestoreDependents = %d, %v; want 2", n, err)
+	}
+	if holder := slotHolder(s, 1); holder != kept.ID {
+		t.Errorf("slot 1 held by %d, want the restored appointment %d", holder, kept.ID)
+	}
+	if holder := slotHolder(s, 3); holder != other.ID {
+		t.Errorf("slot 3 held by %d, want the appointment booked meanwhile %d", holder, other.ID)
+	}
+	restored, _ := s.GetAppointmentByID(lost.ID)
+	if restored.Status != StatusCancelled || restored.CancellationReason != cancelledOnRestore {
+		t.Errorf("appointment whose slot was taken = %+v, want it cancelled", restored)
+	}
+}
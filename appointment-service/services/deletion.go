@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+)
+
+// cancelledOnRestore is the cancellation reason of a scheduled appointment restored after its slot was booked again.
+const cancelledOnRestore = "slot was booked by another patient while the appointment was deleted"
+
+// CountDependents counts the live appointments of the parent records, for a check before deleting them.
+func (s *AppointmentService) CountDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.CountLive(s.DB, &models.Appointment{}, "patient_id", req.ParentIDs)
+}
+
+// DeleteDependents soft-deletes the appointments of patients deleted at req.DeletedAt. The slots
+// of their scheduled appointments are freed for other patients.
+func (s *AppointmentService) DeleteDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil || len(req.ParentIDs) == 0 {
+		return 0, err
+	}
+	var deleted int
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var scheduled []uint
+		err := tx.Model(&models.Appointment{}).Where("patient_id IN ? AND status = ?", req.ParentIDs, StatusScheduled).
+			Pluck("id", &scheduled).Error
+		if err != nil {
+			return err
+		}
+		deleted, err = deletion.SoftDelete(tx, &models.Appointment{}, "patient_id", req.ParentIDs, req.DeletedAt)
+		if err != nil || len(scheduled) == 0 {
+			return err
+		}
+		return tx.Model(&models.AppointmentSlot{}).Where("appointment_id IN ?", scheduled).Update("appointment_id", nil).Error
+	})
+	return deleted, err
+}
+
+// RestoreDependents brings back the appointments deleted along with patients at req.DeletedAt.
+// Scheduled appointments claim their slots again; one whose slot was booked meanwhile comes back cancelled.
+func (s *AppointmentService) RestoreDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil || len(req.ParentIDs) == 0 {
+		return 0, err
+	}
+	var restored int
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var scheduled []models.Appointment
+		err := tx.Unscoped().Where("patient_id IN ? AND deleted_at = ? AND status = ?", req.ParentIDs, req.DeletedAt, StatusScheduled).
+			Find(&scheduled).Error
+		if err != nil {
+			return err
+		}
+		restored, err = deletion.Restore(tx, &models.Appointment{}, "patient_id", req.ParentIDs, req.DeletedAt)
+		if err != nil {
+			return err
+		}
+		for _, appointment := range scheduled {
+			result := tx.Model(&models.AppointmentSlot{}).Where("id = ? AND appointment_id IS NULL", appointment.SlotID).
+				Update("appointment_id", appointment.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				continue
+			}
+			err := tx.Model(&appointment).Updates(map[string]interface{}{"status": StatusCancelled, "cancellation_reason": cancelledOnRestore}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return restored, err
+}
+
+// PurgeDeleted permanently deletes the appointments soft-deleted before the cutoff, freeing the
+// slots they still hold. The appointments of patients under a retention hold on appointments are
+// kept until the hold is released or expires.
+func (s *AppointmentService) PurgeDeleted(cutoff time.Time) (int, error) {
+	var purged int
+	err := audit.System(s.DB, deletion.PurgeJob).Transaction(func(tx *gorm.DB) error {
+		held := deletion.HeldPatients(tx, deletion.Appointments)
+		expired := tx.Unscoped().Model(&models.Appointment{}).Select("id").
+			Where("deleted_at < ? AND patient_id NOT IN (?)", cutoff, held)
+		if err := tx.Model(&models.AppointmentSlot{}).Where("appointment_id IN (?)", expired).Update("appointment_id", nil).Error; err != nil {
+			return err
+		}
+		var err error
+		purged, err = deletion.Purge(tx, cutoff, &models.Appointment{}, "patient_id", held)
+		return err
+	})
+	return purged, err
+}
+
+// checkParent accepts requests about patients, the only records appointments are deleted with.
+func checkParent(req deletion.Request) error {
+	if req.Parent != deletion.Patients {
+		return fmt.Errorf("%w: %q", deletion.ErrUnknownParent, req.Parent)
+	}
+	return nil
+}
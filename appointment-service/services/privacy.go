@@ -0,0 +1,34 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"gorm.io/gorm"
+)
+
+// ExportPatientData retrieves all of a patient's appointments, deleted or not, for a patient data export.
+func (s *AppointmentService) ExportPatientData(req privacy.Request) ([]models.Appointment, error) {
+	if req.PatientID == 0 {
+		return nil, errors.New("patientId is required")
+	}
+	appointments := []models.Appointment{}
+	result := s.DB.Unscoped().Where("patient_id = ?", req.PatientID).Order("id").Find(&appointments)
+	return appointments, result.Error
+}
+
+// ErasePatientData anonymises a patient's appointments by removing their reasons and cancellation
+// reasons. Times, practitioners and slots are kept so schedules stay intact.
+func (s *AppointmentService) ErasePatientData(req privacy.Request) (int, error) {
+	if req.PatientID == 0 {
+		return 0, errors.New("patientId is required")
+	}
+	result := audit.Redacted(s.DB).Unscoped().Model(&models.Appointment{}).Where("patient_id = ?", req.PatientID).
+		Updates(map[string]interface{}{
+			"reason":              privacy.ErasedText,
+			"cancellation_reason": gorm.Expr("CASE WHEN cancellation_reason = '' THEN '' ELSE ? END", privacy.ErasedText),
+		})
+	return int(result.RowsAffected), result.Error
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"gorm.io/gorm"
+)
+
+// ErrSlotOverlap is returned when a new slot overlaps an existing slot in the practitioner's calendar.
+var ErrSlotOverlap = errors.New("slot overlaps an existing slot")
+
+// ErrSlotBooked is returned when deleting a slot that holds an appointment.
+var ErrSlotBooked = errors.New("slot has a booked appointment")
+
+// Calendar is a practitioner's slots over a period, with any booked appointments
+type Calendar struct {
+	PractitionerID uint                     `json:"practitionerId"`
+	From           time.Time                `json:"from"`
+	To             time.Time                `json:"to"`
+	Slots          []models.AppointmentSlot `json:"slots"`
+}
+
+// SlotService handles database operations for appointment slots.
+type SlotService struct {
+	DB *gorm.DB
+
+	// Practitioners validates practitioners and supplies their weekly availability
+	Practitioners practitioners.Directory
+}
+
+// NewSlotService creates a new SlotService.
+func NewSlotService(db *gorm.DB) *SlotService {
+	return &SlotService{DB: db}
+}
+
+// CreateSlot adds a single slot to a practitioner's calendar.
+func (s *SlotService) CreateSlot(practitionerID uint, start, end time.Time) (models.AppointmentSlot, error) {
+	if !end.After(start) {
+		return models.AppointmentSlot{}, errors.New("slot end must be after its start")
+	}
+	if _, err := practitioners.Resolve(s.Practitioners, &practitionerID); err != nil {
+		return models.AppointmentSlot{}, err
+	}
+
+	// Times are stored in UTC so they compare correctly in the database
+	start, end = start.UTC(), end.UTC()
+	slot := models.AppointmentSlot{PractitionerID: practitionerID, StartTime: start, EndTime: end}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if overlaps, err := slotOverlaps(tx, practitionerID, start, end); err != nil {
+			return err
+		} else if overlaps {
+			return ErrSlotOverlap
+		}
+		return tx.Create(&slot).Error
+	})
+	return slot, err
+}
+
+// GenerateSlots fills the practitioner's calendar between from and to with slots of the given length,
+// following their weekly availability. Times that already have a slot are skipped.
+func (s *SlotService) GenerateSlots(practitionerID uint, from, to time.Time, length time.Duration) ([]models.AppointmentSlot, error) {
+	if length <= 0 {
+		return nil, errors.New("slot length must be positive")
+	}
+	if !to.After(from) {
+		return nil, errors.New("'to' must be after 'from'")
+	}
+	practitioner, err := practitioners.Resolve(s.Practitioners, &practitionerID)
+	if err != nil {
+		return nil, err
+	}
+
+	created := []models.AppointmentSlot{}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for day := truncateToDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+			for _, window := range practitioner.Availability {
+				if time.Weekday(window.Weekday) != day.Weekday() {
+					continue
+				}
+				windowStart, err := atTimeOfDay(day, window.StartTime)
+				if err != nil {
+					return err
+				}
+				windowEnd, err := atTimeOfDay(day, window.EndTime)
+				if err != nil {
+					return err
+				}
+
+				for start := windowStart; !start.Add(length).After(windowEnd); start = start.Add(length) {
+					end := start.Add(length)
+					if start.Before(from) || end.After(to) {
+						continue
+					}
+					start, end := start.UTC(), end.UTC()
+					overlaps, err := slotOverlaps(tx, practitionerID, start, end)
+					if err != nil {
+						return err
+					}
+					if overlaps {
+						continue
+					}
+					slot := models.AppointmentSlot{PractitionerID: practitionerID, StartTime: start, EndTime: end}
+					if err := tx.Create(&slot).Error; err != nil {
+						return err
+					}
+					created = append(created, slot)
+				}
+			}
+		}
+		return nil
+	})
+	return created, err
+}
+
+// slotQuery is the allow-list for listing slots.
+var slotQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"practitionerId": {Column: "practitioner_id", Kind: query.Int},
+		"from":           {Column: "start_time", Kind: query.Time, Op: query.Gte},
+		"to":             {Column: "start_time", Kind: query.Time, Op: query.Lte},
+		"available":      {Apply: filterAvailable},
+	},
+	Sorts:       map[string]string{"startTime": "start_time"},
+	DefaultSort: "startTime",
+}
+
+// GetSlots retrieves one page of slots, earliest first by default.
+// Filters: practitionerId, from and to (start time, inclusive) and available (not booked).
+func (s *SlotService) GetSlots(params query.Params) (query.Page[models.AppointmentSlot], error) {
+	return query.Find[models.AppointmentSlot](s.DB.Preload("Appointment"), slotQuery, params)
+}
+
+// GetCalendar retrieves a practitioner's calendar between from and to.
+func (s *SlotService) GetCalendar(practitionerID uint, from, to time.Time) (Calendar, error) {
+	slots := []models.AppointmentSlot{}
+	result := s.DB.Preload("Appointment").
+		Where("practitioner_id = ? AND start_time >= ? AND start_time < ?", practitionerID, from.UTC(), to.UTC()).
+		Order("start_time").Find(&slots)
+	if result.Error != nil {
+		return Calendar{}, result.Error
+	}
+	return Calendar{PractitionerID: practitionerID, From: from, To: to, Slots: slots}, nil
+}
+
+// filterAvailable matches free or booked slots.
+func filterAvailable(db *gorm.DB, value string) (*gorm.DB, error) {
+	available, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("must be true or false")
+	}
+	if available {
+		return db.Where("appointment_id IS NULL"), nil
+	}
+	return db.Where("appointment_id IS NOT NULL"), nil
+}
+
+// FindSlot looks up the practitioner's slot starting at the given time.
+func (s *SlotService) FindSlot(practitionerID uint, start time.Time) (models.AppointmentSlot, error) {
+	var slot models.AppointmentSlot
+	result := s.DB.Where("practitioner_id = ? AND start_time = ?", practitionerID, start.UTC()).First(&slot)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.AppointmentSlot{}, errors.New("slot not found")
+		}
+		return models.AppointmentSlot{}, result.Error
+	}
+	return slot, nil
+}
+
+// DeleteSlot removes a slot that has no booked appointment. It fails with etag.ErrMismatch
+// unless the slot is still at the given version.
+func (s *SlotService) DeleteSlot(id, version uint) error {
+	result := etag.Expect(s.DB, version).Where("appointment_id IS NULL").Delete(&models.AppointmentSlot{}, id)
+	if !errors.Is(result.Error, etag.ErrMismatch) {
+		return result.Error
+	}
+	var slot models.AppointmentSlot
+	if err := s.DB.Limit(1).Find(&slot, id).Error; err != nil {
+		return err
+	}
+	switch {
+	case slot.ID == 0:
+		return errors.New("slot not found or already deleted")
+	case slot.AppointmentID != nil:
+		return ErrSlotBooked
+	}
+	return etag.ErrMismatch
+}
+
+// slotOverlaps reports whether the practitioner already has a slot overlapping [start, end).
+func slotOverlaps(tx *gorm.DB, practitionerID uint, start, end time.Time) (bool, error) {
+	var count int64
+	err := tx.Model(&models.AppointmentSlot{}).
+		Where("practitioner_id = ? AND start_time < ? AND end_time > ?", practitionerID, end, start).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// atTimeOfDay combines a day with an "HH:MM" time.
+func atTimeOfDay(day time.Time, hhmm string) (time.Time, error) {
+	clock, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid availability time %q", hhmm)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location()), nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckDeletion handles POST /api/examinations/deletion/check
+// The patient service calls it before deleting patients.
+func (h *ExaminationHandler) CheckDeletion(c *gin.Context) {
+	h.handleDeletion(c, "check examinations", h.Service.CountDependents)
+}
+
+// DeleteDependents handles POST /api/examinations/deletion/delete
+// The patient service calls it when deleting patients.
+func (h *ExaminationHandler) DeleteDependents(c *gin.Context) {
+	h.handleDeletion(c, "delete examinations", h.Service.DeleteDependents)
+}
+
+// RestoreDependents handles POST /api/examinations/deletion/restore
+// The patient service calls it when restoring patients.
+func (h *ExaminationHandler) RestoreDependents(c *gin.Context) {
+	h.handleDeletion(c, "restore examinations", h.Service.RestoreDependents)
+}
+
+// RestoreExamination handles POST /api/examinations/:id/restore
+func (h *ExaminationHandler) RestoreExamination(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	exam, err := h.Service.RestoreExamination(uint(id))
+	if err != nil {
+		if err.Error() == "examination not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			writeDeletionError(c, "Failed to restore examination", err)
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(exam.Version))
+	c.JSON(http.StatusOK, exam)
+}
+
+// handleDeletion runs a deletion request from another service and replies
+// with the number of examinations it concerned.
+func (h *ExaminationHandler) handleDeletion(c *gin.Context, action string, run func(deletion.Request) (int, error)) {
+	var req deletion.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	count, err := run(req)
+	if err != nil {
+		writeDeletionError(c, "Failed to "+action, err)
+		return
+	}
+	c.JSON(http.StatusOK, deletion.Result{Count: count})
+}
+
+// writeDeletionError maps errors from deleting and restoring to status codes.
+func writeDeletionError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, deletion.ErrUnknownParent):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, deletion.ErrBlocked), errors.Is(err, deletion.ErrNotDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, etag.ErrMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, deletion.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": action + ": " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
@@ -1,17 +1,26 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/fitnis/examination-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
 	"github.com/gin-gonic/gin"
 )
 
 // ExaminationHandler holds the examination service.
 type ExaminationHandler struct {
 	Service *services.ExaminationService
+
+	// Consent enforces patients' consents on reads; nil allows every read
+	Consent *consent.Enforcer
 }
 
 // NewExaminationHandler creates a new ExaminationHandler.
@@ -33,17 +42,35 @@ type UpdateExaminationRequest struct {
 	Diagnosis string    `json:"diagnosis"`
 }
 
-// GetExaminations handles GET /api/examinations
+// GetExaminations handles GET /api/examinations?patientId=&from=&to=&diagnosis=&sort=&limit=&offset=&cursor=
 func (h *ExaminationHandler) GetExaminations(c *gin.Context) {
-	examinations, err := h.Service.GetExaminations()
+	params, err := query.FromValues(c.Request.URL.Query())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve examinations: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, examinations)
+
+	// Examinations of patients whose consents refuse the caller are left out before paging
+	refused, err := h.Consent.Refused(consent.ScopeExaminations, consent.IdentityFromHeaders(c.Request.Header))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check consent: " + err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetExaminations(params, refused)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve examinations: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
-// GetExamination handles GET /api/examinations/:id
+// GetExamination handles GET /api/examinations/:id?asOf=
+// asOf (RFC 3339) retrieves the examination as it was at that time.
 func (h *ExaminationHandler) GetExamination(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -51,19 +78,87 @@ func (h *ExaminationHandler) GetExamination(c *gin.Context) {
 		return
 	}
 
-	examination, err := h.Service.GetExaminationByID(uint(id))
+	var examination models.Examination
+	if asOf := c.Query("asOf"); asOf != "" {
+		at, perr := time.Parse(time.RFC3339, asOf)
+		if perr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "asOf must be an RFC 3339 time"})
+			return
+		}
+		examination, err = h.Service.GetExaminationAsOf(uint(id), at)
+	} else {
+		examination, err = h.Service.GetExaminationByID(uint(id))
+	}
 	if err != nil {
-		if err.Error() == "examination not found" {
+		if err.Error() == "examination not found" || err.Error() == "examination not found at that time" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve examination: " + err.Error()})
 		}
 		return
 	}
+	if !h.checkConsent(c, examination.PatientID, consent.ScopeExaminations) {
+		return
+	}
 
+	if c.Query("asOf") == "" {
+		c.Header(etag.HeaderETag, etag.Format(examination.Version))
+	}
 	c.JSON(http.StatusOK, examination)
 }
 
+// GetExaminationHistory handles GET /api/examinations/:id/history
+func (h *ExaminationHandler) GetExaminationHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	history, err := h.Service.GetExaminationHistory(uint(id))
+	if err != nil {
+		if err.Error() == "examination not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve examination history: " + err.Error()})
+		}
+		return
+	}
+	if !h.checkConsent(c, history.PatientID, consent.ScopeExaminations) {
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// ReassignRequest moves examinations between patients
+type ReassignRequest struct {
+	FromPatientID  uint   `json:"fromPatientId" binding:"required"`
+	ToPatientID    uint   `json:"toPatientId" binding:"required"`
+	ExaminationIDs []uint `json:"examinationIds"` // optional; all of the patient's examinations when empty
+}
+
+// ReassignExaminations handles POST /api/examinations/reassign
+// It is used by the patient service when merging duplicate records and undoing merges.
+func (h *ExaminationHandler) ReassignExaminations(c *gin.Context) {
+	var req ReassignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	moved, err := h.Service.ReassignExaminations(req.FromPatientID, req.ToPatientID, req.ExaminationIDs)
+	if err != nil {
+		if err.Error() == "cannot reassign examinations to the same patient" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign examinations: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"examinationIds": moved})
+}
+
 // GetExaminationsByPatientID handles GET /api/examinations/patient/:patientId
 func (h *ExaminationHandler) GetExaminationsByPatientID(c *gin.Context) {
 	patientID, err := strconv.ParseUint(c.Param("patientId"), 10, 32)
@@ -73,6 +168,9 @@ func (h *ExaminationHandler) GetExaminationsByPatientID(c *gin.Context) {
 	}
 
 	// Optional: Check if patient exists first using PatientService (would require injecting it)
+	if !h.checkConsent(c, uint(patientID), consent.ScopeExaminations) {
+		return
+	}
 
 	examinations, err := h.Service.GetExaminationsByPatientID(uint(patientID))
 	if err != nil {
@@ -90,24 +188,33 @@ func (h *ExaminationHandler) CreateExamination(c *gin.Context) {
 		return
 	}
 
-	// Optional: Check if patient exists first using PatientService
-
 	examination, err := h.Service.CreateExamination(req.PatientID, &req.ExamDate, req.Anamnesis, req.Diagnosis)
 	if err != nil {
-		// Handle potential foreign key constraint errors etc.
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create examination: " + err.Error()})
+		if errors.Is(err, references.ErrNotFound) || errors.Is(err, references.ErrInactive) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid patient reference: " + err.Error()})
+		} else if errors.Is(err, references.ErrUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify patient: " + err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create examination: " + err.Error()})
+		}
 		return
 	}
+	c.Header(etag.HeaderETag, etag.Format(examination.Version))
 	c.JSON(http.StatusCreated, examination)
 }
 
 // UpdateExamination handles PUT /api/examinations/:id
+// The If-Match header must hold the examination's current ETag.
 func (h *ExaminationHandler) UpdateExamination(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
 	var req UpdateExaminationRequest
 	if err := c.BindJSON(&req); err != nil { // Use BindJSON for optional fields
@@ -115,36 +222,75 @@ func (h *ExaminationHandler) UpdateExamination(c *gin.Context) {
 		return
 	}
 
-	updatedExam, err := h.Service.UpdateExamination(uint(id), req.ExamDate, req.Anamnesis, req.Diagnosis)
+	updatedExam, err := h.Service.UpdateExamination(uint(id), version, req.ExamDate, req.Anamnesis, req.Diagnosis)
 	if err != nil {
 		if err.Error() == "examination not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update examination: " + err.Error()})
 		}
 		return
 	}
 
+	c.Header(etag.HeaderETag, etag.Format(updatedExam.Version))
 	c.JSON(http.StatusOK, updatedExam)
 }
 
 // DeleteExamination handles DELETE /api/examinations/:id
+// The If-Match header must hold the examination's current ETag.
 func (h *ExaminationHandler) DeleteExamination(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
-	err = h.Service.DeleteExamination(uint(id))
+	err = h.Service.DeleteExamination(uint(id), version)
 	if err != nil {
 		if err.Error() == "examination not found or already deleted" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Examination not found"})
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete examination: " + err.Error()})
+			writeDeletionError(c, "Failed to delete examination", err)
 		}
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
+
+// checkConsent checks the caller identified by the request headers against the
+// patient's consents. When the read is refused it writes the response and returns false.
+func (h *ExaminationHandler) checkConsent(c *gin.Context, patientID uint, scope string) bool {
+	err := h.Consent.Check(patientID, scope, consent.IdentityFromHeaders(c.Request.Header))
+	if err == nil {
+		return true
+	}
+	var denied *consent.DeniedError
+	if errors.As(err, &denied) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": denied.Reason})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check consent: " + err.Error()})
+	}
+	return false
+}
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/fitnis/shared/privacy"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportPatientData handles POST /api/examinations/privacy/export
+// The patient service calls it to gather a patient's data for export.
+func (h *ExaminationHandler) ExportPatientData(c *gin.Context) {
+	var req privacy.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.PatientID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patientId is required"})
+		return
+	}
+
+	examinations, err := h.Service.ExportPatientData(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export examinations: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, examinations)
+}
+
+// ErasePatientData handles POST /api/examinations/privacy/erase
+// The patient service calls it when erasing a patient's data.
+func (h *ExaminationHandler) ErasePatientData(c *gin.Context) {
+	var req privacy.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.PatientID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patientId is required"})
+		return
+	}
+
+	erased, err := h.Service.ErasePatientData(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase examinations: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, privacy.ErasureResult{Erased: erased})
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/fitnis/shared/references"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckReference handles POST /api/examinations/references/check
+// Other services call it before creating records that reference an examination.
+func (h *ExaminationHandler) CheckReference(c *gin.Context) {
+	var req references.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	result, err := h.Service.CheckReference(req.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check examination: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
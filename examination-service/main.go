@@ -11,8 +11,14 @@ import (
 
 	"github.com/fitnis/examination-service/handlers"
 	"github.com/fitnis/examination-service/services"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/consent"
 	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
 	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"github.com/fitnis/shared/references"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,15 +27,29 @@ func main() {
 	database.InitDB()
 	db := database.DB
 
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "examinations")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+	recorder.Version(&models.Examination{})
+
 	// Initialize services and handlers
 	examinationService := services.NewExaminationService(db)
+	examinationService.Dependents.Client = deletion.NewKafkaClient()
+	examinationService.References = references.NewKafkaCheckerFromEnv()
 	examinationHandler := handlers.NewExaminationHandler(examinationService)
+	examinationHandler.Consent = consent.NewEnforcer(db)
+
+	// Purge examinations soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, examinationService.PurgeDeleted)
 
 	// Start Kafka consumer
 	log.Println("Starting Kafka consumer")
-	kafka.StartKafkaConsumer("examinations", func(req kafka.KafkaRequest) kafka.KafkaResponse {
+	kafka.StartKafkaConsumer("examinations", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
 		return handleKafkaRequest(req, examinationHandler)
-	})
+	}))
 
 	// Block main goroutine
 	select {}
@@ -41,11 +61,59 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.ExaminationHan
 	c, w := createMockGinContext(req)
 
 	// Route the request based on path and method
-	path := req.Path
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
 	if path == "" {
 		path = "/"
 	}
 
+	// Patient data export and erasure have no examination ID in the path
+	if path == privacy.ExportPath || path == privacy.ErasePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		if path == privacy.ExportPath {
+			handler.ExportPatientData(c)
+		} else {
+			handler.ErasePatientData(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Deletion requests from the patient service have no examination ID in the path
+	if path == deletion.CheckPath || path == deletion.DeletePath || path == deletion.RestorePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		switch path {
+		case deletion.CheckPath:
+			handler.CheckDeletion(c)
+		case deletion.DeletePath:
+			handler.DeleteDependents(c)
+		default:
+			handler.RestoreDependents(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Reference checks from other services have no examination ID in the path
+	if path == references.CheckPath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		handler.CheckReference(c)
+		return createResponse(req.RequestID, w)
+	}
+
+	// Reassignment has no examination ID in the path
+	if path == "/reassign" {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		handler.ReassignExaminations(c)
+		return createResponse(req.RequestID, w)
+	}
+
 	// Extract ID from path if present
 	var id uint64
 	var err error
@@ -71,9 +139,15 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.ExaminationHan
 	switch {
 	case req.Method == "GET" && path == "/":
 		handler.GetExaminations(c)
+	case req.Method == "GET" && id > 0 && strings.HasSuffix(path, "/history"):
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.GetExaminationHistory(c)
 	case req.Method == "GET" && id > 0:
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
 		handler.GetExamination(c)
+	case req.Method == "POST" && id > 0 && strings.HasSuffix(path, "/restore"):
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.RestoreExamination(c)
 	case req.Method == "POST" && path == "/":
 		handler.CreateExamination(c)
 	case req.Method == "PUT" && id > 0:
@@ -90,14 +164,7 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.ExaminationHan
 	}
 
 	// Create response from the written data
-	return kafka.KafkaResponse{
-		RequestID:  req.RequestID,
-		StatusCode: w.Code,
-		Headers: map[string]string{
-			"Content-Type": w.Header().Get("Content-Type"),
-		},
-		Body: w.Body.Bytes(),
-	}
+	return createResponse(req.RequestID, w)
 }
 
 // Helper functions
@@ -134,6 +201,15 @@ func extractPatientIDFromPath(path string) string {
 	return ""
 }
 
+func createResponse(requestID string, w *httptest.ResponseRecorder) kafka.KafkaResponse {
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
 func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
 	errorJSON, _ := json.Marshal(gin.H{"error": message})
 	return kafka.KafkaResponse{
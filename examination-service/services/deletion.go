@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+)
+
+// RestoreExamination brings back a soft-deleted examination along with the records deleted with it.
+func (s *ExaminationService) RestoreExamination(id uint) (models.Examination, error) {
+	var exam models.Examination
+	result := s.DB.Unscoped().Limit(1).Find(&exam, id)
+	if result.Error != nil {
+		return models.Examination{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Examination{}, errors.New("examination not found")
+	}
+	if !exam.DeletedAt.Valid {
+		return models.Examination{}, deletion.ErrNotDeleted
+	}
+
+	at := exam.DeletedAt.Time
+	if err := s.DB.Unscoped().Model(&exam).Update("deleted_at", nil).Error; err != nil {
+		return models.Examination{}, err
+	}
+	if err := s.cascadeRestore([]uint{id}, at); err != nil {
+		return models.Examination{}, err
+	}
+	return s.GetExaminationByID(id)
+}
+
+// CountDependents counts the patients' live examinations, for a check before deleting the patients.
+// It fails with deletion.ErrBlocked when the deletion rules keep the examinations from being deleted.
+func (s *ExaminationService) CountDependents(req deletion.Request) (int, error) {
+	ids, err := s.liveExaminationIDs(req)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	if err := s.Dependents.Check(ids); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// DeleteDependents soft-deletes the examinations of patients deleted at req.DeletedAt, applying
+// the deletion rules to their own dependents.
+func (s *ExaminationService) DeleteDependents(req deletion.Request) (int, error) {
+	ids, err := s.liveExaminationIDs(req)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	if err := s.Dependents.Check(ids); err != nil {
+		return 0, err
+	}
+
+	deleted, err := deletion.SoftDelete(s.DB, &models.Examination{}, "id", ids, req.DeletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, s.cascadeDelete(ids, req.DeletedAt)
+}
+
+// RestoreDependents brings back the examinations deleted along with patients at req.DeletedAt,
+// and the records deleted along with them.
+func (s *ExaminationService) RestoreDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	var ids []uint
+	err := s.DB.Unscoped().Model(&models.Examination{}).
+		Where("patient_id IN ? AND deleted_at = ?", req.ParentIDs, req.DeletedAt).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	restored, err := deletion.Restore(s.DB, &models.Examination{}, "id", ids, req.DeletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return restored, s.cascadeRestore(ids, req.DeletedAt)
+}
+
+// PurgeDeleted permanently deletes the examinations soft-deleted before the cutoff. The examinations of
+// patients under a retention hold on examinations are kept until the hold is released or expires.
+func (s *ExaminationService) PurgeDeleted(cutoff time.Time) (int, error) {
+	return deletion.Purge(s.DB, cutoff, &models.Examination{}, "patient_id", deletion.HeldPatients(s.DB, deletion.Examinations))
+}
+
+// cascadeDelete deletes the dependents of examinations just deleted at the given
+// time. When that fails the examinations are restored, so nothing is left half deleted.
+func (s *ExaminationService) cascadeDelete(ids []uint, at time.Time) error {
+	if err := s.Dependents.Delete(ids, at); err != nil {
+		if _, undoErr := deletion.Restore(s.DB, &models.Examination{}, "id", ids, at); undoErr != nil {
+			return fmt.Errorf("%w; the examinations stay deleted: %v", err, undoErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// cascadeRestore restores the dependents of examinations just restored from a
+// delete at the given time. When that fails the examinations are deleted again.
+func (s *ExaminationService) cascadeRestore(ids []uint, at time.Time) error {
+	if err := s.Dependents.Restore(ids, at); err != nil {
+		if _, undoErr := deletion.SoftDelete(s.DB, &models.Examination{}, "id", ids, at); undoErr != nil {
+			return fmt.Errorf("%w; the examinations stay restored: %v", err, undoErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// liveExaminationIDs lists the IDs of the live examinations of the requested patients.
+func (s *ExaminationService) liveExaminationIDs(req deletion.Request) ([]uint, error) {
+	if err := checkParent(req); err != nil {
+		return nil, err
+	}
+	var ids []uint
+	if len(req.ParentIDs) == 0 {
+		return ids, nil
+	}
+	err := s.DB.Model(&models.Examination{}).Where("patient_id IN ?", req.ParentIDs).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// checkParent accepts requests about patients, the only records examinations reference.
+func checkParent(req deletion.Request) error {
+	if req.Parent != deletion.Patients {
+		return fmt.Errorf("%w: %q", deletion.ErrUnknownParent, req.Parent)
+	}
+	return nil
+}
@@ -1,25 +1,45 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
 	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
 	"gorm.io/gorm"
 )
 
 // ExaminationService handles database operations for examinations.
 type ExaminationService struct {
 	DB *gorm.DB
+
+	// Dependents applies the deletion rules to samples, prescriptions, referrals and orders; deletes
+	// fail with deletion.ErrUnavailable until its client is set
+	Dependents *deletion.Cascader
+
+	// References checks that new examinations reference an existing patient whose data has not
+	// been erased
+	References references.Checker
 }
 
 // NewExaminationService creates a new ExaminationService.
 func NewExaminationService(db *gorm.DB) *ExaminationService {
-	return &ExaminationService{DB: db}
+	return &ExaminationService{DB: db, Dependents: deletion.NewCascader(deletion.Examinations, nil)}
 }
 
 // CreateExamination adds a new examination to the database.
+// patientID must reference a patient who may be examined; see references.Require.
 func (s *ExaminationService) CreateExamination(patientID uint, examDate *time.Time, anamnesis, diagnosis string) (models.Examination, error) {
+	if err := references.Require(s.References, references.Patients, patientID); err != nil {
+		return models.Examination{}, fmt.Errorf("patient: %w", err)
+	}
+
 	exam := models.Examination{
 		PatientID: patientID,
 		ExamDate:  examDate,
@@ -30,12 +50,28 @@ func (s *ExaminationService) CreateExamination(patientID uint, examDate *time.Ti
 	return exam, result.Error
 }
 
-// GetExaminations retrieves all examinations from the database.
-func (s *ExaminationService) GetExaminations() ([]models.Examination, error) {
-	var examinations []models.Examination
+// examinationQuery is the allow-list for listing examinations.
+var examinationQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"patientId": {Column: "patient_id", Kind: query.Int},
+		"from":      {Column: "exam_date", Kind: query.Time, Op: query.Gte},
+		"to":        {Column: "exam_date", Kind: query.Time, Op: query.Lte},
+		"diagnosis": {Column: "diagnosis", Op: query.Contains},
+	},
+	Sorts:       map[string]string{"examDate": "exam_date"},
+	DefaultSort: "-examDate",
+}
+
+// GetExaminations retrieves one page of examinations, newest first by default, leaving out
+// those of excludedPatients (see consent.Enforcer.Refused).
+// Filters: patientId, from and to (exam date, inclusive) and diagnosis (substring).
+func (s *ExaminationService) GetExaminations(params query.Params, excludedPatients []uint) (query.Page[models.Examination], error) {
 	// Preload associated data if needed, e.g., Patient
-	result := s.DB.Preload("Patient").Find(&examinations)
-	return examinations, result.Error
+	db := s.DB.Preload("Patient")
+	if len(excludedPatients) > 0 {
+		db = db.Where("patient_id NOT IN ?", excludedPatients)
+	}
+	return query.Find[models.Examination](db, examinationQuery, params)
 }
 
 // GetExaminationByID retrieves an examination by its ID.
@@ -53,6 +89,70 @@ func (s *ExaminationService) GetExaminationByID(id uint) (models.Examination, er
 	return exam, nil
 }
 
+// ExaminationHistory lists every version of an examination, oldest first
+type ExaminationHistory struct {
+	ExaminationID uint                   `json:"examinationId"`
+	PatientID     uint                   `json:"patientId"`
+	Versions      []models.RecordVersion `json:"versions"`
+}
+
+// GetExaminationHistory retrieves every stored version of an examination, including those
+// from before it was deleted. Examinations unchanged since versioning began have none.
+func (s *ExaminationService) GetExaminationHistory(id uint) (ExaminationHistory, error) {
+	versions, err := audit.History(s.DB, "examinations", id)
+	if err != nil {
+		return ExaminationHistory{}, err
+	}
+	history := ExaminationHistory{ExaminationID: id, Versions: versions}
+
+	exam, err := s.GetExaminationByID(id)
+	switch {
+	case err == nil:
+		history.PatientID = exam.PatientID
+	case err.Error() != "examination not found":
+		return ExaminationHistory{}, err
+	case len(versions) == 0:
+		return ExaminationHistory{}, err
+	default:
+		// Deleted: the patient is taken from the last stored state
+		for i := len(versions) - 1; i >= 0; i-- {
+			if versions[i].Snapshot != nil {
+				if err := json.Unmarshal(versions[i].Snapshot, &exam); err != nil {
+					return ExaminationHistory{}, err
+				}
+				history.PatientID = exam.PatientID
+				break
+			}
+		}
+	}
+	return history, nil
+}
+
+// GetExaminationAsOf retrieves an examination as it was at the given time. Examinations
+// unchanged since versioning began are returned as they are now.
+func (s *ExaminationService) GetExaminationAsOf(id uint, at time.Time) (models.Examination, error) {
+	version, err := audit.AsOf(s.DB, "examinations", id, at)
+	if errors.Is(err, audit.ErrNoVersion) {
+		versions, err := audit.History(s.DB, "examinations", id)
+		if err != nil {
+			return models.Examination{}, err
+		}
+		if len(versions) == 0 {
+			return s.GetExaminationByID(id)
+		}
+		return models.Examination{}, errors.New("examination not found at that time")
+	}
+	if err != nil {
+		return models.Examination{}, err
+	}
+
+	var exam models.Examination
+	if err := json.Unmarshal(version.Snapshot, &exam); err != nil {
+		return models.Examination{}, err
+	}
+	return exam, nil
+}
+
 // GetExaminationsByPatientID retrieves all examinations for a specific patient.
 func (s *ExaminationService) GetExaminationsByPatientID(patientID uint) ([]models.Examination, error) {
 	var patientExams []models.Examination
@@ -60,8 +160,36 @@ func (s *ExaminationService) GetExaminationsByPatientID(patientID uint) ([]model
 	return patientExams, result.Error
 }
 
-// UpdateExamination updates an existing examination's details.
-func (s *ExaminationService) UpdateExamination(id uint, examDate time.Time, anamnesis, diagnosis string) (models.Examination, error) {
+// ReassignExaminations moves examinations from one patient to another, e.g. when duplicate
+// patient records are merged. When examinationIDs is empty every examination of fromPatientID
+// is moved; otherwise only the listed ones that still belong to fromPatientID. It returns the IDs moved.
+func (s *ExaminationService) ReassignExaminations(fromPatientID, toPatientID uint, examinationIDs []uint) ([]uint, error) {
+	if fromPatientID == toPatientID {
+		return nil, errors.New("cannot reassign examinations to the same patient")
+	}
+	moved := []uint{}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		db := tx.Model(&models.Examination{}).Where("patient_id = ?", fromPatientID)
+		if len(examinationIDs) > 0 {
+			db = db.Where("id IN ?", examinationIDs)
+		}
+		if err := db.Order("id").Pluck("id", &moved).Error; err != nil {
+			return err
+		}
+		if len(moved) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Examination{}).Where("id IN ?", moved).Update("patient_id", toPatientID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// UpdateExamination updates an existing examination's details. It fails with etag.ErrMismatch
+// unless the examination is still at the given version.
+func (s *ExaminationService) UpdateExamination(id, version uint, examDate time.Time, anamnesis, diagnosis string) (models.Examination, error) {
 	exam, err := s.GetExaminationByID(id)
 	if err != nil {
 		return models.Examination{}, err
@@ -75,19 +203,28 @@ func (s *ExaminationService) UpdateExamination(id uint, examDate time.Time, anam
 	exam.Anamnesis = anamnesis
 	exam.Diagnosis = diagnosis
 
-	result := s.DB.Save(&exam)
+	result := etag.Expect(s.DB, version).Save(&exam)
 	return exam, result.Error
 }
 
-// DeleteExamination removes an examination from the database.
-// Note: Consider cascading deletes or handling related records (samples, prescriptions, referrals)
-func (s *ExaminationService) DeleteExamination(id uint) error {
-	result := s.DB.Delete(&models.Examination{}, id)
-	if result.Error != nil {
-		return result.Error
+// DeleteExamination soft-deletes an examination, applying the deletion rules to its samples,
+// prescriptions, referrals, orders and chart notes; it can be restored until it is purged. It fails with
+// deletion.ErrBlocked when a rule forbids the delete, and with etag.ErrMismatch unless the
+// examination is still at the given version.
+func (s *ExaminationService) DeleteExamination(id, version uint) error {
+	if _, err := s.GetExaminationByID(id); err != nil {
+		if err.Error() == "examination not found" {
+			return errors.New("examination not found or already deleted")
+		}
+		return err
+	}
+	ids := []uint{id}
+	if err := s.Dependents.Check(ids); err != nil {
+		return err
 	}
-	if result.RowsAffected == 0 {
-		return errors.New("examination not found or already deleted")
+	at := deletion.Stamp()
+	if err := etag.Expect(deletion.At(s.DB, at), version).Delete(&models.Examination{}, id).Error; err != nil {
+		return err
 	}
-	return nil
+	return s.cascadeDelete(ids, at)
 }
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"gorm.io/gorm"
+)
+
+// ExportPatientData retrieves all of a patient's examinations, for a patient data export.
+func (s *ExaminationService) ExportPatientData(req privacy.Request) ([]models.Examination, error) {
+	if req.PatientID == 0 {
+		return nil, errors.New("patientId is required")
+	}
+	examinations := []models.Examination{}
+	result := s.DB.Unscoped().Where("patient_id = ?", req.PatientID).Order("id").Find(&examinations)
+	return examinations, result.Error
+}
+
+// ErasePatientData anonymises a patient's examinations by removing their anamnesis and diagnosis,
+// including from their earlier versions. Structured data is kept so statistics and references
+// stay intact; the audit log records which fields were erased but not their values.
+func (s *ExaminationService) ErasePatientData(req privacy.Request) (int, error) {
+	if req.PatientID == 0 {
+		return 0, errors.New("patientId is required")
+	}
+	erased := map[string]interface{}{"anamnesis": privacy.ErasedText, "diagnosis": privacy.ErasedText}
+	var ids []uint
+	err := audit.Redacted(s.DB).Transaction(func(tx *gorm.DB) error {
+		examinations := tx.Unscoped().Model(&models.Examination{}).Where("patient_id = ?", req.PatientID).Session(&gorm.Session{})
+		if err := examinations.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if err := examinations.Updates(erased).Error; err != nil {
+			return err
+		}
+		_, err := audit.ScrubVersions(tx, &models.Examination{}, ids, erased)
+		return err
+	})
+	return len(ids), err
+}
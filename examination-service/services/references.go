@@ -0,0 +1,21 @@
+package services
+
+import (
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/references"
+)
+
+// CheckReference tells other services whether new records may reference the examination.
+// Deleted examinations may not be referenced but still report their patient, so that the
+// patient's consents apply to records left behind until the examination is purged.
+func (s *ExaminationService) CheckReference(id uint) (references.Result, error) {
+	var exam models.Examination
+	result := s.DB.Unscoped().Select("id", "patient_id", "deleted_at").Limit(1).Find(&exam, id)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return references.Result{}, result.Error
+	}
+	if exam.DeletedAt.Valid {
+		return references.Result{Exists: true, Reason: "examination deleted", PatientID: exam.PatientID}, nil
+	}
+	return references.Result{Exists: true, Active: true, PatientID: exam.PatientID}, nil
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckDeletion handles POST /api/orders/deletion/check
+// The examination service calls it before deleting examinations.
+func (h *OrderHandler) CheckDeletion(c *gin.Context) {
+	h.handleDeletion(c, "check orders", h.Service.CountDependents)
+}
+
+// DeleteDependents handles POST /api/orders/deletion/delete
+// The examination service calls it when deleting examinations.
+func (h *OrderHandler) DeleteDependents(c *gin.Context) {
+	h.handleDeletion(c, "delete orders", h.Service.DeleteDependents)
+}
+
+// RestoreDependents handles POST /api/orders/deletion/restore
+// The examination service calls it when restoring examinations.
+func (h *OrderHandler) RestoreDependents(c *gin.Context) {
+	h.handleDeletion(c, "restore orders", h.Service.RestoreDependents)
+}
+
+// RestoreOrder handles POST /api/orders/:id/restore
+func (h *OrderHandler) RestoreOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	order, err := h.Service.RestoreOrder(uint(id))
+	if err != nil {
+		switch {
+		case err.Error() == "order not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, deletion.ErrNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore order: " + err.Error()})
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(order.Version))
+	c.JSON(http.StatusOK, order)
+}
+
+// handleDeletion runs a deletion request from another service and replies
+// with the number of orders it concerned.
+func (h *OrderHandler) handleDeletion(c *gin.Context, action string, run func(deletion.Request) (int, error)) {
+	var req deletion.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	count, err := run(req)
+	if err != nil {
+		if errors.Is(err, deletion.ErrUnknownParent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + ": " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, deletion.Result{Count: count})
+}
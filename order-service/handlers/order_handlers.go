@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/order-service/services"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
+	"github.com/gin-gonic/gin"
+)
+
+// OrderHandler holds the order service.
+type OrderHandler struct {
+	Service *services.OrderService
+}
+
+// NewOrderHandler creates a new OrderHandler.
+func NewOrderHandler(s *services.OrderService) *OrderHandler {
+	return &OrderHandler{Service: s}
+}
+
+type OrderItemRequest struct {
+	Category    string `json:"category" binding:"required"` // lab or imaging
+	Code        string `json:"code" binding:"required"`
+	Description string `json:"description"`
+	SampleType  string `json:"sampleType"` // required for lab items
+}
+
+type OrderRequest struct {
+	ExaminationID uint               `json:"examinationId" binding:"required"`
+	Priority      string             `json:"priority"` // routine (default), urgent or stat
+	OrderedBy     string             `json:"orderedBy"`
+	OrderedByID   *uint              `json:"orderedById"`
+	Notes         string             `json:"notes"`
+	Items         []OrderItemRequest `json:"items" binding:"required,dive"`
+}
+
+type ItemResultRequest struct {
+	Result string `json:"result" binding:"required"`
+}
+
+// GetOrders handles GET /api/orders?examinationId=&orderedById=&status=&priority=&from=&to=&sort=&limit=&offset=&cursor=
+func (h *OrderHandler) GetOrders(c *gin.Context) {
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetOrders(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetOrder handles GET /api/orders/:id
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	order, err := h.Service.GetOrderByID(uint(id))
+	if err != nil {
+		writeOrderError(c, "Failed to retrieve order", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(order.Version))
+	c.JSON(http.StatusOK, order)
+}
+
+// CreateOrder handles POST /api/orders
+func (h *OrderHandler) CreateOrder(c *gin.Context) {
+	var req OrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	order := models.Order{
+		ExaminationID: req.ExaminationID,
+		Priority:      req.Priority,
+		OrderedBy:     req.OrderedBy,
+		OrderedByID:   req.OrderedByID,
+		Notes:         req.Notes,
+	}
+	for _, item := range req.Items {
+		order.Items = append(order.Items, models.OrderItem{
+			Category:    item.Category,
+			Code:        item.Code,
+			Description: item.Description,
+			SampleType:  item.SampleType,
+		})
+	}
+
+	created, err := h.Service.CreateOrder(order)
+	if err != nil {
+		writeOrderError(c, "Failed to create order", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(created.Version))
+	c.JSON(http.StatusCreated, created)
+}
+
+// FulfilOrder handles POST /api/orders/:id/fulfil
+func (h *OrderHandler) FulfilOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	order, err := h.Service.FulfilOrder(uint(id))
+	if err != nil {
+		if order.ID != 0 {
+			// Some samples were created; report the order state along with what failed
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "order": order})
+			return
+		}
+		writeOrderError(c, "Failed to fulfil order", err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// RecordItemResult handles POST /api/orders/:id/items/:itemId/result
+func (h *OrderHandler) RecordItemResult(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	itemID, err := strconv.ParseUint(c.Param("itemId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID format"})
+		return
+	}
+
+	var req ItemResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	order, err := h.Service.RecordItemResult(uint(id), uint(itemID), req.Result)
+	if err != nil {
+		writeOrderError(c, "Failed to record result", err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// CancelOrder handles POST /api/orders/:id/cancel
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	order, err := h.Service.CancelOrder(uint(id))
+	if err != nil {
+		writeOrderError(c, "Failed to cancel order", err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// DeleteOrder handles DELETE /api/orders/:id
+// The If-Match header must hold the order's current ETag.
+func (h *OrderHandler) DeleteOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	err = h.Service.DeleteOrder(uint(id), version)
+	if err != nil {
+		if err.Error() == "order not found or already deleted" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		} else {
+			writeOrderError(c, "Failed to delete order", err)
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeOrderError maps service errors to status codes.
+func writeOrderError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "order not found", err.Error() == "order item not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidOrder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrderClosed), errors.Is(err, services.ErrOrderStarted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, etag.ErrMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, references.ErrNotFound), errors.Is(err, references.ErrInactive),
+		errors.Is(err, practitioners.ErrNotFound), errors.Is(err, practitioners.ErrInactive):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, references.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify examination: " + err.Error()})
+	case errors.Is(err, practitioners.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify practitioner: " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/fitnis/shared/privacy"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportPatientData handles POST /api/orders/privacy/export
+// The patient service calls it to gather a patient's data for export.
+func (h *OrderHandler) ExportPatientData(c *gin.Context) {
+	var req privacy.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	orders, err := h.Service.ExportPatientData(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export orders: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// ErasePatientData handles POST /api/orders/privacy/erase
+// The patient service calls it when erasing a patient's data.
+func (h *OrderHandler) ErasePatientData(c *gin.Context) {
+	var req privacy.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	erased, err := h.Service.ErasePatientData(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase orders: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, privacy.ErasureResult{Erased: erased})
+}
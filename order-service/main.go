@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fitnis/order-service/handlers"
+	"github.com/fitnis/order-service/services"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/privacy"
+	"github.com/fitnis/shared/references"
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	// Initialize Database
+	database.InitDB()
+	db := database.DB
+
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "orders")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
+	// Initialize services and handlers
+	orderService := services.NewOrderService(db)
+	orderService.Samples = services.NewKafkaSampleClient()
+	orderService.Practitioners = practitioners.NewKafkaDirectory()
+	orderService.References = references.NewKafkaCheckerFromEnv()
+	orderHandler := handlers.NewOrderHandler(orderService)
+
+	// Save sample results to open orders in the background, so reads never write
+	orderService.StartSync(getDurationEnv("ORDER_SYNC_INTERVAL", services.DefaultSyncInterval))
+
+	// Purge orders soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, orderService.PurgeDeleted)
+
+	// Start Kafka consumer
+	log.Println("Starting Kafka consumer")
+	kafka.StartKafkaConsumer("orders", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
+		return handleKafkaRequest(req, orderHandler)
+	}))
+
+	// Block main goroutine
+	select {}
+}
+
+// handleKafkaRequest processes Kafka requests and returns responses
+func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.OrderHandler) kafka.KafkaResponse {
+	// Create a mock gin context to reuse our handler functions
+	c, w := createMockGinContext(req)
+
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
+	if path == "" {
+		path = "/"
+	}
+
+	// Patient data export and erasure have no order ID in the path
+	if path == privacy.ExportPath || path == privacy.ErasePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		if path == privacy.ExportPath {
+			handler.ExportPatientData(c)
+		} else {
+			handler.ErasePatientData(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Deletion requests from the examination service have no order ID in the path
+	if path == deletion.CheckPath || path == deletion.DeletePath || path == deletion.RestorePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		switch path {
+		case deletion.CheckPath:
+			handler.CheckDeletion(c)
+		case deletion.DeletePath:
+			handler.DeleteDependents(c)
+		default:
+			handler.RestoreDependents(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Extract ID from path if present
+	var id uint64
+	var err error
+	idStr := extractIDFromPath(path)
+	if idStr != "" {
+		id, err = strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			return createErrorResponse(req.RequestID, http.StatusBadRequest, "Invalid ID format")
+		}
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+	}
+	action := extractActionFromPath(path)
+	itemIDStr := extractItemIDFromPath(path)
+
+	// Route to appropriate handler
+	switch {
+	case req.Method == "GET" && path == "/":
+		handler.GetOrders(c)
+	case req.Method == "GET" && id > 0 && action == "":
+		handler.GetOrder(c)
+	case req.Method == "POST" && path == "/":
+		handler.CreateOrder(c)
+	case req.Method == "DELETE" && id > 0 && action == "":
+		handler.DeleteOrder(c)
+	case req.Method == "POST" && id > 0 && action == "fulfil":
+		handler.FulfilOrder(c)
+	case req.Method == "POST" && id > 0 && action == "restore":
+		handler.RestoreOrder(c)
+	case req.Method == "POST" && id > 0 && action == "cancel":
+		handler.CancelOrder(c)
+	case req.Method == "POST" && id > 0 && itemIDStr != "":
+		c.Params = append(c.Params, gin.Param{Key: "itemId", Value: itemIDStr})
+		handler.RecordItemResult(c)
+	default:
+		return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+	}
+
+	// Create response from the written data
+	return createResponse(req.RequestID, w)
+}
+
+// Helper functions
+
+func createMockGinContext(req kafka.KafkaRequest) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	httpReq, _ := http.NewRequest(req.Method, req.Path, bytes.NewReader(req.Body))
+
+	// Add headers
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+	return c, w
+}
+
+func extractIDFromPath(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) >= 2 {
+		return parts[1]
+	}
+	return ""
+}
+
+// extractActionFromPath returns "fulfil" from /:id/fulfil
+func extractActionFromPath(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) == 3 {
+		return parts[2]
+	}
+	return ""
+}
+
+// extractItemIDFromPath returns the item ID from /:id/items/:itemId/result
+func extractItemIDFromPath(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) == 5 && parts[2] == "items" && parts[4] == "result" {
+		return parts[3]
+	}
+	return ""
+}
+
+// getDurationEnv reads a duration such as "1m" from the environment, falling back to def
+func getDurationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %s: %v", key, value, def, err)
+		return def
+	}
+	return d
+}
+
+func createResponse(requestID string, w *httptest.ResponseRecorder) kafka.KafkaResponse {
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
+func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
+	errorJSON, _ := json.Marshal(gin.H{"error": message})
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: errorJSON,
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+)
+
+// CountDependents counts the live orders of the parent records, for a check before deleting them.
+func (s *OrderService) CountDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.CountLive(s.DB, &models.Order{}, "examination_id", req.ParentIDs)
+}
+
+// DeleteDependents soft-deletes the orders of examinations deleted at req.DeletedAt.
+func (s *OrderService) DeleteDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.SoftDelete(s.DB, &models.Order{}, "examination_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreDependents brings back the orders deleted along with examinations at req.DeletedAt.
+func (s *OrderService) RestoreDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.Restore(s.DB, &models.Order{}, "examination_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreOrder brings back a soft-deleted order with its items.
+func (s *OrderService) RestoreOrder(id uint) (models.Order, error) {
+	var order models.Order
+	result := s.DB.Unscoped().Limit(1).Find(&order, id)
+	if result.Error != nil {
+		return models.Order{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Order{}, errors.New("order not found")
+	}
+	if !order.DeletedAt.Valid {
+		return models.Order{}, deletion.ErrNotDeleted
+	}
+	if err := s.DB.Unscoped().Model(&order).Update("deleted_at", nil).Error; err != nil {
+		return models.Order{}, err
+	}
+	return s.GetOrderByID(id)
+}
+
+// PurgeDeleted permanently deletes the orders soft-deleted before the cutoff, with their items.
+// The orders of patients under a retention hold on orders are kept until the hold is released or expires.
+func (s *OrderService) PurgeDeleted(cutoff time.Time) (int, error) {
+	var purged int
+	err := audit.System(s.DB, deletion.PurgeJob).Transaction(func(tx *gorm.DB) error {
+		held := deletion.HeldExaminations(tx, deletion.Orders)
+		expired := tx.Unscoped().Model(&models.Order{}).Select("id").
+			Where("deleted_at < ? AND examination_id NOT IN (?)", cutoff, held)
+		if err := tx.Where("order_id IN (?)", expired).Delete(&models.OrderItem{}).Error; err != nil {
+			return err
+		}
+		var err error
+		purged, err = deletion.Purge(tx, cutoff, &models.Order{}, "examination_id", held)
+		return err
+	})
+	return purged, err
+}
+
+// checkParent accepts requests about examinations, the only records orders are deleted with.
+func checkParent(req deletion.Request) error {
+	if req.Parent != deletion.Examinations {
+		return fmt.Errorf("%w: %q", deletion.ErrUnknownParent, req.Parent)
+	}
+	return nil
+}
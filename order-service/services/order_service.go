@@ -0,0 +1,435 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
+	"gorm.io/gorm"
+)
+
+// Order statuses.
+const (
+	StatusOrdered    = "ordered"
+	StatusInProgress = "in-progress"
+	StatusCompleted  = "completed"
+	StatusCancelled  = "cancelled"
+)
+
+// Order item statuses.
+const (
+	ItemPending   = "pending"
+	ItemCollected = "collected"
+	ItemResulted  = "resulted"
+	ItemCancelled = "cancelled"
+)
+
+// Order item categories.
+const (
+	CategoryLab     = "lab"
+	CategoryImaging = "imaging"
+)
+
+// Order priorities.
+const (
+	PriorityRoutine = "routine"
+	PriorityUrgent  = "urgent"
+	PriorityStat    = "stat"
+)
+
+// ErrInvalidOrder is returned when an order or one of its items is malformed.
+var ErrInvalidOrder = errors.New("invalid order")
+
+// ErrOrderClosed is returned when changing an order that is completed or cancelled.
+var ErrOrderClosed = errors.New("order is already closed")
+
+// ErrOrderStarted is returned when deleting an order that already has collected samples.
+var ErrOrderStarted = errors.New("order has collected samples; cancel it instead")
+
+// DefaultSyncInterval is how often StartSync picks up sample results for open orders.
+const DefaultSyncInterval = time.Minute
+
+// OrderService handles database operations for orders.
+type OrderService struct {
+	DB      *gorm.DB
+	Samples SampleClient // Optional: required only for FulfilOrder
+
+	// Practitioners validates the ordering clinician on creation
+	Practitioners practitioners.Directory
+	// References checks that the examination exists on creation
+	References references.Checker
+}
+
+// NewOrderService creates a new OrderService.
+func NewOrderService(db *gorm.DB) *OrderService {
+	return &OrderService{DB: db}
+}
+
+// IsValidPriority reports whether p is a known order priority.
+func IsValidPriority(p string) bool {
+	return p == PriorityRoutine || p == PriorityUrgent || p == PriorityStat
+}
+
+// CreateOrder adds a new order with its items.
+func (s *OrderService) CreateOrder(order models.Order) (models.Order, error) {
+	if order.Priority == "" {
+		order.Priority = PriorityRoutine
+	}
+	if !IsValidPriority(order.Priority) {
+		return models.Order{}, fmt.Errorf("%w: priority must be routine, urgent or stat", ErrInvalidOrder)
+	}
+	if len(order.Items) == 0 {
+		return models.Order{}, fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.Category = strings.ToLower(item.Category)
+		switch {
+		case item.Category != CategoryLab && item.Category != CategoryImaging:
+			return models.Order{}, fmt.Errorf("%w: item %d category must be lab or imaging", ErrInvalidOrder, i+1)
+		case item.Code == "":
+			return models.Order{}, fmt.Errorf("%w: item %d code is required", ErrInvalidOrder, i+1)
+		case item.Category == CategoryLab && item.SampleType == "":
+			return models.Order{}, fmt.Errorf("%w: lab item %d needs a sampleType", ErrInvalidOrder, i+1)
+		}
+		item.ID = 0
+		item.Status = ItemPending
+		item.SampleID = nil
+		item.Result = ""
+	}
+
+	if err := references.Require(s.References, references.Examinations, order.ExaminationID); err != nil {
+		return models.Order{}, fmt.Errorf("examination: %w", err)
+	}
+
+	practitioner, err := practitioners.Resolve(s.Practitioners, order.OrderedByID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if practitioner != nil && order.OrderedBy == "" {
+		order.OrderedBy = practitioner.FullName()
+	}
+
+	order.ID = 0
+	order.Status = StatusOrdered
+	order.CompletedAt = nil
+	result := s.DB.Create(&order)
+	return order, result.Error
+}
+
+// orderQuery is the allow-list for listing orders.
+var orderQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"examinationId": {Column: "examination_id", Kind: query.Int},
+		"orderedById":   {Column: "ordered_by_id", Kind: query.Int},
+		"status":        {Column: "status"},
+		"priority":      {Column: "priority"},
+		"from":          {Column: "created_at", Kind: query.Time, Op: query.Gte},
+		"to":            {Column: "created_at", Kind: query.Time, Op: query.Lte},
+	},
+	Sorts: map[string]string{
+		"priority":  "CASE priority WHEN 'stat' THEN 0 WHEN 'urgent' THEN 1 ELSE 2 END",
+		"createdAt": "created_at",
+	},
+	DefaultSort: "priority",
+}
+
+// GetOrders retrieves one page of orders, most urgent first by default.
+// Filters: examinationId, orderedById, status, priority, and from and to (creation date, inclusive).
+// Sample results are shown as soon as they are recorded; they are saved to the order by
+// StartSync or the next change to the order.
+func (s *OrderService) GetOrders(params query.Params) (query.Page[models.Order], error) {
+	page, err := query.Find[models.Order](s.DB.Preload("Items"), orderQuery, params)
+	if err != nil {
+		return page, err
+	}
+	for i := range page.Items {
+		if _, err := s.refreshOrder(&page.Items[i]); err != nil {
+			return query.Page[models.Order]{}, err
+		}
+	}
+	return page, nil
+}
+
+// GetOrderByID retrieves an order by its ID, with its items. Like GetOrders it does not save anything.
+func (s *OrderService) GetOrderByID(id uint) (models.Order, error) {
+	order, err := s.getOrder(id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if _, err := s.refreshOrder(&order); err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+// SyncOpenOrders saves the results of collected samples to open orders and returns
+// how many orders changed.
+func (s *OrderService) SyncOpenOrders() (int, error) {
+	var ids []uint
+	if err := s.DB.Model(&models.Order{}).Where("status IN ?", []string{StatusOrdered, StatusInProgress}).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, id := range ids {
+		order, err := s.getOrder(id)
+		if err != nil {
+			return changed, err
+		}
+		ok, err := s.syncOrder(&order)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// StartSync calls SyncOpenOrders in the background every interval. Its changes are audited
+// as the "sync" job's, not the caller's of the request being handled at the time.
+func (s *OrderService) StartSync(interval time.Duration) {
+	background := *s
+	background.DB = audit.System(s.DB, "sync")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := background.SyncOpenOrders(); err != nil {
+				log.Printf("Failed to sync orders with sample results: %v", err)
+			} else if n > 0 {
+				log.Printf("Synced %d orders with sample results", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// getOrder loads an order and its items as stored.
+func (s *OrderService) getOrder(id uint) (models.Order, error) {
+	var order models.Order
+	result := s.DB.Preload("Items").First(&order, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.Order{}, errors.New("order not found")
+		}
+		return models.Order{}, result.Error
+	}
+	return order, nil
+}
+
+// FulfilOrder creates a sample in the sample service for every pending lab item.
+// Imaging items have no sample and are resulted with RecordItemResult.
+// Items whose sample could not be created stay pending, so the call can be retried.
+func (s *OrderService) FulfilOrder(id uint) (models.Order, error) {
+	if s.Samples == nil {
+		return models.Order{}, errors.New("sample service client not configured")
+	}
+	order, err := s.getOrder(id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if order.Status == StatusCompleted || order.Status == StatusCancelled {
+		return models.Order{}, fmt.Errorf("%w: status is %s", ErrOrderClosed, order.Status)
+	}
+
+	var failures []string
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.Category != CategoryLab || item.Status != ItemPending {
+			continue
+		}
+		sample, err := s.Samples.CreateSample(order.ExaminationID, item.SampleType, order.ID, item.ID)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", item.Code, err))
+			continue
+		}
+		item.SampleID = &sample.ID
+		item.Status = ItemCollected
+		if err := s.DB.Model(item).Updates(map[string]interface{}{"sample_id": sample.ID, "status": ItemCollected}).Error; err != nil {
+			return models.Order{}, err
+		}
+	}
+
+	if _, err := s.syncOrder(&order); err != nil {
+		return models.Order{}, err
+	}
+	if len(failures) > 0 {
+		return order, fmt.Errorf("failed to create samples for %s", strings.Join(failures, "; "))
+	}
+	return order, nil
+}
+
+// RecordItemResult stores the result for an imaging item (lab items are resulted through their sample).
+func (s *OrderService) RecordItemResult(orderID, itemID uint, resultText string) (models.Order, error) {
+	if strings.TrimSpace(resultText) == "" {
+		return models.Order{}, fmt.Errorf("%w: result is required", ErrInvalidOrder)
+	}
+	order, err := s.getOrder(orderID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if order.Status == StatusCompleted || order.Status == StatusCancelled {
+		return models.Order{}, fmt.Errorf("%w: status is %s", ErrOrderClosed, order.Status)
+	}
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.ID != itemID {
+			continue
+		}
+		if item.Category != CategoryImaging {
+			return models.Order{}, fmt.Errorf("%w: lab results come from the item's sample", ErrInvalidOrder)
+		}
+		if item.Status == ItemCancelled {
+			return models.Order{}, fmt.Errorf("%w: item is cancelled", ErrInvalidOrder)
+		}
+		item.Result = resultText
+		item.Status = ItemResulted
+		if err := s.DB.Save(item).Error; err != nil {
+			return models.Order{}, err
+		}
+		if _, err := s.syncOrder(&order); err != nil {
+			return models.Order{}, err
+		}
+		return order, nil
+	}
+	return models.Order{}, errors.New("order item not found")
+}
+
+// CancelOrder cancels an open order and its unfinished items. Items whose sample already
+// has a result keep it.
+func (s *OrderService) CancelOrder(id uint) (models.Order, error) {
+	order, err := s.getOrder(id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if _, err := s.syncOrder(&order); err != nil {
+		return models.Order{}, err
+	}
+	if order.Status == StatusCompleted || order.Status == StatusCancelled {
+		return models.Order{}, fmt.Errorf("%w: status is %s", ErrOrderClosed, order.Status)
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range order.Items {
+			if order.Items[i].Status != ItemResulted {
+				order.Items[i].Status = ItemCancelled
+				if err := tx.Save(&order.Items[i]).Error; err != nil {
+					return err
+				}
+			}
+		}
+		order.Status = StatusCancelled
+		return tx.Model(&order).Update("status", StatusCancelled).Error
+	})
+	return order, err
+}
+
+// DeleteOrder soft-deletes an order that has not been fulfilled yet. Its items are kept until the
+// order is purged, so a restore brings them back. It fails with etag.ErrMismatch unless the order
+// is still at the given version.
+func (s *OrderService) DeleteOrder(id, version uint) error {
+	if _, err := s.getOrder(id); err != nil {
+		if err.Error() == "order not found" {
+			return errors.New("order not found or already deleted")
+		}
+		return err
+	}
+	var collected int64
+	if err := s.DB.Model(&models.OrderItem{}).Where("order_id = ? AND sample_id IS NOT NULL", id).Count(&collected).Error; err != nil {
+		return err
+	}
+	if collected > 0 {
+		return ErrOrderStarted
+	}
+
+	return etag.Expect(deletion.At(s.DB, deletion.Stamp()), version).Delete(&models.Order{}, id).Error
+}
+
+// refreshOrder brings an order up to date in memory: collected lab items whose
+// sample has a result are marked resulted, and the order moves to in-progress or completed to
+// match its items. It returns the items that were resulted; nothing is saved.
+func (s *OrderService) refreshOrder(order *models.Order) ([]*models.OrderItem, error) {
+	if order.Status == StatusCompleted || order.Status == StatusCancelled {
+		return nil, nil
+	}
+
+	var resulted []*models.OrderItem
+	open, started := 0, false
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.Status == ItemCollected && item.SampleID != nil {
+			var sample models.Sample
+			err := s.DB.Select("id", "result").First(&sample, *item.SampleID).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			if err == nil && strings.TrimSpace(sample.Result) != "" {
+				item.Result = sample.Result
+				item.Status = ItemResulted
+				resulted = append(resulted, item)
+			}
+		}
+		switch item.Status {
+		case ItemCancelled:
+		case ItemResulted:
+			started = true
+		case ItemCollected:
+			started = true
+			open++
+		default:
+			open++
+		}
+	}
+
+	switch {
+	case open == 0:
+		now := time.Now()
+		order.Status = StatusCompleted
+		order.CompletedAt = &now
+	case started:
+		order.Status = StatusInProgress
+	}
+	return resulted, nil
+}
+
+// syncOrder refreshes an order like refreshOrder and saves the changes.
+// It reports whether anything changed.
+func (s *OrderService) syncOrder(order *models.Order) (bool, error) {
+	status := order.Status
+	resulted, err := s.refreshOrder(order)
+	if err != nil {
+		return false, err
+	}
+	if len(resulted) == 0 && order.Status == status {
+		return false, nil
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range resulted {
+			if err := tx.Model(item).Updates(map[string]interface{}{"result": item.Result, "status": ItemResulted}).Error; err != nil {
+				return err
+			}
+		}
+		if order.Status == status {
+			return nil
+		}
+		updates := map[string]interface{}{"status": order.Status}
+		if order.Status == StatusCompleted {
+			updates["completed_at"] = *order.CompletedAt
+		}
+		return tx.Model(order).Updates(updates).Error
+	})
+	return err == nil, err
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeSamples creates samples in the test database, one per order item like the sample
+// service, and fails for the sample types in failures.
+type fakeSamples struct {
+	db       *gorm.DB
+	failures map[string]bool
+	calls    int
+}
+
+func (f *fakeSamples) CreateSample(examinationID uint, sampleType string, orderID, orderItemID uint) (models.Sample, error) {
+	f.calls++
+	if f.failures[sampleType] {
+		return models.Sample{}, errors.New("sample service down")
+	}
+	var sample models.Sample
+	err := f.db.Where(models.Sample{OrderItemID: &orderItemID}).
+		Attrs(models.Sample{ExaminationID: examinationID, SampleType: sampleType, OrderID: &orderID}).
+		FirstOrCreate(&sample).Error
+	return sample, err
+}
+
+// newTestOrder opens an empty database with an order for a blood test, a urine test and a chest X-ray.
+func newTestOrder(t *testing.T) (*OrderService, *fakeSamples, models.Order) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Order{}, &models.OrderItem{}, &models.Sample{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	order := models.Order{ExaminationID: 1, Status: StatusOrdered, Priority: PriorityRoutine, Items: []models.OrderItem{
+		{Category: CategoryLab, Code: "CBC", SampleType: "blood", Status: ItemPending},
+		{Category: CategoryLab, Code: "UA", SampleType: "urine", Status: ItemPending},
+		{Category: CategoryImaging, Code: "XR-CHEST", Status: ItemPending},
+	}}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	samples := &fakeSamples{db: db}
+	s := NewOrderService(db)
+	s.Samples = samples
+	return s, samples, order
+}
+
+// storedItems returns the statuses of the order's items as saved.
+func storedItems(s *OrderService, orderID uint) []string {
+	var statuses []string
+	s.DB.Model(&models.OrderItem{}).Where("order_id = ?", orderID).Order("id").Pluck("status", &statuses)
+	return statuses
+}
+
+func TestFulfilOrderRetry(t *testing.T) {
+	s, samples, order := newTestOrder(t)
+	samples.failures = map[string]bool{"urine": true}
+
+	if _, err := s.FulfilOrder(order.ID); err == nil {
+		t.Fatal("fulfilment with a failed sample reported no error")
+	}
+	if got := storedItems(s, order.ID); got[0] != ItemCollected || got[1] != ItemPending || got[2] != ItemPending {
+		t.Fatalf("items after the failure = %v, want collected, pending, pending", got)
+	}
+
+	samples.failures = nil
+	samples.calls = 0
+	fulfilled, err := s.FulfilOrder(order.ID)
+	if err != nil {
+		t.Fatalf("retried FulfilOrder: %v", err)
+	}
+	if samples.calls != 1 {
+		t.Errorf("retry asked for %d samples, want 1 for the pending urine test", samples.calls)
+	}
+	var count int64
+	s.DB.Model(&models.Sample{}).Count(&count)
+	if count != 2 || fulfilled.Status != StatusInProgress {
+		t.Errorf("%d samples and order %s, want 2 samples and the order in progress", count, fulfilled.Status)
+	}
+}
+
+func TestResultsAreSavedBySyncNotReads(t *testing.T) {
+	s, _, order := newTestOrder(t)
+	if _, err := s.FulfilOrder(order.ID); err != nil {
+		t.Fatalf("FulfilOrder: %v", err)
+	}
+	s.DB.Model(&models.Sample{}).Where("1 = 1").Update("result", "Within normal range")
+
+	read, err := s.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	if read.Status != StatusInProgress || read.Items[0].Status != ItemResulted || read.Items[0].Result != "Within normal range" {
+		t.Errorf("read order %s with first item %+v, want the sample result shown", read.Status, read.Items[0])
+	}
+	if got := storedItems(s, order.ID); got[0] != ItemCollected || got[1] != ItemCollected {
+		t.Errorf("items after a read = %v, want the results unsaved", got)
+	}
+
+	if n, err := s.SyncOpenOrders(); err != nil || n != 1 {
+		t.Fatalf("SyncOpenOrders = %d, %v; want 1 order changed", n, err)
+	}
+	if got := storedItems(s, order.ID); got[0] != ItemResulted || got[1] != ItemResulted || got[2] != ItemPending {
+		t.Errorf("items after sync = %v, want resulted, resulted, pending", got)
+	}
+	if n, _ := s.SyncOpenOrders(); n != 0 {
+		t.Errorf("second sync changed %d orders, want 0", n)
+	}
+
+	// The X-ray result completes the order
+	completed, err := s.RecordItemResult(order.ID, order.Items[2].ID, "Clear lungs")
+	if err != nil {
+		t.Fatalf("RecordItemResult: %v", err)
+	}
+	if completed.Status != StatusCompleted || completed.CompletedAt == nil {
+		t.Errorf("order %s after the last result, want completed", completed.Status)
+	}
+}
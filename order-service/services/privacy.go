@@ -0,0 +1,41 @@
+package services
+
+import (
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"gorm.io/gorm"
+)
+
+// ExportPatientData retrieves every order of the patient's examinations with its items, deleted or not,
+// for a patient data export.
+func (s *OrderService) ExportPatientData(req privacy.Request) ([]models.Order, error) {
+	if len(req.ExaminationIDs) == 0 {
+		return []models.Order{}, nil
+	}
+	orders := []models.Order{}
+	result := s.DB.Unscoped().Preload("Items").Where("examination_id IN ?", req.ExaminationIDs).Order("id").Find(&orders)
+	return orders, result.Error
+}
+
+// ErasePatientData anonymises the orders of the patient's examinations by removing their notes
+// and the results of their items. Tests ordered and their statuses are kept.
+func (s *OrderService) ErasePatientData(req privacy.Request) (int, error) {
+	if len(req.ExaminationIDs) == 0 {
+		return 0, nil
+	}
+	var erased int
+	err := audit.Redacted(s.DB).Transaction(func(tx *gorm.DB) error {
+		orders := tx.Unscoped().Model(&models.Order{}).Select("id").Where("examination_id IN ?", req.ExaminationIDs)
+		err := tx.Model(&models.OrderItem{}).Where("order_id IN (?) AND result <> ''", orders).
+			Update("result", privacy.ErasedText).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Model(&models.Order{}).Where("examination_id IN ?", req.ExaminationIDs).
+			Update("notes", privacy.ErasedText)
+		erased = int(result.RowsAffected)
+		return result.Error
+	})
+	return erased, err
+}
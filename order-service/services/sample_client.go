@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/models"
+)
+
+// SampleClient creates samples in the sample service.
+type SampleClient interface {
+	CreateSample(examinationID uint, sampleType string, orderID, orderItemID uint) (models.Sample, error)
+}
+
+// KafkaSampleClient creates samples by sending requests to the sample service over Kafka.
+type KafkaSampleClient struct {
+	Timeout time.Duration
+}
+
+// NewKafkaSampleClient creates a sample client with a default timeout.
+func NewKafkaSampleClient() *KafkaSampleClient {
+	return &KafkaSampleClient{Timeout: 15 * time.Second}
+}
+
+// CreateSample sends POST /api/samples for an order item.
+// The sample service de-duplicates on orderItemId, so a retry after a lost response
+// returns the sample already created instead of a second one.
+func (k *KafkaSampleClient) CreateSample(examinationID uint, sampleType string, orderID, orderItemID uint) (models.Sample, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"examinationId": examinationID,
+		"sampleType":    sampleType,
+		"orderId":       orderID,
+		"orderItemId":   orderItemID,
+	})
+	if err != nil {
+		return models.Sample{}, err
+	}
+
+	resp, err := kafka.SendRequest("samples", kafka.KafkaRequest{
+		Method:  "POST",
+		Path:    "/",
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    body,
+	}, k.Timeout)
+	if err != nil {
+		return models.Sample{}, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return models.Sample{}, fmt.Errorf("sample service returned status %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	var sample models.Sample
+	if err := json.Unmarshal(resp.Body, &sample); err != nil {
+		return models.Sample{}, fmt.Errorf("failed to decode sample: %w", err)
+	}
+	return sample, nil
+}
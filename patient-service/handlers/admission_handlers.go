@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/gin-gonic/gin"
+)
+
+// AdmissionHandler holds the admission service.
+type AdmissionHandler struct {
+	Service *services.AdmissionService
+}
+
+// NewAdmissionHandler creates a new AdmissionHandler.
+func NewAdmissionHandler(s *services.AdmissionService) *AdmissionHandler {
+	return &AdmissionHandler{Service: s}
+}
+
+type AdmitPatientRequest struct {
+	PatientID               uint   `json:"patientId" binding:"required"`
+	Ward                    string `json:"ward" binding:"required"`
+	Bed                     string `json:"bed"`
+	Reason                  string `json:"reason"`
+	AdmittedBy              string `json:"admittedBy"`
+	AdmittingPractitionerID *uint  `json:"admittingPractitionerId"`
+}
+
+type TransferPatientRequest struct {
+	Ward   string `json:"ward" binding:"required"`
+	Bed    string `json:"bed"`
+	Reason string `json:"reason"`
+}
+
+type DischargePatientRequest struct {
+	DischargeSummary string `json:"dischargeSummary"`
+}
+
+// AdmitPatient handles POST /api/patients/admit
+func (h *AdmissionHandler) AdmitPatient(c *gin.Context) {
+	var req AdmitPatientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	admission, err := h.Service.AdmitPatient(req.PatientID, req.Ward, req.Bed, req.Reason, req.AdmittedBy, req.AdmittingPractitionerID)
+	if err != nil {
+		writeAdmissionError(c, "Failed to admit patient", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(admission.Version))
+	c.JSON(http.StatusCreated, admission)
+}
+
+// GetCensus handles GET /api/patients/admit?ward=
+func (h *AdmissionHandler) GetCensus(c *gin.Context) {
+	admissions, err := h.Service.GetCensus(c.Query("ward"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve census: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, admissions)
+}
+
+// TransferPatient handles POST /api/patients/admit/:patientId/transfer
+func (h *AdmissionHandler) TransferPatient(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("patientId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID format"})
+		return
+	}
+
+	var req TransferPatientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	admission, err := h.Service.TransferPatient(uint(patientID), req.Ward, req.Bed, req.Reason)
+	if err != nil {
+		writeAdmissionError(c, "Failed to transfer patient", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(admission.Version))
+	c.JSON(http.StatusOK, admission)
+}
+
+// DischargePatient handles DELETE /api/patients/admit/:patientId
+// The body with a discharge summary is optional. The If-Match header must hold the open
+// admission's current ETag.
+func (h *AdmissionHandler) DischargePatient(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Param("patientId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req DischargePatientRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	admission, err := h.Service.DischargePatient(uint(patientID), version, req.DischargeSummary)
+	if err != nil {
+		writeAdmissionError(c, "Failed to discharge patient", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(admission.Version))
+	c.JSON(http.StatusOK, admission)
+}
+
+// GetPatientAdmissions handles GET /api/patients/:id/admissions
+func (h *AdmissionHandler) GetPatientAdmissions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	admissions, err := h.Service.GetAdmissionsByPatientID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve admissions: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, admissions)
+}
+
+// writeAdmissionError maps service errors to status codes.
+func writeAdmissionError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "patient not found", err.Error() == "patient is not admitted":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyAdmitted), errors.Is(err, services.ErrBedOccupied):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err.Error() == "ward is required", err.Error() == "patient is already in this ward and bed":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, practitioners.ErrNotFound), errors.Is(err, practitioners.ErrInactive):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid admitting practitioner: " + err.Error()})
+	case errors.Is(err, practitioners.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify practitioner: " + err.Error()})
+	case errors.Is(err, etag.ErrMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
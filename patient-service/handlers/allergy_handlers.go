@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"github.com/gin-gonic/gin"
+)
+
+// AllergyRequest records an allergy
+type AllergyRequest struct {
+	Substance    string     `json:"substance" binding:"required"`
+	Reaction     string     `json:"reaction"`
+	Severity     string     `json:"severity"`     // mild, moderate, severe or unknown (default)
+	Verification string     `json:"verification"` // unconfirmed (default), confirmed or refuted
+	Status       string     `json:"status"`       // active (default) or inactive
+	OnsetDate    *time.Time `json:"onsetDate"`
+	RecordedBy   string     `json:"recordedBy"`
+	Notes        string     `json:"notes"`
+}
+
+// UpdateAllergyRequest changes part of an allergy; omitted fields are left as they are
+type UpdateAllergyRequest struct {
+	Substance    *string    `json:"substance"`
+	Reaction     *string    `json:"reaction"`
+	Severity     *string    `json:"severity"`
+	Verification *string    `json:"verification"`
+	Status       *string    `json:"status"`
+	OnsetDate    *time.Time `json:"onsetDate"`
+	Notes        *string    `json:"notes"`
+}
+
+// GetAllergies handles GET /api/patients/:id/allergies?status=&verification=&severity=&substance=&sort=&limit=&offset=&cursor=
+// Other services use it to check a patient's allergies over Kafka. Allergies are not restricted
+// by consent, as prescribing safety checks depend on them.
+func (h *PatientHandler) GetAllergies(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetAllergies(uint(id), params)
+	if err != nil {
+		writeClinicalError(c, "Failed to retrieve allergies", err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetAllergy handles GET /api/patients/:id/allergies/:allergyId
+func (h *PatientHandler) GetAllergy(c *gin.Context) {
+	id, allergyID, ok := parseSubrecordIDs(c, "allergyId", "allergy")
+	if !ok {
+		return
+	}
+
+	allergy, err := h.Service.GetAllergy(id, allergyID)
+	if err != nil {
+		writeClinicalError(c, "Failed to retrieve allergy", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(allergy.Version))
+	c.JSON(http.StatusOK, allergy)
+}
+
+// AddAllergy handles POST /api/patients/:id/allergies
+func (h *PatientHandler) AddAllergy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req AllergyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	allergy, err := h.Service.AddAllergy(uint(id), models.Allergy{
+		Substance:    req.Substance,
+		Reaction:     req.Reaction,
+		Severity:     req.Severity,
+		Verification: req.Verification,
+		Status:       req.Status,
+		OnsetDate:    req.OnsetDate,
+		RecordedBy:   req.RecordedBy,
+		Notes:        req.Notes,
+	})
+	if err != nil {
+		writeClinicalError(c, "Failed to add allergy", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(allergy.Version))
+	c.JSON(http.StatusCreated, allergy)
+}
+
+// UpdateAllergy handles PUT and PATCH /api/patients/:id/allergies/:allergyId
+// The If-Match header must hold the allergy's current ETag.
+func (h *PatientHandler) UpdateAllergy(c *gin.Context) {
+	id, allergyID, ok := parseSubrecordIDs(c, "allergyId", "allergy")
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAllergyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	allergy, err := h.Service.UpdateAllergy(id, allergyID, version, services.AllergyUpdate{
+		Substance:    req.Substance,
+		Reaction:     req.Reaction,
+		Severity:     req.Severity,
+		Verification: req.Verification,
+		Status:       req.Status,
+		OnsetDate:    req.OnsetDate,
+		Notes:        req.Notes,
+	})
+	if err != nil {
+		writeClinicalError(c, "Failed to update allergy", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(allergy.Version))
+	c.JSON(http.StatusOK, allergy)
+}
+
+// RemoveAllergy handles DELETE /api/patients/:id/allergies/:allergyId
+// The If-Match header must hold the allergy's current ETag.
+func (h *PatientHandler) RemoveAllergy(c *gin.Context) {
+	id, allergyID, ok := parseSubrecordIDs(c, "allergyId", "allergy")
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.RemoveAllergy(id, allergyID, version); err != nil {
+		writeClinicalError(c, "Failed to remove allergy", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// parseSubrecordIDs parses the patient ID and the ID of one of their records,
+// writing a 400 response when either is malformed.
+func parseSubrecordIDs(c *gin.Context, key, name string) (uint, uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return 0, 0, false
+	}
+	recordID, err := strconv.ParseUint(c.Param(key), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + " ID format"})
+		return 0, 0, false
+	}
+	return uint(id), uint(recordID), true
+}
+
+// writeClinicalError maps allergy and condition service errors to status codes.
+func writeClinicalError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "patient not found", err.Error() == "allergy not found", err.Error() == "condition not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAllergyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidAllergy), errors.Is(err, services.ErrInvalidCondition), errors.Is(err, query.ErrInvalidQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, etag.ErrMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
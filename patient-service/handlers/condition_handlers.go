@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"github.com/gin-gonic/gin"
+)
+
+// ConditionRequest adds a condition to the problem list
+type ConditionRequest struct {
+	Code         string     `json:"code"` // code or description is required
+	CodeSystem   string     `json:"codeSystem"`
+	Description  string     `json:"description"`
+	Status       string     `json:"status"` // active (default), recurrence, remission or resolved
+	OnsetDate    *time.Time `json:"onsetDate"`
+	ResolvedDate *time.Time `json:"resolvedDate"`
+	RecordedBy   string     `json:"recordedBy"`
+	Notes        string     `json:"notes"`
+}
+
+// UpdateConditionRequest changes part of a condition; omitted fields are left as they are
+type UpdateConditionRequest struct {
+	Code         *string    `json:"code"`
+	CodeSystem   *string    `json:"codeSystem"`
+	Description  *string    `json:"description"`
+	Status       *string    `json:"status"`
+	OnsetDate    *time.Time `json:"onsetDate"`
+	ResolvedDate *time.Time `json:"resolvedDate"`
+	Notes        *string    `json:"notes"`
+}
+
+// GetConditions handles GET /api/patients/:id/conditions?status=&code=&codeSystem=&description=&onsetFrom=&onsetTo=&sort=&limit=&offset=&cursor=
+func (h *PatientHandler) GetConditions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkConsent(c, uint(id), consent.ScopeConditions) {
+		return
+	}
+	page, err := h.Service.GetConditions(uint(id), params)
+	if err != nil {
+		writeClinicalError(c, "Failed to retrieve conditions", err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetCondition handles GET /api/patients/:id/conditions/:conditionId
+func (h *PatientHandler) GetCondition(c *gin.Context) {
+	id, conditionID, ok := parseSubrecordIDs(c, "conditionId", "condition")
+	if !ok {
+		return
+	}
+
+	if !h.checkConsent(c, id, consent.ScopeConditions) {
+		return
+	}
+	condition, err := h.Service.GetCondition(id, conditionID)
+	if err != nil {
+		writeClinicalError(c, "Failed to retrieve condition", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(condition.Version))
+	c.JSON(http.StatusOK, condition)
+}
+
+// AddCondition handles POST /api/patients/:id/conditions
+func (h *PatientHandler) AddCondition(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req ConditionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	condition, err := h.Service.AddCondition(uint(id), models.Condition{
+		Code:         req.Code,
+		CodeSystem:   req.CodeSystem,
+		Description:  req.Description,
+		Status:       req.Status,
+		OnsetDate:    req.OnsetDate,
+		ResolvedDate: req.ResolvedDate,
+		RecordedBy:   req.RecordedBy,
+		Notes:        req.Notes,
+	})
+	if err != nil {
+		writeClinicalError(c, "Failed to add condition", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(condition.Version))
+	c.JSON(http.StatusCreated, condition)
+}
+
+// UpdateCondition handles PUT and PATCH /api/patients/:id/conditions/:conditionId
+// The If-Match header must hold the condition's current ETag.
+func (h *PatientHandler) UpdateCondition(c *gin.Context) {
+	id, conditionID, ok := parseSubrecordIDs(c, "conditionId", "condition")
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateConditionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	condition, err := h.Service.UpdateCondition(id, conditionID, version, services.ConditionUpdate{
+		Code:         req.Code,
+		CodeSystem:   req.CodeSystem,
+		Description:  req.Description,
+		Status:       req.Status,
+		OnsetDate:    req.OnsetDate,
+		ResolvedDate: req.ResolvedDate,
+		Notes:        req.Notes,
+	})
+	if err != nil {
+		writeClinicalError(c, "Failed to update condition", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(condition.Version))
+	c.JSON(http.StatusOK, condition)
+}
+
+// RemoveCondition handles DELETE /api/patients/:id/conditions/:conditionId
+// The If-Match header must hold the condition's current ETag.
+func (h *PatientHandler) RemoveCondition(c *gin.Context) {
+	id, conditionID, ok := parseSubrecordIDs(c, "conditionId", "condition")
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.RemoveCondition(id, conditionID, version); err != nil {
+		writeClinicalError(c, "Failed to remove condition", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
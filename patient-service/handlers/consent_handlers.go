@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"github.com/gin-gonic/gin"
+)
+
+// ConsentRequest records a consent directive
+type ConsentRequest struct {
+	Decision   string     `json:"decision" binding:"required"` // permit or deny
+	Scope      string     `json:"scope"`                       // demographics, conditions, examinations, chart, or * (default)
+	Purpose    string     `json:"purpose"`                     // e.g. treatment; empty applies to any purpose
+	Grantee    string     `json:"grantee" binding:"required"`  // a user ID, "role:<role>", or *
+	ValidFrom  time.Time  `json:"validFrom"`                   // defaults to now
+	ValidUntil *time.Time `json:"validUntil"`
+	RecordedBy string     `json:"recordedBy"`
+}
+
+// RevokeConsentRequest ends a consent
+type RevokeConsentRequest struct {
+	RevokedBy string `json:"revokedBy" binding:"required"`
+	Reason    string `json:"reason"`
+}
+
+// GetConsents handles GET /api/patients/:id/consents?decision=&scope=&purpose=&grantee=&active=&sort=&limit=&offset=&cursor=
+func (h *PatientHandler) GetConsents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetConsents(uint(id), params)
+	if err != nil {
+		writeConsentError(c, "Failed to retrieve consents", err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetConsent handles GET /api/patients/:id/consents/:consentId
+func (h *PatientHandler) GetConsent(c *gin.Context) {
+	id, consentID, ok := parseSubrecordIDs(c, "consentId", "consent")
+	if !ok {
+		return
+	}
+
+	record, err := h.Service.GetConsent(id, consentID)
+	if err != nil {
+		writeConsentError(c, "Failed to retrieve consent", err)
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// AddConsent handles POST /api/patients/:id/consents
+func (h *PatientHandler) AddConsent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req ConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	record, err := h.Service.AddConsent(uint(id), models.Consent{
+		Decision:   req.Decision,
+		Scope:      req.Scope,
+		Purpose:    req.Purpose,
+		Grantee:    req.Grantee,
+		ValidFrom:  req.ValidFrom,
+		ValidUntil: req.ValidUntil,
+		RecordedBy: req.RecordedBy,
+	})
+	if err != nil {
+		writeConsentError(c, "Failed to add consent", err)
+		return
+	}
+	c.JSON(http.StatusCreated, record)
+}
+
+// RevokeConsent handles POST /api/patients/:id/consents/:consentId/revoke
+func (h *PatientHandler) RevokeConsent(c *gin.Context) {
+	id, consentID, ok := parseSubrecordIDs(c, "consentId", "consent")
+	if !ok {
+		return
+	}
+
+	var req RevokeConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	record, err := h.Service.RevokeConsent(id, consentID, req.RevokedBy, req.Reason)
+	if err != nil {
+		writeConsentError(c, "Failed to revoke consent", err)
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// checkConsent checks the caller identified by the request headers against the
+// patient's consents. When the read is refused it writes the response and returns false.
+func (h *PatientHandler) checkConsent(c *gin.Context, patientID uint, scope string) bool {
+	err := h.Consent.Check(patientID, scope, consent.IdentityFromHeaders(c.Request.Header))
+	if err == nil {
+		return true
+	}
+	var denied *consent.DeniedError
+	if errors.As(err, &denied) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": denied.Reason})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check consent: " + err.Error()})
+	}
+	return false
+}
+
+// writeConsentError maps service errors to status codes.
+func writeConsentError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "patient not found", err.Error() == "consent not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrConsentRevoked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidConsent), errors.Is(err, query.ErrInvalidQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/gin-gonic/gin"
+)
+
+// EmergencyContactRequest adds an emergency contact, or one entry of a replacement list
+type EmergencyContactRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Relationship string `json:"relationship"` // e.g. spouse, parent, friend
+	Phone        string `json:"phone" binding:"required"`
+	Email        string `json:"email"`
+	Priority     int    `json:"priority"` // 1 is called first; defaults to last
+}
+
+func (r EmergencyContactRequest) toModel() models.EmergencyContact {
+	return models.EmergencyContact{Name: r.Name, Relationship: r.Relationship, Phone: r.Phone, Email: r.Email, Priority: r.Priority}
+}
+
+// UpdateEmergencyContactRequest changes part of an emergency contact; omitted fields are left as they are
+type UpdateEmergencyContactRequest struct {
+	Name         *string `json:"name"`
+	Relationship *string `json:"relationship"`
+	Phone        *string `json:"phone"`
+	Email        *string `json:"email"`
+	Priority     *int    `json:"priority"`
+}
+
+// toContactModels converts contact requests to models.
+func toContactModels(requests []EmergencyContactRequest) []models.EmergencyContact {
+	contacts := make([]models.EmergencyContact, len(requests))
+	for i, r := range requests {
+		contacts[i] = r.toModel()
+	}
+	return contacts
+}
+
+// GetEmergencyContacts handles GET /api/patients/:id/contacts
+func (h *PatientHandler) GetEmergencyContacts(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if !h.checkConsent(c, uint(id), consent.ScopeDemographics) {
+		return
+	}
+	contacts, err := h.Service.GetEmergencyContacts(uint(id))
+	if err != nil {
+		writePatientError(c, "Failed to retrieve emergency contacts", err)
+		return
+	}
+	c.JSON(http.StatusOK, contacts)
+}
+
+// AddEmergencyContact handles POST /api/patients/:id/contacts
+func (h *PatientHandler) AddEmergencyContact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req EmergencyContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	contact, err := h.Service.AddEmergencyContact(uint(id), req.toModel())
+	if err != nil {
+		writePatientError(c, "Failed to add emergency contact", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(contact.Version))
+	c.JSON(http.StatusCreated, contact)
+}
+
+// UpdateEmergencyContact handles PUT and PATCH /api/patients/:id/contacts/:contactId
+// The If-Match header must hold the contact's current ETag.
+func (h *PatientHandler) UpdateEmergencyContact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	contactID, err := strconv.ParseUint(c.Param("contactId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateEmergencyContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	contact, err := h.Service.UpdateEmergencyContact(uint(id), uint(contactID), version, services.ContactUpdate{
+		Name:         req.Name,
+		Relationship: req.Relationship,
+		Phone:        req.Phone,
+		Email:        req.Email,
+		Priority:     req.Priority,
+	})
+	if err != nil {
+		writePatientError(c, "Failed to update emergency contact", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(contact.Version))
+	c.JSON(http.StatusOK, contact)
+}
+
+// RemoveEmergencyContact handles DELETE /api/patients/:id/contacts/:contactId
+// The If-Match header must hold the contact's current ETag.
+func (h *PatientHandler) RemoveEmergencyContact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	contactID, err := strconv.ParseUint(c.Param("contactId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.RemoveEmergencyContact(uint(id), uint(contactID), version); err != nil {
+		writePatientError(c, "Failed to remove emergency contact", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/gin-gonic/gin"
+)
+
+// IdentifierRequest registers an external identifier such as a national ID or insurance number
+type IdentifierRequest struct {
+	Type   string `json:"type"` // national-id, insurance, passport or other (default)
+	System string `json:"system" binding:"required"`
+	Value  string `json:"value" binding:"required"`
+	Issuer string `json:"issuer"`
+}
+
+func (r IdentifierRequest) toModel() models.PatientIdentifier {
+	return models.PatientIdentifier{Type: r.Type, System: r.System, Value: r.Value, Issuer: r.Issuer}
+}
+
+// GetPatientByIdentifier handles GET /api/patients/by-identifier?system=&value=
+// system "mrn" looks the patient up by medical record number.
+func (h *PatientHandler) GetPatientByIdentifier(c *gin.Context) {
+	patient, err := h.Service.FindByIdentifier(c.Query("system"), c.Query("value"))
+	if err != nil {
+		writeIdentifierError(c, "Failed to retrieve patient", err)
+		return
+	}
+	if !h.checkConsent(c, patient.ID, consent.ScopeDemographics) {
+		return
+	}
+	c.JSON(http.StatusOK, patient)
+}
+
+// GetIdentifiers handles GET /api/patients/:id/identifiers
+func (h *PatientHandler) GetIdentifiers(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if !h.checkConsent(c, uint(id), consent.ScopeDemographics) {
+		return
+	}
+	identifiers, err := h.Service.GetIdentifiers(uint(id))
+	if err != nil {
+		writeIdentifierError(c, "Failed to retrieve identifiers", err)
+		return
+	}
+	c.JSON(http.StatusOK, identifiers)
+}
+
+// AddIdentifier handles POST /api/patients/:id/identifiers
+func (h *PatientHandler) AddIdentifier(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req IdentifierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	identifier, err := h.Service.AddIdentifier(uint(id), req.toModel())
+	if err != nil {
+		writeIdentifierError(c, "Failed to add identifier", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(identifier.Version))
+	c.JSON(http.StatusCreated, identifier)
+}
+
+// RemoveIdentifier handles DELETE /api/patients/:id/identifiers/:identifierId
+// The If-Match header must hold the identifier's current ETag.
+func (h *PatientHandler) RemoveIdentifier(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	identifierID, err := strconv.ParseUint(c.Param("identifierId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identifier ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.RemoveIdentifier(uint(id), uint(identifierID), version); err != nil {
+		writeIdentifierError(c, "Failed to remove identifier", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeIdentifierError maps service errors to status codes.
+func writeIdentifierError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "patient not found", err.Error() == "identifier not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrIdentifierTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidIdentifier):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, etag.ErrMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
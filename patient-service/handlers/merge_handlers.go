@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/query"
+	"github.com/gin-gonic/gin"
+)
+
+// MergeHandler holds the merge service.
+type MergeHandler struct {
+	Service *services.MergeService
+}
+
+// NewMergeHandler creates a new MergeHandler.
+func NewMergeHandler(s *services.MergeService) *MergeHandler {
+	return &MergeHandler{Service: s}
+}
+
+type MergePatientsRequest struct {
+	SurvivorID  uint   `json:"survivorId" binding:"required"`
+	DuplicateID uint   `json:"duplicateId" binding:"required"`
+	Reason      string `json:"reason" binding:"required"`
+	MergedBy    string `json:"mergedBy" binding:"required"`
+}
+
+type UndoMergeRequest struct {
+	UndoneBy string `json:"undoneBy" binding:"required"`
+}
+
+// MergePatients handles POST /api/patients/merges
+func (h *MergeHandler) MergePatients(c *gin.Context) {
+	var req MergePatientsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	merge, err := h.Service.MergePatients(req.SurvivorID, req.DuplicateID, req.Reason, req.MergedBy)
+	if err != nil {
+		writeMergeError(c, "Failed to merge patients", err)
+		return
+	}
+	c.JSON(http.StatusCreated, merge)
+}
+
+// GetMerges handles GET /api/patients/merges?patientId=&survivorId=&duplicateId=&undone=&sort=&limit=&offset=&cursor=
+func (h *MergeHandler) GetMerges(c *gin.Context) {
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetMerges(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve merges: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetMerge handles GET /api/patients/merges/:id
+func (h *MergeHandler) GetMerge(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	merge, err := h.Service.GetMergeByID(uint(id))
+	if err != nil {
+		writeMergeError(c, "Failed to retrieve merge", err)
+		return
+	}
+	c.JSON(http.StatusOK, merge)
+}
+
+// UndoMerge handles POST /api/patients/merges/:id/undo
+func (h *MergeHandler) UndoMerge(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req UndoMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	merge, err := h.Service.UndoMerge(uint(id), req.UndoneBy)
+	if err != nil {
+		writeMergeError(c, "Failed to undo merge", err)
+		return
+	}
+	c.JSON(http.StatusOK, merge)
+}
+
+// writeMergeError maps service errors to status codes.
+func writeMergeError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "merge not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err.Error() == "survivor not found", err.Error() == "duplicate not found":
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case err.Error() == "a patient cannot be merged into itself":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyMerged), errors.Is(err, services.ErrMergeUndone), errors.Is(err, services.ErrMergeBlocked),
+		errors.Is(err, services.ErrBothAdmitted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRecordsUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": action + ": " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
 	"github.com/gin-gonic/gin"
 	// Import gorm for error checking if needed, though better handled in service
 )
@@ -13,6 +19,9 @@ import (
 // PatientHandler holds the patient service.
 type PatientHandler struct {
 	Service *services.PatientService
+
+	// Consent enforces patients' consents on reads; nil allows every read
+	Consent *consent.Enforcer
 }
 
 // NewPatientHandler creates a new PatientHandler.
@@ -26,23 +35,100 @@ type CreatePatientRequest struct {
 	LastName  string    `json:"lastName" binding:"required"`
 	BirthDate time.Time `json:"birthDate" binding:"required"` // Remove strict format requirement
 	Details   string    `json:"details"`
+
+	// Demographics, all optional
+	Sex               string                    `json:"sex"` // female, male, other or unknown
+	Gender            string                    `json:"gender"`
+	Address           models.Address            `json:"address"`
+	Phone             string                    `json:"phone"`
+	Email             string                    `json:"email"`
+	PreferredLanguage string                    `json:"preferredLanguage"` // e.g. "en" or "pt-BR"
+	EmergencyContacts []EmergencyContactRequest `json:"emergencyContacts"`
+
+	Identifiers []IdentifierRequest `json:"identifiers"` // optional external identifiers
+
+	// Set to create the patient even though likely duplicates were reported
+	AllowDuplicate bool `json:"allowDuplicate"`
 }
 
+// UpdatePatientRequest is a partial update: omitted fields keep their current values,
+// and an empty string clears an optional field.
 type UpdatePatientRequest struct {
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	BirthDate time.Time `json:"birthDate"` // Remove strict format requirement
-	Details   string    `json:"details"`
+	FirstName         *string         `json:"firstName"`
+	LastName          *string         `json:"lastName"`
+	BirthDate         *time.Time      `json:"birthDate"` // Remove strict format requirement
+	Details           *string         `json:"details"`
+	Sex               *string         `json:"sex"`
+	Gender            *string         `json:"gender"`
+	Address           *AddressRequest `json:"address"`
+	Phone             *string         `json:"phone"`
+	Email             *string         `json:"email"`
+	PreferredLanguage *string         `json:"preferredLanguage"`
+
+	// When present, replaces all emergency contacts; use /:id/contacts to change just one
+	EmergencyContacts *[]EmergencyContactRequest `json:"emergencyContacts"`
+}
+
+// AddressRequest changes part of an address; omitted fields are left as they are
+type AddressRequest struct {
+	Line1      *string `json:"line1"`
+	Line2      *string `json:"line2"`
+	City       *string `json:"city"`
+	PostalCode *string `json:"postalCode"`
+	Region     *string `json:"region"`
+	Country    *string `json:"country"` // ISO 3166-1 alpha-2
+}
+
+func (r UpdatePatientRequest) toUpdate() services.PatientUpdate {
+	update := services.PatientUpdate{
+		FirstName:         r.FirstName,
+		LastName:          r.LastName,
+		BirthDate:         r.BirthDate,
+		Details:           r.Details,
+		Sex:               r.Sex,
+		Gender:            r.Gender,
+		Phone:             r.Phone,
+		Email:             r.Email,
+		PreferredLanguage: r.PreferredLanguage,
+	}
+	if a := r.Address; a != nil {
+		update.Address = &services.AddressUpdate{
+			Line1: a.Line1, Line2: a.Line2, City: a.City, PostalCode: a.PostalCode, Region: a.Region, Country: a.Country,
+		}
+	}
+	if r.EmergencyContacts != nil {
+		contacts := toContactModels(*r.EmergencyContacts)
+		update.EmergencyContacts = &contacts
+	}
+	return update
 }
 
-// GetPatients handles GET /api/patients
+// GetPatients handles GET /api/patients?mrn=&merged=&name=&q=&bornFrom=&bornTo=&sort=&limit=&offset=&cursor=
+// It returns one page of patients with the total match count.
 func (h *PatientHandler) GetPatients(c *gin.Context) {
-	patients, err := h.Service.GetPatients()
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Patients whose consents refuse the caller are left out before paging
+	refused, err := h.Consent.Refused(consent.ScopeDemographics, consent.IdentityFromHeaders(c.Request.Header))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check consent: " + err.Error()})
+		return
+	}
+
+	page, err := h.Service.SearchPatients(params, refused)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve patients: " + err.Error()})
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve patients: " + err.Error()})
+		}
 		return
 	}
-	c.JSON(http.StatusOK, patients)
+	c.JSON(http.StatusOK, page)
 }
 
 // GetPatient handles GET /api/patients/:id
@@ -62,7 +148,11 @@ func (h *PatientHandler) GetPatient(c *gin.Context) {
 		}
 		return
 	}
+	if !h.checkConsent(c, patient.ID, consent.ScopeDemographics) {
+		return
+	}
 
+	c.Header(etag.HeaderETag, etag.Format(patient.Version))
 	c.JSON(http.StatusOK, patient)
 }
 
@@ -81,21 +171,76 @@ func (h *PatientHandler) CreatePatient(c *gin.Context) {
 		return
 	}
 
-	patient, err := h.Service.CreatePatient(req.FirstName, req.LastName, req.Details, &req.BirthDate)
+	identifiers := make([]models.PatientIdentifier, len(req.Identifiers))
+	for i, identifier := range req.Identifiers {
+		identifiers[i] = identifier.toModel()
+	}
+
+	patient := models.Patient{
+		FirstName:         req.FirstName,
+		LastName:          req.LastName,
+		BirthDate:         &req.BirthDate,
+		Details:           req.Details,
+		Sex:               req.Sex,
+		Gender:            req.Gender,
+		Address:           req.Address,
+		Phone:             req.Phone,
+		Email:             req.Email,
+		PreferredLanguage: req.PreferredLanguage,
+		EmergencyContacts: toContactModels(req.EmergencyContacts),
+	}
+
+	// Likely duplicates are reported; the client confirms by resubmitting with allowDuplicate
+	created, err := h.Service.CreatePatient(patient, identifiers, req.AllowDuplicate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create patient: " + err.Error()})
+		var duplicate *services.DuplicateError
+		if errors.As(err, &duplicate) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "possible duplicate patient; resubmit with allowDuplicate to create anyway",
+				"candidates": duplicate.Candidates,
+			})
+			return
+		}
+		writePatientError(c, "Failed to create patient", err)
 		return
 	}
-	c.JSON(http.StatusCreated, patient)
+	c.Header(etag.HeaderETag, etag.Format(created.Version))
+	c.JSON(http.StatusCreated, created)
 }
 
-// UpdatePatient handles PUT /api/patients/:id
+// GetDuplicates handles GET /api/patients/:id/duplicates
+func (h *PatientHandler) GetDuplicates(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	candidates, err := h.Service.FindDuplicatesOf(uint(id))
+	if err != nil {
+		if err.Error() == "patient not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for duplicates: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, candidates)
+}
+
+// UpdatePatient handles PUT and PATCH /api/patients/:id
+// Both are partial: only the fields present in the body change.
+// The If-Match header must hold the patient's current ETag.
 func (h *PatientHandler) UpdatePatient(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
 	var req UpdatePatientRequest
 	// Use BindJSON here, as fields are optional for update
@@ -104,37 +249,104 @@ func (h *PatientHandler) UpdatePatient(c *gin.Context) {
 		return
 	}
 
-	updatedPatient, err := h.Service.UpdatePatient(uint(id), req.FirstName, req.LastName, req.Details, req.BirthDate)
+	updatedPatient, err := h.Service.UpdatePatient(uint(id), version, req.toUpdate())
 	if err != nil {
-		if err.Error() == "patient not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update patient: " + err.Error()})
-		}
+		writePatientError(c, "Failed to update patient", err)
 		return
 	}
 
+	c.Header(etag.HeaderETag, etag.Format(updatedPatient.Version))
 	c.JSON(http.StatusOK, updatedPatient)
 }
 
 // DeletePatient handles DELETE /api/patients/:id
+// The If-Match header must hold the patient's current ETag.
 func (h *PatientHandler) DeletePatient(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
-	err = h.Service.DeletePatient(uint(id))
+	err = h.Service.DeletePatient(uint(id), version)
 	if err != nil {
 		// Check for specific "not found" error from service
 		if err.Error() == "patient not found or already deleted" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete patient: " + err.Error()})
+			writeDeletionError(c, "Failed to delete patient", err)
 		}
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
+
+// RestorePatient handles POST /api/patients/:id/restore
+// The examinations, appointments, chart notes and admissions deleted along with the patient come back too.
+func (h *PatientHandler) RestorePatient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	patient, err := h.Service.RestorePatient(uint(id))
+	if err != nil {
+		if err.Error() == "patient not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			writeDeletionError(c, "Failed to restore patient", err)
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(patient.Version))
+	c.JSON(http.StatusOK, patient)
+}
+
+// writeDeletionError maps errors from deleting and restoring patients to status codes.
+func writeDeletionError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, deletion.ErrBlocked), errors.Is(err, deletion.ErrNotDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, etag.ErrMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, deletion.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": action + ": " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
+
+// writePatientError maps service errors to status codes.
+func writePatientError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "emergency contact not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidPatient):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPatientErased):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeIdentifierError(c, action, err)
+	}
+}
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
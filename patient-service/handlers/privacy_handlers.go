@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"github.com/gin-gonic/gin"
+)
+
+// PrivacyHandler holds the privacy service.
+type PrivacyHandler struct {
+	Service *services.PrivacyService
+}
+
+// NewPrivacyHandler creates a new PrivacyHandler.
+func NewPrivacyHandler(s *services.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{Service: s}
+}
+
+// RetentionHoldRequest places a retention hold
+type RetentionHoldRequest struct {
+	Scope    string     `json:"scope"` // a dataset, e.g. patient, admissions or chart, or * (default)
+	Reason   string     `json:"reason" binding:"required"`
+	PlacedBy string     `json:"placedBy" binding:"required"`
+	Until    *time.Time `json:"until"` // open-ended when empty
+}
+
+// ReleaseHoldRequest lifts a retention hold
+type ReleaseHoldRequest struct {
+	ReleasedBy string `json:"releasedBy" binding:"required"`
+}
+
+// ErasePatientRequest asks for a patient's data to be erased
+type ErasePatientRequest struct {
+	RequestedBy string `json:"requestedBy" binding:"required"`
+	Reason      string `json:"reason"`
+}
+
+// ExportPatient handles GET /api/patients/:id/export?format=json|zip
+func (h *PrivacyHandler) ExportPatient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	bundle, err := h.Service.ExportPatient(uint(id))
+	if err != nil {
+		writePrivacyError(c, "Failed to export patient data", err)
+		return
+	}
+	if format == "json" {
+		c.JSON(http.StatusOK, bundle)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.WriteZip(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write export: " + err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="patient-%d-export.zip"`, id))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// GetHolds handles GET /api/patients/:id/holds
+func (h *PrivacyHandler) GetHolds(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	holds, err := h.Service.GetHolds(uint(id))
+	if err != nil {
+		writePrivacyError(c, "Failed to retrieve retention holds", err)
+		return
+	}
+	c.JSON(http.StatusOK, holds)
+}
+
+// PlaceHold handles POST /api/patients/:id/holds
+func (h *PrivacyHandler) PlaceHold(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req RetentionHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	hold, err := h.Service.PlaceHold(uint(id), models.RetentionHold{
+		Scope:    req.Scope,
+		Reason:   req.Reason,
+		PlacedBy: req.PlacedBy,
+		Until:    req.Until,
+	})
+	if err != nil {
+		writePrivacyError(c, "Failed to place retention hold", err)
+		return
+	}
+	c.JSON(http.StatusCreated, hold)
+}
+
+// ReleaseHold handles POST /api/patients/:id/holds/:holdId/release
+func (h *PrivacyHandler) ReleaseHold(c *gin.Context) {
+	id, holdID, ok := parseSubrecordIDs(c, "holdId", "retention hold")
+	if !ok {
+		return
+	}
+
+	var req ReleaseHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	hold, err := h.Service.ReleaseHold(id, holdID, req.ReleasedBy)
+	if err != nil {
+		writePrivacyError(c, "Failed to release retention hold", err)
+		return
+	}
+	c.JSON(http.StatusOK, hold)
+}
+
+// ErasePatient handles POST /api/patients/:id/erase
+func (h *PrivacyHandler) ErasePatient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req ErasePatientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	erasure, err := h.Service.ErasePatient(uint(id), req.RequestedBy, req.Reason)
+	switch {
+	case errors.Is(err, services.ErrErasureFailed):
+		// The record says which datasets failed; the erasure can be requested again
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "erasure": erasure})
+	case err != nil:
+		writePrivacyError(c, "Failed to erase patient data", err)
+	default:
+		c.JSON(http.StatusOK, erasure)
+	}
+}
+
+// GetErasures handles GET /api/patients/:id/erasures
+func (h *PrivacyHandler) GetErasures(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	erasures, err := h.Service.GetErasures(uint(id))
+	if err != nil {
+		writePrivacyError(c, "Failed to retrieve erasures", err)
+		return
+	}
+	c.JSON(http.StatusOK, erasures)
+}
+
+// GetErasure handles GET /api/patients/:id/erasures/:erasureId
+func (h *PrivacyHandler) GetErasure(c *gin.Context) {
+	id, erasureID, ok := parseSubrecordIDs(c, "erasureId", "erasure")
+	if !ok {
+		return
+	}
+
+	erasure, err := h.Service.GetErasure(id, erasureID)
+	if err != nil {
+		writePrivacyError(c, "Failed to retrieve erasure", err)
+		return
+	}
+	c.JSON(http.StatusOK, erasure)
+}
+
+// writePrivacyError maps service errors to status codes.
+func writePrivacyError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "patient not found", err.Error() == "retention hold not found", err.Error() == "erasure not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyErased), errors.Is(err, services.ErrHoldReleased):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidHold):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, privacy.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": action + ": " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
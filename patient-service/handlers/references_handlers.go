@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/fitnis/shared/references"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckReference handles POST /api/patients/references/check
+// Other services call it before creating records that reference a patient.
+func (h *PatientHandler) CheckReference(c *gin.Context) {
+	var req references.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	result, err := h.Service.CheckReference(req.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check patient: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
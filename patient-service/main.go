@@ -12,8 +12,14 @@ import (
 
 	"github.com/fitnis/patient-service/handlers"
 	"github.com/fitnis/patient-service/services"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/consent"
 	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
 	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/privacy"
+	"github.com/fitnis/shared/references"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,31 +28,126 @@ func main() {
 	database.InitDB()
 	db := database.DB
 
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "patients")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
 	// Initialize services and handlers
 	patientService := services.NewPatientService(db)
+	patientService.Dependents.Client = deletion.NewKafkaClient()
 	patientHandler := handlers.NewPatientHandler(patientService)
+	patientHandler.Consent = consent.NewEnforcer(db)
+	if n, err := patientService.AssignMissingMRNs(); err != nil {
+		log.Fatalf("Failed to assign MRNs: %v", err)
+	} else if n > 0 {
+		log.Printf("Assigned MRNs to %d existing patients", n)
+	}
+	admissionService := services.NewAdmissionService(db)
+	admissionService.Practitioners = practitioners.NewKafkaDirectory()
+	admissionHandler := handlers.NewAdmissionHandler(admissionService)
+	mergeService := services.NewMergeService(db)
+	mergeService.Examinations = services.NewKafkaReassignClient("examinations", "examinationIds")
+	mergeService.Appointments = services.NewKafkaReassignClient("appointments", "appointmentIds")
+	mergeService.ChartNotes = services.NewKafkaReassignClient("records", "chartNoteIds")
+	mergeHandler := handlers.NewMergeHandler(mergeService)
+	privacyService := services.NewPrivacyService(db, patientService)
+	privacyService.Data = privacy.NewKafkaClient()
+	privacyHandler := handlers.NewPrivacyHandler(privacyService)
+
+	// Purge patients soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, privacyService.PurgeDeleted)
 
 	// Start Kafka consumer
 	log.Println("Starting Kafka consumer")
-	kafka.StartKafkaConsumer("patients", func(req kafka.KafkaRequest) kafka.KafkaResponse {
-		return handleKafkaRequest(req, patientHandler)
-	})
+	kafka.StartKafkaConsumer("patients", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
+		return handleKafkaRequest(req, patientHandler, admissionHandler, mergeHandler, privacyHandler)
+	}))
 
 	// Block main goroutine
 	select {}
 }
 
 // handleKafkaRequest processes Kafka requests and returns responses
-func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PatientHandler) kafka.KafkaResponse {
+func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PatientHandler, admissionHandler *handlers.AdmissionHandler, mergeHandler *handlers.MergeHandler, privacyHandler *handlers.PrivacyHandler) kafka.KafkaResponse {
 	// Create a mock gin context to reuse our handler functions
 	c, w := createMockGinContext(req)
 
 	// Route the request based on path and method
-	path := req.Path
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
 	if path == "" {
 		path = "/"
 	}
 
+	// Admissions live under /admit and are keyed by patient ID
+	if path == "/admit" || strings.HasPrefix(path, "/admit/") {
+		parts := strings.Split(strings.Trim(path, "/"), "/")
+		if len(parts) >= 2 {
+			if _, err := strconv.ParseUint(parts[1], 10, 32); err != nil {
+				return createErrorResponse(req.RequestID, http.StatusBadRequest, "Invalid patient ID format")
+			}
+			c.Params = append(c.Params, gin.Param{Key: "patientId", Value: parts[1]})
+		}
+		switch {
+		case req.Method == "GET" && len(parts) == 1:
+			admissionHandler.GetCensus(c)
+		case req.Method == "POST" && len(parts) == 1:
+			admissionHandler.AdmitPatient(c)
+		case req.Method == "DELETE" && len(parts) == 2:
+			admissionHandler.DischargePatient(c)
+		case req.Method == "POST" && len(parts) == 3 && parts[2] == "transfer":
+			admissionHandler.TransferPatient(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Merges live under /merges[/:id[/undo]]
+	if path == "/merges" || strings.HasPrefix(path, "/merges/") {
+		parts := strings.Split(strings.Trim(path, "/"), "/")
+		if len(parts) >= 2 {
+			if _, err := strconv.ParseUint(parts[1], 10, 32); err != nil {
+				return createErrorResponse(req.RequestID, http.StatusBadRequest, "Invalid ID format")
+			}
+			c.Params = append(c.Params, gin.Param{Key: "id", Value: parts[1]})
+		}
+		switch {
+		case req.Method == "GET" && len(parts) == 1:
+			mergeHandler.GetMerges(c)
+		case req.Method == "POST" && len(parts) == 1:
+			mergeHandler.MergePatients(c)
+		case req.Method == "GET" && len(parts) == 2:
+			mergeHandler.GetMerge(c)
+		case req.Method == "POST" && len(parts) == 3 && parts[2] == "undo":
+			mergeHandler.UndoMerge(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Reference checks from other services have no patient ID in the path
+	if path == references.CheckPath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		handler.CheckReference(c)
+		return createResponse(req.RequestID, w)
+	}
+
+	// Identifier lookup has no patient ID in the path
+	if path == "/by-identifier" {
+		if req.Method != "GET" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		handler.GetPatientByIdentifier(c)
+		return createResponse(req.RequestID, w)
+	}
+
 	// Extract ID from path if present
 	var id uint64
 	var err error
@@ -58,16 +159,158 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PatientHandler
 		}
 	}
 
+	// Sub-records live under /:id/<collection>[/:recordId]: identifiers, emergency contacts,
+	// allergies, the problem list, consents, retention holds and erasure records
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	isIdentifiersPath := len(parts) >= 2 && parts[1] == "identifiers"
+	if isIdentifiersPath && len(parts) == 3 {
+		c.Params = append(c.Params, gin.Param{Key: "identifierId", Value: parts[2]})
+	}
+	isContactsPath := len(parts) >= 2 && parts[1] == "contacts"
+	if isContactsPath && len(parts) == 3 {
+		c.Params = append(c.Params, gin.Param{Key: "contactId", Value: parts[2]})
+	}
+	isAllergiesPath := len(parts) >= 2 && parts[1] == "allergies"
+	if isAllergiesPath && len(parts) == 3 {
+		c.Params = append(c.Params, gin.Param{Key: "allergyId", Value: parts[2]})
+	}
+	isConditionsPath := len(parts) >= 2 && parts[1] == "conditions"
+	if isConditionsPath && len(parts) == 3 {
+		c.Params = append(c.Params, gin.Param{Key: "conditionId", Value: parts[2]})
+	}
+	isConsentsPath := len(parts) >= 2 && parts[1] == "consents"
+	if isConsentsPath && len(parts) >= 3 {
+		c.Params = append(c.Params, gin.Param{Key: "consentId", Value: parts[2]})
+	}
+
+	isHoldsPath := len(parts) >= 2 && parts[1] == "holds"
+	if isHoldsPath && len(parts) >= 3 {
+		c.Params = append(c.Params, gin.Param{Key: "holdId", Value: parts[2]})
+	}
+	isErasuresPath := len(parts) >= 2 && parts[1] == "erasures"
+	if isErasuresPath && len(parts) == 3 {
+		c.Params = append(c.Params, gin.Param{Key: "erasureId", Value: parts[2]})
+	}
+
 	// Route to appropriate handler
 	switch {
+	case isIdentifiersPath && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		switch {
+		case req.Method == "GET" && len(parts) == 2:
+			handler.GetIdentifiers(c)
+		case req.Method == "POST" && len(parts) == 2:
+			handler.AddIdentifier(c)
+		case req.Method == "DELETE" && len(parts) == 3:
+			handler.RemoveIdentifier(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+	case isContactsPath && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		switch {
+		case req.Method == "GET" && len(parts) == 2:
+			handler.GetEmergencyContacts(c)
+		case req.Method == "POST" && len(parts) == 2:
+			handler.AddEmergencyContact(c)
+		case (req.Method == "PUT" || req.Method == "PATCH") && len(parts) == 3:
+			handler.UpdateEmergencyContact(c)
+		case req.Method == "DELETE" && len(parts) == 3:
+			handler.RemoveEmergencyContact(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+	case isAllergiesPath && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		switch {
+		case req.Method == "GET" && len(parts) == 2:
+			handler.GetAllergies(c)
+		case req.Method == "POST" && len(parts) == 2:
+			handler.AddAllergy(c)
+		case req.Method == "GET" && len(parts) == 3:
+			handler.GetAllergy(c)
+		case (req.Method == "PUT" || req.Method == "PATCH") && len(parts) == 3:
+			handler.UpdateAllergy(c)
+		case req.Method == "DELETE" && len(parts) == 3:
+			handler.RemoveAllergy(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+	case isConditionsPath && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		switch {
+		case req.Method == "GET" && len(parts) == 2:
+			handler.GetConditions(c)
+		case req.Method == "POST" && len(parts) == 2:
+			handler.AddCondition(c)
+		case req.Method == "GET" && len(parts) == 3:
+			handler.GetCondition(c)
+		case (req.Method == "PUT" || req.Method == "PATCH") && len(parts) == 3:
+			handler.UpdateCondition(c)
+		case req.Method == "DELETE" && len(parts) == 3:
+			handler.RemoveCondition(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+	case isConsentsPath && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		switch {
+		case req.Method == "GET" && len(parts) == 2:
+			handler.GetConsents(c)
+		case req.Method == "POST" && len(parts) == 2:
+			handler.AddConsent(c)
+		case req.Method == "GET" && len(parts) == 3:
+			handler.GetConsent(c)
+		case req.Method == "POST" && len(parts) == 4 && parts[3] == "revoke":
+			handler.RevokeConsent(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+	case isHoldsPath && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		switch {
+		case req.Method == "GET" && len(parts) == 2:
+			privacyHandler.GetHolds(c)
+		case req.Method == "POST" && len(parts) == 2:
+			privacyHandler.PlaceHold(c)
+		case req.Method == "POST" && len(parts) == 4 && parts[3] == "release":
+			privacyHandler.ReleaseHold(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+	case isErasuresPath && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		switch {
+		case req.Method == "GET" && len(parts) == 2:
+			privacyHandler.GetErasures(c)
+		case req.Method == "GET" && len(parts) == 3:
+			privacyHandler.GetErasure(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+	case req.Method == "GET" && id > 0 && len(parts) == 2 && parts[1] == "export":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		privacyHandler.ExportPatient(c)
+	case req.Method == "POST" && id > 0 && len(parts) == 2 && parts[1] == "erase":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		privacyHandler.ErasePatient(c)
+	case req.Method == "POST" && id > 0 && len(parts) == 2 && parts[1] == "restore":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.RestorePatient(c)
 	case req.Method == "GET" && path == "/":
 		handler.GetPatients(c)
+	case req.Method == "GET" && id > 0 && strings.HasSuffix(path, "/duplicates"):
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.GetDuplicates(c)
+	case req.Method == "GET" && id > 0 && strings.HasSuffix(path, "/admissions"):
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		admissionHandler.GetPatientAdmissions(c)
 	case req.Method == "GET" && id > 0:
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
 		handler.GetPatient(c)
 	case req.Method == "POST" && path == "/":
 		handler.CreatePatient(c)
-	case req.Method == "PUT" && id > 0:
+	case (req.Method == "PUT" || req.Method == "PATCH") && id > 0:
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
 		handler.UpdatePatient(c)
 	case req.Method == "DELETE" && id > 0:
@@ -78,14 +321,7 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PatientHandler
 	}
 
 	// Create response from the written data
-	return kafka.KafkaResponse{
-		RequestID:  req.RequestID,
-		StatusCode: w.Code,
-		Headers: map[string]string{
-			"Content-Type": w.Header().Get("Content-Type"),
-		},
-		Body: w.Body.Bytes(),
-	}
+	return createResponse(req.RequestID, w)
 }
 
 // Helper functions
@@ -112,6 +348,15 @@ func extractIDFromPath(path string) string {
 	return ""
 }
 
+func createResponse(requestID string, w *httptest.ResponseRecorder) kafka.KafkaResponse {
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
 func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
 	errorJSON, _ := json.Marshal(gin.H{"error": message})
 	return kafka.KafkaResponse{
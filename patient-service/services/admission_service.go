@@ -0,0 +1,189 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"gorm.io/gorm"
+)
+
+// ErrAlreadyAdmitted is returned when admitting a patient who already has an open admission.
+var ErrAlreadyAdmitted = errors.New("patient already has an open admission")
+
+// ErrBedOccupied is returned when the ward and bed are held by another open admission.
+var ErrBedOccupied = errors.New("bed is occupied")
+
+// AdmissionService handles database operations for inpatient admissions.
+type AdmissionService struct {
+	DB *gorm.DB
+
+	// Practitioners validates the admitting practitioner
+	Practitioners practitioners.Directory
+}
+
+// NewAdmissionService creates a new AdmissionService.
+func NewAdmissionService(db *gorm.DB) *AdmissionService {
+	return &AdmissionService{DB: db}
+}
+
+// AdmitPatient opens an admission for the patient.
+func (s *AdmissionService) AdmitPatient(patientID uint, ward, bed, reason, admittedBy string, practitionerID *uint) (models.Admission, error) {
+	if strings.TrimSpace(ward) == "" {
+		return models.Admission{}, errors.New("ward is required")
+	}
+	practitioner, err := practitioners.Resolve(s.Practitioners, practitionerID)
+	if err != nil {
+		return models.Admission{}, err
+	}
+	if practitioner != nil && admittedBy == "" {
+		admittedBy = practitioner.FullName()
+	}
+
+	admission := models.Admission{
+		PatientID:               patientID,
+		Ward:                    ward,
+		Bed:                     bed,
+		AdmittingPractitionerID: practitionerID,
+		AdmittedBy:              admittedBy,
+		Reason:                  reason,
+		AdmittedAt:              time.Now(),
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Patient{}).Where("id = ?", patientID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("patient not found")
+		}
+		if _, found, err := openAdmission(tx, patientID); err != nil {
+			return err
+		} else if found {
+			return ErrAlreadyAdmitted
+		}
+		if err := checkBedFree(tx, ward, bed, 0); err != nil {
+			return err
+		}
+		// The partial unique index on open admissions backs up the check above
+		return tx.Create(&admission).Error
+	})
+	return admission, err
+}
+
+// TransferPatient moves the patient's open admission to another ward or bed.
+func (s *AdmissionService) TransferPatient(patientID uint, ward, bed, reason string) (models.Admission, error) {
+	if strings.TrimSpace(ward) == "" {
+		return models.Admission{}, errors.New("ward is required")
+	}
+
+	var admission models.Admission
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var found bool
+		var err error
+		admission, found, err = openAdmission(tx, patientID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("patient is not admitted")
+		}
+		if admission.Ward == ward && admission.Bed == bed {
+			return errors.New("patient is already in this ward and bed")
+		}
+		if err := checkBedFree(tx, ward, bed, admission.ID); err != nil {
+			return err
+		}
+
+		transfer := models.AdmissionTransfer{
+			AdmissionID:   admission.ID,
+			FromWard:      admission.Ward,
+			FromBed:       admission.Bed,
+			ToWard:        ward,
+			ToBed:         bed,
+			Reason:        reason,
+			TransferredAt: time.Now(),
+		}
+		if err := tx.Create(&transfer).Error; err != nil {
+			return err
+		}
+		admission.Ward = ward
+		admission.Bed = bed
+		if err := tx.Model(&admission).Updates(map[string]interface{}{"ward": ward, "bed": bed}).Error; err != nil {
+			return err
+		}
+		return tx.Preload("Transfers", func(db *gorm.DB) *gorm.DB { return db.Order("transferred_at") }).
+			First(&admission, admission.ID).Error
+	})
+	return admission, err
+}
+
+// DischargePatient closes the patient's open admission. It fails with etag.ErrMismatch
+// unless the admission is still at the given version.
+func (s *AdmissionService) DischargePatient(patientID, version uint, summary string) (models.Admission, error) {
+	var admission models.Admission
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var found bool
+		var err error
+		admission, found, err = openAdmission(tx, patientID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("patient is not admitted")
+		}
+		now := time.Now()
+		admission.DischargedAt = &now
+		admission.DischargeSummary = summary
+		return etag.Expect(tx, version).Model(&admission).Updates(map[string]interface{}{"discharged_at": now, "discharge_summary": summary}).Error
+	})
+	return admission, err
+}
+
+// GetCensus retrieves the open admissions, optionally for one ward, ordered by ward and bed.
+func (s *AdmissionService) GetCensus(ward string) ([]models.Admission, error) {
+	var admissions []models.Admission
+	db := s.DB.Preload("Patient").Where("discharged_at IS NULL")
+	if ward != "" {
+		db = db.Where("ward = ?", ward)
+	}
+	result := db.Order("ward, bed").Find(&admissions)
+	return admissions, result.Error
+}
+
+// GetAdmissionsByPatientID retrieves a patient's admission history, newest first.
+func (s *AdmissionService) GetAdmissionsByPatientID(patientID uint) ([]models.Admission, error) {
+	var admissions []models.Admission
+	result := s.DB.Preload("Transfers", func(db *gorm.DB) *gorm.DB { return db.Order("transferred_at") }).
+		Where("patient_id = ?", patientID).Order("admitted_at DESC").Find(&admissions)
+	return admissions, result.Error
+}
+
+// openAdmission loads the patient's open admission, if there is one.
+func openAdmission(tx *gorm.DB, patientID uint) (models.Admission, bool, error) {
+	var admission models.Admission
+	result := tx.Where("patient_id = ? AND discharged_at IS NULL", patientID).Limit(1).Find(&admission)
+	return admission, result.RowsAffected > 0, result.Error
+}
+
+// checkBedFree checks that no other open admission holds the ward and bed.
+// An empty bed means "unassigned" and never conflicts.
+func checkBedFree(tx *gorm.DB, ward, bed string, exceptAdmissionID uint) error {
+	if bed == "" {
+		return nil
+	}
+	var count int64
+	err := tx.Model(&models.Admission{}).
+		Where("ward = ? AND bed = ? AND discharged_at IS NULL AND id <> ?", ward, bed, exceptAdmissionID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrBedOccupied
+	}
+	return nil
+}
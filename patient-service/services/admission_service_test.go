@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newAdmissionService opens an empty database, with the etag callbacks, holding patients 1 to 3.
+func newAdmissionService(t *testing.T) *AdmissionService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Patient{}, &models.Admission{}, &models.AdmissionTransfer{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := etag.Register(db); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	for _, p := range []models.Patient{{ID: 1, MRN: "MRN-1"}, {ID: 2, MRN: "MRN-2"}, {ID: 3, MRN: "MRN-3"}} {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create patient: %v", err)
+		}
+	}
+	return NewAdmissionService(db)
+}
+
+func TestAdmitPatient(t *testing.T) {
+	s := newAdmissionService(t)
+	if _, err := s.AdmitPatient(1, "Cardiology", "4", "chest pain", "Dr. Grey", nil); err != nil {
+		t.Fatalf("AdmitPatient: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		patientID uint
+		ward, bed string
+		wantErr   error
+	}{
+		{"already admitted", 1, "Surgery", "1", ErrAlreadyAdmitted},
+		{"bed occupied", 2, "Cardiology", "4", ErrBedOccupied},
+		{"same bed number on another ward", 2, "Surgery", "4", nil},
+		{"unassigned bed never conflicts", 3, "Cardiology", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.AdmitPatient(tt.patientID, tt.ward, tt.bed, "", "", nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := s.AdmitPatient(99, "Cardiology", "5", "", "", nil); err == nil || err.Error() != "patient not found" {
+		t.Errorf("unknown patient: got %v, want patient not found", err)
+	}
+
+	census, err := s.GetCensus("Cardiology")
+	if err != nil {
+		t.Fatalf("GetCensus: %v", err)
+	}
+	if len(census) != 2 || census[0].Bed != "" || census[1].Bed != "4" {
+		t.Errorf("census = %+v, want the unassigned bed, then bed 4", census)
+	}
+}
+
+func TestTransferAndDischarge(t *testing.T) {
+	s := newAdmissionService(t)
+	s.AdmitPatient(1, "Cardiology", "4", "", "", nil)
+	s.AdmitPatient(2, "Surgery", "1", "", "", nil)
+
+	if _, err := s.TransferPatient(1, "Surgery", "1", "post-op"); !errors.Is(err, ErrBedOccupied) {
+		t.Errorf("transfer to an occupied bed: got %v, want ErrBedOccupied", err)
+	}
+	admission, err := s.TransferPatient(1, "Surgery", "2", "post-op")
+	if err != nil {
+		t.Fatalf("TransferPatient: %v", err)
+	}
+	if admission.Ward != "Surgery" || admission.Bed != "2" || len(admission.Transfers) != 1 || admission.Transfers[0].FromBed != "4" {
+		t.Errorf("got %+v, want bed 2 on Surgery with one transfer from bed 4", admission)
+	}
+
+	if _, err := s.DischargePatient(1, 1, "recovered"); !errors.Is(err, etag.ErrMismatch) {
+		t.Errorf("discharge at the admission's first version: got %v, want etag.ErrMismatch", err)
+	}
+	if _, err := s.DischargePatient(1, 2, "recovered"); err != nil {
+		t.Fatalf("DischargePatient: %v", err)
+	}
+	if _, err := s.TransferPatient(1, "Cardiology", "4", ""); err == nil {
+		t.Error("transferred a discharged patient")
+	}
+
+	// The bed is free and the patient can be admitted again
+	if _, err := s.AdmitPatient(3, "Surgery", "2", "", "", nil); err != nil {
+		t.Errorf("admitting to the freed bed: %v", err)
+	}
+	if _, err := s.AdmitPatient(1, "Cardiology", "4", "", "", nil); err != nil {
+		t.Errorf("readmitting the discharged patient: %v", err)
+	}
+	history, _ := s.GetAdmissionsByPatientID(1)
+	if len(history) != 2 || history[1].DischargedAt == nil {
+		t.Errorf("history has %d admissions, want the open one and the discharged one", len(history))
+	}
+}
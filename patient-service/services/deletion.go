@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+)
+
+// RestorePatient brings back a soft-deleted patient along with the records deleted with them.
+func (s *PatientService) RestorePatient(id uint) (models.Patient, error) {
+	var patient models.Patient
+	result := s.DB.Unscoped().Limit(1).Find(&patient, id)
+	if result.Error != nil {
+		return models.Patient{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Patient{}, errors.New("patient not found")
+	}
+	if !patient.DeletedAt.Valid {
+		return models.Patient{}, deletion.ErrNotDeleted
+	}
+
+	at := patient.DeletedAt.Time
+	ids := []uint{id}
+	if err := restoreLocal(s.DB, ids, at); err != nil {
+		return models.Patient{}, err
+	}
+	if err := s.Dependents.Restore(ids, at); err != nil {
+		// Delete the patient again so the restore can be retried as a whole
+		if undoErr := deleteLocal(s.DB, ids, at); undoErr != nil {
+			return models.Patient{}, fmt.Errorf("%w; the patient stays restored: %v", err, undoErr)
+		}
+		return models.Patient{}, err
+	}
+	return s.GetPatientByID(id)
+}
+
+// deleteLocal soft-deletes patients with their admissions, stamped with the given time.
+func deleteLocal(db *gorm.DB, ids []uint, at time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := deletion.SoftDelete(tx, &models.Patient{}, "id", ids, at); err != nil {
+			return err
+		}
+		_, err := deletion.SoftDelete(tx, &models.Admission{}, "patient_id", ids, at)
+		return err
+	})
+}
+
+// restoreLocal brings back patients deleted at the given time with the admissions deleted along with them.
+func restoreLocal(db *gorm.DB, ids []uint, at time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := deletion.Restore(tx, &models.Patient{}, "id", ids, at); err != nil {
+			return err
+		}
+		_, err := deletion.Restore(tx, &models.Admission{}, "patient_id", ids, at)
+		return err
+	})
+}
+
+// PurgeDeleted permanently deletes the patients soft-deleted before the cutoff, with their
+// emergency contacts, allergies, conditions, consents and external identifiers, and the admissions
+// soft-deleted before the cutoff. Patients under a retention hold on their record, or on their
+// admissions, keep them until the hold is released or expires.
+func (s *PrivacyService) PurgeDeleted(cutoff time.Time) (int, error) {
+	admissions, err := s.purgeAdmissions(cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	held := deletion.HeldPatients(s.DB, DatasetPatient)
+	var ids []uint
+	err = s.DB.Unscoped().Model(&models.Patient{}).
+		Where("deleted_at < ? AND id NOT IN (?)", cutoff, held).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return admissions, err
+	}
+
+	err = audit.System(s.DB, deletion.PurgeJob).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.PatientIdentifier{}, &models.EmergencyContact{}, &models.Allergy{}, &models.Condition{}, &models.Consent{}} {
+			if err := tx.Where("patient_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&models.Patient{}, ids).Error
+	})
+	if err != nil {
+		return admissions, err
+	}
+	return admissions + len(ids), nil
+}
+
+// purgeAdmissions permanently deletes the admissions soft-deleted before the cutoff, with their transfers.
+func (s *PrivacyService) purgeAdmissions(cutoff time.Time) (int, error) {
+	var purged int
+	err := audit.System(s.DB, deletion.PurgeJob).Transaction(func(tx *gorm.DB) error {
+		held := deletion.HeldPatients(tx, DatasetAdmissions)
+		expired := tx.Unscoped().Model(&models.Admission{}).Select("id").
+			Where("deleted_at < ? AND patient_id NOT IN (?)", cutoff, held)
+		if err := tx.Where("admission_id IN (?)", expired).Delete(&models.AdmissionTransfer{}).Error; err != nil {
+			return err
+		}
+		var err error
+		purged, err = deletion.Purge(tx, cutoff, &models.Admission{}, "patient_id", held)
+		return err
+	})
+	return purged, err
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Administrative sex values.
+const (
+	SexFemale  = "female"
+	SexMale    = "male"
+	SexOther   = "other"
+	SexUnknown = "unknown"
+)
+
+// ErrInvalidPatient is returned when patient or emergency contact details fail validation.
+var ErrInvalidPatient = errors.New("invalid patient details")
+
+var (
+	// phoneDigits matches a phone number once spaces and punctuation are removed
+	phoneDigits = regexp.MustCompile(`^\+?[0-9]{6,15}$`)
+	// languageTag matches simple BCP 47 tags such as "en", "pt-BR" or "zh-Hant-TW"
+	languageTag = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+	countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// PatientUpdate holds the fields to change on a patient; nil fields are left as they are,
+// and a pointer to "" clears an optional field.
+type PatientUpdate struct {
+	FirstName         *string
+	LastName          *string
+	BirthDate         *time.Time
+	Details           *string
+	Sex               *string
+	Gender            *string
+	Phone             *string
+	Email             *string
+	PreferredLanguage *string
+	Address           *AddressUpdate
+
+	// EmergencyContacts, when set, replaces the whole list
+	EmergencyContacts *[]models.EmergencyContact
+}
+
+// AddressUpdate holds the address fields to change; nil fields are left as they are.
+type AddressUpdate struct {
+	Line1      *string
+	Line2      *string
+	City       *string
+	PostalCode *string
+	Region     *string
+	Country    *string
+}
+
+// ContactUpdate holds the emergency contact fields to change; nil fields are left as they are.
+type ContactUpdate struct {
+	Name         *string
+	Relationship *string
+	Phone        *string
+	Email        *string
+	Priority     *int
+}
+
+// IsValidSex reports whether s is a known administrative sex value.
+func IsValidSex(s string) bool {
+	return s == SexFemale || s == SexMale || s == SexOther || s == SexUnknown
+}
+
+// NormalizePhone strips spaces and punctuation from a phone number and checks what is left:
+// 6 to 15 digits with an optional leading +.
+func NormalizePhone(phone string) (string, error) {
+	normalized := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '/':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+	if !phoneDigits.MatchString(normalized) {
+		return "", fmt.Errorf("%w: %q is not a valid phone number", ErrInvalidPatient, phone)
+	}
+	return normalized, nil
+}
+
+// NormalizeEmail trims and lower-cases an email address and checks it is a bare address.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	parsed, err := mail.ParseAddress(email)
+	if err != nil || parsed.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", fmt.Errorf("%w: %q is not a valid email address", ErrInvalidPatient, email)
+	}
+	return strings.ToLower(email), nil
+}
+
+// validatePatient checks and normalizes a patient's demographics and contacts.
+func validatePatient(patient *models.Patient) error {
+	patient.FirstName = strings.TrimSpace(patient.FirstName)
+	patient.LastName = strings.TrimSpace(patient.LastName)
+	if patient.FirstName == "" || patient.LastName == "" {
+		return fmt.Errorf("%w: first and last name are required", ErrInvalidPatient)
+	}
+
+	patient.Sex = strings.ToLower(strings.TrimSpace(patient.Sex))
+	if patient.Sex != "" && !IsValidSex(patient.Sex) {
+		return fmt.Errorf("%w: sex must be female, male, other or unknown", ErrInvalidPatient)
+	}
+	patient.Gender = strings.TrimSpace(patient.Gender)
+
+	var err error
+	if patient.Phone = strings.TrimSpace(patient.Phone); patient.Phone != "" {
+		if patient.Phone, err = NormalizePhone(patient.Phone); err != nil {
+			return err
+		}
+	}
+	if patient.Email = strings.TrimSpace(patient.Email); patient.Email != "" {
+		if patient.Email, err = NormalizeEmail(patient.Email); err != nil {
+			return err
+		}
+	}
+	if patient.PreferredLanguage = strings.TrimSpace(patient.PreferredLanguage); patient.PreferredLanguage != "" &&
+		!languageTag.MatchString(patient.PreferredLanguage) {
+		return fmt.Errorf("%w: %q is not a valid language tag", ErrInvalidPatient, patient.PreferredLanguage)
+	}
+
+	patient.Address.Country = strings.ToUpper(strings.TrimSpace(patient.Address.Country))
+	if patient.Address.Country != "" && !countryCode.MatchString(patient.Address.Country) {
+		return fmt.Errorf("%w: country must be a two-letter code", ErrInvalidPatient)
+	}
+
+	for i := range patient.EmergencyContacts {
+		if err := validateContact(&patient.EmergencyContacts[i]); err != nil {
+			return err
+		}
+		if patient.EmergencyContacts[i].Priority == 0 {
+			patient.EmergencyContacts[i].Priority = i + 1
+		}
+	}
+	return nil
+}
+
+// validateContact checks and normalizes an emergency contact. A contact needs a name and a phone number.
+func validateContact(contact *models.EmergencyContact) error {
+	contact.Name = strings.TrimSpace(contact.Name)
+	contact.Relationship = strings.ToLower(strings.TrimSpace(contact.Relationship))
+	if contact.Name == "" {
+		return fmt.Errorf("%w: emergency contact name is required", ErrInvalidPatient)
+	}
+	if strings.TrimSpace(contact.Phone) == "" {
+		return fmt.Errorf("%w: emergency contact phone is required", ErrInvalidPatient)
+	}
+	var err error
+	if contact.Phone, err = NormalizePhone(contact.Phone); err != nil {
+		return err
+	}
+	if contact.Email = strings.TrimSpace(contact.Email); contact.Email != "" {
+		if contact.Email, err = NormalizeEmail(contact.Email); err != nil {
+			return err
+		}
+	}
+	if contact.Priority < 0 {
+		return fmt.Errorf("%w: emergency contact priority must be positive", ErrInvalidPatient)
+	}
+	return nil
+}
+
+// apply copies the set fields of the update onto the patient.
+func (u PatientUpdate) apply(patient *models.Patient) {
+	setString(&patient.FirstName, u.FirstName)
+	setString(&patient.LastName, u.LastName)
+	if u.BirthDate != nil {
+		patient.BirthDate = u.BirthDate
+	}
+	setString(&patient.Details, u.Details)
+	setString(&patient.Sex, u.Sex)
+	setString(&patient.Gender, u.Gender)
+	setString(&patient.Phone, u.Phone)
+	setString(&patient.Email, u.Email)
+	setString(&patient.PreferredLanguage, u.PreferredLanguage)
+	if a := u.Address; a != nil {
+		setString(&patient.Address.Line1, a.Line1)
+		setString(&patient.Address.Line2, a.Line2)
+		setString(&patient.Address.City, a.City)
+		setString(&patient.Address.PostalCode, a.PostalCode)
+		setString(&patient.Address.Region, a.Region)
+		setString(&patient.Address.Country, a.Country)
+	}
+	if u.EmergencyContacts != nil {
+		patient.EmergencyContacts = *u.EmergencyContacts
+	}
+}
+
+func setString(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// GetEmergencyContacts retrieves a patient's emergency contacts in call order.
+func (s *PatientService) GetEmergencyContacts(patientID uint) ([]models.EmergencyContact, error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return nil, err
+	}
+	contacts := []models.EmergencyContact{}
+	result := s.DB.Where("patient_id = ?", patientID).Order("priority, id").Find(&contacts)
+	return contacts, result.Error
+}
+
+// AddEmergencyContact adds an emergency contact, last in call order unless a priority is given.
+func (s *PatientService) AddEmergencyContact(patientID uint, contact models.EmergencyContact) (models.EmergencyContact, error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return models.EmergencyContact{}, err
+	}
+	if err := validateContact(&contact); err != nil {
+		return models.EmergencyContact{}, err
+	}
+	if contact.Priority == 0 {
+		var last int
+		if err := s.DB.Model(&models.EmergencyContact{}).Where("patient_id = ?", patientID).
+			Select("COALESCE(MAX(priority), 0)").Scan(&last).Error; err != nil {
+			return models.EmergencyContact{}, err
+		}
+		contact.Priority = last + 1
+	}
+	contact.ID = 0
+	contact.PatientID = patientID
+	result := s.DB.Create(&contact)
+	return contact, result.Error
+}
+
+// UpdateEmergencyContact changes the set fields of one of a patient's emergency contacts.
+// It fails with etag.ErrMismatch unless the contact is still at the given version.
+func (s *PatientService) UpdateEmergencyContact(patientID, contactID, version uint, update ContactUpdate) (models.EmergencyContact, error) {
+	var contact models.EmergencyContact
+	result := s.DB.Where("id = ? AND patient_id = ?", contactID, patientID).Limit(1).Find(&contact)
+	if result.Error != nil {
+		return models.EmergencyContact{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.EmergencyContact{}, errors.New("emergency contact not found")
+	}
+
+	setString(&contact.Name, update.Name)
+	setString(&contact.Relationship, update.Relationship)
+	setString(&contact.Phone, update.Phone)
+	setString(&contact.Email, update.Email)
+	if update.Priority != nil {
+		contact.Priority = *update.Priority
+	}
+	if err := validateContact(&contact); err != nil {
+		return models.EmergencyContact{}, err
+	}
+	result = etag.Expect(s.DB, version).Save(&contact)
+	return contact, result.Error
+}
+
+// RemoveEmergencyContact deletes one of a patient's emergency contacts. It fails with
+// etag.ErrMismatch unless the contact is still at the given version.
+func (s *PatientService) RemoveEmergencyContact(patientID, contactID, version uint) error {
+	err := etag.Expect(s.DB, version).Where("id = ? AND patient_id = ?", contactID, patientID).Delete(&models.EmergencyContact{}).Error
+	if errors.Is(err, etag.ErrMismatch) {
+		return missingOrChanged(s.DB, &models.EmergencyContact{}, patientID, contactID, "emergency contact not found")
+	}
+	return err
+}
+
+// replaceEmergencyContacts swaps a patient's emergency contacts for a new list.
+func replaceEmergencyContacts(tx *gorm.DB, patientID uint, contacts []models.EmergencyContact) error {
+	if err := tx.Where("patient_id = ?", patientID).Delete(&models.EmergencyContact{}).Error; err != nil {
+		return err
+	}
+	for i := range contacts {
+		contacts[i].ID = 0
+		contacts[i].PatientID = patientID
+	}
+	if len(contacts) == 0 {
+		return nil
+	}
+	return tx.Omit(clause.Associations).Create(&contacts).Error
+}
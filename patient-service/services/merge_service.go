@@ -0,0 +1,349 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"gorm.io/gorm"
+)
+
+// ErrAlreadyMerged is returned when either record in a merge has already been merged into another patient.
+var ErrAlreadyMerged = errors.New("patient record is already merged")
+
+// ErrMergeUndone is returned when undoing a merge a second time.
+var ErrMergeUndone = errors.New("merge has already been undone")
+
+// ErrMergeBlocked is returned when undoing a merge whose survivor has since been merged itself.
+var ErrMergeBlocked = errors.New("survivor has since been merged into another patient; undo that merge first")
+
+// ErrBothAdmitted is returned when a merge or undo would give a patient two open admissions.
+var ErrBothAdmitted = errors.New("both records have an open admission; discharge one first")
+
+// ErrRecordsUnavailable is returned when a service owning patient records cannot reassign them.
+var ErrRecordsUnavailable = errors.New("record service unavailable")
+
+// mergedTable is a table of this service's records keyed by patient_id. On a merge the
+// duplicate's records move to the survivor and their IDs are noted in the merge, so that an
+// undo moves exactly those back.
+type mergedTable struct {
+	model interface{}
+	ids   func(*models.PatientMerge) *[]uint // the merge's field for the moved IDs
+
+	// check, when set, may refuse to move the records to the patient
+	check func(tx *gorm.DB, ids []uint, toPatientID uint) error
+}
+
+// mergedTables is the registry of patient-keyed tables in this service's database. Every such
+// table must be listed, with a field on PatientMerge for its IDs, or its records stay with the
+// duplicate when patients are merged.
+var mergedTables = []mergedTable{
+	{model: &models.PatientIdentifier{}, ids: func(m *models.PatientMerge) *[]uint { return &m.IdentifierIDs }},
+	{model: &models.EmergencyContact{}, ids: func(m *models.PatientMerge) *[]uint { return &m.ContactIDs }},
+	{model: &models.Allergy{}, ids: func(m *models.PatientMerge) *[]uint { return &m.AllergyIDs }},
+	{model: &models.Condition{}, ids: func(m *models.PatientMerge) *[]uint { return &m.ConditionIDs }},
+	{model: &models.Consent{}, ids: func(m *models.PatientMerge) *[]uint { return &m.ConsentIDs }},
+	{model: &models.Admission{}, ids: func(m *models.PatientMerge) *[]uint { return &m.AdmissionIDs }, check: checkOpenAdmissions},
+}
+
+// remoteTable is a kind of patient record owned by another service, moved through its
+// /reassign endpoint. The moved IDs are noted in the merge like those of mergedTables.
+type remoteTable struct {
+	name   string
+	client func(*MergeService) ReassignClient
+	ids    func(*models.PatientMerge) *[]uint
+}
+
+// remoteTables is the registry of patient records held by other services. Every service
+// keeping records by patient ID must be listed, or its records stay with the duplicate.
+var remoteTables = []remoteTable{
+	{
+		name:   "examinations",
+		client: func(s *MergeService) ReassignClient { return s.Examinations },
+		ids:    func(m *models.PatientMerge) *[]uint { return &m.ExaminationIDs },
+	},
+	{
+		name:   "appointments",
+		client: func(s *MergeService) ReassignClient { return s.Appointments },
+		ids:    func(m *models.PatientMerge) *[]uint { return &m.AppointmentIDs },
+	},
+	{
+		name:   "chart notes",
+		client: func(s *MergeService) ReassignClient { return s.ChartNotes },
+		ids:    func(m *models.PatientMerge) *[]uint { return &m.ChartNoteIDs },
+	},
+}
+
+// MergeService merges duplicate patient records and undoes merges.
+type MergeService struct {
+	DB *gorm.DB
+
+	// Examinations moves examinations between the merged records
+	Examinations ReassignClient
+	// Appointments moves appointments between the merged records
+	Appointments ReassignClient
+	// ChartNotes moves chart notes between the merged records
+	ChartNotes ReassignClient
+}
+
+// NewMergeService creates a new MergeService.
+func NewMergeService(db *gorm.DB) *MergeService {
+	return &MergeService{DB: db}
+}
+
+// MergePatients merges the duplicate record into the survivor. The duplicate's records in
+// remoteTables and mergedTables move to the survivor, and the duplicate is kept with MergedIntoID
+// set so references held by other services still resolve. The merge is recorded so it can be undone.
+func (s *MergeService) MergePatients(survivorID, duplicateID uint, reason, mergedBy string) (models.PatientMerge, error) {
+	if survivorID == duplicateID {
+		return models.PatientMerge{}, errors.New("a patient cannot be merged into itself")
+	}
+	for _, record := range []struct {
+		role string
+		id   uint
+	}{{"survivor", survivorID}, {"duplicate", duplicateID}} {
+		var patient models.Patient
+		if err := s.DB.First(&patient, record.id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.PatientMerge{}, errors.New(record.role + " not found")
+			}
+			return models.PatientMerge{}, err
+		}
+		if patient.MergedIntoID != nil {
+			return models.PatientMerge{}, fmt.Errorf("%w: patient %d", ErrAlreadyMerged, record.id)
+		}
+	}
+
+	merge := models.PatientMerge{
+		SurvivorID:  survivorID,
+		DuplicateID: duplicateID,
+		Reason:      reason,
+		MergedBy:    mergedBy,
+		MergedAt:    time.Now(),
+	}
+	// Records in other services are moved first and moved back if the merge fails
+	if err := s.reassign(duplicateID, survivorID, nil, &merge); err != nil {
+		return models.PatientMerge{}, err
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		// Conditional update so concurrent merges of the same duplicate cannot both succeed
+		result := tx.Model(&models.Patient{}).Where("id = ? AND merged_into_id IS NULL", duplicateID).Update("merged_into_id", survivorID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: patient %d", ErrAlreadyMerged, duplicateID)
+		}
+		var survivorMerged int64
+		if err := tx.Model(&models.Patient{}).Where("id = ? AND merged_into_id IS NOT NULL", survivorID).Count(&survivorMerged).Error; err != nil {
+			return err
+		}
+		if survivorMerged > 0 {
+			return fmt.Errorf("%w: patient %d", ErrAlreadyMerged, survivorID)
+		}
+
+		for _, table := range mergedTables {
+			ids := table.ids(&merge)
+			*ids = []uint{}
+			if err := tx.Model(table.model).Where("patient_id = ?", duplicateID).Order("id").Pluck("id", ids).Error; err != nil {
+				return err
+			}
+			if len(*ids) == 0 {
+				continue
+			}
+			if table.check != nil {
+				if err := table.check(tx, *ids, survivorID); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(table.model).Where("id IN ?", *ids).Update("patient_id", survivorID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&merge).Error
+	})
+	if err != nil {
+		s.compensate(survivorID, duplicateID, &merge)
+		return models.PatientMerge{}, err
+	}
+	return merge, nil
+}
+
+// UndoMerge reverses a merge: the records it moved, in this service and others, go back to the
+// duplicate, which becomes an independent record again.
+func (s *MergeService) UndoMerge(id uint, undoneBy string) (models.PatientMerge, error) {
+	merge, err := s.GetMergeByID(id)
+	if err != nil {
+		return models.PatientMerge{}, err
+	}
+	if merge.UndoneAt != nil {
+		return models.PatientMerge{}, ErrMergeUndone
+	}
+	var survivor models.Patient
+	if err := s.DB.First(&survivor, merge.SurvivorID).Error; err != nil {
+		return models.PatientMerge{}, err
+	}
+	if survivor.MergedIntoID != nil {
+		return models.PatientMerge{}, ErrMergeBlocked
+	}
+
+	var moved models.PatientMerge
+	if err := s.reassign(merge.SurvivorID, merge.DuplicateID, &merge, &moved); err != nil {
+		return models.PatientMerge{}, err
+	}
+
+	now := time.Now()
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PatientMerge{}).Where("id = ? AND undone_at IS NULL", id).
+			Updates(map[string]interface{}{"undone_at": now, "undone_by": undoneBy})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMergeUndone
+		}
+		if err := tx.Model(&models.Patient{}).Where("id = ?", merge.DuplicateID).Update("merged_into_id", nil).Error; err != nil {
+			return err
+		}
+		for _, table := range mergedTables {
+			ids := *table.ids(&merge)
+			if len(ids) == 0 {
+				continue
+			}
+			if table.check != nil {
+				if err := table.check(tx, ids, merge.DuplicateID); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(table.model).Where("id IN ? AND patient_id = ?", ids, merge.SurvivorID).
+				Update("patient_id", merge.DuplicateID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.compensate(merge.DuplicateID, merge.SurvivorID, &moved)
+		return models.PatientMerge{}, err
+	}
+	merge.UndoneAt = &now
+	merge.UndoneBy = undoneBy
+	return merge, nil
+}
+
+// mergeQuery is the allow-list for listing merges.
+var mergeQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"patientId":   {Apply: filterMergePatient},
+		"survivorId":  {Column: "survivor_id", Kind: query.Int},
+		"duplicateId": {Column: "duplicate_id", Kind: query.Int},
+		"undone":      {Apply: filterMergeUndone},
+	},
+	Sorts:       map[string]string{"mergedAt": "merged_at"},
+	DefaultSort: "-mergedAt",
+}
+
+// GetMerges retrieves one page of merges, newest first by default.
+// Filters: patientId (survivor or duplicate), survivorId, duplicateId and undone.
+func (s *MergeService) GetMerges(params query.Params) (query.Page[models.PatientMerge], error) {
+	return query.Find[models.PatientMerge](s.DB, mergeQuery, params)
+}
+
+// GetMergeByID retrieves a merge by its ID.
+func (s *MergeService) GetMergeByID(id uint) (models.PatientMerge, error) {
+	var merge models.PatientMerge
+	result := s.DB.First(&merge, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.PatientMerge{}, errors.New("merge not found")
+		}
+		return models.PatientMerge{}, result.Error
+	}
+	return merge, nil
+}
+
+// reassign moves records in the services in remoteTables and notes the moved
+// IDs in moved. With only nil all of the patient's records move, as in a merge; otherwise just
+// the IDs noted in only, as in an undo. If a service fails, those already moved are moved back.
+func (s *MergeService) reassign(fromPatientID, toPatientID uint, only, moved *models.PatientMerge) error {
+	for _, table := range remoteTables {
+		var ids []uint
+		if only != nil {
+			if ids = *table.ids(only); len(ids) == 0 {
+				continue
+			}
+		}
+		client := table.client(s)
+		if client == nil {
+			s.compensate(toPatientID, fromPatientID, moved)
+			return fmt.Errorf("%w: no %s client configured", ErrRecordsUnavailable, table.name)
+		}
+		done, err := client.Reassign(fromPatientID, toPatientID, ids)
+		if err != nil {
+			s.compensate(toPatientID, fromPatientID, moved)
+			return fmt.Errorf("%w: %s: %v", ErrRecordsUnavailable, table.name, err)
+		}
+		*table.ids(moved) = done
+	}
+	return nil
+}
+
+// compensate moves the records noted in moved back after a failed merge or undo.
+// Failures are logged: the merge record is the source of truth for a manual fix.
+func (s *MergeService) compensate(fromPatientID, toPatientID uint, moved *models.PatientMerge) {
+	for _, table := range remoteTables {
+		ids := *table.ids(moved)
+		if len(ids) == 0 {
+			continue
+		}
+		if _, err := table.client(s).Reassign(fromPatientID, toPatientID, ids); err != nil {
+			log.Printf("Failed to move %s %v back from patient %d to %d: %v", table.name, ids, fromPatientID, toPatientID, err)
+		}
+	}
+}
+
+// checkOpenAdmissions refuses to move an open admission to a patient who has an
+// open admission of their own, which the one-open-admission-per-patient index would reject.
+func checkOpenAdmissions(tx *gorm.DB, ids []uint, toPatientID uint) error {
+	var moving int64
+	if err := tx.Model(&models.Admission{}).Where("id IN ? AND discharged_at IS NULL", ids).Count(&moving).Error; err != nil {
+		return err
+	}
+	if moving == 0 {
+		return nil
+	}
+	var open int64
+	if err := tx.Model(&models.Admission{}).Where("patient_id = ? AND discharged_at IS NULL AND id NOT IN ?", toPatientID, ids).Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return fmt.Errorf("%w: patient %d", ErrBothAdmitted, toPatientID)
+	}
+	return nil
+}
+
+// filterMergePatient matches merges where the patient was the survivor or the duplicate.
+func filterMergePatient(db *gorm.DB, value string) (*gorm.DB, error) {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, errors.New("must be a non-negative number")
+	}
+	return db.Where("survivor_id = ? OR duplicate_id = ?", id, id), nil
+}
+
+// filterMergeUndone matches undone or active merges.
+func filterMergeUndone(db *gorm.DB, value string) (*gorm.DB, error) {
+	undone, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("must be true or false")
+	}
+	if undone {
+		return db.Where("undone_at IS NOT NULL"), nil
+	}
+	return db.Where("undone_at IS NULL"), nil
+}
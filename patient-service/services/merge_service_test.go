@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeRecords stands in for another service's records: it maps record IDs to patient IDs.
+type fakeRecords struct {
+	owners map[uint]uint
+	err    error // returned by Reassign when set
+}
+
+func (f *fakeRecords) Reassign(from, to uint, ids []uint) ([]uint, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var moved []uint
+	for id, owner := range f.owners {
+		if owner == from && (len(ids) == 0 || slices.Contains(ids, id)) {
+			f.owners[id] = to
+			moved = append(moved, id)
+		}
+	}
+	sort.Slice(moved, func(i, j int) bool { return moved[i] < moved[j] })
+	return moved, nil
+}
+
+// ownedBy returns the IDs of the patient's records, in order.
+func (f *fakeRecords) ownedBy(patientID uint) []uint {
+	var ids []uint
+	for id, owner := range f.owners {
+		if owner == patientID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// mergeFixture is a survivor (patient 1) and a duplicate (patient 2), each with local allergies
+// and examinations, appointments and chart notes in fake services.
+type mergeFixture struct {
+	db           *gorm.DB
+	service      *MergeService
+	examinations *fakeRecords
+	appointments *fakeRecords
+	chartNotes   *fakeRecords
+}
+
+func newMergeFixture(t *testing.T) *mergeFixture {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.Patient{}, &models.PatientIdentifier{}, &models.EmergencyContact{}, &models.Allergy{},
+		&models.Condition{}, &models.Consent{}, &models.Admission{}, &models.PatientMerge{})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, p := range []models.Patient{{ID: 1, FirstName: "Ann", MRN: "MRN-1"}, {ID: 2, FirstName: "Anne", MRN: "MRN-2"}} {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create patient: %v", err)
+		}
+	}
+	db.Create(&models.Allergy{PatientID: 1, Substance: "latex"})
+	db.Create(&models.Allergy{PatientID: 2, Substance: "penicillin"})
+
+	f := &mergeFixture{
+		db:           db,
+		examinations: &fakeRecords{owners: map[uint]uint{10: 1, 20: 2, 21: 2}},
+		appointments: &fakeRecords{owners: map[uint]uint{30: 2}},
+		chartNotes:   &fakeRecords{owners: map[uint]uint{40: 1, 41: 2}},
+	}
+	f.service = NewMergeService(db)
+	f.service.Examinations = f.examinations
+	f.service.Appointments = f.appointments
+	f.service.ChartNotes = f.chartNotes
+	return f
+}
+
+// allergiesOf returns the substances of the patient's allergies, in order.
+func (f *mergeFixture) allergiesOf(patientID uint) []string {
+	var substances []string
+	f.db.Model(&models.Allergy{}).Where("patient_id = ?", patientID).Order("id").Pluck("substance", &substances)
+	return substances
+}
+
+func TestMergeAndUndo(t *testing.T) {
+	f := newMergeFixture(t)
+
+	merge, err := f.service.MergePatients(1, 2, "same person", "clerk")
+	if err != nil {
+		t.Fatalf("MergePatients: %v", err)
+	}
+	if !reflect.DeepEqual(merge.ExaminationIDs, []uint{20, 21}) || !reflect.DeepEqual(merge.ChartNoteIDs, []uint{41}) {
+		t.Errorf("merge noted examinations %v and chart notes %v, want [20 21] and [41]", merge.ExaminationIDs, merge.ChartNoteIDs)
+	}
+	if got := f.allergiesOf(1); !reflect.DeepEqual(got, []string{"latex", "penicillin"}) {
+		t.Errorf("survivor allergies = %v, want both", got)
+	}
+	if got := f.examinations.ownedBy(1); !reflect.DeepEqual(got, []uint{10, 20, 21}) {
+		t.Errorf("survivor examinations = %v, want [10 20 21]", got)
+	}
+	var duplicate models.Patient
+	f.db.First(&duplicate, 2)
+	if duplicate.MergedIntoID == nil || *duplicate.MergedIntoID != 1 {
+		t.Errorf("duplicate MergedIntoID = %v, want 1", duplicate.MergedIntoID)
+	}
+	if _, err := f.service.MergePatients(1, 2, "again", "clerk"); !errors.Is(err, ErrAlreadyMerged) {
+		t.Errorf("second merge: got %v, want ErrAlreadyMerged", err)
+	}
+
+	// Records added to the survivor after the merge stay with it on undo
+	f.db.Create(&models.Allergy{PatientID: 1, Substance: "peanuts"})
+	f.examinations.owners[22] = 1
+
+	if _, err := f.service.UndoMerge(merge.ID, "supervisor"); err != nil {
+		t.Fatalf("UndoMerge: %v", err)
+	}
+	if got := f.allergiesOf(2); !reflect.DeepEqual(got, []string{"penicillin"}) {
+		t.Errorf("duplicate allergies after undo = %v, want [penicillin]", got)
+	}
+	if got := f.examinations.ownedBy(1); !reflect.DeepEqual(got, []uint{10, 22}) {
+		t.Errorf("survivor examinations after undo = %v, want [10 22]", got)
+	}
+	if got := f.appointments.ownedBy(2); !reflect.DeepEqual(got, []uint{30}) {
+		t.Errorf("duplicate appointments after undo = %v, want [30]", got)
+	}
+	f.db.First(&duplicate, 2)
+	if duplicate.MergedIntoID != nil {
+		t.Errorf("duplicate still merged into %d after undo", *duplicate.MergedIntoID)
+	}
+	if _, err := f.service.UndoMerge(merge.ID, "supervisor"); !errors.Is(err, ErrMergeUndone) {
+		t.Errorf("second undo: got %v, want ErrMergeUndone", err)
+	}
+}
+
+func TestMergeMovesRemoteRecordsBackOnFailure(t *testing.T) {
+	f := newMergeFixture(t)
+	f.chartNotes.err = errors.New("records service down")
+
+	if _, err := f.service.MergePatients(1, 2, "same person", "clerk"); !errors.Is(err, ErrRecordsUnavailable) {
+		t.Fatalf("got %v, want ErrRecordsUnavailable", err)
+	}
+	// Examinations and appointments were moved before chart notes failed, and are moved back
+	if got := f.examinations.ownedBy(2); !reflect.DeepEqual(got, []uint{20, 21}) {
+		t.Errorf("duplicate examinations = %v, want [20 21]", got)
+	}
+	if got := f.appointments.ownedBy(2); !reflect.DeepEqual(got, []uint{30}) {
+		t.Errorf("duplicate appointments = %v, want [30]", got)
+	}
+	var duplicate models.Patient
+	f.db.First(&duplicate, 2)
+	if duplicate.MergedIntoID != nil {
+		t.Error("duplicate was merged despite the failure")
+	}
+}
+
+func TestMergeRefusesTwoOpenAdmissions(t *testing.T) {
+	f := newMergeFixture(t)
+	f.db.Create(&models.Admission{PatientID: 1, Ward: "A", AdmittedAt: time.Now()})
+	f.db.Create(&models.Admission{PatientID: 2, Ward: "B", AdmittedAt: time.Now()})
+
+	if _, err := f.service.MergePatients(1, 2, "same person", "clerk"); !errors.Is(err, ErrBothAdmitted) {
+		t.Fatalf("got %v, want ErrBothAdmitted", err)
+	}
+	// The local transaction rolled back and the remote records were moved back
+	if got := f.allergiesOf(2); !reflect.DeepEqual(got, []string{"penicillin"}) {
+		t.Errorf("duplicate allergies = %v, want [penicillin]", got)
+	}
+	if got := f.examinations.ownedBy(2); !reflect.DeepEqual(got, []uint{20, 21}) {
+		t.Errorf("duplicate examinations = %v, want [20 21]", got)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"gorm.io/gorm"
+)
+
+// Allergy severities.
+const (
+	AllergySeverityMild     = "mild"
+	AllergySeverityModerate = "moderate"
+	AllergySeveritySevere   = "severe"
+	AllergySeverityUnknown  = "unknown"
+)
+
+// Allergy verification statuses. Refuted allergies stay on record but are ignored by safety checks.
+const (
+	AllergyUnconfirmed = "unconfirmed"
+	AllergyConfirmed   = "confirmed"
+	AllergyRefuted     = "refuted"
+)
+
+// Allergy and condition statuses.
+const (
+	StatusActive   = "active"
+	StatusInactive = "inactive"
+)
+
+// ErrInvalidAllergy is returned when allergy details fail validation.
+var ErrInvalidAllergy = errors.New("invalid allergy")
+
+// ErrAllergyExists is returned when the patient already has an active allergy to the same substance.
+var ErrAllergyExists = errors.New("allergy already recorded")
+
+// AllergyUpdate holds the allergy fields to change; nil fields are left as they are.
+type AllergyUpdate struct {
+	Substance    *string
+	Reaction     *string
+	Severity     *string
+	Verification *string
+	Status       *string
+	OnsetDate    *time.Time
+	Notes        *string
+}
+
+// allergyQuery is the allow-list for listing a patient's allergies.
+var allergyQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"status":       {Column: "status"},
+		"verification": {Column: "verification"},
+		"severity":     {Column: "severity"},
+		"substance":    {Column: "substance", Op: query.Contains},
+	},
+	Sorts:       map[string]string{"substance": "substance", "createdAt": "created_at"},
+	DefaultSort: "substance",
+}
+
+// validateAllergy checks and normalizes an allergy, filling in defaults.
+func validateAllergy(allergy *models.Allergy) error {
+	allergy.Substance = strings.TrimSpace(allergy.Substance)
+	allergy.Reaction = strings.TrimSpace(allergy.Reaction)
+	allergy.Severity = strings.ToLower(strings.TrimSpace(allergy.Severity))
+	allergy.Verification = strings.ToLower(strings.TrimSpace(allergy.Verification))
+	allergy.Status = strings.ToLower(strings.TrimSpace(allergy.Status))
+	if allergy.Substance == "" {
+		return fmt.Errorf("%w: substance is required", ErrInvalidAllergy)
+	}
+	if allergy.Severity == "" {
+		allergy.Severity = AllergySeverityUnknown
+	}
+	if allergy.Verification == "" {
+		allergy.Verification = AllergyUnconfirmed
+	}
+	if allergy.Status == "" {
+		allergy.Status = StatusActive
+	}
+
+	switch allergy.Severity {
+	case AllergySeverityMild, AllergySeverityModerate, AllergySeveritySevere, AllergySeverityUnknown:
+	default:
+		return fmt.Errorf("%w: severity must be mild, moderate, severe or unknown", ErrInvalidAllergy)
+	}
+	switch allergy.Verification {
+	case AllergyUnconfirmed, AllergyConfirmed, AllergyRefuted:
+	default:
+		return fmt.Errorf("%w: verification must be unconfirmed, confirmed or refuted", ErrInvalidAllergy)
+	}
+	if allergy.Status != StatusActive && allergy.Status != StatusInactive {
+		return fmt.Errorf("%w: status must be active or inactive", ErrInvalidAllergy)
+	}
+	return nil
+}
+
+// checkAllergyUnique rejects a second active allergy to the same substance.
+func checkAllergyUnique(tx *gorm.DB, allergy models.Allergy) error {
+	if allergy.Status != StatusActive {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.Allergy{}).
+		Where("patient_id = ? AND LOWER(substance) = ? AND status = ? AND id <> ?", allergy.PatientID, strings.ToLower(allergy.Substance), StatusActive, allergy.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrAllergyExists, allergy.Substance)
+	}
+	return nil
+}
+
+// GetAllergies retrieves one page of a patient's allergies, by substance by default.
+// Filters: status, verification, severity and substance (substring).
+func (s *PatientService) GetAllergies(patientID uint, params query.Params) (query.Page[models.Allergy], error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return query.Page[models.Allergy]{}, err
+	}
+	return query.Find[models.Allergy](s.DB.Where("patient_id = ?", patientID), allergyQuery, params)
+}
+
+// GetAllergy retrieves one of a patient's allergies.
+func (s *PatientService) GetAllergy(patientID, allergyID uint) (models.Allergy, error) {
+	var allergy models.Allergy
+	result := s.DB.Where("id = ? AND patient_id = ?", allergyID, patientID).Limit(1).Find(&allergy)
+	if result.Error != nil {
+		return models.Allergy{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Allergy{}, errors.New("allergy not found")
+	}
+	return allergy, nil
+}
+
+// AddAllergy records an allergy for a patient. It is unconfirmed and active unless stated otherwise.
+func (s *PatientService) AddAllergy(patientID uint, allergy models.Allergy) (models.Allergy, error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return models.Allergy{}, err
+	}
+	allergy.ID = 0
+	allergy.PatientID = patientID
+	if err := validateAllergy(&allergy); err != nil {
+		return models.Allergy{}, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkAllergyUnique(tx, allergy); err != nil {
+			return err
+		}
+		return tx.Create(&allergy).Error
+	})
+	if err != nil {
+		return models.Allergy{}, err
+	}
+	return allergy, nil
+}
+
+// UpdateAllergy changes the set fields of one of a patient's allergies. It fails with
+// etag.ErrMismatch unless the allergy is still at the given version.
+func (s *PatientService) UpdateAllergy(patientID, allergyID, version uint, update AllergyUpdate) (models.Allergy, error) {
+	allergy, err := s.GetAllergy(patientID, allergyID)
+	if err != nil {
+		return models.Allergy{}, err
+	}
+
+	setString(&allergy.Substance, update.Substance)
+	setString(&allergy.Reaction, update.Reaction)
+	setString(&allergy.Severity, update.Severity)
+	setString(&allergy.Verification, update.Verification)
+	setString(&allergy.Status, update.Status)
+	setString(&allergy.Notes, update.Notes)
+	if update.OnsetDate != nil {
+		allergy.OnsetDate = update.OnsetDate
+	}
+	if err := validateAllergy(&allergy); err != nil {
+		return models.Allergy{}, err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkAllergyUnique(tx, allergy); err != nil {
+			return err
+		}
+		return etag.Expect(tx, version).Save(&allergy).Error
+	})
+	if err != nil {
+		return models.Allergy{}, err
+	}
+	return allergy, nil
+}
+
+// RemoveAllergy deletes one of a patient's allergies. Allergies recorded in error should be
+// removed; ones that no longer apply are better marked inactive or refuted. It fails with
+// etag.ErrMismatch unless the allergy is still at the given version.
+func (s *PatientService) RemoveAllergy(patientID, allergyID, version uint) error {
+	err := etag.Expect(s.DB, version).Where("id = ? AND patient_id = ?", allergyID, patientID).Delete(&models.Allergy{}).Error
+	if errors.Is(err, etag.ErrMismatch) {
+		return missingOrChanged(s.DB, &models.Allergy{}, patientID, allergyID, "allergy not found")
+	}
+	return err
+}
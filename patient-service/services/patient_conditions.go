@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+)
+
+// Condition statuses, besides StatusActive.
+const (
+	ConditionRecurrence = "recurrence"
+	ConditionRemission  = "remission"
+	ConditionResolved   = "resolved"
+)
+
+// ErrInvalidCondition is returned when condition details fail validation.
+var ErrInvalidCondition = errors.New("invalid condition")
+
+// ConditionUpdate holds the condition fields to change; nil fields are left as they are.
+type ConditionUpdate struct {
+	Code         *string
+	CodeSystem   *string
+	Description  *string
+	Status       *string
+	OnsetDate    *time.Time
+	ResolvedDate *time.Time
+	Notes        *string
+}
+
+// conditionQuery is the allow-list for listing a patient's problem list.
+var conditionQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"status":      {Column: "status"},
+		"code":        {Column: "code", Op: query.Prefix},
+		"codeSystem":  {Column: "code_system"},
+		"description": {Column: "description", Op: query.Contains},
+		"onsetFrom":   {Column: "onset_date", Kind: query.Time, Op: query.Gte},
+		"onsetTo":     {Column: "onset_date", Kind: query.Time, Op: query.Lte},
+	},
+	Sorts:       map[string]string{"onsetDate": "COALESCE(onset_date, '')", "code": "code", "createdAt": "created_at"},
+	DefaultSort: "createdAt",
+}
+
+// validateCondition checks and normalizes a condition, filling in defaults.
+func validateCondition(condition *models.Condition) error {
+	condition.Code = strings.ToUpper(strings.TrimSpace(condition.Code))
+	condition.CodeSystem = strings.ToLower(strings.TrimSpace(condition.CodeSystem))
+	condition.Description = strings.TrimSpace(condition.Description)
+	condition.Status = strings.ToLower(strings.TrimSpace(condition.Status))
+	if condition.Code == "" && condition.Description == "" {
+		return fmt.Errorf("%w: code or description is required", ErrInvalidCondition)
+	}
+	if condition.Status == "" {
+		condition.Status = StatusActive
+	}
+
+	switch condition.Status {
+	case StatusActive, ConditionRecurrence, ConditionRemission:
+		condition.ResolvedDate = nil
+	case ConditionResolved:
+		if condition.ResolvedDate == nil {
+			now := time.Now()
+			condition.ResolvedDate = &now
+		}
+	default:
+		return fmt.Errorf("%w: status must be active, recurrence, remission or resolved", ErrInvalidCondition)
+	}
+	if condition.OnsetDate != nil && condition.ResolvedDate != nil && condition.ResolvedDate.Before(*condition.OnsetDate) {
+		return fmt.Errorf("%w: resolved date is before onset", ErrInvalidCondition)
+	}
+	return nil
+}
+
+// GetConditions retrieves one page of a patient's problem list, oldest entry first by default.
+// Filters: status, code (prefix), codeSystem, description (substring), and onsetFrom and onsetTo (inclusive).
+func (s *PatientService) GetConditions(patientID uint, params query.Params) (query.Page[models.Condition], error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return query.Page[models.Condition]{}, err
+	}
+	return query.Find[models.Condition](s.DB.Where("patient_id = ?", patientID), conditionQuery, params)
+}
+
+// GetCondition retrieves one of a patient's conditions.
+func (s *PatientService) GetCondition(patientID, conditionID uint) (models.Condition, error) {
+	var condition models.Condition
+	result := s.DB.Where("id = ? AND patient_id = ?", conditionID, patientID).Limit(1).Find(&condition)
+	if result.Error != nil {
+		return models.Condition{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Condition{}, errors.New("condition not found")
+	}
+	return condition, nil
+}
+
+// AddCondition adds a condition to a patient's problem list. It is active unless stated otherwise.
+func (s *PatientService) AddCondition(patientID uint, condition models.Condition) (models.Condition, error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return models.Condition{}, err
+	}
+	condition.ID = 0
+	condition.PatientID = patientID
+	if err := validateCondition(&condition); err != nil {
+		return models.Condition{}, err
+	}
+	result := s.DB.Create(&condition)
+	return condition, result.Error
+}
+
+// UpdateCondition changes the set fields of one of a patient's conditions.
+// Moving a condition to resolved stamps the resolved date unless one is given. It fails with
+// etag.ErrMismatch unless the condition is still at the given version.
+func (s *PatientService) UpdateCondition(patientID, conditionID, version uint, update ConditionUpdate) (models.Condition, error) {
+	condition, err := s.GetCondition(patientID, conditionID)
+	if err != nil {
+		return models.Condition{}, err
+	}
+
+	setString(&condition.Code, update.Code)
+	setString(&condition.CodeSystem, update.CodeSystem)
+	setString(&condition.Description, update.Description)
+	setString(&condition.Status, update.Status)
+	setString(&condition.Notes, update.Notes)
+	if update.OnsetDate != nil {
+		condition.OnsetDate = update.OnsetDate
+	}
+	if update.ResolvedDate != nil {
+		condition.ResolvedDate = update.ResolvedDate
+	}
+	if err := validateCondition(&condition); err != nil {
+		return models.Condition{}, err
+	}
+	result := etag.Expect(s.DB, version).Save(&condition)
+	return condition, result.Error
+}
+
+// RemoveCondition deletes a condition recorded in error from a patient's problem list.
+// It fails with etag.ErrMismatch unless the condition is still at the given version.
+func (s *PatientService) RemoveCondition(patientID, conditionID, version uint) error {
+	err := etag.Expect(s.DB, version).Where("id = ? AND patient_id = ?", conditionID, patientID).Delete(&models.Condition{}).Error
+	if errors.Is(err, etag.ErrMismatch) {
+		return missingOrChanged(s.DB, &models.Condition{}, patientID, conditionID, "condition not found")
+	}
+	return err
+}
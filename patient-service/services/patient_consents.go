@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidConsent is returned when consent details fail validation.
+var ErrInvalidConsent = errors.New("invalid consent")
+
+// ErrConsentRevoked is returned when revoking a consent a second time.
+var ErrConsentRevoked = errors.New("consent has already been revoked")
+
+// consentQuery is the allow-list for listing a patient's consents.
+var consentQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"decision": {Column: "decision"},
+		"scope":    {Column: "scope"},
+		"purpose":  {Column: "purpose"},
+		"grantee":  {Column: "grantee"},
+		"active":   {Apply: filterConsentActive},
+	},
+	Sorts:       map[string]string{"validFrom": "valid_from", "createdAt": "created_at"},
+	DefaultSort: "-createdAt",
+}
+
+// validateConsent checks and normalizes a consent, filling in defaults.
+func validateConsent(c *models.Consent) error {
+	c.Decision = strings.ToLower(strings.TrimSpace(c.Decision))
+	c.Scope = strings.ToLower(strings.TrimSpace(c.Scope))
+	c.Purpose = strings.ToLower(strings.TrimSpace(c.Purpose))
+	c.Grantee = strings.TrimSpace(c.Grantee)
+	if c.Decision != consent.Permit && c.Decision != consent.Deny {
+		return fmt.Errorf("%w: decision must be permit or deny", ErrInvalidConsent)
+	}
+	if c.Scope == "" {
+		c.Scope = consent.ScopeAll
+	}
+	if !consent.IsValidScope(c.Scope) {
+		return fmt.Errorf("%w: scope must be demographics, conditions, examinations, chart or *", ErrInvalidConsent)
+	}
+	if c.Grantee == "" || c.Grantee == "role:" {
+		return fmt.Errorf("%w: grantee is required", ErrInvalidConsent)
+	}
+	if strings.HasPrefix(c.Grantee, "role:") {
+		c.Grantee = strings.ToLower(c.Grantee)
+	}
+	if c.ValidFrom.IsZero() {
+		c.ValidFrom = time.Now()
+	}
+	if c.ValidUntil != nil && !c.ValidUntil.After(c.ValidFrom) {
+		return fmt.Errorf("%w: validUntil must be after validFrom", ErrInvalidConsent)
+	}
+	return nil
+}
+
+// GetConsents retrieves one page of a patient's consents, newest first by default.
+// Filters: decision, scope, purpose, grantee and active (in force now).
+func (s *PatientService) GetConsents(patientID uint, params query.Params) (query.Page[models.Consent], error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return query.Page[models.Consent]{}, err
+	}
+	return query.Find[models.Consent](s.DB.Where("patient_id = ?", patientID), consentQuery, params)
+}
+
+// GetConsent retrieves one of a patient's consents.
+func (s *PatientService) GetConsent(patientID, consentID uint) (models.Consent, error) {
+	var c models.Consent
+	result := s.DB.Where("id = ? AND patient_id = ?", consentID, patientID).Limit(1).Find(&c)
+	if result.Error != nil {
+		return models.Consent{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Consent{}, errors.New("consent not found")
+	}
+	return c, nil
+}
+
+// AddConsent records a consent directive for a patient. It is in force from ValidFrom, or now.
+func (s *PatientService) AddConsent(patientID uint, c models.Consent) (models.Consent, error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return models.Consent{}, err
+	}
+	c.ID = 0
+	c.PatientID = patientID
+	c.RevokedAt, c.RevokedBy, c.RevocationReason = nil, "", ""
+	if err := validateConsent(&c); err != nil {
+		return models.Consent{}, err
+	}
+	result := s.DB.Create(&c)
+	return c, result.Error
+}
+
+// RevokeConsent ends a consent. Consents are never edited: to change one, revoke it and add another.
+func (s *PatientService) RevokeConsent(patientID, consentID uint, revokedBy, reason string) (models.Consent, error) {
+	c, err := s.GetConsent(patientID, consentID)
+	if err != nil {
+		return models.Consent{}, err
+	}
+	if c.RevokedAt != nil {
+		return models.Consent{}, ErrConsentRevoked
+	}
+
+	now := time.Now()
+	// Conditional update so a consent is revoked exactly once
+	result := s.DB.Model(&models.Consent{}).Where("id = ? AND revoked_at IS NULL", c.ID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoked_by": revokedBy, "revocation_reason": reason})
+	if result.Error != nil {
+		return models.Consent{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Consent{}, ErrConsentRevoked
+	}
+	c.RevokedAt, c.RevokedBy, c.RevocationReason = &now, revokedBy, reason
+	return c, nil
+}
+
+// filterConsentActive matches consents in force now, or ones that are not.
+func filterConsentActive(db *gorm.DB, value string) (*gorm.DB, error) {
+	active, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("must be true or false")
+	}
+	now := time.Now()
+	inForce := "revoked_at IS NULL AND valid_from <= ? AND (valid_until IS NULL OR valid_until > ?)"
+	if active {
+		return db.Where(inForce, now, now), nil
+	}
+	return db.Where("NOT ("+inForce+")", now, now), nil
+}
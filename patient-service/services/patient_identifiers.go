@@ -0,0 +1,224 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+)
+
+// SystemMRN is the identifier system that looks patients up by medical record number.
+const SystemMRN = "mrn"
+
+// Identifier types.
+const (
+	IdentifierNationalID = "national-id"
+	IdentifierInsurance  = "insurance"
+	IdentifierPassport   = "passport"
+	IdentifierOther      = "other"
+)
+
+// mrnLength is the number of digits in an MRN, including the trailing check digit.
+const mrnLength = 10
+
+// ErrIdentifierTaken is returned when an identifier value is already registered in its system.
+var ErrIdentifierTaken = errors.New("identifier already registered")
+
+// ErrInvalidIdentifier is returned for an unknown identifier type, a missing system or value,
+// or an MRN whose check digit does not match.
+var ErrInvalidIdentifier = errors.New("invalid identifier")
+
+// IsValidIdentifierType reports whether t is a known identifier type.
+func IsValidIdentifierType(t string) bool {
+	return t == IdentifierNationalID || t == IdentifierInsurance || t == IdentifierPassport || t == IdentifierOther
+}
+
+// GenerateMRN returns a random MRN: nine digits followed by a Luhn check digit.
+// Random numbers, unlike the row ID, do not reveal how many patients are registered.
+func GenerateMRN() (string, error) {
+	// The first digit is never zero so MRNs survive systems that store them as numbers
+	n, err := rand.Int(rand.Reader, big.NewInt(900000000))
+	if err != nil {
+		return "", err
+	}
+	body := fmt.Sprintf("%09d", n.Int64()+100000000)
+	return body + string(luhnDigit(body)), nil
+}
+
+// ValidMRN reports whether s is a well-formed MRN with a matching check digit.
+func ValidMRN(s string) bool {
+	if len(s) != mrnLength {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return luhnDigit(s[:mrnLength-1]) == s[mrnLength-1]
+}
+
+// luhnDigit computes the Luhn check digit for a string of digits.
+func luhnDigit(digits string) byte {
+	sum := 0
+	double := true // the digit next to the check digit is doubled
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// newMRN generates an MRN not yet assigned to any patient.
+func newMRN(tx *gorm.DB) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		mrn, err := GenerateMRN()
+		if err != nil {
+			return "", err
+		}
+		var count int64
+		if err := tx.Model(&models.Patient{}).Where("mrn = ?", mrn).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return mrn, nil
+		}
+	}
+	return "", errors.New("could not generate a unique MRN")
+}
+
+// AssignMissingMRNs gives an MRN to every patient registered before MRNs were introduced.
+func (s *PatientService) AssignMissingMRNs() (int, error) {
+	var ids []uint
+	if err := s.DB.Model(&models.Patient{}).Where("mrn IS NULL OR mrn = ''").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		mrn, err := newMRN(s.DB)
+		if err != nil {
+			return 0, err
+		}
+		if err := s.DB.Model(&models.Patient{}).Where("id = ?", id).Update("mrn", mrn).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// normalizeIdentifier trims and checks an identifier before it is stored.
+func normalizeIdentifier(identifier *models.PatientIdentifier) error {
+	identifier.Type = strings.ToLower(strings.TrimSpace(identifier.Type))
+	identifier.System = strings.TrimSpace(identifier.System)
+	identifier.Value = strings.TrimSpace(identifier.Value)
+	identifier.Issuer = strings.TrimSpace(identifier.Issuer)
+	if identifier.Type == "" {
+		identifier.Type = IdentifierOther
+	}
+	switch {
+	case !IsValidIdentifierType(identifier.Type):
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidIdentifier, identifier.Type)
+	case identifier.System == "" || identifier.Value == "":
+		return fmt.Errorf("%w: system and value are required", ErrInvalidIdentifier)
+	case strings.EqualFold(identifier.System, SystemMRN):
+		return fmt.Errorf("%w: the %q system is reserved for generated MRNs", ErrInvalidIdentifier, SystemMRN)
+	}
+	return nil
+}
+
+// addIdentifier stores an identifier for a patient, enforcing uniqueness within its system.
+func addIdentifier(tx *gorm.DB, patientID uint, identifier models.PatientIdentifier) (models.PatientIdentifier, error) {
+	if err := normalizeIdentifier(&identifier); err != nil {
+		return models.PatientIdentifier{}, err
+	}
+	var count int64
+	if err := tx.Model(&models.PatientIdentifier{}).
+		Where("system = ? AND value = ?", identifier.System, identifier.Value).Count(&count).Error; err != nil {
+		return models.PatientIdentifier{}, err
+	}
+	if count > 0 {
+		return models.PatientIdentifier{}, fmt.Errorf("%w: %s %s", ErrIdentifierTaken, identifier.System, identifier.Value)
+	}
+	identifier.ID = 0
+	identifier.PatientID = patientID
+	result := tx.Create(&identifier)
+	return identifier, result.Error
+}
+
+// AddIdentifier registers an external identifier for a patient.
+func (s *PatientService) AddIdentifier(patientID uint, identifier models.PatientIdentifier) (models.PatientIdentifier, error) {
+	var created models.PatientIdentifier
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.Patient{}, patientID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("patient not found")
+			}
+			return err
+		}
+		var err error
+		created, err = addIdentifier(tx, patientID, identifier)
+		return err
+	})
+	return created, err
+}
+
+// GetIdentifiers retrieves a patient's external identifiers.
+func (s *PatientService) GetIdentifiers(patientID uint) ([]models.PatientIdentifier, error) {
+	if _, err := s.GetPatientByID(patientID); err != nil {
+		return nil, err
+	}
+	identifiers := []models.PatientIdentifier{}
+	result := s.DB.Where("patient_id = ?", patientID).Order("id").Find(&identifiers)
+	return identifiers, result.Error
+}
+
+// RemoveIdentifier deletes one of a patient's external identifiers. It fails with
+// etag.ErrMismatch unless the identifier is still at the given version.
+func (s *PatientService) RemoveIdentifier(patientID, identifierID, version uint) error {
+	err := etag.Expect(s.DB, version).Where("id = ? AND patient_id = ?", identifierID, patientID).Delete(&models.PatientIdentifier{}).Error
+	if errors.Is(err, etag.ErrMismatch) {
+		return missingOrChanged(s.DB, &models.PatientIdentifier{}, patientID, identifierID, "identifier not found")
+	}
+	return err
+}
+
+// FindByIdentifier retrieves the patient holding value in system.
+// The "mrn" system matches the patient's own MRN, whose check digit is validated first.
+func (s *PatientService) FindByIdentifier(system, value string) (models.Patient, error) {
+	system, value = strings.TrimSpace(system), strings.TrimSpace(value)
+	if system == "" || value == "" {
+		return models.Patient{}, fmt.Errorf("%w: system and value are required", ErrInvalidIdentifier)
+	}
+
+	db := s.DB.Preload("Identifiers", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+	if strings.EqualFold(system, SystemMRN) {
+		if !ValidMRN(value) {
+			return models.Patient{}, fmt.Errorf("%w: %q is not a valid MRN", ErrInvalidIdentifier, value)
+		}
+		db = db.Where("mrn = ?", value)
+	} else {
+		db = db.Where("id = (?)", s.DB.Model(&models.PatientIdentifier{}).
+			Select("patient_id").Where("system = ? AND value = ?", system, value))
+	}
+
+	var patient models.Patient
+	result := db.Limit(1).Find(&patient)
+	if result.Error != nil {
+		return models.Patient{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Patient{}, errors.New("patient not found")
+	}
+	return patient, nil
+}
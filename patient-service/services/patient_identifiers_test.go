@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestValidMRN(t *testing.T) {
+	tests := []struct {
+		mrn  string
+		want bool
+	}{
+		{"1234567897", true},
+		{"1000000008", true},
+		{"9999999999", true},
+		{"1234567890", false}, // wrong check digit
+		{"1234567898", false},
+		{"1243567897", false}, // adjacent digits swapped
+		{"1234557897", false}, // one digit mistyped
+		{"123456789", false},  // too short
+		{"12345678977", false},
+		{"12345678a7", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidMRN(tt.mrn); got != tt.want {
+			t.Errorf("ValidMRN(%q) = %v, want %v", tt.mrn, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateMRN(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		mrn, err := GenerateMRN()
+		if err != nil {
+			t.Fatalf("GenerateMRN: %v", err)
+		}
+		if !ValidMRN(mrn) || mrn[0] == '0' {
+			t.Fatalf("GenerateMRN() = %q, want ten digits with a check digit and no leading zero", mrn)
+		}
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Patient{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Patients registered before MRNs have a NULL or empty MRN
+	db.Create(&models.Patient{ID: 1, FirstName: "Ann"})
+	db.Exec("UPDATE patients SET mrn = NULL WHERE id = 1")
+	db.Create(&models.Patient{ID: 2, FirstName: "Bob"})
+	db.Create(&models.Patient{ID: 3, FirstName: "Cy", MRN: "1234567897"})
+
+	s := NewPatientService(db)
+	if n, err := s.AssignMissingMRNs(); err != nil || n != 2 {
+		t.Fatalf("AssignMissingMRNs = %d, %v; want 2", n, err)
+	}
+	var mrns []string
+	db.Model(&models.Patient{}).Order("id").Pluck("mrn", &mrns)
+	if !ValidMRN(mrns[0]) || !ValidMRN(mrns[1]) || mrns[0] == mrns[1] || mrns[2] != "1234567897" {
+		t.Errorf("MRNs = %v, want two new distinct MRNs and the existing one kept", mrns)
+	}
+	if n, _ := s.AssignMissingMRNs(); n != 0 {
+		t.Errorf("second run assigned %d MRNs, want 0", n)
+	}
+
+	tests := []struct {
+		identifier models.PatientIdentifier
+		wantErr    error
+	}{
+		{models.PatientIdentifier{Type: " Passport ", System: "urn:passport:at", Value: "P123"}, nil},
+		{models.PatientIdentifier{System: "urn:local", Value: "X1"}, nil},
+		{models.PatientIdentifier{Type: "ssn", System: "urn:ssn", Value: "1"}, ErrInvalidIdentifier},
+		{models.PatientIdentifier{Type: "passport", System: "urn:passport:at"}, ErrInvalidIdentifier},
+		{models.PatientIdentifier{Type: "other", System: "MRN", Value: "1234567897"}, ErrInvalidIdentifier},
+	}
+	for _, tt := range tests {
+		identifier := tt.identifier
+		if err := normalizeIdentifier(&identifier); !errors.Is(err, tt.wantErr) {
+			t.Errorf("normalizeIdentifier(%+v) = %v, want %v", tt.identifier, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fitnis/shared/models"
+)
+
+// DuplicateThreshold is the match score from which a patient is reported as a likely duplicate.
+const DuplicateThreshold = 0.85
+
+// Weights of the match signals; a perfect name and birth date match scores 1.
+const (
+	weightBirthDate  = 0.4
+	weightFirstName  = 0.25
+	weightLastName   = 0.35
+	weightIdentifier = 0.4
+)
+
+// maxDuplicateCandidates bounds how many stored patients are scored per check.
+const maxDuplicateCandidates = 200
+
+// DuplicateCandidate is an existing patient that closely matches a new or existing record.
+type DuplicateCandidate struct {
+	Patient models.Patient `json:"patient"`
+	Score   float64        `json:"score"`   // 0 to 1
+	Reasons []string       `json:"reasons"` // the signals that matched
+}
+
+// FindDuplicates returns existing patients that are likely the same person as patient,
+// best match first. Merged records are never reported, and neither is patient itself.
+func (s *PatientService) FindDuplicates(patient models.Patient, identifiers []models.PatientIdentifier) ([]DuplicateCandidate, error) {
+	first, last := normalizeName(patient.FirstName), normalizeName(patient.LastName)
+
+	// Narrow the scan to patients sharing at least one exact signal, then score them in Go
+	var candidates []models.Patient
+	db := s.DB.Preload("Identifiers").Where("merged_into_id IS NULL")
+	if patient.ID != 0 {
+		db = db.Where("id <> ?", patient.ID)
+	}
+	conditions := s.DB.Where("LOWER(last_name) = ? OR LOWER(first_name) = ?", strings.ToLower(patient.LastName), strings.ToLower(patient.FirstName))
+	if patient.BirthDate != nil {
+		conditions = conditions.Or("date(birth_date) = ?", patient.BirthDate.Format("2006-01-02"))
+	}
+	values := identifierValues(identifiers)
+	if len(values) > 0 {
+		conditions = conditions.Or("id IN (?)", s.DB.Model(&models.PatientIdentifier{}).Select("patient_id").Where("value IN ?", values))
+	}
+	if err := db.Where(conditions).Limit(maxDuplicateCandidates).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	matches := []DuplicateCandidate{}
+	for _, candidate := range candidates {
+		var score float64
+		var reasons []string
+		if patient.BirthDate != nil && candidate.BirthDate != nil &&
+			patient.BirthDate.Format("2006-01-02") == candidate.BirthDate.Format("2006-01-02") {
+			score += weightBirthDate
+			reasons = append(reasons, "birth date")
+		}
+
+		cFirst, cLast := normalizeName(candidate.FirstName), normalizeName(candidate.LastName)
+		names := weightFirstName*jaroWinkler(first, cFirst) + weightLastName*jaroWinkler(last, cLast)
+		// First and last name entered the wrong way round
+		if swapped := 0.9 * (weightFirstName*jaroWinkler(first, cLast) + weightLastName*jaroWinkler(last, cFirst)); swapped > names {
+			names = swapped
+		}
+		score += names
+		if names >= 0.8*(weightFirstName+weightLastName) {
+			reasons = append(reasons, "name")
+		}
+
+		if sharesIdentifier(identifiers, candidate.Identifiers) {
+			score += weightIdentifier
+			reasons = append(reasons, "identifier")
+		}
+
+		if score > 1 {
+			score = 1
+		}
+		if score >= DuplicateThreshold {
+			matches = append(matches, DuplicateCandidate{Patient: candidate, Score: roundScore(score), Reasons: reasons})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches, nil
+}
+
+// FindDuplicatesOf returns likely duplicates of a stored patient.
+func (s *PatientService) FindDuplicatesOf(id uint) ([]DuplicateCandidate, error) {
+	patient, err := s.GetPatientByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.FindDuplicates(patient, patient.Identifiers)
+}
+
+// normalizeName lower-cases a name and drops everything but letters.
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// identifierValues lists the non-empty identifier values.
+func identifierValues(identifiers []models.PatientIdentifier) []string {
+	var values []string
+	for _, identifier := range identifiers {
+		if v := strings.TrimSpace(identifier.Value); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// sharesIdentifier reports whether two identifier lists hold the same value
+// for the same identifier type, even if registered under different systems.
+func sharesIdentifier(a, b []models.PatientIdentifier) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if strings.TrimSpace(x.Value) != "" && strings.EqualFold(strings.TrimSpace(x.Value), y.Value) &&
+				(x.Type == "" || strings.EqualFold(x.Type, y.Type)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func roundScore(f float64) float64 {
+	return float64(int(f*100+0.5)) / 100
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings, from 0 (nothing in common) to 1 (equal).
+func jaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		if len(ra) == len(rb) {
+			return 1
+		}
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		for j := max(0, i-window); j < min(len(rb), i+window+1); j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	// Boost strings that share a prefix of up to four characters
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
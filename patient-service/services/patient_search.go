@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"gorm.io/gorm"
+)
+
+// patientQuery is the allow-list for listing patients. COALESCE keeps NULLs in a stable
+// position so they sort and compare the same way in ORDER BY and in the cursor condition.
+var patientQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"mrn":      {Column: "mrn"},
+		"merged":   {Apply: filterMerged},
+		"name":     {Apply: filterPatientName},
+		"q":        {Apply: filterPatientWords},
+		"bornFrom": {Column: "birth_date", Kind: query.Time, Op: query.Gte},
+		"bornTo":   {Column: "birth_date", Kind: query.Time, Op: query.Lte},
+	},
+	Sorts: map[string]string{
+		"firstName": "COALESCE(first_name, '')",
+		"lastName":  "COALESCE(last_name, '')",
+		"birthDate": "COALESCE(birth_date, '')",
+	},
+}
+
+// SearchPatients retrieves one page of patients matching the list parameters:
+// mrn, merged (records merged into another patient are hidden unless set), name (prefix of the first name, last name or "first last"), q (every word must appear
+// somewhere in the name), bornFrom and bornTo (inclusive), sorted by id, firstName,
+// lastName or birthDate. Patients in excluded are left out (see consent.Enforcer.Refused).
+func (s *PatientService) SearchPatients(params query.Params, excluded []uint) (query.Page[models.Patient], error) {
+	db := s.DB
+	if params.Filters["merged"] == "" {
+		db = db.Where("merged_into_id IS NULL")
+	}
+	if len(excluded) > 0 {
+		db = db.Where("id NOT IN ?", excluded)
+	}
+	return query.Find[models.Patient](db, patientQuery, params)
+}
+
+// filterMerged matches merged or active patient records.
+func filterMerged(db *gorm.DB, value string) (*gorm.DB, error) {
+	merged, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("must be true or false")
+	}
+	if merged {
+		return db.Where("merged_into_id IS NOT NULL"), nil
+	}
+	return db.Where("merged_into_id IS NULL"), nil
+}
+
+// filterPatientName matches a prefix of the first name, last name or full name.
+func filterPatientName(db *gorm.DB, value string) (*gorm.DB, error) {
+	name := strings.TrimSpace(value)
+	if name == "" {
+		return db, nil
+	}
+	prefix := query.EscapeLike(strings.ToLower(name)) + "%"
+	return db.Where("LOWER(first_name) LIKE ? ESCAPE '\\' OR LOWER(last_name) LIKE ? ESCAPE '\\' OR LOWER(first_name || ' ' || last_name) LIKE ? ESCAPE '\\'",
+		prefix, prefix, prefix), nil
+}
+
+// filterPatientWords requires every word to appear somewhere in the full name.
+func filterPatientWords(db *gorm.DB, value string) (*gorm.DB, error) {
+	for _, word := range strings.Fields(strings.ToLower(value)) {
+		db = db.Where("LOWER(first_name || ' ' || last_name) LIKE ? ESCAPE '\\'", "%"+query.EscapeLike(word)+"%")
+	}
+	return db, nil
+}
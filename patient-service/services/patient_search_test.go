@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newSearchService opens an empty database holding five patients; patient 5 was merged into patient 1.
+func newSearchService(t *testing.T) *PatientService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Patient{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	born := func(year int) *time.Time {
+		t := time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	survivor := uint(1)
+	for _, p := range []models.Patient{
+		{ID: 1, MRN: "MRN-1", FirstName: "Anna", LastName: "Smith", BirthDate: born(1980)},
+		{ID: 2, MRN: "MRN-2", FirstName: "Annabel", LastName: "Jones", BirthDate: born(1990)},
+		{ID: 3, MRN: "MRN-3", FirstName: "John", LastName: "Annan", BirthDate: born(2000)},
+		{ID: 4, MRN: "MRN-4", FirstName: "Mary", LastName: "100%_Smith"},
+		{ID: 5, MRN: "MRN-5", FirstName: "Anna", LastName: "Smith", MergedIntoID: &survivor},
+	} {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create patient: %v", err)
+		}
+	}
+	return NewPatientService(db)
+}
+
+// ids returns the IDs of a page's patients, in order.
+func ids(page query.Page[models.Patient]) []uint {
+	ids := []uint{}
+	for _, p := range page.Items {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func TestSearchPatients(t *testing.T) {
+	s := newSearchService(t)
+	tests := []struct {
+		name     string
+		filters  map[string]string
+		excluded []uint
+		want     []uint
+	}{
+		{"merged records are hidden", nil, nil, []uint{1, 2, 3, 4}},
+		{"merged records on request", map[string]string{"merged": "true"}, nil, []uint{5}},
+		{"name prefix of first or last name", map[string]string{"name": "ann"}, nil, []uint{1, 2, 3}},
+		{"name prefix of the full name", map[string]string{"name": "Anna Sm"}, nil, []uint{1}},
+		{"every word somewhere in the name", map[string]string{"q": "smith ann"}, nil, []uint{1}},
+		{"wildcards are literal", map[string]string{"q": "%_"}, nil, []uint{4}},
+		{"born from, inclusive", map[string]string{"bornFrom": "1990-06-01"}, nil, []uint{2, 3}},
+		{"exact MRN", map[string]string{"mrn": "MRN-3"}, nil, []uint{3}},
+		{"excluded patients are left out", map[string]string{"name": "ann"}, []uint{2}, []uint{1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.SearchPatients(query.Params{Filters: tt.filters}, tt.excluded)
+			if err != nil {
+				t.Fatalf("SearchPatients: %v", err)
+			}
+			if got := ids(page); !reflect.DeepEqual(got, tt.want) || page.Total != int64(len(tt.want)) {
+				t.Errorf("got %v (total %d), want %v", got, page.Total, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.SearchPatients(query.Params{Filters: map[string]string{"bornFrom": "June"}}, nil); !errors.Is(err, query.ErrInvalidQuery) {
+		t.Errorf("malformed date: got %v, want query.ErrInvalidQuery", err)
+	}
+	if _, err := s.SearchPatients(query.Params{Sort: "details"}, nil); !errors.Is(err, query.ErrInvalidQuery) {
+		t.Errorf("sort by a field not in the allow-list: got %v, want query.ErrInvalidQuery", err)
+	}
+}
+
+func TestSearchPatientsPages(t *testing.T) {
+	s := newSearchService(t)
+	// Patients without a birth date come last; each cursor carries on after the previous page
+	var got []uint
+	params := query.Params{Limit: 3, Sort: "-birthDate"}
+	for {
+		page, err := s.SearchPatients(params, nil)
+		if err != nil {
+			t.Fatalf("SearchPatients: %v", err)
+		}
+		got = append(got, ids(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		params.Cursor = page.NextCursor
+	}
+	if want := []uint{3, 2, 1, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+}
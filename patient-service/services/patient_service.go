@@ -2,32 +2,82 @@ package services
 
 import (
 	"errors"
-	"time"
+	"fmt"
 
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
 	"github.com/fitnis/shared/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // PatientService handles database operations for patients.
 type PatientService struct {
 	DB *gorm.DB
+
+	// Dependents applies the deletion rules to examinations, appointments and chart notes; deletes fail with
+	// deletion.ErrUnavailable until its client is set
+	Dependents *deletion.Cascader
 }
 
 // NewPatientService creates a new PatientService.
 func NewPatientService(db *gorm.DB) *PatientService {
-	return &PatientService{DB: db}
+	return &PatientService{DB: db, Dependents: deletion.NewCascader(deletion.Patients, nil)}
+}
+
+// DuplicateError is returned by CreatePatient when likely duplicates exist and creating
+// the patient anyway was not confirmed.
+type DuplicateError struct {
+	Candidates []DuplicateCandidate
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("possible duplicate patient: %d similar record(s) found", len(e.Candidates))
 }
 
-// CreatePatient adds a new patient to the database.
-func (s *PatientService) CreatePatient(firstName, lastName, details string, birthDate *time.Time) (models.Patient, error) {
-	patient := models.Patient{
-		FirstName: firstName,
-		LastName:  lastName,
-		BirthDate: birthDate,
-		Details:   details,
+// CreatePatient validates and adds a new patient with a generated MRN, emergency contacts and
+// any external identifiers. Unless allowDuplicate is set, it returns a *DuplicateError when
+// the patient closely matches an existing one.
+func (s *PatientService) CreatePatient(patient models.Patient, identifiers []models.PatientIdentifier, allowDuplicate bool) (models.Patient, error) {
+	if err := validatePatient(&patient); err != nil {
+		return models.Patient{}, err
+	}
+	if !allowDuplicate {
+		candidates, err := s.FindDuplicates(patient, identifiers)
+		if err != nil {
+			return models.Patient{}, err
+		}
+		if len(candidates) > 0 {
+			return models.Patient{}, &DuplicateError{Candidates: candidates}
+		}
+	}
+
+	patient.ID = 0
+	patient.MergedIntoID = nil
+	patient.Identifiers = nil
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		mrn, err := newMRN(tx)
+		if err != nil {
+			return err
+		}
+		patient.MRN = mrn
+		// Creates the emergency contacts along with the patient
+		if err := tx.Create(&patient).Error; err != nil {
+			return err
+		}
+		for _, identifier := range identifiers {
+			created, err := addIdentifier(tx, patient.ID, identifier)
+			if err != nil {
+				return err
+			}
+			patient.Identifiers = append(patient.Identifiers, created)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Patient{}, err
 	}
-	result := s.DB.Create(&patient)
-	return patient, result.Error
+	return patient, nil
 }
 
 // GetPatients retrieves all patients from the database.
@@ -37,10 +87,12 @@ func (s *PatientService) GetPatients() ([]models.Patient, error) {
 	return patients, result.Error
 }
 
-// GetPatientByID retrieves a patient by their ID.
+// GetPatientByID retrieves a patient by their ID, with identifiers and emergency contacts.
 func (s *PatientService) GetPatientByID(id uint) (models.Patient, error) {
 	var patient models.Patient
-	result := s.DB.First(&patient, id)
+	result := s.DB.Preload("Identifiers", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("EmergencyContacts", func(db *gorm.DB) *gorm.DB { return db.Order("priority, id") }).
+		First(&patient, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return models.Patient{}, errors.New("patient not found")
@@ -50,39 +102,87 @@ func (s *PatientService) GetPatientByID(id uint) (models.Patient, error) {
 	return patient, nil
 }
 
-// UpdatePatient updates an existing patient's details.
-func (s *PatientService) UpdatePatient(id uint, firstName, lastName, details string, birthDate time.Time) (models.Patient, error) {
+// UpdatePatient applies a partial update to a patient. Fields left nil in the update keep
+// their stored values; when EmergencyContacts is set it replaces the whole list. It fails with
+// etag.ErrMismatch unless the patient is still at the given version.
+func (s *PatientService) UpdatePatient(id, version uint, update PatientUpdate) (models.Patient, error) {
 	patient, err := s.GetPatientByID(id)
 	if err != nil {
 		return models.Patient{}, err
 	}
-
-	// Only update fields if they are provided in the request (check non-zero/non-empty)
-	// Note: A more robust way might involve using a map[string]interface{} or separate update DTOs
-	if firstName != "" {
-		patient.FirstName = firstName
+	if patient.ErasedAt != nil {
+		return models.Patient{}, ErrPatientErased
 	}
-	if lastName != "" {
-		patient.LastName = lastName
-	}
-	if !birthDate.IsZero() {
-		patient.BirthDate = &birthDate
+
+	update.apply(&patient)
+	if err := validatePatient(&patient); err != nil {
+		return models.Patient{}, err
 	}
-	// Allow clearing details
-	patient.Details = details
 
-	result := s.DB.Save(&patient)
-	return patient, result.Error
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := etag.Expect(tx, version).Omit(clause.Associations).Save(&patient).Error; err != nil {
+			return err
+		}
+		if update.EmergencyContacts != nil {
+			return replaceEmergencyContacts(tx, patient.ID, patient.EmergencyContacts)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Patient{}, err
+	}
+	return s.GetPatientByID(id)
 }
 
-// DeletePatient removes a patient from the database.
-func (s *PatientService) DeletePatient(id uint) error {
-	result := s.DB.Delete(&models.Patient{}, id)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
+// DeletePatient soft-deletes a patient with their admissions, applying the deletion rules to their
+// examinations, appointments and chart notes. The patient's emergency contacts, allergies,
+// conditions, consents and external identifiers are kept until the patient is purged, so a restore
+// brings them back; the identifiers stay registered meanwhile. It fails with deletion.ErrBlocked
+// while the patient is admitted or a rule forbids the delete, and with etag.ErrMismatch unless the
+// patient is still at the given version.
+func (s *PatientService) DeletePatient(id, version uint) error {
+	if _, err := s.GetPatientByID(id); err != nil {
 		return errors.New("patient not found or already deleted")
 	}
+	if _, admitted, err := openAdmission(s.DB, id); err != nil {
+		return err
+	} else if admitted {
+		return fmt.Errorf("%w: the patient must be discharged first", deletion.ErrBlocked)
+	}
+	ids := []uint{id}
+	if err := s.Dependents.Check(ids); err != nil {
+		return err
+	}
+	at := deletion.Stamp()
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := etag.Expect(deletion.At(tx, at), version).Delete(&models.Patient{}, id).Error; err != nil {
+			return err
+		}
+		_, err := deletion.SoftDelete(tx, &models.Admission{}, "patient_id", ids, at)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.Dependents.Delete(ids, at); err != nil {
+		// Bring the patient back rather than leave their records behind
+		if undoErr := restoreLocal(s.DB, ids, at); undoErr != nil {
+			return fmt.Errorf("%w; the patient stays deleted: %v", err, undoErr)
+		}
+		return err
+	}
 	return nil
 }
+
+// missingOrChanged tells why a change limited to an expected version left a
+// patient's record alone: the patient has no such record, or it moved past that version.
+func missingOrChanged(db *gorm.DB, model interface{}, patientID, id uint, notFound string) error {
+	var count int64
+	if err := db.Model(model).Where("id = ? AND patient_id = ?", id, patientID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New(notFound)
+	}
+	return etag.ErrMismatch
+}
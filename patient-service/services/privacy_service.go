@@ -0,0 +1,539 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"gorm.io/gorm"
+)
+
+// Datasets holding a patient's data. The patient and admissions are held here; the others
+// belong to the services listed in remoteDatasets.
+const (
+	DatasetPatient       = "patient"
+	DatasetAdmissions    = "admissions"
+	DatasetExaminations  = "examinations"
+	DatasetSamples       = "samples"
+	DatasetPrescriptions = "prescriptions"
+	DatasetReferrals     = "referrals"
+	DatasetOrders        = "orders"
+	DatasetChart         = "chart"
+	DatasetAppointments  = "appointments"
+)
+
+// Erasure step and record statuses.
+const (
+	ErasureErased    = "erased"
+	ErasureRetained  = "retained"
+	ErasureFailed    = "failed"
+	ErasureCompleted = "completed"
+	ErasurePartial   = "partial"
+)
+
+// ErrAlreadyErased is returned when erasing a patient whose data was already erased in full.
+var ErrAlreadyErased = errors.New("patient data has already been erased")
+
+// ErrPatientErased is returned when changing a patient whose data was erased.
+var ErrPatientErased = errors.New("patient data has been erased")
+
+// ErrErasureFailed is returned with the erasure record when a dataset could not be erased.
+// The patient is left unerased so the erasure can be retried.
+var ErrErasureFailed = errors.New("erasure did not complete")
+
+// ErrInvalidHold is returned when retention hold details fail validation.
+var ErrInvalidHold = errors.New("invalid retention hold")
+
+// ErrHoldReleased is returned when releasing a retention hold a second time.
+var ErrHoldReleased = errors.New("retention hold has already been released")
+
+// remoteDataset is a patient-scoped dataset held by another service.
+type remoteDataset struct {
+	name    string // as in retention holds and erasure steps
+	service string // the service holding it
+}
+
+// remoteDatasets are every patient-scoped dataset held by other services. They are exported
+// and erased in this order, before the patient; dependents of examinations come first.
+var remoteDatasets = []remoteDataset{
+	{DatasetSamples, "samples"},
+	{DatasetPrescriptions, "prescriptions"},
+	{DatasetReferrals, "referrals"},
+	{DatasetOrders, "orders"},
+	{DatasetChart, "records"},
+	{DatasetAppointments, "appointments"},
+	{DatasetExaminations, "examinations"},
+}
+
+// holdScopes are the scopes a retention hold can cover.
+var holdScopes = []string{"*", DatasetPatient, DatasetAdmissions, DatasetExaminations, DatasetSamples,
+	DatasetPrescriptions, DatasetReferrals, DatasetOrders, DatasetChart, DatasetAppointments}
+
+// DataClient exports and erases patient data held by other services.
+type DataClient interface {
+	Export(service string, req privacy.Request) (json.RawMessage, error)
+	Erase(service string, req privacy.Request) (int, error)
+}
+
+// PrivacyService exports a patient's data from every service and erases it, subject to retention holds.
+type PrivacyService struct {
+	DB       *gorm.DB
+	Patients *PatientService
+
+	// Data reaches the services holding remoteDatasets
+	Data DataClient
+}
+
+// NewPrivacyService creates a new PrivacyService.
+func NewPrivacyService(db *gorm.DB, patients *PatientService) *PrivacyService {
+	return &PrivacyService{DB: db, Patients: patients}
+}
+
+// ExportBundle is everything held about one patient.
+type ExportBundle struct {
+	ExportedAt    time.Time          `json:"exportedAt"`
+	Patient       models.Patient     `json:"patient"` // with identifiers and emergency contacts
+	Allergies     []models.Allergy   `json:"allergies"`
+	Conditions    []models.Condition `json:"conditions"`
+	Consents      []models.Consent   `json:"consents"`
+	Admissions    []models.Admission `json:"admissions"` // with transfers
+	Examinations  json.RawMessage    `json:"examinations"`
+	Samples       json.RawMessage    `json:"samples"`
+	Prescriptions json.RawMessage    `json:"prescriptions"`
+	Referrals     json.RawMessage    `json:"referrals"`
+	Orders        json.RawMessage    `json:"orders"` // with items
+	Chart         json.RawMessage    `json:"chart"`
+	Appointments  json.RawMessage    `json:"appointments"`
+}
+
+// remote returns where the bundle holds a remote dataset.
+func (b *ExportBundle) remote(dataset string) *json.RawMessage {
+	switch dataset {
+	case DatasetExaminations:
+		return &b.Examinations
+	case DatasetSamples:
+		return &b.Samples
+	case DatasetPrescriptions:
+		return &b.Prescriptions
+	case DatasetReferrals:
+		return &b.Referrals
+	case DatasetOrders:
+		return &b.Orders
+	case DatasetChart:
+		return &b.Chart
+	case DatasetAppointments:
+		return &b.Appointments
+	}
+	panic("privacy: no export field for dataset " + dataset)
+}
+
+// ExportPatient gathers a patient's data from every service. The export fails rather than
+// leave anything out when a service cannot be reached.
+func (s *PrivacyService) ExportPatient(id uint) (ExportBundle, error) {
+	patient, err := s.Patients.GetPatientByID(id)
+	if err != nil {
+		return ExportBundle{}, err
+	}
+	bundle := ExportBundle{ExportedAt: time.Now(), Patient: patient}
+	for _, records := range []interface{}{&bundle.Allergies, &bundle.Conditions, &bundle.Consents} {
+		if err := s.DB.Where("patient_id = ?", id).Order("id").Find(records).Error; err != nil {
+			return ExportBundle{}, err
+		}
+	}
+	if err := s.DB.Unscoped().Preload("Transfers").Where("patient_id = ?", id).Order("id").Find(&bundle.Admissions).Error; err != nil {
+		return ExportBundle{}, err
+	}
+
+	if s.Data == nil {
+		return ExportBundle{}, fmt.Errorf("%w: no data client configured", privacy.ErrUnavailable)
+	}
+	bundle.Examinations, err = s.Data.Export(serviceOf(DatasetExaminations), privacy.Request{PatientID: id})
+	if err != nil {
+		return ExportBundle{}, err
+	}
+	examinationIDs, err := recordIDs(bundle.Examinations)
+	if err != nil {
+		return ExportBundle{}, err
+	}
+	req := privacy.Request{PatientID: id, ExaminationIDs: examinationIDs}
+	for _, dataset := range remoteDatasets {
+		if dataset.name == DatasetExaminations {
+			continue
+		}
+		if *bundle.remote(dataset.name), err = s.Data.Export(dataset.service, req); err != nil {
+			return ExportBundle{}, err
+		}
+	}
+	return bundle, nil
+}
+
+// WriteZip writes the bundle as a ZIP archive with one JSON file per dataset and a manifest.
+func (b ExportBundle) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"patient.json", b.Patient},
+		{"allergies.json", b.Allergies},
+		{"conditions.json", b.Conditions},
+		{"consents.json", b.Consents},
+		{"admissions.json", b.Admissions},
+		{"examinations.json", b.Examinations},
+		{"samples.json", b.Samples},
+		{"prescriptions.json", b.Prescriptions},
+		{"referrals.json", b.Referrals},
+		{"orders.json", b.Orders},
+		{"chart.json", b.Chart},
+		{"appointments.json", b.Appointments},
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.name
+	}
+	manifest := map[string]interface{}{"patientId": b.Patient.ID, "exportedAt": b.ExportedAt, "files": names}
+	files = append(files, struct {
+		name string
+		data interface{}
+	}{"manifest.json", manifest})
+
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: b.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// ErasePatient anonymises a patient's data in every service, except datasets under a retention
+// hold, and records the outcome. When a dataset fails the patient record itself is kept so the
+// erasure can be retried; the record is returned along with ErrErasureFailed.
+func (s *PrivacyService) ErasePatient(id uint, requestedBy, reason string) (models.PatientErasure, error) {
+	patient, err := s.Patients.GetPatientByID(id)
+	if err != nil {
+		return models.PatientErasure{}, err
+	}
+	if patient.ErasedAt != nil {
+		// Datasets retained under a hold can be erased once it is released
+		var last models.PatientErasure
+		err := s.DB.Where("patient_id = ?", id).Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return models.PatientErasure{}, err
+		}
+		if last.Status == ErasureCompleted {
+			return models.PatientErasure{}, ErrAlreadyErased
+		}
+	}
+	holds, err := s.holdsInForce(id)
+	if err != nil {
+		return models.PatientErasure{}, err
+	}
+
+	erasure := models.PatientErasure{PatientID: id, RequestedBy: requestedBy, Reason: reason, RequestedAt: time.Now()}
+	req, err := s.erasureRequest(id)
+	failed := err != nil
+	for _, dataset := range remoteDatasets {
+		step := models.ErasureStep{Dataset: dataset.name, HoldIDs: heldBy(holds, dataset.name)}
+		switch {
+		case len(step.HoldIDs) > 0:
+			step.Status = ErasureRetained
+		case err != nil:
+			// Without the examination IDs nothing can be erased safely
+			step.Status, step.Error = ErasureFailed, err.Error()
+		default:
+			if step.Records, step.Error = s.eraseRemote(dataset.service, req); step.Error != "" {
+				step.Status, failed = ErasureFailed, true
+			} else {
+				step.Status = ErasureErased
+			}
+		}
+		erasure.Steps = append(erasure.Steps, step)
+	}
+
+	step := models.ErasureStep{Dataset: DatasetAdmissions, HoldIDs: heldBy(holds, DatasetAdmissions)}
+	if len(step.HoldIDs) > 0 {
+		step.Status = ErasureRetained
+	} else if step.Records, err = s.eraseAdmissions(id); err != nil {
+		step.Status, step.Error, failed = ErasureFailed, err.Error(), true
+	} else {
+		step.Status = ErasureErased
+	}
+	erasure.Steps = append(erasure.Steps, step)
+
+	step = models.ErasureStep{Dataset: DatasetPatient, HoldIDs: heldBy(holds, DatasetPatient)}
+	switch {
+	case patient.ErasedAt != nil:
+		// Erased by an earlier request that had to retain other datasets
+		step.Status, step.HoldIDs = ErasureErased, nil
+	case len(step.HoldIDs) > 0:
+		step.Status = ErasureRetained
+	case failed:
+		step.Status, step.Error = ErasureFailed, "kept until the other datasets are erased"
+	default:
+		if step.Records, err = s.erasePatientRecord(id); err != nil {
+			step.Status, step.Error, failed = ErasureFailed, err.Error(), true
+		} else {
+			step.Status = ErasureErased
+		}
+	}
+	erasure.Steps = append(erasure.Steps, step)
+
+	erasure.Status = erasureStatus(erasure.Steps)
+	if erasure.Status != ErasureFailed {
+		now := time.Now()
+		erasure.CompletedAt = &now
+	}
+	if err := s.DB.Create(&erasure).Error; err != nil {
+		return models.PatientErasure{}, err
+	}
+	if failed {
+		return erasure, ErrErasureFailed
+	}
+	return erasure, nil
+}
+
+// erasureRequest finds the patient's examinations, which the samples,
+// prescriptions and referrals to erase hang off.
+func (s *PrivacyService) erasureRequest(id uint) (privacy.Request, error) {
+	if s.Data == nil {
+		return privacy.Request{}, fmt.Errorf("%w: no data client configured", privacy.ErrUnavailable)
+	}
+	examinations, err := s.Data.Export(serviceOf(DatasetExaminations), privacy.Request{PatientID: id})
+	if err != nil {
+		return privacy.Request{}, err
+	}
+	examinationIDs, err := recordIDs(examinations)
+	if err != nil {
+		return privacy.Request{}, err
+	}
+	return privacy.Request{PatientID: id, ExaminationIDs: examinationIDs}, nil
+}
+
+// eraseRemote erases one dataset in its service, returning the error as text for the record.
+func (s *PrivacyService) eraseRemote(service string, req privacy.Request) (int, string) {
+	erased, err := s.Data.Erase(service, req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	return erased, ""
+}
+
+// eraseAdmissions anonymises a patient's admissions by removing their reasons, discharge
+// summaries and the reasons of their transfers. Wards, beds and times are kept so bed
+// occupancy stays intact.
+func (s *PrivacyService) eraseAdmissions(id uint) (int, error) {
+	var erased int
+	err := audit.Redacted(s.DB).Transaction(func(tx *gorm.DB) error {
+		admissions := tx.Unscoped().Model(&models.Admission{}).Select("id").Where("patient_id = ?", id)
+		err := tx.Model(&models.AdmissionTransfer{}).Where("admission_id IN (?)", admissions).
+			Update("reason", privacy.ErasedText).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Model(&models.Admission{}).Where("patient_id = ?", id).Updates(map[string]interface{}{
+			"reason":            privacy.ErasedText,
+			"discharge_summary": gorm.Expr("CASE WHEN discharge_summary = '' THEN '' ELSE ? END", privacy.ErasedText),
+		})
+		erased = int(result.RowsAffected)
+		return result.Error
+	})
+	return erased, err
+}
+
+// serviceOf returns the service holding a remote dataset.
+func serviceOf(dataset string) string {
+	for _, d := range remoteDatasets {
+		if d.name == dataset {
+			return d.service
+		}
+	}
+	panic("privacy: unknown dataset " + dataset)
+}
+
+// erasePatientRecord anonymises the patient and deletes the records that only
+// describe them. The row and its MRN are kept so references from other services still resolve.
+func (s *PrivacyService) erasePatientRecord(id uint) (int, error) {
+	records := 0
+	err := audit.Redacted(s.DB).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Patient{}).Where("id = ? AND erased_at IS NULL", id).Updates(map[string]interface{}{
+			"first_name": privacy.ErasedText, "last_name": privacy.ErasedText, "birth_date": nil, "details": "",
+			"sex": "", "gender": "", "phone": "", "email": "", "preferred_language": "",
+			"address_line1": "", "address_line2": "", "address_city": "", "address_postal_code": "",
+			"address_region": "", "address_country": "", "erased_at": now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyErased
+		}
+		records++
+		for _, model := range []interface{}{&models.PatientIdentifier{}, &models.EmergencyContact{}, &models.Allergy{}, &models.Condition{}, &models.Consent{}} {
+			result := tx.Where("patient_id = ?", id).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			records += int(result.RowsAffected)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// erasureStatus sums up the steps of an erasure.
+func erasureStatus(steps []models.ErasureStep) string {
+	erased, retained := 0, 0
+	for _, step := range steps {
+		switch step.Status {
+		case ErasureFailed:
+			return ErasureFailed
+		case ErasureErased:
+			erased++
+		case ErasureRetained:
+			retained++
+		}
+	}
+	switch {
+	case retained == 0:
+		return ErasureCompleted
+	case erased == 0:
+		return ErasureRetained
+	default:
+		return ErasurePartial
+	}
+}
+
+// GetErasures retrieves the erasure records of a patient, newest first.
+func (s *PrivacyService) GetErasures(patientID uint) ([]models.PatientErasure, error) {
+	if _, err := s.Patients.GetPatientByID(patientID); err != nil {
+		return nil, err
+	}
+	erasures := []models.PatientErasure{}
+	result := s.DB.Where("patient_id = ?", patientID).Order("requested_at DESC, id DESC").Find(&erasures)
+	return erasures, result.Error
+}
+
+// GetErasure retrieves one of a patient's erasure records.
+func (s *PrivacyService) GetErasure(patientID, erasureID uint) (models.PatientErasure, error) {
+	var erasure models.PatientErasure
+	result := s.DB.Where("id = ? AND patient_id = ?", erasureID, patientID).Limit(1).Find(&erasure)
+	if result.Error != nil {
+		return models.PatientErasure{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.PatientErasure{}, errors.New("erasure not found")
+	}
+	return erasure, nil
+}
+
+// GetHolds retrieves a patient's retention holds, including released ones.
+func (s *PrivacyService) GetHolds(patientID uint) ([]models.RetentionHold, error) {
+	if _, err := s.Patients.GetPatientByID(patientID); err != nil {
+		return nil, err
+	}
+	holds := []models.RetentionHold{}
+	result := s.DB.Where("patient_id = ?", patientID).Order("id").Find(&holds)
+	return holds, result.Error
+}
+
+// PlaceHold puts a retention hold on a dataset of a patient's data, or on all of it.
+func (s *PrivacyService) PlaceHold(patientID uint, hold models.RetentionHold) (models.RetentionHold, error) {
+	if _, err := s.Patients.GetPatientByID(patientID); err != nil {
+		return models.RetentionHold{}, err
+	}
+	hold.Scope = strings.ToLower(strings.TrimSpace(hold.Scope))
+	hold.Reason = strings.TrimSpace(hold.Reason)
+	if hold.Scope == "" {
+		hold.Scope = "*"
+	}
+	if !slices.Contains(holdScopes, hold.Scope) {
+		return models.RetentionHold{}, fmt.Errorf("%w: scope must be one of %s", ErrInvalidHold, strings.Join(holdScopes, ", "))
+	}
+	if hold.Reason == "" {
+		return models.RetentionHold{}, fmt.Errorf("%w: reason is required", ErrInvalidHold)
+	}
+	hold.ID = 0
+	hold.PatientID = patientID
+	hold.PlacedAt = time.Now()
+	hold.ReleasedAt, hold.ReleasedBy = nil, ""
+	if hold.Until != nil && !hold.Until.After(hold.PlacedAt) {
+		return models.RetentionHold{}, fmt.Errorf("%w: until must be in the future", ErrInvalidHold)
+	}
+	result := s.DB.Create(&hold)
+	return hold, result.Error
+}
+
+// ReleaseHold lifts a retention hold.
+func (s *PrivacyService) ReleaseHold(patientID, holdID uint, releasedBy string) (models.RetentionHold, error) {
+	var hold models.RetentionHold
+	result := s.DB.Where("id = ? AND patient_id = ?", holdID, patientID).Limit(1).Find(&hold)
+	if result.Error != nil {
+		return models.RetentionHold{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.RetentionHold{}, errors.New("retention hold not found")
+	}
+
+	now := time.Now()
+	// Conditional update so a hold is released exactly once
+	result = s.DB.Model(&models.RetentionHold{}).Where("id = ? AND released_at IS NULL", hold.ID).
+		Updates(map[string]interface{}{"released_at": now, "released_by": releasedBy})
+	if result.Error != nil {
+		return models.RetentionHold{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.RetentionHold{}, ErrHoldReleased
+	}
+	hold.ReleasedAt, hold.ReleasedBy = &now, releasedBy
+	return hold, nil
+}
+
+// holdsInForce loads a patient's unreleased, unexpired retention holds.
+func (s *PrivacyService) holdsInForce(patientID uint) ([]models.RetentionHold, error) {
+	var holds []models.RetentionHold
+	now := time.Now()
+	result := s.DB.Where("patient_id = ? AND released_at IS NULL AND (until IS NULL OR until > ?)", patientID, now).
+		Order("id").Find(&holds)
+	return holds, result.Error
+}
+
+// heldBy lists the holds covering a dataset.
+func heldBy(holds []models.RetentionHold, dataset string) []uint {
+	var ids []uint
+	for _, hold := range holds {
+		if hold.Scope == "*" || hold.Scope == dataset {
+			ids = append(ids, hold.ID)
+		}
+	}
+	return ids
+}
+
+// recordIDs reads the IDs out of an exported JSON array.
+func recordIDs(records json.RawMessage) ([]uint, error) {
+	var items []struct {
+		ID uint `json:"id"`
+	}
+	if err := json.Unmarshal(records, &items); err != nil {
+		return nil, fmt.Errorf("%w: invalid export: %v", privacy.ErrUnavailable, err)
+	}
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeData is a DataClient holding examination 4 of the patient and recording which services it was asked.
+type fakeData struct {
+	exported, erased []string
+}
+
+func (f *fakeData) Export(service string, req privacy.Request) (json.RawMessage, error) {
+	f.exported = append(f.exported, service)
+	if service == "examinations" {
+		return json.RawMessage(`[{"id":4}]`), nil
+	}
+	return json.RawMessage(`[]`), nil
+}
+
+func (f *fakeData) Erase(service string, req privacy.Request) (int, error) {
+	f.erased = append(f.erased, service)
+	return len(req.ExaminationIDs), nil
+}
+
+// newPrivacyService opens an empty database, with the audit callbacks, holding patient 1
+// with an allergy and a discharged admission.
+func newPrivacyService(t *testing.T) (*PrivacyService, *fakeData) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	err = db.AutoMigrate(&models.Patient{}, &models.PatientIdentifier{}, &models.EmergencyContact{}, &models.Allergy{},
+		&models.Condition{}, &models.Consent{}, &models.Admission{}, &models.AdmissionTransfer{},
+		&models.RetentionHold{}, &models.PatientErasure{}, &models.AuditEntry{}, &models.RecordVersion{})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := audit.Register(db, "patients"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	discharged := time.Now()
+	db.Create(&models.Patient{ID: 1, MRN: "MRN-1", FirstName: "Zelda", LastName: "Quist"})
+	db.Create(&models.Allergy{PatientID: 1, Substance: "penicillin"})
+	db.Create(&models.Admission{PatientID: 1, Ward: "Cardiology", Reason: "chest pain", DischargedAt: &discharged, DischargeSummary: "stable"})
+
+	data := &fakeData{}
+	s := NewPrivacyService(db, NewPatientService(db))
+	s.Data = data
+	return s, data
+}
+
+func TestExportPatientCoversEveryDataset(t *testing.T) {
+	s, data := newPrivacyService(t)
+	bundle, err := s.ExportPatient(1)
+	if err != nil {
+		t.Fatalf("ExportPatient: %v", err)
+	}
+	want := []string{"examinations", "samples", "prescriptions", "referrals", "orders", "records", "appointments"}
+	if !reflect.DeepEqual(data.exported, want) {
+		t.Errorf("exported from %v, want %v", data.exported, want)
+	}
+	if len(bundle.Admissions) != 1 || bundle.Admissions[0].Reason != "chest pain" {
+		t.Errorf("admissions = %+v, want the patient's admission", bundle.Admissions)
+	}
+	if string(bundle.Chart) != "[]" || string(bundle.Appointments) != "[]" || string(bundle.Orders) != "[]" {
+		t.Errorf("chart, appointments and orders were not exported: %s %s %s", bundle.Chart, bundle.Appointments, bundle.Orders)
+	}
+}
+
+func TestErasePatientLeavesNoValuesInTheAuditLog(t *testing.T) {
+	s, data := newPrivacyService(t)
+	erasure, err := s.ErasePatient(1, "dpo", "request")
+	if err != nil {
+		t.Fatalf("ErasePatient: %v", err)
+	}
+	if erasure.Status != ErasureCompleted {
+		t.Fatalf("status = %s, want %s: %+v", erasure.Status, ErasureCompleted, erasure.Steps)
+	}
+	want := []string{"samples", "prescriptions", "referrals", "orders", "records", "appointments", "examinations"}
+	if !reflect.DeepEqual(data.erased, want) {
+		t.Errorf("erased in %v, want %v", data.erased, want)
+	}
+
+	var admission models.Admission
+	s.DB.First(&admission)
+	if admission.Reason != privacy.ErasedText || admission.DischargeSummary != privacy.ErasedText || admission.Ward != "Cardiology" {
+		t.Errorf("admission = %+v, want the reason and summary erased and the ward kept", admission)
+	}
+
+	var entries []models.AuditEntry
+	s.DB.Where("action IN ?", []string{audit.ActionUpdate, audit.ActionDelete}).Find(&entries)
+	if len(entries) == 0 {
+		t.Fatal("the erasure was not audited")
+	}
+	for _, entry := range entries {
+		for _, change := range entry.Changes {
+			if change.Before != nil || change.After != nil {
+				t.Errorf("%s %s %s recorded the values of %s", entry.Action, entry.ResourceType, entry.ResourceID, change.Field)
+			}
+		}
+	}
+}
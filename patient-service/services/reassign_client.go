@@ -0,0 +1,58 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fitnis/shared/kafka"
+)
+
+// ReassignClient moves a patient's records between patients in the service that owns them.
+type ReassignClient interface {
+	Reassign(fromPatientID, toPatientID uint, ids []uint) ([]uint, error)
+}
+
+// KafkaReassignClient reassigns records by sending POST /reassign to their service over Kafka.
+type KafkaReassignClient struct {
+	Service string // the owning service, e.g. "examinations"
+	Field   string // the JSON field holding the record IDs, e.g. "examinationIds"
+	Timeout time.Duration
+}
+
+// NewKafkaReassignClient creates a reassign client for a service with a default timeout.
+func NewKafkaReassignClient(service, field string) *KafkaReassignClient {
+	return &KafkaReassignClient{Service: service, Field: field, Timeout: 15 * time.Second}
+}
+
+// Reassign sends POST /api/<service>/reassign and returns the IDs that were moved.
+func (k *KafkaReassignClient) Reassign(fromPatientID, toPatientID uint, ids []uint) ([]uint, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"fromPatientId": fromPatientID,
+		"toPatientId":   toPatientID,
+		k.Field:         ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := kafka.SendRequest(k.Service, kafka.KafkaRequest{
+		Method:  "POST",
+		Path:    "/reassign",
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    body,
+	}, k.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s service returned status %d: %s", k.Service, resp.StatusCode, resp.Body)
+	}
+
+	var result map[string][]uint
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode reassigned %s: %w", k.Service, err)
+	}
+	return result[k.Field], nil
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/references"
+)
+
+// CheckReference tells other services whether new records may reference the patient.
+// Deleted patients do not exist; merged and erased patients exist but are inactive.
+func (s *PatientService) CheckReference(id uint) (references.Result, error) {
+	var patient models.Patient
+	result := s.DB.Select("id", "merged_into_id", "erased_at").Limit(1).Find(&patient, id)
+	if result.Error != nil {
+		return references.Result{}, result.Error
+	}
+	switch {
+	case result.RowsAffected == 0:
+		return references.Result{}, nil
+	case patient.MergedIntoID != nil:
+		return references.Result{Exists: true, Reason: fmt.Sprintf("merged into patient %d", *patient.MergedIntoID)}, nil
+	case patient.ErasedAt != nil:
+		return references.Result{Exists: true, Reason: "personal data erased"}, nil
+	}
+	return references.Result{Exists: true, Active: true}, nil
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fitnis/practitioner-service/services"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"github.com/gin-gonic/gin"
+)
+
+// PractitionerHandler holds the practitioner service.
+type PractitionerHandler struct {
+	Service *services.PractitionerService
+}
+
+// NewPractitionerHandler creates a new PractitionerHandler.
+func NewPractitionerHandler(s *services.PractitionerService) *PractitionerHandler {
+	return &PractitionerHandler{Service: s}
+}
+
+// AvailabilityRequest is a weekly availability window
+type AvailabilityRequest struct {
+	Weekday   int    `json:"weekday"`
+	StartTime string `json:"startTime"`
+	EndTime   string `json:"endTime"`
+}
+
+type CreatePractitionerRequest struct {
+	FirstName     string                `json:"firstName" binding:"required"`
+	LastName      string                `json:"lastName" binding:"required"`
+	Title         string                `json:"title"`
+	LicenceNumber string                `json:"licenceNumber" binding:"required"`
+	Department    string                `json:"department"`
+	Email         string                `json:"email"`
+	Phone         string                `json:"phone"`
+	Specialties   []string              `json:"specialties"`
+	Availability  []AvailabilityRequest `json:"availability"`
+}
+
+// UpdatePractitionerRequest replaces specialties/availability only when they are present in the body
+type UpdatePractitionerRequest struct {
+	FirstName     string                `json:"firstName"`
+	LastName      string                `json:"lastName"`
+	Title         string                `json:"title"`
+	LicenceNumber string                `json:"licenceNumber"`
+	Department    string                `json:"department"`
+	Email         string                `json:"email"`
+	Phone         string                `json:"phone"`
+	Active        *bool                 `json:"active"`
+	Specialties   []string              `json:"specialties"`
+	Availability  []AvailabilityRequest `json:"availability"`
+}
+
+// GetPractitioners handles GET /api/practitioners?specialty=&department=&active=&name=&sort=&limit=&offset=&cursor=
+func (h *PractitionerHandler) GetPractitioners(c *gin.Context) {
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetPractitioners(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve practitioners: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetPractitioner handles GET /api/practitioners/:id
+func (h *PractitionerHandler) GetPractitioner(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	practitioner, err := h.Service.GetPractitionerByID(uint(id))
+	if err != nil {
+		if err.Error() == "practitioner not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve practitioner: " + err.Error()})
+		}
+		return
+	}
+
+	c.Header(etag.HeaderETag, etag.Format(practitioner.Version))
+	c.JSON(http.StatusOK, practitioner)
+}
+
+// CreatePractitioner handles POST /api/practitioners
+func (h *PractitionerHandler) CreatePractitioner(c *gin.Context) {
+	var req CreatePractitionerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	practitioner, err := h.Service.CreatePractitioner(models.Practitioner{
+		FirstName:     req.FirstName,
+		LastName:      req.LastName,
+		Title:         req.Title,
+		LicenceNumber: req.LicenceNumber,
+		Department:    req.Department,
+		Email:         req.Email,
+		Phone:         req.Phone,
+		Specialties:   toSpecialties(req.Specialties),
+		Availability:  toAvailability(req.Availability),
+	})
+	if err != nil {
+		if err.Error() == "licence number already registered" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if strings.HasPrefix(err.Error(), "invalid availability") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create practitioner: " + err.Error()})
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(practitioner.Version))
+	c.JSON(http.StatusCreated, practitioner)
+}
+
+// UpdatePractitioner handles PUT /api/practitioners/:id
+// The If-Match header must hold the practitioner's current ETag.
+func (h *PractitionerHandler) UpdatePractitioner(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req UpdatePractitionerRequest
+	if err := c.BindJSON(&req); err != nil { // Use BindJSON for optional fields
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	update := models.Practitioner{
+		FirstName:     req.FirstName,
+		LastName:      req.LastName,
+		Title:         req.Title,
+		LicenceNumber: req.LicenceNumber,
+		Department:    req.Department,
+		Email:         req.Email,
+		Phone:         req.Phone,
+	}
+	updated, err := h.Service.UpdatePractitioner(uint(id), version, update, req.Active, toSpecialties(req.Specialties), toAvailability(req.Availability))
+	if err != nil {
+		if err.Error() == "practitioner not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		} else if err.Error() == "licence number already registered" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if strings.HasPrefix(err.Error(), "invalid availability") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update practitioner: " + err.Error()})
+		}
+		return
+	}
+
+	c.Header(etag.HeaderETag, etag.Format(updated.Version))
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeletePractitioner handles DELETE /api/practitioners/:id
+// The If-Match header must hold the practitioner's current ETag.
+func (h *PractitionerHandler) DeletePractitioner(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	err = h.Service.DeletePractitioner(uint(id), version)
+	if err != nil {
+		if err.Error() == "practitioner not found or already deleted" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Practitioner not found"})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete practitioner: " + err.Error()})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RestorePractitioner handles POST /api/practitioners/:id/restore
+func (h *PractitionerHandler) RestorePractitioner(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	practitioner, err := h.Service.RestorePractitioner(uint(id))
+	if err != nil {
+		switch {
+		case err.Error() == "practitioner not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, deletion.ErrNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore practitioner: " + err.Error()})
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(practitioner.Version))
+	c.JSON(http.StatusOK, practitioner)
+}
+
+// toSpecialties keeps nil as nil so updates can tell "not provided" from "clear all"
+func toSpecialties(names []string) []models.PractitionerSpecialty {
+	if names == nil {
+		return nil
+	}
+	specialties := make([]models.PractitionerSpecialty, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			specialties = append(specialties, models.PractitionerSpecialty{Name: name})
+		}
+	}
+	return specialties
+}
+
+func toAvailability(reqs []AvailabilityRequest) []models.PractitionerAvailability {
+	if reqs == nil {
+		return nil
+	}
+	slots := make([]models.PractitionerAvailability, 0, len(reqs))
+	for _, r := range reqs {
+		slots = append(slots, models.PractitionerAvailability{Weekday: r.Weekday, StartTime: r.StartTime, EndTime: r.EndTime})
+	}
+	return slots
+}
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/fitnis/practitioner-service/handlers"
+	"github.com/fitnis/practitioner-service/services"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/kafka"
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	// Initialize Database
+	database.InitDB()
+	db := database.DB
+
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "practitioners")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
+	// Initialize services and handlers
+	practitionerService := services.NewPractitionerService(db)
+	practitionerHandler := handlers.NewPractitionerHandler(practitionerService)
+
+	// Purge practitioners soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, practitionerService.PurgeDeleted)
+
+	// Start Kafka consumer
+	log.Println("Starting Kafka consumer")
+	kafka.StartKafkaConsumer("practitioners", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
+		return handleKafkaRequest(req, practitionerHandler)
+	}))
+
+	// Block main goroutine
+	select {}
+}
+
+// handleKafkaRequest processes Kafka requests and returns responses
+func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PractitionerHandler) kafka.KafkaResponse {
+	// Create a mock gin context to reuse our handler functions
+	c, w := createMockGinContext(req)
+
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
+	if path == "" {
+		path = "/"
+	}
+
+	// Extract ID from path if present
+	var id uint64
+	var err error
+	idStr := extractIDFromPath(path)
+	if idStr != "" {
+		id, err = strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			return createErrorResponse(req.RequestID, http.StatusBadRequest, "Invalid ID format")
+		}
+	}
+
+	// Route to appropriate handler
+	switch {
+	case req.Method == "GET" && path == "/":
+		handler.GetPractitioners(c)
+	case req.Method == "GET" && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.GetPractitioner(c)
+	case req.Method == "POST" && id > 0 && strings.HasSuffix(path, "/restore"):
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.RestorePractitioner(c)
+	case req.Method == "POST" && path == "/":
+		handler.CreatePractitioner(c)
+	case req.Method == "PUT" && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.UpdatePractitioner(c)
+	case req.Method == "DELETE" && id > 0:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.DeletePractitioner(c)
+	default:
+		return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+	}
+
+	// Create response from the written data
+	return kafka.KafkaResponse{
+		RequestID:  req.RequestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
+// Helper functions
+
+func createMockGinContext(req kafka.KafkaRequest) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	httpReq, _ := http.NewRequest(req.Method, req.Path, bytes.NewReader(req.Body))
+
+	// Add headers
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+	return c, w
+}
+
+func extractIDFromPath(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) >= 2 {
+		return parts[1]
+	}
+	return ""
+}
+
+func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
+	errorJSON, _ := json.Marshal(gin.H{"error": message})
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: errorJSON,
+	}
+}
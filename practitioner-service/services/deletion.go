@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+)
+
+// RestorePractitioner brings back a soft-deleted practitioner with their specialties and availability.
+func (s *PractitionerService) RestorePractitioner(id uint) (models.Practitioner, error) {
+	var practitioner models.Practitioner
+	result := s.DB.Unscoped().Limit(1).Find(&practitioner, id)
+	if result.Error != nil {
+		return models.Practitioner{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Practitioner{}, errors.New("practitioner not found")
+	}
+	if !practitioner.DeletedAt.Valid {
+		return models.Practitioner{}, deletion.ErrNotDeleted
+	}
+	if err := s.DB.Unscoped().Model(&practitioner).Update("deleted_at", nil).Error; err != nil {
+		return models.Practitioner{}, err
+	}
+	return s.GetPractitionerByID(id)
+}
+
+// PurgeDeleted permanently deletes the practitioners soft-deleted before the cutoff, with their
+// specialties and availability.
+func (s *PractitionerService) PurgeDeleted(cutoff time.Time) (int, error) {
+	var ids []uint
+	err := s.DB.Unscoped().Model(&models.Practitioner{}).Where("deleted_at < ?", cutoff).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	err = audit.System(s.DB, deletion.PurgeJob).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.PractitionerSpecialty{}, &models.PractitionerAvailability{}} {
+			if err := tx.Where("practitioner_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&models.Practitioner{}, ids).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"gorm.io/gorm"
+)
+
+// timeOfDay matches "HH:MM" in 24-hour format.
+var timeOfDay = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// PractitionerService handles database operations for practitioners.
+type PractitionerService struct {
+	DB *gorm.DB
+}
+
+// NewPractitionerService creates a new PractitionerService.
+func NewPractitionerService(db *gorm.DB) *PractitionerService {
+	return &PractitionerService{DB: db}
+}
+
+// CreatePractitioner adds a new practitioner with their specialties and availability.
+func (s *PractitionerService) CreatePractitioner(practitioner models.Practitioner) (models.Practitioner, error) {
+	if err := validateAvailability(practitioner.Availability); err != nil {
+		return models.Practitioner{}, err
+	}
+	if taken, err := s.licenceTaken(practitioner.LicenceNumber, 0); err != nil {
+		return models.Practitioner{}, err
+	} else if taken {
+		return models.Practitioner{}, errors.New("licence number already registered")
+	}
+
+	practitioner.ID = 0
+	practitioner.Active = true
+	result := s.DB.Create(&practitioner)
+	return practitioner, result.Error
+}
+
+// practitionerQuery is the allow-list for listing practitioners.
+var practitionerQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"specialty":  {Apply: filterSpecialty},
+		"department": {Apply: filterDepartment},
+		"active":     {Column: "active", Kind: query.Bool},
+		"name":       {Column: "first_name || ' ' || last_name", Op: query.Contains},
+	},
+	Sorts: map[string]string{
+		"lastName":  "LOWER(COALESCE(last_name, '') || ' ' || COALESCE(first_name, ''))",
+		"firstName": "LOWER(COALESCE(first_name, '') || ' ' || COALESCE(last_name, ''))",
+	},
+	DefaultSort: "lastName",
+}
+
+// GetPractitioners retrieves one page of practitioners, by last name by default.
+// Filters: specialty, department (both case-insensitive), active and name (substring).
+func (s *PractitionerService) GetPractitioners(params query.Params) (query.Page[models.Practitioner], error) {
+	return query.Find[models.Practitioner](s.DB.Preload("Specialties").Preload("Availability"), practitionerQuery, params)
+}
+
+// filterSpecialty matches practitioners with the named specialty.
+func filterSpecialty(db *gorm.DB, value string) (*gorm.DB, error) {
+	return db.Where("id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&models.PractitionerSpecialty{}).
+		Select("practitioner_id").Where("LOWER(name) = LOWER(?)", value)), nil
+}
+
+// filterDepartment matches the department case-insensitively.
+func filterDepartment(db *gorm.DB, value string) (*gorm.DB, error) {
+	return db.Where("LOWER(department) = LOWER(?)", value), nil
+}
+
+// GetPractitionerByID retrieves a practitioner by their ID.
+func (s *PractitionerService) GetPractitionerByID(id uint) (models.Practitioner, error) {
+	var practitioner models.Practitioner
+	result := s.DB.Preload("Specialties").Preload("Availability").First(&practitioner, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.Practitioner{}, errors.New("practitioner not found")
+		}
+		return models.Practitioner{}, result.Error
+	}
+	return practitioner, nil
+}
+
+// UpdatePractitioner updates a practitioner's details. Non-nil specialties or availability
+// replace the existing lists; nil leaves them unchanged.
+// It fails with etag.ErrMismatch unless the practitioner is still at the given version.
+func (s *PractitionerService) UpdatePractitioner(id, version uint, update models.Practitioner, active *bool,
+	specialties []models.PractitionerSpecialty, availability []models.PractitionerAvailability) (models.Practitioner, error) {
+	practitioner, err := s.GetPractitionerByID(id)
+	if err != nil {
+		return models.Practitioner{}, err
+	}
+	if availability != nil {
+		if err := validateAvailability(availability); err != nil {
+			return models.Practitioner{}, err
+		}
+	}
+
+	// Update fields if provided
+	if update.FirstName != "" {
+		practitioner.FirstName = update.FirstName
+	}
+	if update.LastName != "" {
+		practitioner.LastName = update.LastName
+	}
+	if update.Title != "" {
+		practitioner.Title = update.Title
+	}
+	if update.LicenceNumber != "" && update.LicenceNumber != practitioner.LicenceNumber {
+		if taken, err := s.licenceTaken(update.LicenceNumber, id); err != nil {
+			return models.Practitioner{}, err
+		} else if taken {
+			return models.Practitioner{}, errors.New("licence number already registered")
+		}
+		practitioner.LicenceNumber = update.LicenceNumber
+	}
+	if update.Department != "" {
+		practitioner.Department = update.Department
+	}
+	if update.Email != "" {
+		practitioner.Email = update.Email
+	}
+	if update.Phone != "" {
+		practitioner.Phone = update.Phone
+	}
+	if active != nil {
+		practitioner.Active = *active
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := etag.Expect(tx, version).Omit("Specialties", "Availability").Save(&practitioner).Error; err != nil {
+			return err
+		}
+		if specialties != nil {
+			if err := tx.Where("practitioner_id = ?", id).Delete(&models.PractitionerSpecialty{}).Error; err != nil {
+				return err
+			}
+			for i := range specialties {
+				specialties[i].ID = 0
+				specialties[i].PractitionerID = id
+			}
+			if len(specialties) > 0 {
+				if err := tx.Create(&specialties).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if availability != nil {
+			if err := tx.Where("practitioner_id = ?", id).Delete(&models.PractitionerAvailability{}).Error; err != nil {
+				return err
+			}
+			for i := range availability {
+				availability[i].ID = 0
+				availability[i].PractitionerID = id
+			}
+			if len(availability) > 0 {
+				if err := tx.Create(&availability).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Practitioner{}, err
+	}
+
+	return s.GetPractitionerByID(id)
+}
+
+// DeletePractitioner soft-deletes a practitioner. Their specialties and availability are kept
+// until the practitioner is purged, so a restore brings them back, and their licence number stays
+// registered meanwhile. Appointments, orders and notes keep naming them. It fails with
+// etag.ErrMismatch unless the practitioner is still at the given version.
+func (s *PractitionerService) DeletePractitioner(id, version uint) error {
+	if _, err := s.GetPractitionerByID(id); err != nil {
+		if err.Error() == "practitioner not found" {
+			return errors.New("practitioner not found or already deleted")
+		}
+		return err
+	}
+	return etag.Expect(deletion.At(s.DB, deletion.Stamp()), version).Delete(&models.Practitioner{}, id).Error
+}
+
+// licenceTaken reports whether another practitioner, deleted or not, already holds the licence number.
+func (s *PractitionerService) licenceTaken(licence string, exceptID uint) (bool, error) {
+	var count int64
+	result := s.DB.Unscoped().Model(&models.Practitioner{}).Where("licence_number = ? AND id <> ?", licence, exceptID).Count(&count)
+	return count > 0, result.Error
+}
+
+// validateAvailability checks weekdays and "HH:MM" windows.
+func validateAvailability(slots []models.PractitionerAvailability) error {
+	for _, slot := range slots {
+		if slot.Weekday < 0 || slot.Weekday > 6 {
+			return fmt.Errorf("invalid availability: weekday %d must be between 0 (Sunday) and 6", slot.Weekday)
+		}
+		if !timeOfDay.MatchString(slot.StartTime) || !timeOfDay.MatchString(slot.EndTime) {
+			return fmt.Errorf("invalid availability: times must be HH:MM, got %q-%q", slot.StartTime, slot.EndTime)
+		}
+		if slot.StartTime >= slot.EndTime {
+			return fmt.Errorf("invalid availability: start %s must be before end %s", slot.StartTime, slot.EndTime)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/fitnis/prescription-service/pharmacy"
+)
+
+// A standalone stub pharmacy for local development and integration testing.
+func main() {
+	mode := os.Getenv("PHARMACY_STUB_MODE")
+	if mode == "" {
+		mode = pharmacy.StubAccept
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8090"
+	}
+
+	log.Printf("Starting stub pharmacy on :%s in %s mode", port, mode)
+	if err := http.ListenAndServe(":"+port, pharmacy.NewStubServer(mode)); err != nil {
+		log.Fatalf("Stub pharmacy stopped: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckDeletion handles POST /api/prescriptions/deletion/check
+// The examination service calls it before deleting examinations.
+func (h *PrescriptionHandler) CheckDeletion(c *gin.Context) {
+	h.handleDeletion(c, "check prescriptions", h.Service.CountDependents)
+}
+
+// DeleteDependents handles POST /api/prescriptions/deletion/delete
+// The examination service calls it when deleting examinations.
+func (h *PrescriptionHandler) DeleteDependents(c *gin.Context) {
+	h.handleDeletion(c, "delete prescriptions", h.Service.DeleteDependents)
+}
+
+// RestoreDependents handles POST /api/prescriptions/deletion/restore
+// The examination service calls it when restoring examinations.
+func (h *PrescriptionHandler) RestoreDependents(c *gin.Context) {
+	h.handleDeletion(c, "restore prescriptions", h.Service.RestoreDependents)
+}
+
+// RestorePrescription handles POST /api/prescriptions/:id/restore
+func (h *PrescriptionHandler) RestorePrescription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	prescription, err := h.Service.RestorePrescription(uint(id))
+	if err != nil {
+		switch {
+		case err.Error() == "prescription not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, deletion.ErrNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore prescription: " + err.Error()})
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(prescription.Version))
+	c.JSON(http.StatusOK, prescription)
+}
+
+// handleDeletion runs a deletion request from another service and replies
+// with the number of prescriptions it concerned.
+func (h *PrescriptionHandler) handleDeletion(c *gin.Context, action string, run func(deletion.Request) (int, error)) {
+	var req deletion.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	count, err := run(req)
+	if err != nil {
+		if errors.Is(err, deletion.ErrUnknownParent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + ": " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, deletion.Result{Count: count})
+}
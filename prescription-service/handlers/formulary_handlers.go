@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/fitnis/prescription-service/services"
+	"github.com/gin-gonic/gin"
+)
+
+// FormularyHandler holds the formulary service.
+type FormularyHandler struct {
+	Service *services.FormularyService
+}
+
+// NewFormularyHandler creates a new FormularyHandler.
+func NewFormularyHandler(s *services.FormularyService) *FormularyHandler {
+	return &FormularyHandler{Service: s}
+}
+
+// SearchFormulary handles GET /api/prescriptions/formulary and /api/prescriptions/formulary/search/:query
+func (h *FormularyHandler) SearchFormulary(c *gin.Context) {
+	items, err := h.Service.SearchFormulary(c.Param("query"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search formulary: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// GetFormularyItem handles GET /api/prescriptions/formulary/:code
+func (h *FormularyHandler) GetFormularyItem(c *gin.Context) {
+	item, err := h.Service.GetFormularyItem(c.Param("code"))
+	if err != nil {
+		if err.Error() == "formulary item not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve formulary item: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
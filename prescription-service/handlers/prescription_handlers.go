@@ -1,16 +1,30 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/fitnis/prescription-service/pharmacy"
 	"github.com/fitnis/prescription-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/documents"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
 	"github.com/gin-gonic/gin"
 )
 
 // PrescriptionHandler holds the prescription service.
 type PrescriptionHandler struct {
-	Service *services.PrescriptionService
+	Service   *services.PrescriptionService
+	Documents *documents.Generator // Optional: required only for printable documents
+	// Consent enforces the consents of the examination's patient on reads; nil allows every read
+	Consent *consent.Enforcer
 }
 
 // NewPrescriptionHandler creates a new PrescriptionHandler.
@@ -18,34 +32,66 @@ func NewPrescriptionHandler(s *services.PrescriptionService) *PrescriptionHandle
 	return &PrescriptionHandler{Service: s}
 }
 
-// Request structs remain the same
+// PrescriptionRequest accepts either a free-text medication and dosage or
+// a medicationCode with structured dosing fields (frequency, doseAmount, ...)
 type PrescriptionRequest struct {
 	ExaminationID uint   `json:"examinationId" binding:"required"`
-	Medication    string `json:"medication" binding:"required"`
-	Dosage        string `json:"dosage" binding:"required"`
+	Medication    string `json:"medication"`
+	Dosage        string `json:"dosage"`
 	Instructions  string `json:"instructions"`
+	Prescriber    string `json:"prescriber"`
+	PrescriberID  *uint  `json:"prescriberId"` // Optional: practitioner directory ID
+	models.StructuredDosage
 }
 
-// UpdatePrescriptionRequest uses pointers for booleans to differentiate false from not provided
+// UpdatePrescriptionRequest uses pointers to differentiate zero values from not provided
 type UpdatePrescriptionRequest struct {
-	Medication   string `json:"medication"`
-	Dosage       string `json:"dosage"`
-	Instructions string `json:"instructions"`
-	Validated    *bool  `json:"validated"`
-	Sent         *bool  `json:"sent"`
+	Medication   *string `json:"medication"`
+	Dosage       *string `json:"dosage"`
+	Instructions *string `json:"instructions"`
+	Validated    *bool   `json:"validated"`
+	Sent         *bool   `json:"sent"`
+	services.StructuredDosageUpdate
 }
 
-// GetPrescriptions handles GET /api/prescriptions
+// ValidatePrescriptionRequest optionally carries the reason for overriding safety warnings
+type ValidatePrescriptionRequest struct {
+	OverrideReason string `json:"overrideReason"`
+}
+
+// RefillPrescriptionRequest describes a refill being dispensed
+type RefillPrescriptionRequest struct {
+	Quantity int    `json:"quantity"`
+	Pharmacy string `json:"pharmacy"`
+}
+
+// RenewPrescriptionRequest optionally sets the refills authorised on the renewal
+type RenewPrescriptionRequest struct {
+	Refills *int `json:"refills"`
+}
+
+// GetPrescriptions handles GET /api/prescriptions?examinationId=&prescriberId=&validated=&sent=&medication=&medicationCode=&from=&to=&sort=&limit=&offset=&cursor=
 func (h *PrescriptionHandler) GetPrescriptions(c *gin.Context) {
-	prescriptions, err := h.Service.GetPrescriptions()
+	params, err := query.FromValues(c.Request.URL.Query())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve prescriptions: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, prescriptions)
+
+	page, err := h.Service.GetPrescriptions(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve prescriptions: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
-// GetPrescription handles GET /api/prescriptions/:id
+// GetPrescription handles GET /api/prescriptions/:id?asOf=
+// asOf (RFC 3339) retrieves the prescription as it was at that time.
 func (h *PrescriptionHandler) GetPrescription(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -53,19 +99,58 @@ func (h *PrescriptionHandler) GetPrescription(c *gin.Context) {
 		return
 	}
 
-	prescription, err := h.Service.GetPrescriptionByID(uint(id))
+	var prescription models.Prescription
+	if asOf := c.Query("asOf"); asOf != "" {
+		at, perr := time.Parse(time.RFC3339, asOf)
+		if perr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "asOf must be an RFC 3339 time"})
+			return
+		}
+		prescription, err = h.Service.GetPrescriptionAsOf(uint(id), at)
+	} else {
+		prescription, err = h.Service.GetPrescriptionByID(uint(id))
+	}
 	if err != nil {
-		if err.Error() == "prescription not found" {
+		if err.Error() == "prescription not found" || err.Error() == "prescription not found at that time" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve prescription: " + err.Error()})
 		}
 		return
 	}
+	if !h.checkConsent(c, prescription.ExaminationID) {
+		return
+	}
 
+	if c.Query("asOf") == "" {
+		c.Header(etag.HeaderETag, etag.Format(prescription.Version))
+	}
 	c.JSON(http.StatusOK, prescription)
 }
 
+// GetPrescriptionHistory handles GET /api/prescriptions/:id/history
+func (h *PrescriptionHandler) GetPrescriptionHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	history, err := h.Service.GetPrescriptionHistory(uint(id))
+	if err != nil {
+		if err.Error() == "prescription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve prescription history: " + err.Error()})
+		}
+		return
+	}
+	if !h.checkConsent(c, history.ExaminationID) {
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
 // GetPrescriptionsByExaminationID handles GET /api/prescriptions/examination/:examinationId
 func (h *PrescriptionHandler) GetPrescriptionsByExaminationID(c *gin.Context) {
 	examinationID, err := strconv.ParseUint(c.Param("examinationId"), 10, 32)
@@ -73,6 +158,9 @@ func (h *PrescriptionHandler) GetPrescriptionsByExaminationID(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid examination ID format"})
 		return
 	}
+	if !h.checkConsent(c, uint(examinationID)) {
+		return
+	}
 
 	prescriptions, err := h.Service.GetPrescriptionsByExaminationID(uint(examinationID))
 	if err != nil {
@@ -90,23 +178,55 @@ func (h *PrescriptionHandler) CreatePrescription(c *gin.Context) {
 		return
 	}
 
-	// Optional: Check if ExaminationID exists
+	structured := req.MedicationCode != "" || req.Frequency != ""
+	if req.Medication == "" && req.MedicationCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required field: medication or medicationCode"})
+		return
+	}
+	if req.Dosage == "" && req.Frequency == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required field: dosage or frequency"})
+		return
+	}
 
-	prescription, err := h.Service.CreatePrescription(req.ExaminationID, req.Medication, req.Dosage, req.Instructions)
+	var prescription models.Prescription
+	var err error
+	if structured {
+		prescription, err = h.Service.CreateStructuredPrescription(req.ExaminationID, req.Medication, req.StructuredDosage, req.Instructions, req.Prescriber, req.PrescriberID)
+	} else {
+		prescription, err = h.Service.CreatePrescription(req.ExaminationID, req.Medication, req.Dosage, req.Instructions, req.Prescriber, req.PrescriberID)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create prescription: " + err.Error()})
+		if errors.Is(err, services.ErrUnknownMedicationCode) || errors.Is(err, services.ErrUnknownFrequency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.Is(err, references.ErrNotFound) || errors.Is(err, references.ErrInactive) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid examination reference: " + err.Error()})
+		} else if errors.Is(err, references.ErrUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify examination: " + err.Error()})
+		} else if errors.Is(err, practitioners.ErrNotFound) || errors.Is(err, practitioners.ErrInactive) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid prescriber: " + err.Error()})
+		} else if errors.Is(err, practitioners.ErrUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify prescriber: " + err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create prescription: " + err.Error()})
+		}
 		return
 	}
+	c.Header(etag.HeaderETag, etag.Format(prescription.Version))
 	c.JSON(http.StatusCreated, prescription)
 }
 
 // UpdatePrescription handles PUT /api/prescriptions/:id
+// The If-Match header must hold the prescription's current ETag.
 func (h *PrescriptionHandler) UpdatePrescription(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
 	var req UpdatePrescriptionRequest
 	if err := c.BindJSON(&req); err != nil { // Use BindJSON for optional fields
@@ -114,10 +234,14 @@ func (h *PrescriptionHandler) UpdatePrescription(c *gin.Context) {
 		return
 	}
 
-	updatedPrescription, err := h.Service.UpdatePrescription(uint(id), req.Medication, req.Dosage, req.Instructions, req.Validated, req.Sent)
+	updatedPrescription, err := h.Service.UpdatePrescription(uint(id), version, req.Medication, req.Dosage, req.Instructions, req.StructuredDosageUpdate, req.Validated, req.Sent)
 	if err != nil {
 		if err.Error() == "prescription not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		} else if errors.Is(err, services.ErrPrescriptionSent) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		} else {
 			// Handle other specific errors like "cannot send unvalidated prescription"
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) // Use 400 for business rule violations
@@ -125,6 +249,7 @@ func (h *PrescriptionHandler) UpdatePrescription(c *gin.Context) {
 		return
 	}
 
+	c.Header(etag.HeaderETag, etag.Format(updatedPrescription.Version))
 	c.JSON(http.StatusOK, updatedPrescription)
 }
 
@@ -136,10 +261,25 @@ func (h *PrescriptionHandler) ValidatePrescription(c *gin.Context) {
 		return
 	}
 
-	validatedPrescription, err := h.Service.ValidatePrescription(uint(id))
+	// The body is optional; it is only needed to override warnings
+	var req ValidatePrescriptionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	validatedPrescription, findings, err := h.Service.ValidatePrescription(uint(id), req.OverrideReason)
 	if err != nil {
 		if err.Error() == "prescription not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, services.ErrBlockingFindings) || errors.Is(err, services.ErrOverrideRequired) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":    err.Error(),
+				"warnings": findings.Warnings,
+				"errors":   findings.Errors,
+			})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate prescription: " + err.Error()})
 		}
@@ -149,6 +289,7 @@ func (h *PrescriptionHandler) ValidatePrescription(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Prescription validated successfully",
 		"prescription": validatedPrescription,
+		"warnings":     findings.Warnings,
 	})
 }
 
@@ -166,6 +307,10 @@ func (h *PrescriptionHandler) SendPrescription(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		} else if err.Error() == "prescription must be validated before sending" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) // 400 for business rule violation
+		} else if errors.Is(err, pharmacy.ErrRejected) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		} else if errors.Is(err, pharmacy.ErrUnavailable) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send prescription: " + err.Error()})
 		}
@@ -178,18 +323,195 @@ func (h *PrescriptionHandler) SendPrescription(c *gin.Context) {
 	})
 }
 
+// RefillPrescription handles POST /api/prescriptions/:id/refill
+func (h *PrescriptionHandler) RefillPrescription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req RefillPrescriptionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	prescription, event, err := h.Service.RefillPrescription(uint(id), req.Quantity, req.Pharmacy)
+	if err != nil {
+		if err.Error() == "prescription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if err.Error() == "no refills remaining" || err.Error() == "prescription must be sent before it can be refilled" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refill prescription: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Refill dispensed",
+		"prescription": prescription,
+		"dispense":     event,
+	})
+}
+
+// GetDispenseEvents handles GET /api/prescriptions/:id/dispenses
+func (h *PrescriptionHandler) GetDispenseEvents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	events, err := h.Service.GetDispenseEvents(uint(id))
+	if err != nil {
+		if err.Error() == "prescription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dispense events: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// RenewPrescription handles POST /api/prescriptions/:id/renew
+func (h *PrescriptionHandler) RenewPrescription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req RenewPrescriptionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+	refills := -1 // Keep the original count unless given
+	if req.Refills != nil {
+		if *req.Refills < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refills cannot be negative"})
+			return
+		}
+		refills = *req.Refills
+	}
+
+	renewal, err := h.Service.RenewPrescription(uint(id), refills)
+	if err != nil {
+		if err.Error() == "prescription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if err.Error() == "only validated prescriptions can be renewed" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if errors.Is(err, references.ErrNotFound) || errors.Is(err, references.ErrInactive) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid examination reference: " + err.Error()})
+		} else if errors.Is(err, references.ErrUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify examination: " + err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew prescription: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Renewal created and awaiting validation",
+		"prescription": renewal,
+	})
+}
+
+// GetPrescriptionDocument handles GET /api/prescriptions/:id/document
+func (h *PrescriptionHandler) GetPrescriptionDocument(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	prescription, err := h.Service.GetPrescriptionWithDetails(uint(id))
+	if err != nil {
+		if err.Error() == "prescription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve prescription: " + err.Error()})
+		}
+		return
+	}
+
+	pdf, code, err := h.Documents.Generate(documents.KindPrescription, prescription.ID, prescription, signedPrescription(prescription), consent.IdentityFromHeaders(c.Request.Header))
+	if err != nil {
+		var denied *consent.DeniedError
+		if errors.As(err, &denied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": denied.Reason})
+		} else if errors.Is(err, documents.ErrUnsupportedText) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate document: " + err.Error()})
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="prescription-%d.pdf"`, prescription.ID))
+	c.Header("X-Verification-Code", code)
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// VerifyPrescriptionDocument handles GET /api/prescriptions/:id/document/verify/:code
+func (h *PrescriptionHandler) VerifyPrescriptionDocument(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	prescription, err := h.Service.GetPrescriptionWithDetails(uint(id))
+	if err != nil {
+		if err.Error() == "prescription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve prescription: " + err.Error()})
+		}
+		return
+	}
+
+	valid := h.Documents.Verify(documents.KindPrescription, prescription.ID, signedPrescription(prescription), c.Param("code"))
+	c.JSON(http.StatusOK, gin.H{"valid": valid})
+}
+
+// signedPrescription returns what a prescription document's verification code covers.
+func signedPrescription(p models.Prescription) documents.Signed {
+	return documents.Signed{
+		PatientID: p.Examination.PatientID,
+		Subject:   p.Medication,
+		Details:   p.Dosage,
+		Issuer:    p.Prescriber,
+		IssuedAt:  p.CreatedAt,
+	}
+}
+
 // DeletePrescription handles DELETE /api/prescriptions/:id
+// The If-Match header must hold the prescription's current ETag.
 func (h *PrescriptionHandler) DeletePrescription(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
-	err = h.Service.DeletePrescription(uint(id))
+	err = h.Service.DeletePrescription(uint(id), version)
 	if err != nil {
 		if err.Error() == "prescription not found or already deleted" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Prescription not found"})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete prescription: " + err.Error()})
 		}
@@ -198,3 +520,38 @@ func (h *PrescriptionHandler) DeletePrescription(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
+
+// checkConsent checks the caller identified by the request headers against the consents of
+// the patient the examination belongs to. When the read is refused it writes the response
+// and returns false.
+func (h *PrescriptionHandler) checkConsent(c *gin.Context, examinationID uint) bool {
+	err := h.Consent.CheckExamination(h.Service.References, examinationID, consent.IdentityFromHeaders(c.Request.Header))
+	if err == nil {
+		return true
+	}
+	var denied *consent.DeniedError
+	switch {
+	case errors.As(err, &denied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": denied.Reason})
+	case errors.Is(err, references.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check consent: " + err.Error()})
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/fitnis/shared/privacy"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportPatientData handles POST /api/prescriptions/privacy/export
+// The patient service calls it to gather a patient's data for export.
+func (h *PrescriptionHandler) ExportPatientData(c *gin.Context) {
+	var req privacy.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	prescriptions, err := h.Service.ExportPatientData(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export prescriptions: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prescriptions)
+}
+
+// ErasePatientData handles POST /api/prescriptions/privacy/erase
+// The patient service calls it when erasing a patient's data.
+func (h *PrescriptionHandler) ErasePatientData(c *gin.Context) {
+	var req privacy.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	erased, err := h.Service.ErasePatientData(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase prescriptions: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, privacy.ErasureResult{Erased: erased})
+}
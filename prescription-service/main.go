@@ -7,13 +7,25 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/fitnis/prescription-service/handlers"
+	"github.com/fitnis/prescription-service/pharmacy"
+	"github.com/fitnis/prescription-service/safety"
 	"github.com/fitnis/prescription-service/services"
+	"github.com/fitnis/shared/allergies"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/consent"
 	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/documents"
 	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/privacy"
+	"github.com/fitnis/shared/references"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,31 +34,108 @@ func main() {
 	database.InitDB()
 	db := database.DB
 
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "prescriptions")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+	recorder.Version(&models.Prescription{})
+
 	// Initialize services and handlers
 	prescriptionService := services.NewPrescriptionService(db)
+	prescriptionService.Pharmacy = pharmacy.NewHTTPClient(getPharmacyURL())
+	prescriptionService.Practitioners = practitioners.NewKafkaDirectory()
+	prescriptionService.References = references.NewKafkaCheckerFromEnv()
+	prescriptionService.Allergies = allergies.NewKafkaRegistry()
+	prescriptionService.Checkers = safety.DefaultCheckers(loadInteractionDataset())
 	prescriptionHandler := handlers.NewPrescriptionHandler(prescriptionService)
+	prescriptionHandler.Documents, err = documents.NewGeneratorFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure documents: %v", err)
+	}
+	prescriptionHandler.Consent = consent.NewEnforcer(db)
+	prescriptionHandler.Documents.Consent = prescriptionHandler.Consent
+
+	formularyService := services.NewFormularyService(db)
+	if err := formularyService.SeedFormulary(); err != nil {
+		log.Fatalf("Failed to seed formulary: %v", err)
+	}
+	formularyHandler := handlers.NewFormularyHandler(formularyService)
+
+	// Purge prescriptions soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, prescriptionService.PurgeDeleted)
 
 	// Start Kafka consumer
 	log.Println("Starting Kafka consumer")
-	kafka.StartKafkaConsumer("prescriptions", func(req kafka.KafkaRequest) kafka.KafkaResponse {
-		return handleKafkaRequest(req, prescriptionHandler)
-	})
+	kafka.StartKafkaConsumer("prescriptions", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
+		return handleKafkaRequest(req, prescriptionHandler, formularyHandler)
+	}))
 
 	// Block main goroutine
 	select {}
 }
 
 // handleKafkaRequest processes Kafka requests and returns responses
-func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PrescriptionHandler) kafka.KafkaResponse {
+func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PrescriptionHandler, formularyHandler *handlers.FormularyHandler) kafka.KafkaResponse {
 	// Create a mock gin context to reuse our handler functions
 	c, w := createMockGinContext(req)
 
 	// Route the request based on path and method
-	path := req.Path
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
 	if path == "" {
 		path = "/"
 	}
 
+	// Patient data export and erasure have no prescription ID in the path
+	if path == privacy.ExportPath || path == privacy.ErasePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		if path == privacy.ExportPath {
+			handler.ExportPatientData(c)
+		} else {
+			handler.ErasePatientData(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Deletion requests from the examination service have no prescription ID in the path
+	if path == deletion.CheckPath || path == deletion.DeletePath || path == deletion.RestorePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		switch path {
+		case deletion.CheckPath:
+			handler.CheckDeletion(c)
+		case deletion.DeletePath:
+			handler.DeleteDependents(c)
+		default:
+			handler.RestoreDependents(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Formulary lookups are keyed by code rather than numeric ID
+	if strings.HasPrefix(path, "/formulary") {
+		if req.Method != "GET" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		rest := strings.Trim(strings.TrimPrefix(path, "/formulary"), "/")
+		switch {
+		case rest == "":
+			formularyHandler.SearchFormulary(c)
+		case strings.HasPrefix(rest, "search/"):
+			c.Params = append(c.Params, gin.Param{Key: "query", Value: strings.TrimPrefix(rest, "search/")})
+			formularyHandler.SearchFormulary(c)
+		default:
+			c.Params = append(c.Params, gin.Param{Key: "code", Value: rest})
+			formularyHandler.GetFormularyItem(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
 	// Extract ID from path if present
 	var id uint64
 	var err error
@@ -71,14 +160,35 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PrescriptionHa
 	// Check for special action paths
 	isValidatePath := strings.Contains(path, "/validate")
 	isSendPath := strings.Contains(path, "/send")
+	isRefillPath := strings.HasSuffix(path, "/refill")
+	isRenewPath := strings.HasSuffix(path, "/renew")
+	isDispensesPath := strings.HasSuffix(path, "/dispenses")
+	isDocumentPath := strings.HasSuffix(path, "/document")
+	isHistoryPath := strings.HasSuffix(path, "/history")
+	verifyCode := extractVerificationCodeFromPath(path)
 
 	// Route to appropriate handler
 	switch {
 	case req.Method == "GET" && path == "/":
 		handler.GetPrescriptions(c)
+	case req.Method == "GET" && id > 0 && isDispensesPath:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.GetDispenseEvents(c)
+	case req.Method == "GET" && id > 0 && isHistoryPath:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.GetPrescriptionHistory(c)
+	case req.Method == "GET" && id > 0 && isDocumentPath:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.GetPrescriptionDocument(c)
+	case req.Method == "GET" && id > 0 && verifyCode != "":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr}, gin.Param{Key: "code", Value: verifyCode})
+		handler.VerifyPrescriptionDocument(c)
 	case req.Method == "GET" && id > 0 && !isValidatePath && !isSendPath:
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
 		handler.GetPrescription(c)
+	case req.Method == "POST" && id > 0 && strings.HasSuffix(path, "/restore"):
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.RestorePrescription(c)
 	case req.Method == "POST" && path == "/":
 		handler.CreatePrescription(c)
 	case req.Method == "PUT" && id > 0:
@@ -96,19 +206,18 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.PrescriptionHa
 	case req.Method == "POST" && id > 0 && isSendPath:
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
 		handler.SendPrescription(c)
+	case req.Method == "POST" && id > 0 && isRefillPath:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.RefillPrescription(c)
+	case req.Method == "POST" && id > 0 && isRenewPath:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.RenewPrescription(c)
 	default:
 		return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
 	}
 
 	// Create response from the written data
-	return kafka.KafkaResponse{
-		RequestID:  req.RequestID,
-		StatusCode: w.Code,
-		Headers: map[string]string{
-			"Content-Type": w.Header().Get("Content-Type"),
-		},
-		Body: w.Body.Bytes(),
-	}
+	return createResponse(req.RequestID, w)
 }
 
 // Helper functions
@@ -140,6 +249,16 @@ func extractIDFromPath(path string) string {
 	return ""
 }
 
+func extractVerificationCodeFromPath(path string) string {
+	if strings.Contains(path, "/document/verify/") {
+		parts := strings.Split(path, "/document/verify/")
+		if len(parts) >= 2 {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
 func extractExaminationIDFromPath(path string) string {
 	if strings.Contains(path, "/examination/") {
 		parts := strings.Split(path, "/examination/")
@@ -150,6 +269,44 @@ func extractExaminationIDFromPath(path string) string {
 	return ""
 }
 
+func getPharmacyURL() string {
+	// Read from environment variable or use the bundled stub pharmacy
+	url := os.Getenv("PHARMACY_URL")
+	if url == "" {
+		url = "http://pharmacy-stub:8090"
+	}
+	return url
+}
+
+func loadInteractionDataset() *safety.Dataset {
+	// A local CSV/JSON dataset can replace the bundled one
+	path := os.Getenv("DRUG_INTERACTION_DATA")
+	if path == "" {
+		ds, err := safety.LoadDefaultDataset()
+		if err != nil {
+			log.Fatalf("Failed to load bundled drug interaction dataset: %v", err)
+		}
+		return ds
+	}
+
+	ds, err := safety.LoadDataset(path)
+	if err != nil {
+		log.Fatalf("Failed to load drug interaction dataset %s: %v", path, err)
+	}
+	log.Printf("Loaded drug interaction dataset from %s", path)
+	return ds
+}
+
+// createResponse copies the recorded handler output, including its headers, into a Kafka response
+func createResponse(requestID string, w *httptest.ResponseRecorder) kafka.KafkaResponse {
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
 func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
 	errorJSON, _ := json.Marshal(gin.H{"error": message})
 	return kafka.KafkaResponse{
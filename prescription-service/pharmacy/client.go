@@ -0,0 +1,135 @@
+package pharmacy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ErrRejected is returned when the pharmacy explicitly refuses a prescription.
+var ErrRejected = errors.New("pharmacy rejected prescription")
+
+// ErrUnavailable is returned when the pharmacy could not be reached after all retries.
+var ErrUnavailable = errors.New("pharmacy unavailable")
+
+// IdempotencyHeader carries the key the pharmacy uses to de-duplicate retried submissions.
+const IdempotencyHeader = "Idempotency-Key"
+
+// Order is the payload transmitted to the pharmacy for a single prescription.
+type Order struct {
+	PrescriptionID uint   `json:"prescriptionId"`
+	ExaminationID  uint   `json:"examinationId"`
+	Medication     string `json:"medication"`
+	Dosage         string `json:"dosage"`
+	Instructions   string `json:"instructions"`
+}
+
+// Acknowledgement is the pharmacy's answer to a submitted order.
+type Acknowledgement struct {
+	AckID  string `json:"ackId"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// HTTPClient posts orders to a pharmacy endpoint over HTTP.
+type HTTPClient struct {
+	BaseURL    string
+	HTTP       *http.Client
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// NewHTTPClient creates a new HTTPClient for the pharmacy at baseURL.
+func NewHTTPClient(baseURL string) *HTTPClient {
+	return &HTTPClient{
+		BaseURL:    baseURL,
+		HTTP:       &http.Client{Timeout: 5 * time.Second},
+		MaxRetries: 3,
+		Backoff:    500 * time.Millisecond,
+	}
+}
+
+// SubmitPrescription sends an order to the pharmacy and returns its acknowledgement.
+// Network errors, timeouts and 5xx responses are retried with the same idempotency key,
+// so the pharmacy never dispenses the same prescription twice.
+func (c *HTTPClient) SubmitPrescription(ctx context.Context, order Order, idempotencyKey string) (Acknowledgement, error) {
+	body, err := json.Marshal(order)
+	if err != nil {
+		return Acknowledgement{}, fmt.Errorf("failed to marshal order: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			// Linear backoff between attempts
+			select {
+			case <-ctx.Done():
+				return Acknowledgement{}, fmt.Errorf("%w: %v", ErrUnavailable, ctx.Err())
+			case <-time.After(time.Duration(attempt) * c.Backoff):
+			}
+		}
+
+		ack, retry, err := c.submitOnce(ctx, body, idempotencyKey)
+		if err == nil {
+			return ack, nil
+		}
+		if !retry {
+			return Acknowledgement{}, err
+		}
+		lastErr = err
+		log.Printf("Pharmacy submission for prescription %d failed (attempt %d/%d): %v",
+			order.PrescriptionID, attempt+1, c.MaxRetries+1, err)
+	}
+
+	return Acknowledgement{}, fmt.Errorf("%w: %v", ErrUnavailable, lastErr)
+}
+
+// submitOnce performs a single POST and reports whether a failure is worth retrying.
+func (c *HTTPClient) submitOnce(ctx context.Context, body []byte, idempotencyKey string) (Acknowledgement, bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/prescriptions", bytes.NewReader(body))
+	if err != nil {
+		return Acknowledgement{}, false, fmt.Errorf("failed to build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(IdempotencyHeader, idempotencyKey)
+
+	resp, err := c.HTTP.Do(httpReq)
+	if err != nil {
+		return Acknowledgement{}, true, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Acknowledgement{}, true, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var ack Acknowledgement
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, &ack); err != nil && resp.StatusCode < 500 {
+			return Acknowledgement{}, false, fmt.Errorf("invalid pharmacy response: %w", err)
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusAccepted:
+		if ack.AckID == "" {
+			return Acknowledgement{}, false, errors.New("pharmacy response is missing an acknowledgement ID")
+		}
+		return ack, false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return Acknowledgement{}, true, fmt.Errorf("pharmacy returned status %d", resp.StatusCode)
+	default:
+		reason := ack.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("status %d", resp.StatusCode)
+		}
+		return Acknowledgement{}, false, fmt.Errorf("%w: %s", ErrRejected, reason)
+	}
+}
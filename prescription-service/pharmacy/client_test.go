@@ -0,0 +1,80 @@
+package pharmacy
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for the stub that retries quickly.
+func newTestClient(t *testing.T, stub *StubServer) *HTTPClient {
+	t.Helper()
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	client := NewHTTPClient(server.URL)
+	client.Backoff = time.Millisecond
+	client.HTTP.Timeout = 50 * time.Millisecond
+	return client
+}
+
+func TestStubAccept(t *testing.T) {
+	stub := NewStubServer(StubAccept)
+	client := newTestClient(t, stub)
+	order := Order{PrescriptionID: 1, Medication: "Amoxicillin"}
+
+	ack, err := client.SubmitPrescription(context.Background(), order, "rx-1")
+	if err != nil {
+		t.Fatalf("SubmitPrescription: %v", err)
+	}
+	if ack.Status != "accepted" || ack.AckID == "" {
+		t.Fatalf("got %+v, want an accepted acknowledgement", ack)
+	}
+
+	// Resubmitting with the same key returns the first acknowledgement without a second dispense
+	again, err := client.SubmitPrescription(context.Background(), order, "rx-1")
+	if err != nil {
+		t.Fatalf("resubmit: %v", err)
+	}
+	if again.AckID != ack.AckID {
+		t.Errorf("resubmit got ack %s, want %s", again.AckID, ack.AckID)
+	}
+	if n := len(stub.Received()); n != 1 {
+		t.Errorf("stub received %d orders, want 1", n)
+	}
+}
+
+func TestStubReject(t *testing.T) {
+	stub := NewStubServer(StubReject)
+	client := newTestClient(t, stub)
+
+	_, err := client.SubmitPrescription(context.Background(), Order{PrescriptionID: 2}, "rx-2")
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("got %v, want ErrRejected", err)
+	}
+	if n := len(stub.Received()); n != 0 {
+		t.Errorf("stub received %d orders, want 0", n)
+	}
+}
+
+func TestStubTimeout(t *testing.T) {
+	stub := NewStubServer(StubTimeout)
+	stub.TimeoutDelay = time.Second
+	client := newTestClient(t, stub)
+	client.MaxRetries = 1
+
+	_, err := client.SubmitPrescription(context.Background(), Order{PrescriptionID: 3}, "rx-3")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got %v, want ErrUnavailable", err)
+	}
+
+	// Once the pharmacy answers again, the retried key is accepted exactly once
+	stub.SetMode(StubAccept)
+	if _, err := client.SubmitPrescription(context.Background(), Order{PrescriptionID: 3}, "rx-3"); err != nil {
+		t.Fatalf("after recovery: %v", err)
+	}
+	if n := len(stub.Received()); n != 1 {
+		t.Errorf("stub received %d orders, want 1", n)
+	}
+}
@@ -0,0 +1,118 @@
+package pharmacy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Stub modes control how the StubServer answers submissions.
+const (
+	StubAccept  = "accept"
+	StubReject  = "reject"
+	StubTimeout = "timeout"
+)
+
+// StubModeHeader lets a caller override the stub's mode for a single request.
+const StubModeHeader = "X-Stub-Mode"
+
+// StubServer is a local stand-in for a pharmacy endpoint. It can simulate acceptance,
+// rejection and timeouts, and honours idempotency keys like a real pharmacy would.
+type StubServer struct {
+	Mode         string
+	RejectReason string
+	// TimeoutDelay is how long the stub stalls before answering in timeout mode.
+	TimeoutDelay time.Duration
+
+	mu       sync.Mutex
+	acks     map[string]Acknowledgement
+	received []Order
+}
+
+// NewStubServer creates a new StubServer in the given mode.
+func NewStubServer(mode string) *StubServer {
+	return &StubServer{
+		Mode:         mode,
+		RejectReason: "medication not stocked",
+		TimeoutDelay: 30 * time.Second,
+		acks:         make(map[string]Acknowledgement),
+	}
+}
+
+// SetMode changes how subsequent submissions are answered.
+func (s *StubServer) SetMode(mode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Mode = mode
+}
+
+// Received returns the orders the stub has accepted so far.
+func (s *StubServer) Received() []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Order(nil), s.received...)
+}
+
+// ServeHTTP handles POST /prescriptions
+func (s *StubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/prescriptions" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var order Order
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		writeAck(w, http.StatusBadRequest, Acknowledgement{Status: "rejected", Reason: "invalid order payload"})
+		return
+	}
+
+	key := r.Header.Get(IdempotencyHeader)
+
+	s.mu.Lock()
+	mode := s.Mode
+	if override := r.Header.Get(StubModeHeader); override != "" {
+		mode = override
+	}
+	// A repeated key gets the original acknowledgement back without a second dispense
+	if ack, ok := s.acks[key]; ok && key != "" {
+		s.mu.Unlock()
+		writeAck(w, http.StatusOK, ack)
+		return
+	}
+	s.mu.Unlock()
+
+	switch mode {
+	case StubReject:
+		writeAck(w, http.StatusUnprocessableEntity, Acknowledgement{Status: "rejected", Reason: s.RejectReason})
+	case StubTimeout:
+		select {
+		case <-r.Context().Done():
+		case <-time.After(s.TimeoutDelay):
+			w.WriteHeader(http.StatusGatewayTimeout)
+		}
+	default:
+		ack := Acknowledgement{AckID: newAckID(), Status: "accepted"}
+		s.mu.Lock()
+		if key != "" {
+			s.acks[key] = ack
+		}
+		s.received = append(s.received, order)
+		s.mu.Unlock()
+		writeAck(w, http.StatusCreated, ack)
+	}
+}
+
+func writeAck(w http.ResponseWriter, status int, ack Acknowledgement) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ack)
+}
+
+func newAckID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return "ACK-" + hex.EncodeToString(bytes)
+}
@@ -0,0 +1,168 @@
+package safety
+
+import (
+	"fmt"
+
+	"github.com/fitnis/shared/models"
+)
+
+// Finding severities. Warnings can be overridden with a reason; blocking findings cannot.
+const (
+	SeverityWarning  = "warning"
+	SeverityBlocking = "blocking"
+)
+
+// Finding is a single issue raised by a checker.
+type Finding struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Result groups the findings of all checkers by severity.
+type Result struct {
+	Warnings []Finding `json:"warnings"`
+	Errors   []Finding `json:"errors"`
+}
+
+// HasErrors reports whether any blocking finding was raised.
+func (r Result) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// HasWarnings reports whether any warning was raised.
+func (r Result) HasWarnings() bool {
+	return len(r.Warnings) > 0
+}
+
+// Input is everything a checker may look at for one prescription.
+type Input struct {
+	Prescription models.Prescription
+	PatientID    uint
+	// ActivePrescriptions are the patient's other active prescriptions
+	ActivePrescriptions []models.Prescription
+	// Allergies are the substances the patient is recorded as allergic to
+	Allergies []string
+}
+
+// Checker inspects a prescription and reports findings.
+type Checker interface {
+	Check(in Input) []Finding
+}
+
+// AllergySource looks up the allergies recorded for a patient.
+type AllergySource interface {
+	AllergiesForPatient(patientID uint) ([]string, error)
+}
+
+// Run executes all checkers and sorts their findings by severity.
+func Run(in Input, checkers ...Checker) Result {
+	result := Result{Warnings: []Finding{}, Errors: []Finding{}}
+	for _, checker := range checkers {
+		for _, f := range checker.Check(in) {
+			if f.Severity == SeverityBlocking {
+				result.Errors = append(result.Errors, f)
+			} else {
+				result.Warnings = append(result.Warnings, f)
+			}
+		}
+	}
+	return result
+}
+
+// DefaultCheckers returns the interaction, allergy and duplicate therapy checkers for a dataset.
+func DefaultCheckers(ds *Dataset) []Checker {
+	return []Checker{
+		InteractionChecker{Dataset: ds},
+		AllergyChecker{Dataset: ds},
+		DuplicateTherapyChecker{Dataset: ds},
+	}
+}
+
+// InteractionChecker flags known interactions with the patient's active prescriptions.
+type InteractionChecker struct {
+	Dataset *Dataset
+}
+
+// Check implements Checker.
+func (c InteractionChecker) Check(in Input) []Finding {
+	var findings []Finding
+	medication := in.Prescription.Medication
+	for _, active := range in.ActivePrescriptions {
+		// One finding per active prescription, for the most severe of the matching interactions,
+		// so that a warning listed first cannot hide a blocking one
+		var worst *Finding
+		for _, ix := range c.Dataset.Interactions {
+			forward := c.Dataset.matches(ix.DrugA, medication) && c.Dataset.matches(ix.DrugB, active.Medication)
+			reverse := c.Dataset.matches(ix.DrugB, medication) && c.Dataset.matches(ix.DrugA, active.Medication)
+			if !forward && !reverse {
+				continue
+			}
+			severity := ix.Severity
+			if severity != SeverityBlocking {
+				severity = SeverityWarning
+			}
+			if worst != nil && (worst.Severity == SeverityBlocking || severity != SeverityBlocking) {
+				continue
+			}
+			worst = &Finding{
+				Code:     "DRUG_INTERACTION",
+				Severity: severity,
+				Message:  fmt.Sprintf("%s interacts with %s (prescription %d): %s", medication, active.Medication, active.ID, ix.Description),
+			}
+		}
+		if worst != nil {
+			findings = append(findings, *worst)
+		}
+	}
+	return findings
+}
+
+// AllergyChecker blocks medications the patient is allergic to, by name or by class.
+type AllergyChecker struct {
+	Dataset *Dataset
+}
+
+// Check implements Checker.
+func (c AllergyChecker) Check(in Input) []Finding {
+	var findings []Finding
+	for _, allergy := range in.Allergies {
+		if c.Dataset.matches(allergy, in.Prescription.Medication) {
+			findings = append(findings, Finding{
+				Code:     "ALLERGY",
+				Severity: SeverityBlocking,
+				Message:  fmt.Sprintf("Patient has a recorded allergy to %s", allergy),
+			})
+		}
+	}
+	return findings
+}
+
+// DuplicateTherapyChecker warns when the patient already takes the same drug or another drug of the same class.
+type DuplicateTherapyChecker struct {
+	Dataset *Dataset
+}
+
+// Check implements Checker.
+func (c DuplicateTherapyChecker) Check(in Input) []Finding {
+	var findings []Finding
+	medication := in.Prescription.Medication
+	class := c.Dataset.ClassOf(medication)
+	for _, active := range in.ActivePrescriptions {
+		switch {
+		case normalize(active.Medication) == normalize(medication):
+			findings = append(findings, Finding{
+				Code:     "DUPLICATE_THERAPY",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("Patient already has an active prescription for %s (prescription %d)", active.Medication, active.ID),
+			})
+		case class != "" && c.Dataset.ClassOf(active.Medication) == class:
+			findings = append(findings, Finding{
+				Code:     "DUPLICATE_THERAPY",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("%s and %s (prescription %d) are both %s drugs", medication, active.Medication, active.ID, class),
+			})
+		}
+	}
+	return findings
+}
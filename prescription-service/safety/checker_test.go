@@ -0,0 +1,126 @@
+package safety
+
+import (
+	"testing"
+
+	"github.com/fitnis/shared/models"
+)
+
+// testDataset lists a warning for warfarin and aspirin before the blocking class interaction,
+// to check that the order of the dataset cannot hide the blocking one.
+const testDataset = `{
+  "drugs": [
+    { "name": "warfarin", "class": "anticoagulant" },
+    { "name": "aspirin", "class": "nsaid" },
+    { "name": "ibuprofen", "class": "nsaid" },
+    { "name": "amoxicillin", "class": "penicillin" }
+  ],
+  "interactions": [
+    { "drugA": "warfarin", "drugB": "aspirin", "severity": "warning", "description": "Monitor INR" },
+    { "drugA": "anticoagulant", "drugB": "nsaid", "severity": "blocking", "description": "Bleeding risk" },
+    { "drugA": "amoxicillin", "drugB": "warfarin", "severity": "moderate", "description": "May raise INR" }
+  ]
+}`
+
+func loadTestDataset(t *testing.T) *Dataset {
+	t.Helper()
+	ds, err := parseJSONDataset([]byte(testDataset))
+	if err != nil {
+		t.Fatalf("parseJSONDataset: %v", err)
+	}
+	return ds
+}
+
+func input(medication string, active ...string) Input {
+	in := Input{Prescription: models.Prescription{Medication: medication}, PatientID: 1}
+	for i, m := range active {
+		in.ActivePrescriptions = append(in.ActivePrescriptions, models.Prescription{ID: uint(i + 1), Medication: m})
+	}
+	return in
+}
+
+func TestInteractionChecker(t *testing.T) {
+	checker := InteractionChecker{Dataset: loadTestDataset(t)}
+	tests := []struct {
+		name         string
+		in           Input
+		wantSeverity string // "" for no finding
+	}{
+		{"blocking wins over an earlier warning", input("Aspirin", "warfarin"), SeverityBlocking},
+		{"either direction", input("warfarin", "aspirin"), SeverityBlocking},
+		{"by class", input("ibuprofen", "warfarin"), SeverityBlocking},
+		{"unknown severities are warnings", input("amoxicillin", "warfarin"), SeverityWarning},
+		{"no interaction", input("amoxicillin", "ibuprofen"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := checker.Check(tt.in)
+			if tt.wantSeverity == "" {
+				if len(findings) != 0 {
+					t.Fatalf("got %+v, want no findings", findings)
+				}
+				return
+			}
+			if len(findings) != 1 {
+				t.Fatalf("got %d findings, want 1: %+v", len(findings), findings)
+			}
+			if findings[0].Code != "DRUG_INTERACTION" || findings[0].Severity != tt.wantSeverity {
+				t.Errorf("got %+v, want a %s DRUG_INTERACTION", findings[0], tt.wantSeverity)
+			}
+		})
+	}
+}
+
+func TestAllergyChecker(t *testing.T) {
+	checker := AllergyChecker{Dataset: loadTestDataset(t)}
+
+	in := input("Ibuprofen")
+	in.Allergies = []string{"NSAID"}
+	findings := checker.Check(in)
+	if len(findings) != 1 || findings[0].Code != "ALLERGY" || findings[0].Severity != SeverityBlocking {
+		t.Fatalf("allergy by class: got %+v, want one blocking ALLERGY", findings)
+	}
+
+	in.Allergies = []string{"penicillin"}
+	if findings := checker.Check(in); len(findings) != 0 {
+		t.Errorf("unrelated allergy: got %+v, want no findings", findings)
+	}
+}
+
+func TestDuplicateTherapyChecker(t *testing.T) {
+	checker := DuplicateTherapyChecker{Dataset: loadTestDataset(t)}
+
+	if findings := checker.Check(input("aspirin", " Aspirin ")); len(findings) != 1 || findings[0].Code != "DUPLICATE_THERAPY" {
+		t.Errorf("same drug: got %+v, want one DUPLICATE_THERAPY", findings)
+	}
+	if findings := checker.Check(input("aspirin", "ibuprofen")); len(findings) != 1 || findings[0].Severity != SeverityWarning {
+		t.Errorf("same class: got %+v, want one warning", findings)
+	}
+	if findings := checker.Check(input("aspirin", "amoxicillin")); len(findings) != 0 {
+		t.Errorf("different class: got %+v, want no findings", findings)
+	}
+}
+
+func TestRunSortsBySeverity(t *testing.T) {
+	in := input("ibuprofen", "warfarin", "aspirin")
+	in.Allergies = []string{"nsaid"}
+
+	result := Run(in, DefaultCheckers(loadTestDataset(t))...)
+	// The interaction with warfarin and the allergy block; taking aspirin already is a warning
+	if len(result.Errors) != 2 || len(result.Warnings) != 1 {
+		t.Fatalf("got %d errors and %d warnings, want 2 and 1: %+v", len(result.Errors), len(result.Warnings), result)
+	}
+	if !result.HasErrors() || !result.HasWarnings() {
+		t.Errorf("HasErrors/HasWarnings disagree with %+v", result)
+	}
+}
+
+func TestDefaultDatasetLoads(t *testing.T) {
+	ds, err := LoadDefaultDataset()
+	if err != nil {
+		t.Fatalf("LoadDefaultDataset: %v", err)
+	}
+	if ds.ClassOf("Warfarin") != "anticoagulant" {
+		t.Errorf("ClassOf(Warfarin) = %q, want anticoagulant", ds.ClassOf("Warfarin"))
+	}
+}
@@ -0,0 +1,124 @@
+package safety
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed data/interactions.json
+var defaultDataset []byte
+
+// Drug is a dataset entry mapping a medication name to its therapeutic class.
+type Drug struct {
+	Name  string `json:"name"`
+	Class string `json:"class"`
+}
+
+// Interaction describes a known interaction between two drugs or drug classes.
+type Interaction struct {
+	DrugA       string `json:"drugA"`
+	DrugB       string `json:"drugB"`
+	Severity    string `json:"severity"` // SeverityWarning or SeverityBlocking
+	Description string `json:"description"`
+}
+
+// Dataset is the local drug-interaction reference data used by the checkers.
+type Dataset struct {
+	Drugs        []Drug        `json:"drugs"`
+	Interactions []Interaction `json:"interactions"`
+
+	classes map[string]string
+}
+
+// LoadDefaultDataset returns the dataset bundled with the service.
+func LoadDefaultDataset() (*Dataset, error) {
+	return parseJSONDataset(defaultDataset)
+}
+
+// LoadDataset reads a dataset from a .json or .csv file.
+// CSV files hold interactions only, one per row: drugA,drugB,severity,description.
+func LoadDataset(path string) (*Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dataset: %w", err)
+		}
+		return parseJSONDataset(data)
+	case ".csv":
+		return parseCSVDataset(f)
+	default:
+		return nil, fmt.Errorf("unsupported dataset format: %s", path)
+	}
+}
+
+func parseJSONDataset(data []byte) (*Dataset, error) {
+	var ds Dataset
+	if err := json.Unmarshal(data, &ds); err != nil {
+		return nil, fmt.Errorf("failed to parse dataset: %w", err)
+	}
+	ds.index()
+	return &ds, nil
+}
+
+func parseCSVDataset(r io.Reader) (*Dataset, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dataset: %w", err)
+	}
+
+	var ds Dataset
+	for i, rec := range records {
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("dataset row %d: expected at least 3 columns", i+1)
+		}
+		// Skip an optional header row
+		if i == 0 && strings.EqualFold(rec[0], "drugA") {
+			continue
+		}
+		interaction := Interaction{DrugA: rec[0], DrugB: rec[1], Severity: strings.TrimSpace(rec[2])}
+		if len(rec) > 3 {
+			interaction.Description = rec[3]
+		}
+		ds.Interactions = append(ds.Interactions, interaction)
+	}
+	ds.index()
+	return &ds, nil
+}
+
+func (ds *Dataset) index() {
+	ds.classes = make(map[string]string, len(ds.Drugs))
+	for _, d := range ds.Drugs {
+		ds.classes[normalize(d.Name)] = normalize(d.Class)
+	}
+}
+
+// ClassOf returns the therapeutic class of a medication, or "" if it is unknown.
+func (ds *Dataset) ClassOf(medication string) string {
+	return ds.classes[normalize(medication)]
+}
+
+// matches reports whether a dataset term refers to the medication, either by name or by class.
+func (ds *Dataset) matches(term, medication string) bool {
+	term = normalize(term)
+	if term == "" {
+		return false
+	}
+	return term == normalize(medication) || term == ds.ClassOf(medication)
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
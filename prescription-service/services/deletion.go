@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+)
+
+// CountDependents counts the live prescriptions of the parent records, for a check before deleting them.
+func (s *PrescriptionService) CountDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.CountLive(s.DB, &models.Prescription{}, "examination_id", req.ParentIDs)
+}
+
+// DeleteDependents soft-deletes the prescriptions of examinations deleted at req.DeletedAt.
+func (s *PrescriptionService) DeleteDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.SoftDelete(s.DB, &models.Prescription{}, "examination_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreDependents brings back the prescriptions deleted along with examinations at req.DeletedAt.
+func (s *PrescriptionService) RestoreDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.Restore(s.DB, &models.Prescription{}, "examination_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestorePrescription brings back a soft-deleted prescription.
+func (s *PrescriptionService) RestorePrescription(id uint) (models.Prescription, error) {
+	var prescription models.Prescription
+	result := s.DB.Unscoped().Limit(1).Find(&prescription, id)
+	if result.Error != nil {
+		return models.Prescription{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Prescription{}, errors.New("prescription not found")
+	}
+	if !prescription.DeletedAt.Valid {
+		return models.Prescription{}, deletion.ErrNotDeleted
+	}
+	if err := s.DB.Unscoped().Model(&prescription).Update("deleted_at", nil).Error; err != nil {
+		return models.Prescription{}, err
+	}
+	return s.GetPrescriptionByID(id)
+}
+
+// PurgeDeleted permanently deletes the prescriptions soft-deleted before the cutoff, with their
+// dispense events. The prescriptions of patients under a retention hold on prescriptions are kept
+// until the hold is released or expires.
+func (s *PrescriptionService) PurgeDeleted(cutoff time.Time) (int, error) {
+	var purged int
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		held := deletion.HeldExaminations(tx, deletion.Prescriptions)
+		expired := tx.Unscoped().Model(&models.Prescription{}).Select("id").
+			Where("deleted_at < ? AND examination_id NOT IN (?)", cutoff, held)
+		if err := tx.Where("prescription_id IN (?)", expired).Delete(&models.DispenseEvent{}).Error; err != nil {
+			return err
+		}
+		var err error
+		purged, err = deletion.Purge(tx, cutoff, &models.Prescription{}, "examination_id", held)
+		return err
+	})
+	return purged, err
+}
+
+// checkParent accepts requests about examinations, the only records prescriptions reference.
+func checkParent(req deletion.Request) error {
+	if req.Parent != deletion.Examinations {
+		return fmt.Errorf("%w: %q", deletion.ErrUnknownParent, req.Parent)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:embed data/formulary.json
+var defaultFormulary []byte
+
+// FormularyService handles lookups in the local medication formulary.
+type FormularyService struct {
+	DB *gorm.DB
+}
+
+// NewFormularyService creates a new FormularyService.
+func NewFormularyService(db *gorm.DB) *FormularyService {
+	return &FormularyService{DB: db}
+}
+
+// SeedFormulary inserts the bundled formulary entries that are not in the table yet.
+func (s *FormularyService) SeedFormulary() error {
+	var items []models.FormularyItem
+	if err := json.Unmarshal(defaultFormulary, &items); err != nil {
+		return fmt.Errorf("failed to parse bundled formulary: %w", err)
+	}
+	// Existing rows win so local edits to the table are preserved
+	result := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&items)
+	return result.Error
+}
+
+// SearchFormulary returns formulary items whose code or name starts with the query.
+// An empty query returns the whole formulary.
+func (s *FormularyService) SearchFormulary(query string) ([]models.FormularyItem, error) {
+	var items []models.FormularyItem
+	db := s.DB.Order("name, code")
+	if query = strings.TrimSpace(query); query != "" {
+		prefix := strings.ToLower(query) + "%"
+		db = db.Where("LOWER(code) LIKE ? OR LOWER(name) LIKE ?", prefix, prefix)
+	}
+	result := db.Find(&items)
+	return items, result.Error
+}
+
+// GetFormularyItem retrieves a formulary item by its code.
+func (s *FormularyService) GetFormularyItem(code string) (models.FormularyItem, error) {
+	var item models.FormularyItem
+	result := s.DB.Where("code = ?", strings.ToUpper(code)).First(&item)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.FormularyItem{}, errors.New("formulary item not found")
+		}
+		return models.FormularyItem{}, result.Error
+	}
+	return item, nil
+}
@@ -1,15 +1,67 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/fitnis/prescription-service/pharmacy"
+	"github.com/fitnis/prescription-service/safety"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/etag"
 	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
 	"gorm.io/gorm"
 )
 
+// PharmacyClient transmits prescriptions to an outside pharmacy.
+type PharmacyClient interface {
+	SubmitPrescription(ctx context.Context, order pharmacy.Order, idempotencyKey string) (pharmacy.Acknowledgement, error)
+}
+
+// pharmacyTimeout bounds the whole submission, including retries.
+const pharmacyTimeout = 20 * time.Second
+
+// ErrUnknownMedicationCode is returned when a medication code is not in the formulary.
+var ErrUnknownMedicationCode = errors.New("unknown medication code")
+
+// ErrUnknownFrequency is returned when a structured dosage uses an unsupported frequency code.
+var ErrUnknownFrequency = errors.New("unknown frequency code")
+
+// ErrBlockingFindings is returned when safety checks raise findings that cannot be overridden.
+var ErrBlockingFindings = errors.New("prescription has blocking safety findings")
+
+// ErrOverrideRequired is returned when safety checks raise warnings and no override reason was given.
+var ErrOverrideRequired = errors.New("an override reason is required to validate despite warnings")
+
+// ErrCodedMedication is returned when renaming a medication that is set by its formulary code.
+var ErrCodedMedication = errors.New("medication is named by its formulary code; change medicationCode instead")
+
+// ErrStructuredDosage is returned when giving a free-text dosage for a structured prescription.
+var ErrStructuredDosage = errors.New("dosage is rendered from the structured dosing fields; change those instead")
+
+// ErrPrescriptionSent is returned when changing the medication or dosage of a sent prescription.
+var ErrPrescriptionSent = errors.New("prescription has been sent; its medication and dosage can no longer be changed")
+
 // PrescriptionService handles database operations for prescriptions.
 type PrescriptionService struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Pharmacy PharmacyClient // Optional: required only for SendPrescription
+
+	// Safety checks run by ValidatePrescription
+	Checkers  []safety.Checker
+	Allergies safety.AllergySource // Optional: without it validation warns that allergies were not checked
+
+	// Practitioners validates prescriber references on creation
+	Practitioners practitioners.Directory
+
+	// References checks that new prescriptions reference an existing examination
+	References references.Checker
 }
 
 // NewPrescriptionService creates a new PrescriptionService.
@@ -19,12 +71,22 @@ func NewPrescriptionService(db *gorm.DB) *PrescriptionService {
 }
 
 // CreatePrescription adds a new prescription to the database.
-func (s *PrescriptionService) CreatePrescription(examinationID uint, medication, dosage, instructions string) (models.Prescription, error) {
+// examinationID must reference an existing examination, and a prescriberID, when given, an active practitioner.
+func (s *PrescriptionService) CreatePrescription(examinationID uint, medication, dosage, instructions, prescriber string, prescriberID *uint) (models.Prescription, error) {
+	if err := s.checkExamination(examinationID); err != nil {
+		return models.Prescription{}, err
+	}
+	if err := s.resolvePrescriber(prescriberID, &prescriber); err != nil {
+		return models.Prescription{}, err
+	}
+
 	prescription := models.Prescription{
 		ExaminationID: examinationID,
 		Medication:    medication,
 		Dosage:        dosage,
 		Instructions:  instructions,
+		Prescriber:    prescriber,
+		PrescriberID:  prescriberID,
 		Validated:     false, // Default values
 		Sent:          false,
 	}
@@ -33,11 +95,113 @@ func (s *PrescriptionService) CreatePrescription(examinationID uint, medication,
 	return prescription, result.Error
 }
 
-// GetPrescriptions retrieves all prescriptions from the database.
-func (s *PrescriptionService) GetPrescriptions() ([]models.Prescription, error) {
-	var prescriptions []models.Prescription
-	result := s.DB.Find(&prescriptions)
-	return prescriptions, result.Error
+// CreateStructuredPrescription adds a prescription with coded medication and structured dosing.
+// Missing strength, form and route are taken from the formulary, and Dosage is rendered from the structure.
+func (s *PrescriptionService) CreateStructuredPrescription(examinationID uint, medication string, dosage models.StructuredDosage, instructions, prescriber string, prescriberID *uint) (models.Prescription, error) {
+	if err := s.checkExamination(examinationID); err != nil {
+		return models.Prescription{}, err
+	}
+	if err := s.completeStructuredDosage(&medication, &dosage); err != nil {
+		return models.Prescription{}, err
+	}
+	if err := s.resolvePrescriber(prescriberID, &prescriber); err != nil {
+		return models.Prescription{}, err
+	}
+
+	prescription := models.Prescription{
+		ExaminationID:    examinationID,
+		Medication:       medication,
+		Dosage:           RenderSig(dosage),
+		Instructions:     instructions,
+		Prescriber:       prescriber,
+		PrescriberID:     prescriberID,
+		StructuredDosage: dosage,
+		RefillsRemaining: dosage.Refills,
+		Validated:        false, // Default values
+		Sent:             false,
+	}
+	result := s.DB.Create(&prescription)
+	return prescription, result.Error
+}
+
+// checkExamination checks that the examination may be prescribed for.
+func (s *PrescriptionService) checkExamination(examinationID uint) error {
+	if err := references.Require(s.References, references.Examinations, examinationID); err != nil {
+		return fmt.Errorf("examination: %w", err)
+	}
+	return nil
+}
+
+// resolvePrescriber validates the prescriber reference
+// and fills in the prescriber's name when none was given.
+func (s *PrescriptionService) resolvePrescriber(prescriberID *uint, prescriber *string) error {
+	practitioner, err := practitioners.Resolve(s.Practitioners, prescriberID)
+	if err != nil {
+		return err
+	}
+	if practitioner != nil && *prescriber == "" {
+		*prescriber = practitioner.FullName()
+	}
+	return nil
+}
+
+// completeStructuredDosage resolves the medication code against the formulary
+// and checks that the frequency can be rendered.
+func (s *PrescriptionService) completeStructuredDosage(medication *string, dosage *models.StructuredDosage) error {
+	if dosage.MedicationCode != "" {
+		item, err := NewFormularyService(s.DB).GetFormularyItem(dosage.MedicationCode)
+		if err != nil {
+			if err.Error() == "formulary item not found" {
+				return fmt.Errorf("%w: %s", ErrUnknownMedicationCode, dosage.MedicationCode)
+			}
+			return err
+		}
+		dosage.MedicationCode = item.Code
+		*medication = item.Name
+		if dosage.Strength == "" {
+			dosage.Strength = item.Strength
+		}
+		if dosage.Form == "" {
+			dosage.Form = item.Form
+		}
+		if dosage.Route == "" {
+			dosage.Route = item.Route
+		}
+	}
+
+	if dosage.Frequency != "" {
+		if !IsKnownFrequency(dosage.Frequency) {
+			return fmt.Errorf("%w: %s", ErrUnknownFrequency, dosage.Frequency)
+		}
+		dosage.Frequency = strings.ToUpper(dosage.Frequency)
+	}
+	return nil
+}
+
+// prescriptionQuery is the allow-list for listing prescriptions.
+// Prescriptions written before creation times were recorded sort first by createdAt.
+var prescriptionQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"examinationId":  {Column: "examination_id", Kind: query.Int},
+		"prescriberId":   {Column: "prescriber_id", Kind: query.Int},
+		"validated":      {Column: "validated", Kind: query.Bool},
+		"sent":           {Column: "sent", Kind: query.Bool},
+		"medication":     {Column: "medication", Op: query.Contains},
+		"medicationCode": {Column: "medication_code"},
+		"from":           {Column: "created_at", Kind: query.Time, Op: query.Gte},
+		"to":             {Column: "created_at", Kind: query.Time, Op: query.Lte},
+	},
+	Sorts: map[string]string{
+		"createdAt": "COALESCE(created_at, '')",
+		"sentAt":    "COALESCE(sent_at, '')",
+	},
+}
+
+// GetPrescriptions retrieves one page of prescriptions.
+// Filters: examinationId, prescriberId, validated, sent, medication (substring),
+// medicationCode, and from and to (creation date, inclusive).
+func (s *PrescriptionService) GetPrescriptions(params query.Params) (query.Page[models.Prescription], error) {
+	return query.Find[models.Prescription](s.DB, prescriptionQuery, params)
 }
 
 // GetPrescriptionByID retrieves a prescription by its ID.
@@ -53,6 +217,91 @@ func (s *PrescriptionService) GetPrescriptionByID(id uint) (models.Prescription,
 	return prescription, nil
 }
 
+// PrescriptionHistory lists every version of a prescription, oldest first
+type PrescriptionHistory struct {
+	PrescriptionID uint                   `json:"prescriptionId"`
+	ExaminationID  uint                   `json:"examinationId"`
+	Versions       []models.RecordVersion `json:"versions"`
+}
+
+// GetPrescriptionHistory retrieves every stored version of a prescription, including those
+// from before it was deleted. Prescriptions unchanged since versioning began have none.
+func (s *PrescriptionService) GetPrescriptionHistory(id uint) (PrescriptionHistory, error) {
+	versions, err := audit.History(s.DB, "prescriptions", id)
+	if err != nil {
+		return PrescriptionHistory{}, err
+	}
+	history := PrescriptionHistory{PrescriptionID: id, Versions: versions}
+
+	prescription, err := s.GetPrescriptionByID(id)
+	switch {
+	case err == nil:
+		history.ExaminationID = prescription.ExaminationID
+	case err.Error() != "prescription not found":
+		return PrescriptionHistory{}, err
+	case len(versions) == 0:
+		return PrescriptionHistory{}, err
+	default:
+		// Deleted: the examination is taken from the last stored state
+		for i := len(versions) - 1; i >= 0; i-- {
+			if versions[i].Snapshot != nil {
+				if err := json.Unmarshal(versions[i].Snapshot, &prescription); err != nil {
+					return PrescriptionHistory{}, err
+				}
+				history.ExaminationID = prescription.ExaminationID
+				break
+			}
+		}
+	}
+	return history, nil
+}
+
+// GetPrescriptionAsOf retrieves a prescription as it was at the given time. Prescriptions
+// unchanged since versioning began are returned as they are now, unless created after it.
+func (s *PrescriptionService) GetPrescriptionAsOf(id uint, at time.Time) (models.Prescription, error) {
+	version, err := audit.AsOf(s.DB, "prescriptions", id, at)
+	if errors.Is(err, audit.ErrNoVersion) {
+		versions, err := audit.History(s.DB, "prescriptions", id)
+		if err != nil {
+			return models.Prescription{}, err
+		}
+		if len(versions) > 0 {
+			return models.Prescription{}, errors.New("prescription not found at that time")
+		}
+		prescription, err := s.GetPrescriptionByID(id)
+		if err == nil && prescription.CreatedAt.After(at) {
+			return models.Prescription{}, errors.New("prescription not found at that time")
+		}
+		return prescription, err
+	}
+	if err != nil {
+		return models.Prescription{}, err
+	}
+
+	var prescription models.Prescription
+	if err := json.Unmarshal(version.Snapshot, &prescription); err != nil {
+		return models.Prescription{}, err
+	}
+	if prescription.CreatedAt.After(at) {
+		// A baseline stands for earlier times only from the prescription's creation
+		return models.Prescription{}, errors.New("prescription not found at that time")
+	}
+	return prescription, nil
+}
+
+// GetPrescriptionWithDetails retrieves a prescription together with its examination and patient.
+func (s *PrescriptionService) GetPrescriptionWithDetails(id uint) (models.Prescription, error) {
+	var prescription models.Prescription
+	result := s.DB.Preload("Examination.Patient").First(&prescription, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.Prescription{}, errors.New("prescription not found")
+		}
+		return models.Prescription{}, result.Error
+	}
+	return prescription, nil
+}
+
 // GetPrescriptionsByExaminationID retrieves all prescriptions for a specific examination.
 func (s *PrescriptionService) GetPrescriptionsByExaminationID(examinationID uint) ([]models.Prescription, error) {
 	var examPrescriptions []models.Prescription
@@ -60,24 +309,81 @@ func (s *PrescriptionService) GetPrescriptionsByExaminationID(examinationID uint
 	return examPrescriptions, result.Error
 }
 
-// UpdatePrescription updates an existing prescription's details.
-func (s *PrescriptionService) UpdatePrescription(id uint, medication, dosage, instructions string, validated, sent *bool) (models.Prescription, error) {
+// StructuredDosageUpdate holds the structured dosing fields to change; nil fields are kept.
+type StructuredDosageUpdate struct {
+	MedicationCode *string  `json:"medicationCode"`
+	Strength       *string  `json:"strength"`
+	Form           *string  `json:"form"`
+	Route          *string  `json:"route"`
+	DoseAmount     *float64 `json:"doseAmount"`
+	Frequency      *string  `json:"frequency"`
+	DurationDays   *int     `json:"durationDays"`
+	Quantity       *int     `json:"quantity"`
+	Refills        *int     `json:"refills"`
+}
+
+// UpdatePrescription updates an existing prescription's details; nil arguments are kept.
+// The given structured fields replace the stored ones. Structured prescriptions take their
+// medication name from the formulary code and their dosage from the sig rendered from the
+// structure, so neither can be set as free text.
+// Changing the medication or dosage voids an earlier validation, so the safety checks run again
+// before the prescription can be sent; once sent, they can no longer be changed.
+// It fails with etag.ErrMismatch unless the prescription is still at the given version.
+func (s *PrescriptionService) UpdatePrescription(id, version uint, medication, dosage, instructions *string, structured StructuredDosageUpdate, validated, sent *bool) (models.Prescription, error) {
 	prescription, err := s.GetPrescriptionByID(id)
 	if err != nil {
 		return models.Prescription{}, err
 	}
+	before := prescription
+
+	if structured != (StructuredDosageUpdate{}) {
+		merged := mergeStructuredDosage(prescription.StructuredDosage, structured)
+		if err := s.completeStructuredDosage(&prescription.Medication, &merged); err != nil {
+			return models.Prescription{}, err
+		}
+		if merged.Refills != prescription.Refills && !prescription.Sent {
+			// Authorised refills can only change before the prescription reaches the pharmacy
+			prescription.RefillsRemaining = merged.Refills
+		}
+		prescription.StructuredDosage = merged
+	}
 
-	// Update fields if provided (use pointers for bools to distinguish between false and not provided)
-	if medication != "" {
-		prescription.Medication = medication
+	if medication != nil {
+		if prescription.MedicationCode != "" {
+			return models.Prescription{}, ErrCodedMedication
+		}
+		if strings.TrimSpace(*medication) == "" {
+			return models.Prescription{}, errors.New("medication cannot be empty")
+		}
+		prescription.Medication = *medication
+	}
+	if isStructured(prescription.StructuredDosage) {
+		if dosage != nil {
+			return models.Prescription{}, ErrStructuredDosage
+		}
+		prescription.Dosage = RenderSig(prescription.StructuredDosage)
+	} else if dosage != nil {
+		prescription.Dosage = *dosage
+	}
+	// An empty string clears the instructions
+	if instructions != nil {
+		prescription.Instructions = *instructions
 	}
-	if dosage != "" {
-		prescription.Dosage = dosage
+
+	if prescription.Medication != before.Medication || prescription.Dosage != before.Dosage ||
+		prescription.StructuredDosage != before.StructuredDosage {
+		if before.Sent {
+			return models.Prescription{}, ErrPrescriptionSent
+		}
+		prescription.Validated = false
+		prescription.ValidationOverrideReason = ""
 	}
-	// Allow clearing instructions
-	prescription.Instructions = instructions
 
 	if validated != nil {
+		// Business rule: Validation must go through the safety checks
+		if *validated && !prescription.Validated {
+			return models.Prescription{}, errors.New("prescriptions must be validated through the validate action")
+		}
 		prescription.Validated = *validated
 	}
 	if sent != nil {
@@ -88,25 +394,123 @@ func (s *PrescriptionService) UpdatePrescription(id uint, medication, dosage, in
 		prescription.Sent = *sent
 	}
 
-	result := s.DB.Save(&prescription)
+	result := etag.Expect(s.DB, version).Save(&prescription)
 	return prescription, result.Error
 }
 
-// ValidatePrescription marks a prescription as validated.
-func (s *PrescriptionService) ValidatePrescription(id uint) (models.Prescription, error) {
+// mergeStructuredDosage overlays the given fields of update onto current.
+func mergeStructuredDosage(current models.StructuredDosage, update StructuredDosageUpdate) models.StructuredDosage {
+	if update.MedicationCode != nil && *update.MedicationCode != current.MedicationCode {
+		// A new code brings its own strength, form and route unless given explicitly
+		current.MedicationCode = *update.MedicationCode
+		current.Strength, current.Form, current.Route = "", "", ""
+	}
+	if update.Strength != nil {
+		current.Strength = *update.Strength
+	}
+	if update.Form != nil {
+		current.Form = *update.Form
+	}
+	if update.Route != nil {
+		current.Route = *update.Route
+	}
+	if update.DoseAmount != nil {
+		current.DoseAmount = *update.DoseAmount
+	}
+	if update.Frequency != nil {
+		current.Frequency = *update.Frequency
+	}
+	if update.DurationDays != nil {
+		current.DurationDays = *update.DurationDays
+	}
+	if update.Quantity != nil {
+		current.Quantity = *update.Quantity
+	}
+	if update.Refills != nil {
+		current.Refills = *update.Refills
+	}
+	return current
+}
+
+// isStructured reports whether a dosage is coded or structured, as opposed to
+// free text, in which case the prescription's Dosage is rendered from it.
+func isStructured(d models.StructuredDosage) bool {
+	return d.MedicationCode != "" || d.Frequency != ""
+}
+
+// ValidatePrescription runs the safety checks and marks a prescription as validated.
+// Blocking findings always prevent validation; warnings require an override reason.
+func (s *PrescriptionService) ValidatePrescription(id uint, overrideReason string) (models.Prescription, safety.Result, error) {
 	prescription, err := s.GetPrescriptionByID(id)
 	if err != nil {
-		return models.Prescription{}, err
+		return models.Prescription{}, safety.Result{}, err
 	}
 
 	if prescription.Validated {
 		// Optionally return an error or just the current state if already validated
-		return prescription, nil // Or: errors.New("prescription already validated")
+		return prescription, safety.Result{}, nil // Or: errors.New("prescription already validated")
+	}
+
+	input, err := s.buildSafetyInput(prescription)
+	if err != nil {
+		return models.Prescription{}, safety.Result{}, err
+	}
+	findings := safety.Run(input, s.Checkers...)
+	if input.PatientID != 0 && input.Allergies == nil {
+		// The allergy lookup failed or is not configured; make the clinician acknowledge the gap
+		findings.Warnings = append(findings.Warnings, safety.Finding{
+			Code:     "ALLERGIES_UNAVAILABLE",
+			Severity: safety.SeverityWarning,
+			Message:  "Patient allergies could not be retrieved",
+		})
+	}
+
+	if findings.HasErrors() {
+		return models.Prescription{}, findings, ErrBlockingFindings
+	}
+	if findings.HasWarnings() && overrideReason == "" {
+		return models.Prescription{}, findings, ErrOverrideRequired
 	}
 
 	prescription.Validated = true
+	if findings.HasWarnings() {
+		prescription.ValidationOverrideReason = overrideReason
+	}
 	result := s.DB.Save(&prescription)
-	return prescription, result.Error
+	return prescription, findings, result.Error
+}
+
+// buildSafetyInput gathers the patient context the safety checkers need.
+func (s *PrescriptionService) buildSafetyInput(prescription models.Prescription) (safety.Input, error) {
+	input := safety.Input{Prescription: prescription}
+
+	var exam models.Examination
+	result := s.DB.Select("id", "patient_id").First(&exam, prescription.ExaminationID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			// Without an examination there is no patient to check against
+			return input, nil
+		}
+		return safety.Input{}, result.Error
+	}
+	input.PatientID = exam.PatientID
+
+	// Other validated prescriptions for the same patient count as active therapy
+	result = s.DB.Joins("JOIN examinations ON examinations.id = prescriptions.examination_id").
+		Where("examinations.patient_id = ? AND prescriptions.id <> ? AND prescriptions.validated = ?", exam.PatientID, prescription.ID, true).
+		Find(&input.ActivePrescriptions)
+	if result.Error != nil {
+		return safety.Input{}, result.Error
+	}
+
+	if s.Allergies != nil {
+		allergies, err := s.Allergies.AllergiesForPatient(exam.PatientID)
+		if err == nil {
+			input.Allergies = append([]string{}, allergies...)
+		}
+	}
+
+	return input, nil
 }
 
 // SendPrescription marks a validated prescription as sent.
@@ -125,19 +529,138 @@ func (s *PrescriptionService) SendPrescription(id uint) (models.Prescription, er
 		return prescription, nil // Or: errors.New("prescription already sent")
 	}
 
+	if s.Pharmacy == nil {
+		return models.Prescription{}, errors.New("pharmacy integration is not configured")
+	}
+
+	order := pharmacy.Order{
+		PrescriptionID: prescription.ID,
+		ExaminationID:  prescription.ExaminationID,
+		Medication:     prescription.Medication,
+		Dosage:         prescription.Dosage,
+		Instructions:   prescription.Instructions,
+	}
+
+	// The key is derived from the prescription ID so repeated send attempts are de-duplicated by the pharmacy
+	ctx, cancel := context.WithTimeout(context.Background(), pharmacyTimeout)
+	defer cancel()
+	ack, err := s.Pharmacy.SubmitPrescription(ctx, order, fmt.Sprintf("prescription-%d", prescription.ID))
+	if err != nil {
+		return models.Prescription{}, err
+	}
+
+	now := time.Now()
 	prescription.Sent = true
+	prescription.PharmacyAckID = ack.AckID
+	prescription.SentAt = &now
 	result := s.DB.Save(&prescription)
 	return prescription, result.Error
 }
 
-// DeletePrescription removes a prescription from the database.
-func (s *PrescriptionService) DeletePrescription(id uint) error {
-	result := s.DB.Delete(&models.Prescription{}, id)
-	if result.Error != nil {
-		return result.Error
+// RefillPrescription records a dispensing event for a refill and decrements the remaining refills.
+// A quantity of 0 dispenses the prescribed quantity.
+func (s *PrescriptionService) RefillPrescription(id uint, quantity int, pharmacyName string) (models.Prescription, models.DispenseEvent, error) {
+	prescription, err := s.GetPrescriptionByID(id)
+	if err != nil {
+		return models.Prescription{}, models.DispenseEvent{}, err
+	}
+
+	if !prescription.Sent {
+		return models.Prescription{}, models.DispenseEvent{}, errors.New("prescription must be sent before it can be refilled")
 	}
-	if result.RowsAffected == 0 {
-		return errors.New("prescription not found or already deleted")
+	if quantity <= 0 {
+		quantity = prescription.Quantity
 	}
-	return nil
+
+	event := models.DispenseEvent{
+		PrescriptionID: prescription.ID,
+		DispensedAt:    time.Now(),
+		Quantity:       quantity,
+		Pharmacy:       pharmacyName,
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Conditional decrement so concurrent refills cannot overdraw the count
+		result := tx.Model(&models.Prescription{}).
+			Where("id = ? AND refills_remaining > 0", prescription.ID).
+			Update("refills_remaining", gorm.Expr("refills_remaining - 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("no refills remaining")
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return fmt.Errorf("failed to record dispense event: %w", err)
+		}
+		return tx.First(&prescription, prescription.ID).Error
+	})
+	if err != nil {
+		return models.Prescription{}, models.DispenseEvent{}, err
+	}
+	return prescription, event, nil
+}
+
+// GetDispenseEvents retrieves the dispensing history of a prescription, oldest first.
+func (s *PrescriptionService) GetDispenseEvents(prescriptionID uint) ([]models.DispenseEvent, error) {
+	if _, err := s.GetPrescriptionByID(prescriptionID); err != nil {
+		return nil, err
+	}
+	var events []models.DispenseEvent
+	result := s.DB.Where("prescription_id = ?", prescriptionID).Order("dispensed_at").Find(&events)
+	return events, result.Error
+}
+
+// RenewPrescription creates a new draft prescription repeating a validated one, for the same
+// examination, which must still be referenceable, and prescriber.
+// The draft must be validated by a doctor before it can be sent; refills < 0 keeps the original count.
+// Free-text prescriptions can be renewed with refills too: they are tracked in RefillsRemaining,
+// while only structured prescriptions have them in the rendered sig.
+func (s *PrescriptionService) RenewPrescription(id uint, refills int) (models.Prescription, error) {
+	original, err := s.GetPrescriptionByID(id)
+	if err != nil {
+		return models.Prescription{}, err
+	}
+
+	if !original.Validated {
+		return models.Prescription{}, errors.New("only validated prescriptions can be renewed")
+	}
+	if err := s.checkExamination(original.ExaminationID); err != nil {
+		return models.Prescription{}, err
+	}
+
+	renewal := models.Prescription{
+		ExaminationID:    original.ExaminationID,
+		Medication:       original.Medication,
+		Dosage:           original.Dosage,
+		Instructions:     original.Instructions,
+		Prescriber:       original.Prescriber,
+		PrescriberID:     original.PrescriberID,
+		StructuredDosage: original.StructuredDosage,
+		RenewedFromID:    &original.ID,
+		Validated:        false, // A renewal starts as a draft
+		Sent:             false,
+	}
+	if refills >= 0 {
+		renewal.Refills = refills
+		if isStructured(renewal.StructuredDosage) {
+			renewal.Dosage = RenderSig(renewal.StructuredDosage)
+		}
+	}
+	renewal.RefillsRemaining = renewal.Refills
+
+	result := s.DB.Create(&renewal)
+	return renewal, result.Error
+}
+
+// DeletePrescription soft-deletes a prescription; it can be restored until it is purged. It fails with
+// etag.ErrMismatch unless the prescription is still at the given version.
+func (s *PrescriptionService) DeletePrescription(id, version uint) error {
+	if _, err := s.GetPrescriptionByID(id); err != nil {
+		if err.Error() == "prescription not found" {
+			return errors.New("prescription not found or already deleted")
+		}
+		return err
+	}
+	return etag.Expect(s.DB, version).Delete(&models.Prescription{}, id).Error
 }
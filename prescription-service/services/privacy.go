@@ -0,0 +1,41 @@
+package services
+
+import (
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"gorm.io/gorm"
+)
+
+// ExportPatientData retrieves every prescription of the patient's examinations, for a patient data export.
+func (s *PrescriptionService) ExportPatientData(req privacy.Request) ([]models.Prescription, error) {
+	if len(req.ExaminationIDs) == 0 {
+		return []models.Prescription{}, nil
+	}
+	prescriptions := []models.Prescription{}
+	result := s.DB.Unscoped().Where("examination_id IN ?", req.ExaminationIDs).Order("id").Find(&prescriptions)
+	return prescriptions, result.Error
+}
+
+// ErasePatientData anonymises the prescriptions of the patient's examinations by removing their
+// instructions and override reasons, including from their earlier versions.
+// Structured data is kept so statistics and references stay intact.
+func (s *PrescriptionService) ErasePatientData(req privacy.Request) (int, error) {
+	if len(req.ExaminationIDs) == 0 {
+		return 0, nil
+	}
+	erased := map[string]interface{}{"instructions": privacy.ErasedText, "validation_override_reason": ""}
+	var ids []uint
+	err := audit.Redacted(s.DB).Transaction(func(tx *gorm.DB) error {
+		prescriptions := tx.Unscoped().Model(&models.Prescription{}).Where("examination_id IN ?", req.ExaminationIDs).Session(&gorm.Session{})
+		if err := prescriptions.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if err := prescriptions.Updates(erased).Error; err != nil {
+			return err
+		}
+		_, err := audit.ScrubVersions(tx, &models.Prescription{}, ids, erased)
+		return err
+	})
+	return len(ids), err
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fitnis/shared/models"
+)
+
+// frequencyPhrases maps the supported frequency codes to their sig wording.
+var frequencyPhrases = map[string]string{
+	"QD":   "once daily",
+	"BID":  "twice daily",
+	"TID":  "three times daily",
+	"QID":  "four times daily",
+	"Q4H":  "every 4 hours",
+	"Q6H":  "every 6 hours",
+	"Q8H":  "every 8 hours",
+	"Q12H": "every 12 hours",
+	"QHS":  "at bedtime",
+	"QW":   "once weekly",
+	"PRN":  "as needed",
+	"STAT": "immediately",
+}
+
+// routePhrases maps routes to the phrase used after the dose.
+var routePhrases = map[string]string{
+	"oral":       "by mouth",
+	"sublingual": "under the tongue",
+	"topical":    "to the affected area",
+	"inhaled":    "by inhalation",
+	"rectal":     "rectally",
+	"ophthalmic": "in the eye",
+	"otic":       "in the ear",
+	"nasal":      "in the nose",
+}
+
+// IsKnownFrequency reports whether a frequency code can be rendered into a sig.
+func IsKnownFrequency(code string) bool {
+	_, ok := frequencyPhrases[strings.ToUpper(code)]
+	return ok
+}
+
+// RenderSig produces the human-readable directions for a structured dosage, e.g.
+// "Take 1 capsule (500 mg) by mouth three times daily for 7 days. Dispense 21 capsules. Refills: 0."
+func RenderSig(d models.StructuredDosage) string {
+	var sb strings.Builder
+
+	route := strings.ToLower(d.Route)
+	switch route {
+	case "topical":
+		sb.WriteString("Apply")
+	case "inhaled":
+		sb.WriteString("Inhale")
+	case "ophthalmic", "otic", "nasal":
+		sb.WriteString("Instil")
+	default:
+		sb.WriteString("Take")
+	}
+
+	if d.DoseAmount > 0 {
+		amount := strconv.FormatFloat(d.DoseAmount, 'f', -1, 64)
+		sb.WriteString(" " + amount)
+		if d.Form != "" {
+			sb.WriteString(" " + pluralize(d.Form, d.DoseAmount))
+		}
+	} else if d.Form != "" {
+		sb.WriteString(" as " + d.Form)
+	}
+	if d.Strength != "" {
+		sb.WriteString(" (" + d.Strength + ")")
+	}
+	if phrase, ok := routePhrases[route]; ok {
+		sb.WriteString(" " + phrase)
+	} else if route != "" {
+		sb.WriteString(" via " + route + " route")
+	}
+
+	if d.Frequency != "" {
+		phrase, ok := frequencyPhrases[strings.ToUpper(d.Frequency)]
+		if !ok {
+			phrase = d.Frequency
+		}
+		sb.WriteString(" " + phrase)
+	}
+	if d.DurationDays > 0 {
+		sb.WriteString(fmt.Sprintf(" for %d %s", d.DurationDays, pluralize("day", float64(d.DurationDays))))
+	}
+	sb.WriteString(".")
+
+	if d.Quantity > 0 {
+		unit := d.Form
+		if unit == "" {
+			unit = "unit"
+		}
+		sb.WriteString(fmt.Sprintf(" Dispense %d %s.", d.Quantity, pluralize(unit, float64(d.Quantity))))
+	}
+	sb.WriteString(fmt.Sprintf(" Refills: %d.", d.Refills))
+
+	return sb.String()
+}
+
+func pluralize(word string, n float64) string {
+	// Units such as "mL" or "1%" are not pluralised
+	if n == 1 || word == "" || strings.ToLower(word) != word || strings.HasSuffix(word, "s") {
+		return word
+	}
+	return word + "s"
+}
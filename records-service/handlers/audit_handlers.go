@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fitnis/records-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/query"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditRoles may read the audit log by default.
+var AuditRoles = []string{"auditor", "admin"}
+
+// AuditHandler holds the audit service.
+type AuditHandler struct {
+	Service *services.AuditService
+
+	// Roles may read the audit log; callers with any other role, or none, are refused
+	Roles []string
+}
+
+// NewAuditHandler creates a new AuditHandler readable by AuditRoles.
+func NewAuditHandler(s *services.AuditService) *AuditHandler {
+	return &AuditHandler{Service: s, Roles: AuditRoles}
+}
+
+// GetAuditEntries handles GET /api/audit?actor=&role=&action=&resourceType=&resourceId=&requestId=&service=&sourceIp=&from=&to=&sort=&limit=&offset=&cursor=
+func (h *AuditHandler) GetAuditEntries(c *gin.Context) {
+	if !h.authorize(c) {
+		return
+	}
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.GetEntries(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit entries: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetAuditEntry handles GET /api/audit/:id
+func (h *AuditHandler) GetAuditEntry(c *gin.Context) {
+	if !h.authorize(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	entry, err := h.Service.GetEntry(uint(id))
+	if err != nil {
+		if err.Error() == "audit entry not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit entry: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// VerifyAuditChain handles GET /api/audit/verify
+func (h *AuditHandler) VerifyAuditChain(c *gin.Context) {
+	if !h.authorize(c) {
+		return
+	}
+	result, err := h.Service.VerifyChain()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit log: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// authorize checks the caller identified by the request headers holds one of the roles
+// allowed to read the audit log. When they do not it writes the response and returns false.
+func (h *AuditHandler) authorize(c *gin.Context) bool {
+	who := consent.IdentityFromHeaders(c.Request.Header)
+	if who.Role != "" && slices.Contains(h.Roles, who.Role) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "reading the audit log requires one of the roles: " + strings.Join(h.Roles, ", ")})
+	return false
+}
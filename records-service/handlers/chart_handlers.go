@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/records-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"github.com/gin-gonic/gin"
+)
+
+// ChartHandler holds the chart service.
+type ChartHandler struct {
+	Service *services.ChartService
+
+	// Consent enforces patients' consents on reads; nil allows every read
+	Consent *consent.Enforcer
+}
+
+// NewChartHandler creates a new ChartHandler.
+func NewChartHandler(s *services.ChartService) *ChartHandler {
+	return &ChartHandler{Service: s}
+}
+
+type ChartNoteRequest struct {
+	PatientID     uint   `json:"patientId" binding:"required"`
+	ExaminationID *uint  `json:"examinationId"`
+	NoteType      string `json:"noteType"` // progress (default), nursing, admission, discharge, consult, procedure
+	Author        string `json:"author"`
+	AuthorID      *uint  `json:"authorId"`
+	Note          string `json:"note" binding:"required"`
+}
+
+type UpdateChartNoteRequest struct {
+	NoteType string `json:"noteType"`
+	Note     string `json:"note"`
+}
+
+type AddendumRequest struct {
+	Author   string `json:"author"`
+	AuthorID *uint  `json:"authorId"`
+	Note     string `json:"note" binding:"required"`
+}
+
+type SignChartNoteRequest struct {
+	SignedBy string `json:"signedBy"` // defaults to the note's author
+}
+
+// ReassignRequest moves chart notes between patients
+type ReassignRequest struct {
+	FromPatientID uint   `json:"fromPatientId" binding:"required"`
+	ToPatientID   uint   `json:"toPatientId" binding:"required"`
+	ChartNoteIDs  []uint `json:"chartNoteIds"` // optional; all of the patient's notes when empty
+}
+
+// GetChart handles GET /api/records/chart?patientId=&examinationId=&noteType=&authorId=&signed=&from=&to=&sort=&limit=&offset=&cursor=
+func (h *ChartHandler) GetChart(c *gin.Context) {
+	patientID, err := strconv.ParseUint(c.Query("patientId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patientId query parameter is required"})
+		return
+	}
+	params, err := query.FromValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkConsent(c, uint(patientID), consent.ScopeChart) {
+		return
+	}
+
+	page, err := h.Service.GetChart(uint(patientID), params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chart: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetChartNote handles GET /api/records/chart/:id
+func (h *ChartHandler) GetChartNote(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	note, err := h.Service.GetNoteByID(uint(id))
+	if err != nil {
+		writeChartError(c, "Failed to retrieve chart note", err)
+		return
+	}
+	if !h.checkConsent(c, note.PatientID, consent.ScopeChart) {
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(note.Version))
+	c.JSON(http.StatusOK, note)
+}
+
+// CreateChartNote handles POST /api/records/chart
+func (h *ChartHandler) CreateChartNote(c *gin.Context) {
+	var req ChartNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	note, err := h.Service.CreateNote(models.ChartNote{
+		PatientID:     req.PatientID,
+		ExaminationID: req.ExaminationID,
+		NoteType:      req.NoteType,
+		Author:        req.Author,
+		AuthorID:      req.AuthorID,
+		Content:       req.Note,
+	})
+	if err != nil {
+		writeChartError(c, "Failed to create chart note", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(note.Version))
+	c.JSON(http.StatusCreated, note)
+}
+
+// UpdateChartNote handles PUT /api/records/chart/:id
+// The If-Match header must hold the note's current ETag.
+func (h *ChartHandler) UpdateChartNote(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateChartNoteRequest
+	if err := c.BindJSON(&req); err != nil { // Use BindJSON for optional fields
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	note, err := h.Service.UpdateNote(uint(id), version, req.NoteType, req.Note)
+	if err != nil {
+		writeChartError(c, "Failed to update chart note", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(note.Version))
+	c.JSON(http.StatusOK, note)
+}
+
+// SignChartNote handles POST /api/records/chart/:id/sign
+func (h *ChartHandler) SignChartNote(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req SignChartNoteRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	note, err := h.Service.SignNote(uint(id), req.SignedBy)
+	if err != nil {
+		writeChartError(c, "Failed to sign chart note", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(note.Version))
+	c.JSON(http.StatusOK, note)
+}
+
+// AddAddendum handles POST /api/records/chart/:id/addenda
+func (h *ChartHandler) AddAddendum(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req AddendumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	addendum, err := h.Service.AddAddendum(uint(id), models.ChartNote{Author: req.Author, AuthorID: req.AuthorID, Content: req.Note})
+	if err != nil {
+		writeChartError(c, "Failed to add addendum", err)
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(addendum.Version))
+	c.JSON(http.StatusCreated, addendum)
+}
+
+// DeleteChartNote handles DELETE /api/records/chart/:id
+// The If-Match header must hold the note's current ETag.
+func (h *ChartHandler) DeleteChartNote(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	err = h.Service.DeleteNote(uint(id), version)
+	if err != nil {
+		if err.Error() == "chart note not found or already deleted" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chart note not found"})
+		} else {
+			writeChartError(c, "Failed to delete chart note", err)
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ReassignChartNotes handles POST /api/records/reassign
+// It is used by the patient service when merging duplicate records and undoing merges.
+func (h *ChartHandler) ReassignChartNotes(c *gin.Context) {
+	var req ReassignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	moved, err := h.Service.ReassignNotes(req.FromPatientID, req.ToPatientID, req.ChartNoteIDs)
+	if err != nil {
+		if err.Error() == "cannot reassign chart notes to the same patient" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign chart notes: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"chartNoteIds": moved})
+}
+
+// writeChartError maps service errors to status codes.
+func writeChartError(c *gin.Context, action string, err error) {
+	switch {
+	case err.Error() == "chart note not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNoteSigned):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, etag.ErrMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidNote):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err.Error() == "patient not found", err.Error() == "examination not found",
+		errors.Is(err, practitioners.ErrNotFound), errors.Is(err, practitioners.ErrInactive):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, practitioners.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify author: " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": action + ": " + err.Error()})
+	}
+}
+
+// checkConsent checks the caller identified by the request headers against the
+// patient's consents. When the read is refused it writes the response and returns false.
+func (h *ChartHandler) checkConsent(c *gin.Context, patientID uint, scope string) bool {
+	err := h.Consent.Check(patientID, scope, consent.IdentityFromHeaders(c.Request.Header))
+	if err == nil {
+		return true
+	}
+	var denied *consent.DeniedError
+	if errors.As(err, &denied) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": denied.Reason})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check consent: " + err.Error()})
+	}
+	return false
+}
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckDeletion handles POST /api/records/deletion/check
+// The patient service calls it before deleting patients.
+func (h *ChartHandler) CheckDeletion(c *gin.Context) {
+	h.handleDeletion(c, "check chart notes", h.Service.CountDependents)
+}
+
+// DeleteDependents handles POST /api/records/deletion/delete
+// The patient service calls it when deleting patients.
+func (h *ChartHandler) DeleteDependents(c *gin.Context) {
+	h.handleDeletion(c, "delete chart notes", h.Service.DeleteDependents)
+}
+
+// RestoreDependents handles POST /api/records/deletion/restore
+// The patient service calls it when restoring patients.
+func (h *ChartHandler) RestoreDependents(c *gin.Context) {
+	h.handleDeletion(c, "restore chart notes", h.Service.RestoreDependents)
+}
+
+// RestoreChartNote handles POST /api/records/chart/:id/restore
+func (h *ChartHandler) RestoreChartNote(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	note, err := h.Service.RestoreNote(uint(id))
+	if err != nil {
+		switch {
+		case err.Error() == "chart note not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, deletion.ErrNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore chart note: " + err.Error()})
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(note.Version))
+	c.JSON(http.StatusOK, note)
+}
+
+// handleDeletion runs a deletion request from another service and replies
+// with the number of chart notes it concerned.
+func (h *ChartHandler) handleDeletion(c *gin.Context, action string, run func(deletion.Request) (int, error)) {
+	var req deletion.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	count, err := run(req)
+	if err != nil {
+		if errors.Is(err, deletion.ErrUnknownParent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + ": " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, deletion.Result{Count: count})
+}
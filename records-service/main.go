@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/fitnis/records-service/handlers"
+	"github.com/fitnis/records-service/services"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/privacy"
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	// Initialize Database
+	database.InitDB()
+	db := database.DB
+
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "records")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
+	// Initialize services and handlers
+	chartService := services.NewChartService(db)
+	chartService.Practitioners = practitioners.NewKafkaDirectory()
+	chartHandler := handlers.NewChartHandler(chartService)
+	chartHandler.Consent = consent.NewEnforcer(db)
+	auditHandler := handlers.NewAuditHandler(services.NewAuditService(db))
+
+	// Purge chart notes soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, chartService.PurgeDeleted)
+
+	// Start Kafka consumer
+	log.Println("Starting Kafka consumer")
+	kafka.StartKafkaConsumer("records", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
+		return handleKafkaRequest(req, chartHandler, auditHandler)
+	}))
+
+	// Block main goroutine
+	select {}
+}
+
+// handleKafkaRequest processes Kafka requests and returns responses.
+// Paths are /chart[/:id[/sign|/addenda|/restore]], /audit[/verify|/:id], /reassign, which the patient
+// service calls when merging patients, and /deletion/..., which it calls when deleting and restoring patients.
+func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.ChartHandler, auditHandler *handlers.AuditHandler) kafka.KafkaResponse {
+	// Create a mock gin context to reuse our handler functions
+	c, w := createMockGinContext(req)
+
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
+	resource, idStr, action := splitPath(path)
+
+	// The audit log is read-only; the API gateway serves it as /api/audit
+	if resource == "audit" {
+		switch {
+		case req.Method == "GET" && idStr == "":
+			auditHandler.GetAuditEntries(c)
+		case req.Method == "GET" && idStr == "verify" && action == "":
+			auditHandler.VerifyAuditChain(c)
+		case req.Method == "GET" && action == "":
+			c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+			auditHandler.GetAuditEntry(c)
+		default:
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Patient data export and erasure have no chart note ID in the path
+	if path == privacy.ExportPath || path == privacy.ErasePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		if path == privacy.ExportPath {
+			handler.ExportPatientData(c)
+		} else {
+			handler.ErasePatientData(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Deletion requests from the patient service have no chart note ID in the path
+	if path == deletion.CheckPath || path == deletion.DeletePath || path == deletion.RestorePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		switch path {
+		case deletion.CheckPath:
+			handler.CheckDeletion(c)
+		case deletion.DeletePath:
+			handler.DeleteDependents(c)
+		default:
+			handler.RestoreDependents(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	if resource == "reassign" {
+		if req.Method != "POST" || idStr != "" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		handler.ReassignChartNotes(c)
+		return createResponse(req.RequestID, w)
+	}
+
+	if resource != "chart" {
+		return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+	}
+
+	// Extract ID from path if present
+	var id uint64
+	var err error
+	if idStr != "" {
+		id, err = strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			return createErrorResponse(req.RequestID, http.StatusBadRequest, "Invalid ID format")
+		}
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+	}
+
+	// Route to appropriate handler
+	switch {
+	case req.Method == "GET" && idStr == "":
+		handler.GetChart(c)
+	case req.Method == "GET" && id > 0 && action == "":
+		handler.GetChartNote(c)
+	case req.Method == "POST" && idStr == "":
+		handler.CreateChartNote(c)
+	case req.Method == "PUT" && id > 0 && action == "":
+		handler.UpdateChartNote(c)
+	case req.Method == "DELETE" && id > 0 && action == "":
+		handler.DeleteChartNote(c)
+	case req.Method == "POST" && id > 0 && action == "restore":
+		handler.RestoreChartNote(c)
+	case req.Method == "POST" && id > 0 && action == "sign":
+		handler.SignChartNote(c)
+	case req.Method == "POST" && id > 0 && action == "addenda":
+		handler.AddAddendum(c)
+	default:
+		return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+	}
+
+	// Create response from the written data
+	return createResponse(req.RequestID, w)
+}
+
+// Helper functions
+
+func createMockGinContext(req kafka.KafkaRequest) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	httpReq, _ := http.NewRequest(req.Method, req.Path, bytes.NewReader(req.Body))
+
+	// Add headers
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+	return c, w
+}
+
+// splitPath splits /resource/id/action into its parts; missing parts are empty
+func splitPath(path string) (resource, id, action string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	resource = parts[0]
+	if len(parts) >= 2 {
+		id = parts[1]
+	}
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	return resource, id, action
+}
+
+func createResponse(requestID string, w *httptest.ResponseRecorder) kafka.KafkaResponse {
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
+func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
+	errorJSON, _ := json.Marshal(gin.H{"error": message})
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: errorJSON,
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"gorm.io/gorm"
+)
+
+// AuditService reads the audit log every service writes to.
+type AuditService struct {
+	DB *gorm.DB
+}
+
+// NewAuditService creates a new AuditService.
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{DB: db}
+}
+
+// auditQuery is the allow-list for searching the audit log.
+var auditQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"actor":        {Column: "actor"},
+		"role":         {Column: "role"},
+		"action":       {Column: "action"},
+		"resourceType": {Column: "resource_type"},
+		"resourceId":   {Column: "resource_id"},
+		"requestId":    {Column: "request_id"},
+		"service":      {Column: "service"},
+		"sourceIp":     {Column: "source_ip"},
+		"from":         {Column: "timestamp", Kind: query.Time, Op: query.Gte},
+		"to":           {Column: "timestamp", Kind: query.Time, Op: query.Lte},
+	},
+	Sorts:        map[string]string{"sequence": "sequence", "timestamp": "timestamp"},
+	DefaultSort:  "-sequence",
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+}
+
+// GetEntries retrieves one page of audit entries, newest first by default.
+// Filters: actor, role, action, resourceType, resourceId, requestId, service, sourceIp,
+// and from and to (timestamp, inclusive).
+func (s *AuditService) GetEntries(params query.Params) (query.Page[models.AuditEntry], error) {
+	return query.Find[models.AuditEntry](s.DB, auditQuery, params)
+}
+
+// GetEntry retrieves one audit entry.
+func (s *AuditService) GetEntry(id uint) (models.AuditEntry, error) {
+	var entry models.AuditEntry
+	result := s.DB.Limit(1).Find(&entry, id)
+	if result.Error != nil {
+		return models.AuditEntry{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.AuditEntry{}, errors.New("audit entry not found")
+	}
+	return entry, nil
+}
+
+// VerifyChain checks that no entry has been changed, removed or inserted since it was written.
+func (s *AuditService) VerifyChain() (audit.Verification, error) {
+	return audit.Verify(s.DB)
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"gorm.io/gorm"
+)
+
+// Note types.
+const (
+	NoteProgress  = "progress"
+	NoteNursing   = "nursing"
+	NoteAdmission = "admission"
+	NoteDischarge = "discharge"
+	NoteConsult   = "consult"
+	NoteProcedure = "procedure"
+	NoteAddendum  = "addendum"
+)
+
+// ErrNoteSigned is returned when changing a note that has been signed.
+var ErrNoteSigned = errors.New("note is signed and can no longer be changed")
+
+// ErrInvalidNote is returned when a note is missing required fields or references something it cannot.
+var ErrInvalidNote = errors.New("invalid chart note")
+
+// ChartService handles database operations for chart notes.
+type ChartService struct {
+	DB *gorm.DB
+
+	// Practitioners validates note authors
+	Practitioners practitioners.Directory
+}
+
+// NewChartService creates a new ChartService.
+func NewChartService(db *gorm.DB) *ChartService {
+	return &ChartService{DB: db}
+}
+
+// IsValidNoteType reports whether t can be used for a new chart note.
+func IsValidNoteType(t string) bool {
+	switch t {
+	case NoteProgress, NoteNursing, NoteAdmission, NoteDischarge, NoteConsult, NoteProcedure:
+		return true
+	}
+	return false
+}
+
+// CreateNote adds an unsigned note to a patient's chart.
+func (s *ChartService) CreateNote(note models.ChartNote) (models.ChartNote, error) {
+	if note.NoteType == "" {
+		note.NoteType = NoteProgress
+	}
+	if !IsValidNoteType(note.NoteType) {
+		return models.ChartNote{}, fmt.Errorf("%w: unknown note type %q", ErrInvalidNote, note.NoteType)
+	}
+	if strings.TrimSpace(note.Content) == "" {
+		return models.ChartNote{}, fmt.Errorf("%w: content is required", ErrInvalidNote)
+	}
+	if err := s.checkReferences(note.PatientID, note.ExaminationID); err != nil {
+		return models.ChartNote{}, err
+	}
+	if err := s.resolveAuthor(&note); err != nil {
+		return models.ChartNote{}, err
+	}
+
+	note.ID = 0
+	note.AddendumToID = nil
+	note.SignedAt = nil
+	note.SignedBy = ""
+	result := s.DB.Create(&note)
+	return note, result.Error
+}
+
+// AddAddendum attaches an addendum to a signed note. Addenda always hang off the original note.
+func (s *ChartService) AddAddendum(noteID uint, addendum models.ChartNote) (models.ChartNote, error) {
+	original, err := s.GetNoteByID(noteID)
+	if err != nil {
+		return models.ChartNote{}, err
+	}
+	if original.AddendumToID != nil {
+		return models.ChartNote{}, fmt.Errorf("%w: addenda must reference the original note", ErrInvalidNote)
+	}
+	if original.SignedAt == nil {
+		return models.ChartNote{}, fmt.Errorf("%w: unsigned notes are edited directly", ErrInvalidNote)
+	}
+	if strings.TrimSpace(addendum.Content) == "" {
+		return models.ChartNote{}, fmt.Errorf("%w: content is required", ErrInvalidNote)
+	}
+	if err := s.resolveAuthor(&addendum); err != nil {
+		return models.ChartNote{}, err
+	}
+
+	addendum.ID = 0
+	addendum.PatientID = original.PatientID
+	addendum.ExaminationID = original.ExaminationID
+	addendum.NoteType = NoteAddendum
+	addendum.AddendumToID = &original.ID
+	addendum.SignedAt = nil
+	addendum.SignedBy = ""
+	result := s.DB.Create(&addendum)
+	return addendum, result.Error
+}
+
+// chartQuery is the allow-list for listing a patient's chart.
+var chartQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"examinationId": {Column: "examination_id", Kind: query.Int},
+		"noteType":      {Column: "note_type"},
+		"authorId":      {Column: "author_id", Kind: query.Int},
+		"signed":        {Apply: filterSigned},
+		"from":          {Column: "created_at", Kind: query.Time, Op: query.Gte},
+		"to":            {Column: "created_at", Kind: query.Time, Op: query.Lte},
+	},
+	Sorts:       map[string]string{"createdAt": "created_at"},
+	DefaultSort: "createdAt",
+}
+
+// GetChart retrieves one page of a patient's notes, in chronological order by default, each with its addenda.
+// Filters: examinationId, noteType, authorId, signed, and from and to (creation date, inclusive).
+func (s *ChartService) GetChart(patientID uint, params query.Params) (query.Page[models.ChartNote], error) {
+	db := s.DB.Preload("Addenda", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, id") }).
+		Where("addendum_to_id IS NULL AND patient_id = ?", patientID)
+	return query.Find[models.ChartNote](db, chartQuery, params)
+}
+
+// filterSigned matches signed or unsigned notes.
+func filterSigned(db *gorm.DB, value string) (*gorm.DB, error) {
+	signed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("must be true or false")
+	}
+	if signed {
+		return db.Where("signed_at IS NOT NULL"), nil
+	}
+	return db.Where("signed_at IS NULL"), nil
+}
+
+// GetNoteByID retrieves a note with its addenda.
+func (s *ChartService) GetNoteByID(id uint) (models.ChartNote, error) {
+	var note models.ChartNote
+	result := s.DB.Preload("Addenda", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, id") }).First(&note, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.ChartNote{}, errors.New("chart note not found")
+		}
+		return models.ChartNote{}, result.Error
+	}
+	return note, nil
+}
+
+// UpdateNote changes the content or type of an unsigned note. It fails with etag.ErrMismatch
+// unless the note is still at the given version.
+func (s *ChartService) UpdateNote(id, version uint, noteType, content string) (models.ChartNote, error) {
+	if noteType != "" && !IsValidNoteType(noteType) {
+		return models.ChartNote{}, fmt.Errorf("%w: unknown note type %q", ErrInvalidNote, noteType)
+	}
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if noteType != "" {
+		updates["note_type"] = noteType
+	}
+	if strings.TrimSpace(content) != "" {
+		updates["content"] = content
+	}
+
+	// The signed_at condition keeps a concurrent sign from being overwritten
+	result := etag.Expect(s.DB, version).Model(&models.ChartNote{}).Where("id = ? AND signed_at IS NULL", id).Updates(updates)
+	if errors.Is(result.Error, etag.ErrMismatch) {
+		if _, err := s.GetNoteByID(id); err != nil {
+			return models.ChartNote{}, err
+		}
+		return models.ChartNote{}, s.unchangedReason(id)
+	}
+	if result.Error != nil {
+		return models.ChartNote{}, result.Error
+	}
+	return s.GetNoteByID(id)
+}
+
+// SignNote signs and locks a note.
+func (s *ChartService) SignNote(id uint, signedBy string) (models.ChartNote, error) {
+	note, err := s.GetNoteByID(id)
+	if err != nil {
+		return models.ChartNote{}, err
+	}
+	if signedBy == "" {
+		signedBy = note.Author
+	}
+	if signedBy == "" {
+		return models.ChartNote{}, fmt.Errorf("%w: signedBy is required when the note has no author", ErrInvalidNote)
+	}
+
+	now := time.Now()
+	result := s.DB.Model(&models.ChartNote{}).Where("id = ? AND signed_at IS NULL", id).
+		Updates(map[string]interface{}{"signed_at": now, "signed_by": signedBy})
+	if result.Error != nil {
+		return models.ChartNote{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ChartNote{}, ErrNoteSigned
+	}
+	return s.GetNoteByID(id)
+}
+
+// DeleteNote soft-deletes an unsigned note. Signed notes are part of the record and are only deleted
+// along with their patient. It fails with etag.ErrMismatch unless the note is still at the given version.
+func (s *ChartService) DeleteNote(id, version uint) error {
+	result := etag.Expect(deletion.At(s.DB, deletion.Stamp()), version).Where("signed_at IS NULL").Delete(&models.ChartNote{}, id)
+	if errors.Is(result.Error, etag.ErrMismatch) {
+		if _, err := s.GetNoteByID(id); err != nil {
+			return errors.New("chart note not found or already deleted")
+		}
+		return s.unchangedReason(id)
+	}
+	return result.Error
+}
+
+// ReassignNotes moves chart notes, signed or not, from one patient to another, e.g. when
+// duplicate patient records are merged. With no IDs given, all of the patient's notes move.
+// It returns the IDs that were moved.
+func (s *ChartService) ReassignNotes(fromPatientID, toPatientID uint, noteIDs []uint) ([]uint, error) {
+	if fromPatientID == toPatientID {
+		return nil, errors.New("cannot reassign chart notes to the same patient")
+	}
+	moved := []uint{}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		db := tx.Model(&models.ChartNote{}).Where("patient_id = ?", fromPatientID)
+		if len(noteIDs) > 0 {
+			db = db.Where("id IN ?", noteIDs)
+		}
+		if err := db.Order("id").Pluck("id", &moved).Error; err != nil {
+			return err
+		}
+		if len(moved) == 0 {
+			return nil
+		}
+		return tx.Model(&models.ChartNote{}).Where("id IN ?", moved).Update("patient_id", toPatientID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// unchangedReason tells why a change limited to an unsigned note at an
+// expected version left an existing note alone.
+func (s *ChartService) unchangedReason(id uint) error {
+	note, err := s.GetNoteByID(id)
+	if err != nil {
+		return err
+	}
+	if note.SignedAt != nil {
+		return ErrNoteSigned
+	}
+	return etag.ErrMismatch
+}
+
+// checkReferences checks the patient exists and the examination, if any, is theirs.
+func (s *ChartService) checkReferences(patientID uint, examinationID *uint) error {
+	var count int64
+	if err := s.DB.Model(&models.Patient{}).Where("id = ?", patientID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("patient not found")
+	}
+	if examinationID == nil {
+		return nil
+	}
+
+	var examination models.Examination
+	if err := s.DB.First(&examination, *examinationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("examination not found")
+		}
+		return err
+	}
+	if examination.PatientID != patientID {
+		return fmt.Errorf("%w: examination belongs to a different patient", ErrInvalidNote)
+	}
+	return nil
+}
+
+// resolveAuthor validates the author reference and fills in the author's name.
+func (s *ChartService) resolveAuthor(note *models.ChartNote) error {
+	practitioner, err := practitioners.Resolve(s.Practitioners, note.AuthorID)
+	if err != nil {
+		return err
+	}
+	if practitioner != nil && note.Author == "" {
+		note.Author = practitioner.FullName()
+	}
+	if note.Author == "" {
+		return fmt.Errorf("%w: author or authorId is required", ErrInvalidNote)
+	}
+	return nil
+}
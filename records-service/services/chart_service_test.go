@@ -0,0 +1,123 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newChartService opens an empty database, with the etag callbacks, holding patients 1 and 2
+// and an examination of each.
+func newChartService(t *testing.T) *ChartService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Patient{}, &models.Examination{}, &models.ChartNote{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := etag.Register(db); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	examDate := time.Now()
+	for _, p := range []models.Patient{{ID: 1, MRN: "MRN-1"}, {ID: 2, MRN: "MRN-2"}} {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create patient: %v", err)
+		}
+		if err := db.Create(&models.Examination{ID: p.ID * 10, PatientID: p.ID, ExamDate: &examDate}).Error; err != nil {
+			t.Fatalf("create examination: %v", err)
+		}
+	}
+	return NewChartService(db)
+}
+
+func TestCreateNoteChecksReferences(t *testing.T) {
+	s := newChartService(t)
+	examination, otherExamination := uint(10), uint(20)
+	tests := []struct {
+		name    string
+		note    models.ChartNote
+		wantErr bool
+	}{
+		{"progress note", models.ChartNote{PatientID: 1, Author: "Dr. Grey", Content: "Stable"}, false},
+		{"on the patient's examination", models.ChartNote{PatientID: 1, ExaminationID: &examination, Author: "Dr. Grey", Content: "Stable"}, false},
+		{"on another patient's examination", models.ChartNote{PatientID: 1, ExaminationID: &otherExamination, Author: "Dr. Grey", Content: "Stable"}, true},
+		{"unknown patient", models.ChartNote{PatientID: 9, Author: "Dr. Grey", Content: "Stable"}, true},
+		{"no author", models.ChartNote{PatientID: 1, Content: "Stable"}, true},
+		{"no content", models.ChartNote{PatientID: 1, Author: "Dr. Grey", Content: "  "}, true},
+		{"addendum type", models.ChartNote{PatientID: 1, NoteType: NoteAddendum, Author: "Dr. Grey", Content: "Stable"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note, err := s.CreateNote(tt.note)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (note.NoteType != NoteProgress || note.SignedAt != nil) {
+				t.Errorf("got %+v, want an unsigned progress note", note)
+			}
+		})
+	}
+}
+
+func TestSignedNotesAreLocked(t *testing.T) {
+	s := newChartService(t)
+	note, err := s.CreateNote(models.ChartNote{PatientID: 1, Author: "Dr. Grey", Content: "Stable"})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+	if _, err := s.AddAddendum(note.ID, models.ChartNote{Author: "Dr. Grey", Content: "Later"}); !errors.Is(err, ErrInvalidNote) {
+		t.Errorf("addendum to an unsigned note: got %v, want ErrInvalidNote", err)
+	}
+	if _, err := s.UpdateNote(note.ID, 1, "", "Improving"); err != nil {
+		t.Fatalf("UpdateNote: %v", err)
+	}
+	if _, err := s.UpdateNote(note.ID, 1, "", "Worse"); !errors.Is(err, etag.ErrMismatch) {
+		t.Errorf("stale update: got %v, want etag.ErrMismatch", err)
+	}
+
+	signed, err := s.SignNote(note.ID, "")
+	if err != nil {
+		t.Fatalf("SignNote: %v", err)
+	}
+	if signed.SignedBy != "Dr. Grey" || signed.Content != "Improving" {
+		t.Errorf("got %+v, want the updated note signed by its author", signed)
+	}
+	if _, err := s.SignNote(note.ID, "Dr. Grey"); !errors.Is(err, ErrNoteSigned) {
+		t.Errorf("second sign: got %v, want ErrNoteSigned", err)
+	}
+	if _, err := s.UpdateNote(note.ID, signed.Version, "", "Worse"); !errors.Is(err, ErrNoteSigned) {
+		t.Errorf("update after signing: got %v, want ErrNoteSigned", err)
+	}
+	if err := s.DeleteNote(note.ID, signed.Version); !errors.Is(err, ErrNoteSigned) {
+		t.Errorf("delete after signing: got %v, want ErrNoteSigned", err)
+	}
+
+	addendum, err := s.AddAddendum(note.ID, models.ChartNote{Author: "Dr. Grey", Content: "Discharged"})
+	if err != nil {
+		t.Fatalf("AddAddendum: %v", err)
+	}
+	if addendum.PatientID != 1 || addendum.NoteType != NoteAddendum {
+		t.Errorf("got %+v, want an addendum on patient 1", addendum)
+	}
+	s.SignNote(addendum.ID, "")
+	if _, err := s.AddAddendum(addendum.ID, models.ChartNote{Author: "Dr. Grey", Content: "More"}); !errors.Is(err, ErrInvalidNote) {
+		t.Errorf("addendum to an addendum: got %v, want ErrInvalidNote", err)
+	}
+
+	chart, err := s.GetChart(1, query.Params{})
+	if err != nil {
+		t.Fatalf("GetChart: %v", err)
+	}
+	if len(chart.Items) != 1 || len(chart.Items[0].Addenda) != 1 {
+		t.Errorf("chart has %d notes, want the note with its addendum", len(chart.Items))
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+)
+
+// chartHoldScope is the dataset retention holds name to keep a patient's chart notes.
+const chartHoldScope = "chart"
+
+// CountDependents counts the live chart notes of the parent records, for a check before deleting them.
+func (s *ChartService) CountDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.CountLive(s.DB, &models.ChartNote{}, "patient_id", req.ParentIDs)
+}
+
+// DeleteDependents soft-deletes the chart notes, signed or not, of patients deleted at req.DeletedAt.
+func (s *ChartService) DeleteDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.SoftDelete(s.DB, &models.ChartNote{}, "patient_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreDependents brings back the chart notes deleted along with patients at req.DeletedAt.
+func (s *ChartService) RestoreDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.Restore(s.DB, &models.ChartNote{}, "patient_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreNote brings back a soft-deleted chart note.
+func (s *ChartService) RestoreNote(id uint) (models.ChartNote, error) {
+	var note models.ChartNote
+	result := s.DB.Unscoped().Limit(1).Find(&note, id)
+	if result.Error != nil {
+		return models.ChartNote{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ChartNote{}, errors.New("chart note not found")
+	}
+	if !note.DeletedAt.Valid {
+		return models.ChartNote{}, deletion.ErrNotDeleted
+	}
+	if err := s.DB.Unscoped().Model(&note).Update("deleted_at", nil).Error; err != nil {
+		return models.ChartNote{}, err
+	}
+	return s.GetNoteByID(id)
+}
+
+// PurgeDeleted permanently deletes the chart notes soft-deleted before the cutoff. The notes of
+// patients under a retention hold on their chart are kept until the hold is released or expires.
+func (s *ChartService) PurgeDeleted(cutoff time.Time) (int, error) {
+	return deletion.Purge(s.DB, cutoff, &models.ChartNote{}, "patient_id", deletion.HeldPatients(s.DB, chartHoldScope))
+}
+
+// checkParent accepts requests about patients, the only records chart notes are deleted with.
+func checkParent(req deletion.Request) error {
+	if req.Parent != deletion.Patients {
+		return fmt.Errorf("%w: %q", deletion.ErrUnknownParent, req.Parent)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+)
+
+// ExportPatientData retrieves every note in a patient's chart, addenda included and deleted or not, for a
+// patient data export.
+func (s *ChartService) ExportPatientData(req privacy.Request) ([]models.ChartNote, error) {
+	if req.PatientID == 0 {
+		return nil, errors.New("patientId is required")
+	}
+	notes := []models.ChartNote{}
+	result := s.DB.Unscoped().Where("patient_id = ?", req.PatientID).Order("id").Find(&notes)
+	return notes, result.Error
+}
+
+// ErasePatientData anonymises a patient's chart by removing the content of every note, signed
+// or not. Note types, authors and signatures are kept so the chart's timeline stays intact.
+func (s *ChartService) ErasePatientData(req privacy.Request) (int, error) {
+	if req.PatientID == 0 {
+		return 0, errors.New("patientId is required")
+	}
+	result := audit.Redacted(s.DB).Unscoped().Model(&models.ChartNote{}).Where("patient_id = ?", req.PatientID).
+		Update("content", privacy.ErasedText)
+	return int(result.RowsAffected), result.Error
+}
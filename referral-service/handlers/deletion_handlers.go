@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckDeletion handles POST /api/referrals/deletion/check
+// The examination service calls it before deleting examinations.
+func (h *ReferralHandler) CheckDeletion(c *gin.Context) {
+	h.handleDeletion(c, "check referrals", h.Service.CountDependents)
+}
+
+// DeleteDependents handles POST /api/referrals/deletion/delete
+// The examination service calls it when deleting examinations.
+func (h *ReferralHandler) DeleteDependents(c *gin.Context) {
+	h.handleDeletion(c, "delete referrals", h.Service.DeleteDependents)
+}
+
+// RestoreDependents handles POST /api/referrals/deletion/restore
+// The examination service calls it when restoring examinations.
+func (h *ReferralHandler) RestoreDependents(c *gin.Context) {
+	h.handleDeletion(c, "restore referrals", h.Service.RestoreDependents)
+}
+
+// RestoreReferral handles POST /api/referrals/:id/restore
+func (h *ReferralHandler) RestoreReferral(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	referral, err := h.Service.RestoreReferral(uint(id))
+	if err != nil {
+		switch {
+		case err.Error() == "referral not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, deletion.ErrNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore referral: " + err.Error()})
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(referral.Version))
+	c.JSON(http.StatusOK, referral)
+}
+
+// handleDeletion runs a deletion request from another service and replies
+// with the number of referrals it concerned.
+func (h *ReferralHandler) handleDeletion(c *gin.Context, action string, run func(deletion.Request) (int, error)) {
+	var req deletion.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	count, err := run(req)
+	if err != nil {
+		if errors.Is(err, deletion.ErrUnknownParent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + ": " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, deletion.Result{Count: count})
+}
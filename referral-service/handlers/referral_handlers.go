@@ -1,17 +1,30 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/fitnis/referral-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/documents"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
 
 	"github.com/gin-gonic/gin"
 )
 
 // ReferralHandler holds the referral service.
 type ReferralHandler struct {
-	Service *services.ReferralService
+	Service   *services.ReferralService
+	Documents *documents.Generator // Optional: required only for printable documents
+	// Consent enforces the consents of the examination's patient on reads; nil allows every read
+	Consent *consent.Enforcer
 }
 
 // NewReferralHandler creates a new ReferralHandler.
@@ -22,23 +35,45 @@ func NewReferralHandler(s *services.ReferralService) *ReferralHandler {
 // Request structs remain the same
 type ReferralRequest struct {
 	ExaminationID uint   `json:"examinationId" binding:"required"`
-	Specialist    string `json:"specialist" binding:"required"`
+	Specialist    string `json:"specialist"` // required unless specialistId is given
 	Reason        string `json:"reason" binding:"required"`
+	ReferredBy    string `json:"referredBy"`
+	Priority      string `json:"priority"` // routine (default), urgent or emergency
+	SpecialistID  *uint  `json:"specialistId"`
+	ReferrerID    *uint  `json:"referrerId"`
 }
 
 type UpdateReferralRequest struct {
-	Specialist string `json:"specialist"`
-	Reason     string `json:"reason"`
+	Specialist   string `json:"specialist"`
+	Reason       string `json:"reason"`
+	Priority     string `json:"priority"`
+	SpecialistID *uint  `json:"specialistId"`
 }
 
-// GetReferrals handles GET /api/referrals
+// ReferralActionRequest carries the note for accept/decline/schedule/complete actions
+type ReferralActionRequest struct {
+	Note         string    `json:"note"`
+	ScheduledFor time.Time `json:"scheduledFor"` // used by schedule only
+}
+
+// GetReferrals handles GET /api/referrals?examinationId=&specialist=&specialistId=&status=&priority=&from=&to=&overdue=&sort=&limit=&offset=&cursor=
 func (h *ReferralHandler) GetReferrals(c *gin.Context) {
-	referrals, err := h.Service.GetReferrals()
+	params, err := query.FromValues(c.Request.URL.Query())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve referrals: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, referrals)
+
+	page, err := h.Service.GetReferrals(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve referrals: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 // GetReferral handles GET /api/referrals/:id
@@ -59,6 +94,11 @@ func (h *ReferralHandler) GetReferral(c *gin.Context) {
 		return
 	}
 
+	if !h.checkConsent(c, referral.ExaminationID) {
+		return
+	}
+
+	c.Header(etag.HeaderETag, etag.Format(referral.Version))
 	c.JSON(http.StatusOK, referral)
 }
 
@@ -69,6 +109,9 @@ func (h *ReferralHandler) GetReferralsByExaminationID(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid examination ID format"})
 		return
 	}
+	if !h.checkConsent(c, uint(examinationID)) {
+		return
+	}
 
 	referrals, err := h.Service.GetReferralsByExaminationID(uint(examinationID))
 	if err != nil {
@@ -86,23 +129,46 @@ func (h *ReferralHandler) CreateReferral(c *gin.Context) {
 		return
 	}
 
-	// Optional: Check if ExaminationID exists
+	if req.Specialist == "" && req.SpecialistID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required field: specialist or specialistId"})
+		return
+	}
+	if req.Priority != "" && !services.IsValidPriority(req.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority: must be routine, urgent or emergency"})
+		return
+	}
 
-	referral, err := h.Service.CreateReferral(req.ExaminationID, req.Specialist, req.Reason)
+	referral, err := h.Service.CreateReferral(req.ExaminationID, req.Specialist, req.Reason, req.ReferredBy, req.Priority, req.SpecialistID, req.ReferrerID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create referral: " + err.Error()})
+		if errors.Is(err, references.ErrNotFound) || errors.Is(err, references.ErrInactive) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid examination reference: " + err.Error()})
+		} else if errors.Is(err, references.ErrUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify examination: " + err.Error()})
+		} else if errors.Is(err, practitioners.ErrNotFound) || errors.Is(err, practitioners.ErrInactive) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid practitioner reference: " + err.Error()})
+		} else if errors.Is(err, practitioners.ErrUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify practitioner: " + err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create referral: " + err.Error()})
+		}
 		return
 	}
+	c.Header(etag.HeaderETag, etag.Format(referral.Version))
 	c.JSON(http.StatusCreated, referral)
 }
 
 // UpdateReferral handles PUT /api/referrals/:id
+// The If-Match header must hold the referral's current ETag.
 func (h *ReferralHandler) UpdateReferral(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
 	var req UpdateReferralRequest
 	if err := c.BindJSON(&req); err != nil { // Use BindJSON for optional fields
@@ -110,31 +176,206 @@ func (h *ReferralHandler) UpdateReferral(c *gin.Context) {
 		return
 	}
 
-	updatedReferral, err := h.Service.UpdateReferral(uint(id), req.Specialist, req.Reason)
+	if req.Priority != "" && !services.IsValidPriority(req.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority: must be routine, urgent or emergency"})
+		return
+	}
+
+	updatedReferral, err := h.Service.UpdateReferral(uint(id), version, req.Specialist, req.Reason, req.Priority, req.SpecialistID)
 	if err != nil {
 		if err.Error() == "referral not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		} else if errors.Is(err, services.ErrLinkedSpecialist) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.Is(err, practitioners.ErrNotFound) || errors.Is(err, practitioners.ErrInactive) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid practitioner reference: " + err.Error()})
+		} else if errors.Is(err, practitioners.ErrUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify practitioner: " + err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update referral: " + err.Error()})
 		}
 		return
 	}
 
+	c.Header(etag.HeaderETag, etag.Format(updatedReferral.Version))
 	c.JSON(http.StatusOK, updatedReferral)
 }
 
+// AcceptReferral handles POST /api/referrals/:id/accept
+func (h *ReferralHandler) AcceptReferral(c *gin.Context) {
+	h.handleAction(c, func(id uint, req ReferralActionRequest) (models.Referral, error) {
+		return h.Service.AcceptReferral(id, req.Note)
+	})
+}
+
+// DeclineReferral handles POST /api/referrals/:id/decline
+func (h *ReferralHandler) DeclineReferral(c *gin.Context) {
+	h.handleAction(c, func(id uint, req ReferralActionRequest) (models.Referral, error) {
+		return h.Service.DeclineReferral(id, req.Note)
+	})
+}
+
+// ScheduleReferral handles POST /api/referrals/:id/schedule
+func (h *ReferralHandler) ScheduleReferral(c *gin.Context) {
+	h.handleAction(c, func(id uint, req ReferralActionRequest) (models.Referral, error) {
+		return h.Service.ScheduleReferral(id, req.ScheduledFor, req.Note)
+	})
+}
+
+// CompleteReferral handles POST /api/referrals/:id/complete
+func (h *ReferralHandler) CompleteReferral(c *gin.Context) {
+	h.handleAction(c, func(id uint, req ReferralActionRequest) (models.Referral, error) {
+		return h.Service.CompleteReferral(id, req.Note)
+	})
+}
+
+// GetReferralHistory handles GET /api/referrals/:id/history
+func (h *ReferralHandler) GetReferralHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	referral, err := h.Service.GetReferralByID(uint(id))
+	if err == nil && !h.checkConsent(c, referral.ExaminationID) {
+		return
+	}
+	changes, err := h.Service.GetStatusHistory(uint(id))
+	if err != nil {
+		if err.Error() == "referral not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve referral history: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+// handleAction parses the ID and optional note body shared by the workflow actions.
+func (h *ReferralHandler) handleAction(c *gin.Context, action func(uint, ReferralActionRequest) (models.Referral, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req ReferralActionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	referral, err := action(uint(id), req)
+	if err != nil {
+		if err.Error() == "referral not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, services.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if err.Error() == "a note is required to decline a referral" || err.Error() == "scheduledFor is required to schedule a referral" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update referral status: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, referral)
+}
+
+// GetReferralDocument handles GET /api/referrals/:id/document
+func (h *ReferralHandler) GetReferralDocument(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	referral, err := h.Service.GetReferralWithDetails(uint(id))
+	if err != nil {
+		if err.Error() == "referral not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve referral: " + err.Error()})
+		}
+		return
+	}
+
+	pdf, code, err := h.Documents.Generate(documents.KindReferral, referral.ID, referral, signedReferral(referral), consent.IdentityFromHeaders(c.Request.Header))
+	if err != nil {
+		var denied *consent.DeniedError
+		if errors.As(err, &denied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": denied.Reason})
+		} else if errors.Is(err, documents.ErrUnsupportedText) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate document: " + err.Error()})
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="referral-%d.pdf"`, referral.ID))
+	c.Header("X-Verification-Code", code)
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// VerifyReferralDocument handles GET /api/referrals/:id/document/verify/:code
+func (h *ReferralHandler) VerifyReferralDocument(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	referral, err := h.Service.GetReferralWithDetails(uint(id))
+	if err != nil {
+		if err.Error() == "referral not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve referral: " + err.Error()})
+		}
+		return
+	}
+
+	valid := h.Documents.Verify(documents.KindReferral, referral.ID, signedReferral(referral), c.Param("code"))
+	c.JSON(http.StatusOK, gin.H{"valid": valid})
+}
+
+// signedReferral returns what a referral document's verification code covers.
+func signedReferral(r models.Referral) documents.Signed {
+	return documents.Signed{
+		PatientID: r.Examination.PatientID,
+		Subject:   r.Specialist,
+		Details:   r.Reason,
+		Issuer:    r.ReferredBy,
+		IssuedAt:  r.CreatedAt,
+	}
+}
+
 // DeleteReferral handles DELETE /api/referrals/:id
+// The If-Match header must hold the referral's current ETag.
 func (h *ReferralHandler) DeleteReferral(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
-	err = h.Service.DeleteReferral(uint(id))
+	err = h.Service.DeleteReferral(uint(id), version)
 	if err != nil {
 		if err.Error() == "referral not found or already deleted" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Referral not found"})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete referral: " + err.Error()})
 		}
@@ -143,3 +384,38 @@ func (h *ReferralHandler) DeleteReferral(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
+
+// checkConsent checks the caller identified by the request headers against the consents of
+// the patient the examination belongs to. When the read is refused it writes the response
+// and returns false.
+func (h *ReferralHandler) checkConsent(c *gin.Context, examinationID uint) bool {
+	err := h.Consent.CheckExamination(h.Service.References, examinationID, consent.IdentityFromHeaders(c.Request.Header))
+	if err == nil {
+		return true
+	}
+	var denied *consent.DeniedError
+	switch {
+	case errors.As(err, &denied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": denied.Reason})
+	case errors.Is(err, references.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check consent: " + err.Error()})
+	}
+	return false
+}
@@ -6,13 +6,22 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fitnis/referral-service/handlers"
 	"github.com/fitnis/referral-service/services"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/consent"
 	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/documents"
 	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/privacy"
+	"github.com/fitnis/shared/references"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,15 +30,40 @@ func main() {
 	database.InitDB()
 	db := database.DB
 
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "referrals")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
 	// Initialize services and handlers
 	referralService := services.NewReferralService(db)
+	referralService.UrgentSLA = getDurationEnv("REFERRAL_URGENT_SLA", referralService.UrgentSLA)
+	referralService.EmergencySLA = getDurationEnv("REFERRAL_EMERGENCY_SLA", referralService.EmergencySLA)
+	referralService.Practitioners = practitioners.NewKafkaDirectory()
+	referralService.References = references.NewKafkaCheckerFromEnv()
+	if n, err := referralService.BackfillStatuses(); err != nil {
+		log.Fatalf("Failed to backfill referral statuses: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d referrals without a status as sent", n)
+	}
 	referralHandler := handlers.NewReferralHandler(referralService)
+	referralHandler.Documents, err = documents.NewGeneratorFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure documents: %v", err)
+	}
+	referralHandler.Consent = consent.NewEnforcer(db)
+	referralHandler.Documents.Consent = referralHandler.Consent
+
+	// Purge referrals soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, referralService.PurgeDeleted)
 
 	// Start Kafka consumer
 	log.Println("Starting Kafka consumer")
-	kafka.StartKafkaConsumer("referrals", func(req kafka.KafkaRequest) kafka.KafkaResponse {
+	kafka.StartKafkaConsumer("referrals", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
 		return handleKafkaRequest(req, referralHandler)
-	})
+	}))
 
 	// Block main goroutine
 	select {}
@@ -41,11 +75,41 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.ReferralHandle
 	c, w := createMockGinContext(req)
 
 	// Route the request based on path and method
-	path := req.Path
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
 	if path == "" {
 		path = "/"
 	}
 
+	// Patient data export and erasure have no referral ID in the path
+	if path == privacy.ExportPath || path == privacy.ErasePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		if path == privacy.ExportPath {
+			handler.ExportPatientData(c)
+		} else {
+			handler.ErasePatientData(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Deletion requests from the examination service have no referral ID in the path
+	if path == deletion.CheckPath || path == deletion.DeletePath || path == deletion.RestorePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		switch path {
+		case deletion.CheckPath:
+			handler.CheckDeletion(c)
+		case deletion.DeletePath:
+			handler.DeleteDependents(c)
+		default:
+			handler.RestoreDependents(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
 	// Extract ID from path if present
 	var id uint64
 	var err error
@@ -67,15 +131,44 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.ReferralHandle
 		}
 	}
 
+	// Check for document and workflow action paths
+	isDocumentPath := strings.HasSuffix(path, "/document")
+	verifyCode := extractVerificationCodeFromPath(path)
+	action := extractActionFromPath(path)
+
 	// Route to appropriate handler
 	switch {
 	case req.Method == "GET" && path == "/":
 		handler.GetReferrals(c)
+	case req.Method == "GET" && id > 0 && isDocumentPath:
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.GetReferralDocument(c)
+	case req.Method == "GET" && id > 0 && verifyCode != "":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr}, gin.Param{Key: "code", Value: verifyCode})
+		handler.VerifyReferralDocument(c)
+	case req.Method == "GET" && id > 0 && action == "history":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.GetReferralHistory(c)
 	case req.Method == "GET" && id > 0:
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
 		handler.GetReferral(c)
+	case req.Method == "POST" && id > 0 && strings.HasSuffix(path, "/restore"):
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.RestoreReferral(c)
 	case req.Method == "POST" && path == "/":
 		handler.CreateReferral(c)
+	case req.Method == "POST" && id > 0 && action == "accept":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.AcceptReferral(c)
+	case req.Method == "POST" && id > 0 && action == "decline":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.DeclineReferral(c)
+	case req.Method == "POST" && id > 0 && action == "schedule":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.ScheduleReferral(c)
+	case req.Method == "POST" && id > 0 && action == "complete":
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.CompleteReferral(c)
 	case req.Method == "PUT" && id > 0:
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
 		handler.UpdateReferral(c)
@@ -90,14 +183,7 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.ReferralHandle
 	}
 
 	// Create response from the written data
-	return kafka.KafkaResponse{
-		RequestID:  req.RequestID,
-		StatusCode: w.Code,
-		Headers: map[string]string{
-			"Content-Type": w.Header().Get("Content-Type"),
-		},
-		Body: w.Body.Bytes(),
-	}
+	return createResponse(req.RequestID, w)
 }
 
 // Helper functions
@@ -124,6 +210,25 @@ func extractIDFromPath(path string) string {
 	return ""
 }
 
+// extractActionFromPath returns the workflow action in paths like /123/accept
+func extractActionFromPath(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) == 3 {
+		return parts[2]
+	}
+	return ""
+}
+
+func extractVerificationCodeFromPath(path string) string {
+	if strings.Contains(path, "/document/verify/") {
+		parts := strings.Split(path, "/document/verify/")
+		if len(parts) >= 2 {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
 func extractExaminationIDFromPath(path string) string {
 	if strings.Contains(path, "/examination/") {
 		parts := strings.Split(path, "/examination/")
@@ -134,6 +239,30 @@ func extractExaminationIDFromPath(path string) string {
 	return ""
 }
 
+// getDurationEnv reads a duration such as "48h" from the environment, falling back to def
+func getDurationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s: %v", key, value, def, err)
+		return def
+	}
+	return d
+}
+
+// createResponse copies the recorded handler output, including its headers, into a Kafka response
+func createResponse(requestID string, w *httptest.ResponseRecorder) kafka.KafkaResponse {
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
 func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
 	errorJSON, _ := json.Marshal(gin.H{"error": message})
 	return kafka.KafkaResponse{
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+)
+
+// CountDependents counts the live referrals of the parent records, for a check before deleting them.
+func (s *ReferralService) CountDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.CountLive(s.DB, &models.Referral{}, "examination_id", req.ParentIDs)
+}
+
+// DeleteDependents soft-deletes the referrals of examinations deleted at req.DeletedAt.
+func (s *ReferralService) DeleteDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.SoftDelete(s.DB, &models.Referral{}, "examination_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreDependents brings back the referrals deleted along with examinations at req.DeletedAt.
+func (s *ReferralService) RestoreDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.Restore(s.DB, &models.Referral{}, "examination_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreReferral brings back a soft-deleted referral.
+func (s *ReferralService) RestoreReferral(id uint) (models.Referral, error) {
+	var referral models.Referral
+	result := s.DB.Unscoped().Limit(1).Find(&referral, id)
+	if result.Error != nil {
+		return models.Referral{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Referral{}, errors.New("referral not found")
+	}
+	if !referral.DeletedAt.Valid {
+		return models.Referral{}, deletion.ErrNotDeleted
+	}
+	if err := s.DB.Unscoped().Model(&referral).Update("deleted_at", nil).Error; err != nil {
+		return models.Referral{}, err
+	}
+	return s.GetReferralByID(id)
+}
+
+// PurgeDeleted permanently deletes the referrals soft-deleted before the cutoff, with their status
+// history. The referrals of patients under a retention hold on referrals are kept until the hold
+// is released or expires.
+func (s *ReferralService) PurgeDeleted(cutoff time.Time) (int, error) {
+	var purged int
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		held := deletion.HeldExaminations(tx, deletion.Referrals)
+		expired := tx.Unscoped().Model(&models.Referral{}).Select("id").
+			Where("deleted_at < ? AND examination_id NOT IN (?)", cutoff, held)
+		if err := tx.Where("referral_id IN (?)", expired).Delete(&models.ReferralStatusChange{}).Error; err != nil {
+			return err
+		}
+		var err error
+		purged, err = deletion.Purge(tx, cutoff, &models.Referral{}, "examination_id", held)
+		return err
+	})
+	return purged, err
+}
+
+// checkParent accepts requests about examinations, the only records referrals reference.
+func checkParent(req deletion.Request) error {
+	if req.Parent != deletion.Examinations {
+		return fmt.Errorf("%w: %q", deletion.ErrUnknownParent, req.Parent)
+	}
+	return nil
+}
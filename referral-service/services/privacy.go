@@ -0,0 +1,41 @@
+package services
+
+import (
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+	"gorm.io/gorm"
+)
+
+// ExportPatientData retrieves every referral of the patient's examinations with its status history,
+// for a patient data export.
+func (s *ReferralService) ExportPatientData(req privacy.Request) ([]models.Referral, error) {
+	if len(req.ExaminationIDs) == 0 {
+		return []models.Referral{}, nil
+	}
+	referrals := []models.Referral{}
+	result := s.DB.Unscoped().Preload("History", func(db *gorm.DB) *gorm.DB { return db.Order("changed_at, id") }).
+		Where("examination_id IN ?", req.ExaminationIDs).Order("id").Find(&referrals)
+	return referrals, result.Error
+}
+
+// ErasePatientData anonymises the referrals of the patient's examinations by removing their reasons
+// and status notes, including those in their history.
+// Structured data is kept so statistics and references stay intact.
+func (s *ReferralService) ErasePatientData(req privacy.Request) (int, error) {
+	if len(req.ExaminationIDs) == 0 {
+		return 0, nil
+	}
+	var erased int
+	err := audit.Redacted(s.DB).Transaction(func(tx *gorm.DB) error {
+		referrals := tx.Unscoped().Model(&models.Referral{}).Select("id").Where("examination_id IN ?", req.ExaminationIDs)
+		if err := tx.Model(&models.ReferralStatusChange{}).Where("referral_id IN (?)", referrals).Update("note", "").Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Model(&models.Referral{}).Where("examination_id IN ?", req.ExaminationIDs).
+			Updates(map[string]interface{}{"reason": privacy.ErasedText, "status_note": ""})
+		erased = int(result.RowsAffected)
+		return result.Error
+	})
+	return erased, err
+}
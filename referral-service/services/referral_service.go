@@ -2,37 +2,206 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/fitnis/shared/etag"
 	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/practitioners"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
 	"gorm.io/gorm"
 )
 
+// Referral statuses.
+const (
+	StatusSent      = "sent"
+	StatusAccepted  = "accepted"
+	StatusDeclined  = "declined"
+	StatusScheduled = "scheduled"
+	StatusCompleted = "completed"
+)
+
+// Referral priorities.
+const (
+	PriorityRoutine   = "routine"
+	PriorityUrgent    = "urgent"
+	PriorityEmergency = "emergency"
+)
+
+// allowedTransitions lists the statuses each status may move to.
+var allowedTransitions = map[string][]string{
+	StatusSent:      {StatusAccepted, StatusDeclined},
+	StatusAccepted:  {StatusScheduled, StatusCompleted, StatusDeclined},
+	StatusScheduled: {StatusScheduled, StatusCompleted},
+}
+
+// ErrInvalidTransition is returned when an action does not apply to the referral's current status.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// ErrLinkedSpecialist is returned when renaming a specialist who is linked to a practitioner.
+var ErrLinkedSpecialist = errors.New("specialist is linked to a practitioner; change specialistId instead")
+
 // ReferralService handles database operations for referrals.
 type ReferralService struct {
 	DB *gorm.DB
+
+	// Time within which urgent and emergency referrals must be accepted
+	UrgentSLA    time.Duration
+	EmergencySLA time.Duration
+
+	// Practitioners validates specialist and referrer references on creation
+	Practitioners practitioners.Directory
+
+	// References checks that new referrals reference an existing examination
+	References references.Checker
 }
 
 // NewReferralService creates a new ReferralService.
 func NewReferralService(db *gorm.DB) *ReferralService {
-	return &ReferralService{DB: db}
+	return &ReferralService{DB: db, UrgentSLA: 48 * time.Hour, EmergencySLA: 4 * time.Hour}
+}
+
+// IsValidPriority reports whether p is a known referral priority.
+func IsValidPriority(p string) bool {
+	return p == PriorityRoutine || p == PriorityUrgent || p == PriorityEmergency
 }
 
 // CreateReferral adds a new referral to the database.
-func (s *ReferralService) CreateReferral(examinationID uint, specialist, reason string) (models.Referral, error) {
+// examinationID must reference an existing examination, and specialistID and referrerID,
+// when given, active practitioners.
+func (s *ReferralService) CreateReferral(examinationID uint, specialist, reason, referredBy, priority string, specialistID, referrerID *uint) (models.Referral, error) {
+	if priority == "" {
+		priority = PriorityRoutine
+	}
+	if !IsValidPriority(priority) {
+		return models.Referral{}, fmt.Errorf("invalid priority: %s", priority)
+	}
+	if err := references.Require(s.References, references.Examinations, examinationID); err != nil {
+		return models.Referral{}, fmt.Errorf("examination: %w", err)
+	}
+
+	specialistRecord, err := practitioners.Resolve(s.Practitioners, specialistID)
+	if err != nil {
+		return models.Referral{}, fmt.Errorf("specialist: %w", err)
+	}
+	if specialistRecord != nil && specialist == "" {
+		specialist = specialistRecord.FullName()
+	}
+	referrerRecord, err := practitioners.Resolve(s.Practitioners, referrerID)
+	if err != nil {
+		return models.Referral{}, fmt.Errorf("referrer: %w", err)
+	}
+	if referrerRecord != nil && referredBy == "" {
+		referredBy = referrerRecord.FullName()
+	}
+
 	referral := models.Referral{
 		ExaminationID: examinationID,
 		Specialist:    specialist,
 		Reason:        reason,
+		ReferredBy:    referredBy,
+		SpecialistID:  specialistID,
+		ReferrerID:    referrerID,
+		Status:        StatusSent,
+		Priority:      priority,
 	}
-	result := s.DB.Create(&referral)
-	return referral, result.Error
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&referral).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ReferralStatusChange{
+			ReferralID: referral.ID,
+			ToStatus:   StatusSent,
+			ChangedAt:  referral.CreatedAt,
+		}).Error
+	})
+	if err != nil {
+		return models.Referral{}, err
+	}
+	s.markSLA(&referral)
+	return referral, nil
+}
+
+// BackfillStatuses marks referrals written before statuses were recorded as sent, the status
+// they were created in, and gives them the history entry for it.
+func (s *ReferralService) BackfillStatuses() (int, error) {
+	var ids []uint
+	if err := s.DB.Model(&models.Referral{}).Where("status IS NULL OR status = ''").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Referral{}).Where("id IN ?", ids).Update("status", StatusSent).Error; err != nil {
+			return err
+		}
+		var referrals []models.Referral
+		if err := tx.Select("id", "created_at").Where("id IN ?", ids).Find(&referrals).Error; err != nil {
+			return err
+		}
+		changes := make([]models.ReferralStatusChange, len(referrals))
+		for i, referral := range referrals {
+			changes[i] = models.ReferralStatusChange{ReferralID: referral.ID, ToStatus: StatusSent, ChangedAt: referral.CreatedAt}
+		}
+		return tx.Create(&changes).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
 }
 
-// GetReferrals retrieves all referrals from the database.
-func (s *ReferralService) GetReferrals() ([]models.Referral, error) {
-	var referrals []models.Referral
-	result := s.DB.Find(&referrals)
-	return referrals, result.Error
+// referralPriorityOrder sorts emergency referrals first, then urgent, then routine.
+const referralPriorityOrder = "CASE priority WHEN 'emergency' THEN 0 WHEN 'urgent' THEN 1 ELSE 2 END"
+
+// referralQuery is the allow-list for listing referrals. It is built per call because
+// the overdue filter depends on the service's SLAs.
+func (s *ReferralService) referralQuery() query.Spec {
+	return query.Spec{
+		Filters: map[string]query.Filter{
+			"examinationId": {Column: "examination_id", Kind: query.Int},
+			"specialist":    {Column: "specialist"},
+			"specialistId":  {Column: "specialist_id", Kind: query.Int},
+			"status":        {Column: "status"},
+			"priority":      {Column: "priority"},
+			"from":          {Column: "created_at", Kind: query.Time, Op: query.Gte},
+			"to":            {Column: "created_at", Kind: query.Time, Op: query.Lte},
+			"overdue":       {Apply: s.filterOverdue},
+		},
+		Sorts: map[string]string{
+			"priority":  referralPriorityOrder,
+			"createdAt": "created_at",
+		},
+		DefaultSort: "priority",
+	}
+}
+
+// GetReferrals retrieves one page of referrals, most pressing first by default.
+// Filters: examinationId, specialist, specialistId, status, priority, from and to
+// (creation date, inclusive) and overdue (breached the acceptance SLA).
+func (s *ReferralService) GetReferrals(params query.Params) (query.Page[models.Referral], error) {
+	page, err := query.Find[models.Referral](s.DB, s.referralQuery(), params)
+	for i := range page.Items {
+		s.markSLA(&page.Items[i])
+	}
+	return page, err
+}
+
+// filterOverdue matches sent referrals that have breached their acceptance SLA.
+func (s *ReferralService) filterOverdue(db *gorm.DB, value string) (*gorm.DB, error) {
+	overdue, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("must be true or false")
+	}
+	if !overdue {
+		return db, nil
+	}
+	now := time.Now()
+	return db.Where("status = ? AND ((priority = ? AND created_at < ?) OR (priority = ? AND created_at < ?))",
+		StatusSent, PriorityUrgent, now.Add(-s.UrgentSLA), PriorityEmergency, now.Add(-s.EmergencySLA)), nil
 }
 
 // GetReferralByID retrieves a referral by its ID.
@@ -45,6 +214,20 @@ func (s *ReferralService) GetReferralByID(id uint) (models.Referral, error) {
 		}
 		return models.Referral{}, result.Error
 	}
+	s.markSLA(&referral)
+	return referral, nil
+}
+
+// GetReferralWithDetails retrieves a referral together with its examination and patient.
+func (s *ReferralService) GetReferralWithDetails(id uint) (models.Referral, error) {
+	var referral models.Referral
+	result := s.DB.Preload("Examination.Patient").First(&referral, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return models.Referral{}, errors.New("referral not found")
+		}
+		return models.Referral{}, result.Error
+	}
 	return referral, nil
 }
 
@@ -52,35 +235,171 @@ func (s *ReferralService) GetReferralByID(id uint) (models.Referral, error) {
 func (s *ReferralService) GetReferralsByExaminationID(examinationID uint) ([]models.Referral, error) {
 	var examReferrals []models.Referral
 	result := s.DB.Where("examination_id = ?", examinationID).Find(&examReferrals)
+	for i := range examReferrals {
+		s.markSLA(&examReferrals[i])
+	}
 	return examReferrals, result.Error
 }
 
 // UpdateReferral updates an existing referral's details.
-func (s *ReferralService) UpdateReferral(id uint, specialist, reason string) (models.Referral, error) {
+// A specialistID, when given, must reference an active practitioner, whose name is used unless a
+// specialist name is given too. A specialist linked to a practitioner cannot be renamed alone.
+// It fails with etag.ErrMismatch unless the referral is still at the given version.
+func (s *ReferralService) UpdateReferral(id, version uint, specialist, reason, priority string, specialistID *uint) (models.Referral, error) {
 	referral, err := s.GetReferralByID(id)
 	if err != nil {
 		return models.Referral{}, err
 	}
 
 	// Update fields if provided
-	if specialist != "" {
+	if specialistID != nil {
+		specialistRecord, err := practitioners.Resolve(s.Practitioners, specialistID)
+		if err != nil {
+			return models.Referral{}, fmt.Errorf("specialist: %w", err)
+		}
+		if specialist == "" {
+			specialist = specialistRecord.FullName()
+		}
+		referral.SpecialistID = specialistID
 		referral.Specialist = specialist
+	} else if specialist != "" {
+		if referral.SpecialistID != nil && specialist != referral.Specialist {
+			return models.Referral{}, ErrLinkedSpecialist
+		}
+		referral.Specialist = specialist
+	}
+	if priority != "" {
+		if !IsValidPriority(priority) {
+			return models.Referral{}, fmt.Errorf("invalid priority: %s", priority)
+		}
+		referral.Priority = priority
 	}
 	// Allow clearing reason
 	referral.Reason = reason
 
-	result := s.DB.Save(&referral)
+	result := etag.Expect(s.DB, version).Save(&referral)
 	return referral, result.Error
 }
 
-// DeleteReferral removes a referral from the database.
-func (s *ReferralService) DeleteReferral(id uint) error {
-	result := s.DB.Delete(&models.Referral{}, id)
-	if result.Error != nil {
-		return result.Error
+// AcceptReferral records the specialist's acceptance of a referral.
+func (s *ReferralService) AcceptReferral(id uint, note string) (models.Referral, error) {
+	return s.transition(id, StatusAccepted, note, func(r *models.Referral, now time.Time) {
+		r.AcceptedAt = &now
+	})
+}
+
+// DeclineReferral records the specialist declining a referral. A note explaining why is required.
+func (s *ReferralService) DeclineReferral(id uint, note string) (models.Referral, error) {
+	if note == "" {
+		return models.Referral{}, errors.New("a note is required to decline a referral")
+	}
+	return s.transition(id, StatusDeclined, note, nil)
+}
+
+// ScheduleReferral books an accepted referral for a date; a scheduled referral can be rescheduled.
+func (s *ReferralService) ScheduleReferral(id uint, scheduledFor time.Time, note string) (models.Referral, error) {
+	if scheduledFor.IsZero() {
+		return models.Referral{}, errors.New("scheduledFor is required to schedule a referral")
 	}
-	if result.RowsAffected == 0 {
-		return errors.New("referral not found or already deleted")
+	return s.transition(id, StatusScheduled, note, func(r *models.Referral, now time.Time) {
+		r.ScheduledFor = &scheduledFor
+	})
+}
+
+// CompleteReferral closes a referral once the specialist has seen the patient.
+func (s *ReferralService) CompleteReferral(id uint, note string) (models.Referral, error) {
+	return s.transition(id, StatusCompleted, note, func(r *models.Referral, now time.Time) {
+		r.CompletedAt = &now
+	})
+}
+
+// GetStatusHistory retrieves a referral's status changes, oldest first.
+func (s *ReferralService) GetStatusHistory(id uint) ([]models.ReferralStatusChange, error) {
+	if _, err := s.GetReferralByID(id); err != nil {
+		return nil, err
+	}
+	changes := []models.ReferralStatusChange{}
+	result := s.DB.Where("referral_id = ?", id).Order("changed_at, id").Find(&changes)
+	return changes, result.Error
+}
+
+// transition moves a referral to a new status if the workflow allows it, and
+// records the change in the referral's history.
+func (s *ReferralService) transition(id uint, to, note string, apply func(*models.Referral, time.Time)) (models.Referral, error) {
+	referral, err := s.GetReferralByID(id)
+	if err != nil {
+		return models.Referral{}, err
+	}
+
+	from := referral.Status
+	allowed := false
+	for _, next := range allowedTransitions[from] {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return models.Referral{}, fmt.Errorf("%w: cannot move referral from %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	now := time.Now()
+	referral.Status = to
+	referral.StatusNote = note
+	if apply != nil {
+		apply(&referral, now)
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Conditional on the status read so concurrent actions cannot both move the referral
+		result := tx.Model(&referral).Where("status = ?", from).Select("*").Updates(&referral)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: referral is no longer %s", ErrInvalidTransition, from)
+		}
+		return tx.Create(&models.ReferralStatusChange{
+			ReferralID: referral.ID,
+			FromStatus: from,
+			ToStatus:   to,
+			Note:       note,
+			ChangedAt:  now,
+		}).Error
+	})
+	if err != nil {
+		return models.Referral{}, err
+	}
+	s.markSLA(&referral)
+	return referral, nil
+}
+
+// markSLA flags urgent and emergency referrals not accepted within their SLA.
+func (s *ReferralService) markSLA(referral *models.Referral) {
+	if referral.Status != StatusSent {
+		referral.SLABreached = false
+		return
+	}
+	var sla time.Duration
+	switch referral.Priority {
+	case PriorityUrgent:
+		sla = s.UrgentSLA
+	case PriorityEmergency:
+		sla = s.EmergencySLA
+	default:
+		return
+	}
+	referral.SLABreached = !referral.CreatedAt.IsZero() && time.Since(referral.CreatedAt) > sla
+}
+
+// DeleteReferral soft-deletes a referral; it can be restored until it is purged. It fails with
+// etag.ErrMismatch unless the referral is still at the given version.
+func (s *ReferralService) DeleteReferral(id, version uint) error {
+	if _, err := s.GetReferralByID(id); err != nil {
+		if err.Error() == "referral not found" {
+			return errors.New("referral not found or already deleted")
+		}
+		return err
 	}
-	return nil
+	return etag.Expect(s.DB, version).Delete(&models.Referral{}, id).Error
 }
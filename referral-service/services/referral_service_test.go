@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) *ReferralService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Referral{}, &models.ReferralStatusChange{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewReferralService(db)
+}
+
+// createReferral stores a referral directly in the given status.
+func createReferral(t *testing.T, s *ReferralService, status, priority string, createdAt time.Time) models.Referral {
+	t.Helper()
+	referral := models.Referral{ExaminationID: 1, Specialist: "Cardiology", Status: status, Priority: priority, CreatedAt: createdAt}
+	if err := s.DB.Create(&referral).Error; err != nil {
+		t.Fatalf("create referral: %v", err)
+	}
+	return referral
+}
+
+func TestTransitions(t *testing.T) {
+	actions := map[string]func(s *ReferralService, id uint) (models.Referral, error){
+		"accept": func(s *ReferralService, id uint) (models.Referral, error) { return s.AcceptReferral(id, "") },
+		"decline": func(s *ReferralService, id uint) (models.Referral, error) {
+			return s.DeclineReferral(id, "no capacity")
+		},
+		"schedule": func(s *ReferralService, id uint) (models.Referral, error) {
+			return s.ScheduleReferral(id, time.Now().AddDate(0, 0, 7), "")
+		},
+		"complete": func(s *ReferralService, id uint) (models.Referral, error) { return s.CompleteReferral(id, "") },
+	}
+	tests := []struct {
+		from   string
+		action string
+		want   string // "" when the transition is refused
+	}{
+		{StatusSent, "accept", StatusAccepted},
+		{StatusSent, "decline", StatusDeclined},
+		{StatusSent, "schedule", ""},
+		{StatusSent, "complete", ""},
+		{StatusAccepted, "accept", ""},
+		{StatusAccepted, "decline", StatusDeclined},
+		{StatusAccepted, "schedule", StatusScheduled},
+		{StatusAccepted, "complete", StatusCompleted},
+		{StatusScheduled, "schedule", StatusScheduled},
+		{StatusScheduled, "complete", StatusCompleted},
+		{StatusScheduled, "decline", ""},
+		{StatusDeclined, "accept", ""},
+		{StatusCompleted, "schedule", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" "+tt.action, func(t *testing.T) {
+			s := newTestService(t)
+			referral := createReferral(t, s, tt.from, PriorityRoutine, time.Now())
+
+			got, err := actions[tt.action](s, referral.ID)
+			var stored models.Referral
+			s.DB.First(&stored, referral.ID)
+			var changes int64
+			s.DB.Model(&models.ReferralStatusChange{}).Where("referral_id = ?", referral.ID).Count(&changes)
+
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidTransition) {
+					t.Fatalf("got %v, want ErrInvalidTransition", err)
+				}
+				if stored.Status != tt.from || changes != 0 {
+					t.Errorf("refused transition left status %s and %d history entries", stored.Status, changes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want %s", err, tt.want)
+			}
+			if got.Status != tt.want || stored.Status != tt.want || changes != 1 {
+				t.Errorf("status %s (stored %s) with %d history entries, want %s with 1", got.Status, stored.Status, changes, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeclineNeedsNote(t *testing.T) {
+	s := newTestService(t)
+	referral := createReferral(t, s, StatusSent, PriorityRoutine, time.Now())
+	if _, err := s.DeclineReferral(referral.ID, ""); err == nil {
+		t.Error("declined without a note")
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	s := newTestService(t)
+	referral := createReferral(t, s, StatusSent, PriorityRoutine, time.Now())
+	s.AcceptReferral(referral.ID, "seen")
+	s.ScheduleReferral(referral.ID, time.Now().AddDate(0, 0, 7), "")
+	s.CompleteReferral(referral.ID, "done")
+
+	history, err := s.GetStatusHistory(referral.ID)
+	if err != nil {
+		t.Fatalf("GetStatusHistory: %v", err)
+	}
+	want := [][2]string{{StatusSent, StatusAccepted}, {StatusAccepted, StatusScheduled}, {StatusScheduled, StatusCompleted}}
+	if len(history) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(history), len(want))
+	}
+	for i, change := range history {
+		if [2]string{change.FromStatus, change.ToStatus} != want[i] {
+			t.Errorf("change %d = %s to %s, want %s to %s", i, change.FromStatus, change.ToStatus, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestMarkSLA(t *testing.T) {
+	s := newTestService(t)
+	tests := []struct {
+		status   string
+		priority string
+		age      time.Duration
+		want     bool
+	}{
+		{StatusSent, PriorityRoutine, 30 * 24 * time.Hour, false},
+		{StatusSent, PriorityUrgent, 47 * time.Hour, false},
+		{StatusSent, PriorityUrgent, 49 * time.Hour, true},
+		{StatusSent, PriorityEmergency, 3 * time.Hour, false},
+		{StatusSent, PriorityEmergency, 5 * time.Hour, true},
+		{StatusAccepted, PriorityEmergency, 5 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		referral := models.Referral{Status: tt.status, Priority: tt.priority, CreatedAt: time.Now().Add(-tt.age)}
+		s.markSLA(&referral)
+		if referral.SLABreached != tt.want {
+			t.Errorf("%s %s referral %s old: SLABreached = %v, want %v", tt.status, tt.priority, tt.age, referral.SLABreached, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/etag"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckDeletion handles POST /api/samples/deletion/check
+// The examination service calls it before deleting examinations.
+func (h *SampleHandler) CheckDeletion(c *gin.Context) {
+	h.handleDeletion(c, "check samples", h.Service.CountDependents)
+}
+
+// DeleteDependents handles POST /api/samples/deletion/delete
+// The examination service calls it when deleting examinations.
+func (h *SampleHandler) DeleteDependents(c *gin.Context) {
+	h.handleDeletion(c, "delete samples", h.Service.DeleteDependents)
+}
+
+// RestoreDependents handles POST /api/samples/deletion/restore
+// The examination service calls it when restoring examinations.
+func (h *SampleHandler) RestoreDependents(c *gin.Context) {
+	h.handleDeletion(c, "restore samples", h.Service.RestoreDependents)
+}
+
+// RestoreSample handles POST /api/samples/:id/restore
+func (h *SampleHandler) RestoreSample(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	sample, err := h.Service.RestoreSample(uint(id))
+	if err != nil {
+		switch {
+		case err.Error() == "sample not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, deletion.ErrNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore sample: " + err.Error()})
+		}
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(sample.Version))
+	c.JSON(http.StatusOK, sample)
+}
+
+// handleDeletion runs a deletion request from another service and replies
+// with the number of samples it concerned.
+func (h *SampleHandler) handleDeletion(c *gin.Context, action string, run func(deletion.Request) (int, error)) {
+	var req deletion.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	count, err := run(req)
+	if err != nil {
+		if errors.Is(err, deletion.ErrUnknownParent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + ": " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, deletion.Result{Count: count})
+}
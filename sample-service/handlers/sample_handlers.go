@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/fitnis/sample-service/services"
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/etag"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
 	"github.com/gin-gonic/gin"
 	// Keep for potential direct error checks if needed
 )
@@ -12,6 +17,8 @@ import (
 // SampleHandler holds the sample service.
 type SampleHandler struct {
 	Service *services.SampleService
+	// Consent enforces the consents of the examination's patient on reads; nil allows every read
+	Consent *consent.Enforcer
 }
 
 // NewSampleHandler creates a new SampleHandler.
@@ -24,6 +31,8 @@ type SampleRequest struct {
 	ExaminationID uint   `json:"examinationId" binding:"required"`
 	SampleType    string `json:"sampleType" binding:"required"`
 	Result        string `json:"result"` // Result might be set by evaluation
+	OrderID       *uint  `json:"orderId"`
+	OrderItemID   *uint  `json:"orderItemId"`
 }
 
 type UpdateSampleRequest struct {
@@ -31,14 +40,24 @@ type UpdateSampleRequest struct {
 	Result     string `json:"result"`
 }
 
-// GetSamples handles GET /api/samples
+// GetSamples handles GET /api/samples?examinationId=&orderId=&sampleType=&resulted=&sort=&limit=&offset=&cursor=
 func (h *SampleHandler) GetSamples(c *gin.Context) {
-	samples, err := h.Service.GetSamples()
+	params, err := query.FromValues(c.Request.URL.Query())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve samples: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, samples)
+
+	page, err := h.Service.GetSamples(params)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve samples: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 // GetSample handles GET /api/samples/:id
@@ -58,6 +77,10 @@ func (h *SampleHandler) GetSample(c *gin.Context) {
 		}
 		return
 	}
+	if !h.checkConsent(c, sample.ExaminationID) {
+		return
+	}
+	c.Header(etag.HeaderETag, etag.Format(sample.Version))
 	c.JSON(http.StatusOK, sample)
 }
 
@@ -69,7 +92,9 @@ func (h *SampleHandler) GetSamplesByExaminationID(c *gin.Context) {
 		return
 	}
 
-	// TODO: Add check if examination exists before fetching samples? (Optional)
+	if !h.checkConsent(c, uint(examinationID)) {
+		return
+	}
 
 	samples, err := h.Service.GetSamplesByExaminationID(uint(examinationID))
 	if err != nil {
@@ -88,25 +113,34 @@ func (h *SampleHandler) CreateSample(c *gin.Context) {
 		return
 	}
 
-	// TODO: Add check if ExaminationID exists before creating sample? (Requires ExaminationService injection or check within SampleService)
-
 	// Note: The initial req.Result might be ignored as the service evaluates and sets it.
-	sample, err := h.Service.CreateSample(req.ExaminationID, req.SampleType, req.Result)
+	sample, err := h.Service.CreateSample(req.ExaminationID, req.SampleType, req.Result, req.OrderID, req.OrderItemID)
 	if err != nil {
-		// Handle potential foreign key constraint errors, etc.
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sample: " + err.Error()})
+		if errors.Is(err, references.ErrNotFound) || errors.Is(err, references.ErrInactive) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid examination reference: " + err.Error()})
+		} else if errors.Is(err, references.ErrUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify examination: " + err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sample: " + err.Error()})
+		}
 		return
 	}
+	c.Header(etag.HeaderETag, etag.Format(sample.Version))
 	c.JSON(http.StatusCreated, sample)
 }
 
 // UpdateSample handles PUT /api/samples/:id
+// The If-Match header must hold the sample's current ETag.
 func (h *SampleHandler) UpdateSample(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
 	var req UpdateSampleRequest
 	if err := c.BindJSON(&req); err != nil { // Use BindJSON for optional fields
@@ -114,30 +148,40 @@ func (h *SampleHandler) UpdateSample(c *gin.Context) {
 		return
 	}
 
-	updatedSample, err := h.Service.UpdateSample(uint(id), req.SampleType, req.Result)
+	updatedSample, err := h.Service.UpdateSample(uint(id), version, req.SampleType, req.Result)
 	if err != nil {
 		if err.Error() == "sample not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sample: " + err.Error()})
 		}
 		return
 	}
+	c.Header(etag.HeaderETag, etag.Format(updatedSample.Version))
 	c.JSON(http.StatusOK, updatedSample)
 }
 
 // DeleteSample handles DELETE /api/samples/:id
+// The If-Match header must hold the sample's current ETag.
 func (h *SampleHandler) DeleteSample(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
 
-	err = h.Service.DeleteSample(uint(id))
+	err = h.Service.DeleteSample(uint(id), version)
 	if err != nil {
 		if err.Error() == "sample not found or already deleted" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Sample not found"})
+		} else if errors.Is(err, etag.ErrMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sample: " + err.Error()})
 		}
@@ -145,3 +189,38 @@ func (h *SampleHandler) DeleteSample(c *gin.Context) {
 	}
 	c.Status(http.StatusNoContent)
 }
+
+// ifMatch reads the record version the request expects from its If-Match
+// header. When the header is missing or malformed it writes the response and returns false.
+func ifMatch(c *gin.Context) (uint, bool) {
+	version, err := etag.IfMatch(c.Request.Header)
+	switch {
+	case errors.Is(err, etag.ErrMissing):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return version, true
+	}
+	return 0, false
+}
+
+// checkConsent checks the caller identified by the request headers against the consents of
+// the patient the examination belongs to. When the read is refused it writes the response
+// and returns false.
+func (h *SampleHandler) checkConsent(c *gin.Context, examinationID uint) bool {
+	err := h.Consent.CheckExamination(h.Service.References, examinationID, consent.IdentityFromHeaders(c.Request.Header))
+	if err == nil {
+		return true
+	}
+	var denied *consent.DeniedError
+	switch {
+	case errors.As(err, &denied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": denied.Reason})
+	case errors.Is(err, references.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check consent: " + err.Error()})
+	}
+	return false
+}
@@ -13,8 +13,13 @@ import (
 	presServices "github.com/fitnis/prescription-service/services"
 	"github.com/fitnis/sample-service/handlers"
 	services "github.com/fitnis/sample-service/services"
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/consent"
 	"github.com/fitnis/shared/database"
+	"github.com/fitnis/shared/deletion"
 	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/privacy"
+	"github.com/fitnis/shared/references"
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,15 +28,27 @@ func main() {
 	database.InitDB()
 	db := database.DB
 
+	// Record reads and changes in the audit log
+	recorder, err := audit.Register(db, "samples")
+	if err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
 	// Initialize services and handlers
 	sampleService := services.NewSampleService(db, presServices.NewPrescriptionService(db))
+	sampleService.References = references.NewKafkaCheckerFromEnv()
 	sampleHandler := handlers.NewSampleHandler(sampleService)
+	sampleHandler.Consent = consent.NewEnforcer(db)
+
+	// Purge samples soft-deleted longer than the retention period
+	retention, interval := deletion.RetentionFromEnv()
+	deletion.StartPurge(retention, interval, sampleService.PurgeDeleted)
 
 	// Start Kafka consumer
 	log.Println("Starting Kafka consumer")
-	kafka.StartKafkaConsumer("samples", func(req kafka.KafkaRequest) kafka.KafkaResponse {
+	kafka.StartKafkaConsumer("samples", recorder.Wrap(func(req kafka.KafkaRequest) kafka.KafkaResponse {
 		return handleKafkaRequest(req, sampleHandler)
-	})
+	}))
 
 	// Block main goroutine
 	select {}
@@ -43,11 +60,41 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.SampleHandler)
 	c, w := createMockGinContext(req)
 
 	// Route the request based on path and method
-	path := req.Path
+	// Query parameters stay on the mock request for the handlers; routing uses the bare path
+	path, _, _ := strings.Cut(req.Path, "?")
 	if path == "" {
 		path = "/"
 	}
 
+	// Patient data export and erasure have no sample ID in the path
+	if path == privacy.ExportPath || path == privacy.ErasePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		if path == privacy.ExportPath {
+			handler.ExportPatientData(c)
+		} else {
+			handler.ErasePatientData(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
+	// Deletion requests from the examination service have no sample ID in the path
+	if path == deletion.CheckPath || path == deletion.DeletePath || path == deletion.RestorePath {
+		if req.Method != "POST" {
+			return createErrorResponse(req.RequestID, http.StatusNotFound, "Route not found")
+		}
+		switch path {
+		case deletion.CheckPath:
+			handler.CheckDeletion(c)
+		case deletion.DeletePath:
+			handler.DeleteDependents(c)
+		default:
+			handler.RestoreDependents(c)
+		}
+		return createResponse(req.RequestID, w)
+	}
+
 	// Extract ID from path if present
 	var id uint64
 	var err error
@@ -76,6 +123,9 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.SampleHandler)
 	case req.Method == "GET" && id > 0:
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
 		handler.GetSample(c)
+	case req.Method == "POST" && id > 0 && strings.HasSuffix(path, "/restore"):
+		c.Params = append(c.Params, gin.Param{Key: "id", Value: idStr})
+		handler.RestoreSample(c)
 	case req.Method == "POST" && path == "/":
 		handler.CreateSample(c)
 	case req.Method == "PUT" && id > 0:
@@ -92,14 +142,7 @@ func handleKafkaRequest(req kafka.KafkaRequest, handler *handlers.SampleHandler)
 	}
 
 	// Create response from the written data
-	return kafka.KafkaResponse{
-		RequestID:  req.RequestID,
-		StatusCode: w.Code,
-		Headers: map[string]string{
-			"Content-Type": w.Header().Get("Content-Type"),
-		},
-		Body: w.Body.Bytes(),
-	}
+	return createResponse(req.RequestID, w)
 }
 
 // Helper functions
@@ -136,6 +179,15 @@ func extractExaminationIDFromPath(path string) string {
 	return ""
 }
 
+func createResponse(requestID string, w *httptest.ResponseRecorder) kafka.KafkaResponse {
+	return kafka.KafkaResponse{
+		RequestID:  requestID,
+		StatusCode: w.Code,
+		Headers:    kafka.ResponseHeaders(w.Header()),
+		Body:       w.Body.Bytes(),
+	}
+}
+
 func createErrorResponse(requestID string, statusCode int, message string) kafka.KafkaResponse {
 	errorJSON, _ := json.Marshal(gin.H{"error": message})
 	return kafka.KafkaResponse{
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitnis/shared/deletion"
+	"github.com/fitnis/shared/models"
+)
+
+// CountDependents counts the live samples of the parent records, for a check before deleting them.
+func (s *SampleService) CountDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.CountLive(s.DB, &models.Sample{}, "examination_id", req.ParentIDs)
+}
+
+// DeleteDependents soft-deletes the samples of examinations deleted at req.DeletedAt.
+func (s *SampleService) DeleteDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.SoftDelete(s.DB, &models.Sample{}, "examination_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreDependents brings back the samples deleted along with examinations at req.DeletedAt.
+func (s *SampleService) RestoreDependents(req deletion.Request) (int, error) {
+	if err := checkParent(req); err != nil {
+		return 0, err
+	}
+	return deletion.Restore(s.DB, &models.Sample{}, "examination_id", req.ParentIDs, req.DeletedAt)
+}
+
+// RestoreSample brings back a soft-deleted sample.
+func (s *SampleService) RestoreSample(id uint) (models.Sample, error) {
+	var sample models.Sample
+	result := s.DB.Unscoped().Limit(1).Find(&sample, id)
+	if result.Error != nil {
+		return models.Sample{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Sample{}, errors.New("sample not found")
+	}
+	if !sample.DeletedAt.Valid {
+		return models.Sample{}, deletion.ErrNotDeleted
+	}
+	if err := s.DB.Unscoped().Model(&sample).Update("deleted_at", nil).Error; err != nil {
+		return models.Sample{}, err
+	}
+	return s.GetSampleByID(id)
+}
+
+// PurgeDeleted permanently deletes the samples soft-deleted before the cutoff. The samples of
+// patients under a retention hold on samples are kept until the hold is released or expires.
+func (s *SampleService) PurgeDeleted(cutoff time.Time) (int, error) {
+	return deletion.Purge(s.DB, cutoff, &models.Sample{}, "examination_id", deletion.HeldExaminations(s.DB, deletion.Samples))
+}
+
+// checkParent accepts requests about examinations, the only records samples reference.
+func checkParent(req deletion.Request) error {
+	if req.Parent != deletion.Examinations {
+		return fmt.Errorf("%w: %q", deletion.ErrUnknownParent, req.Parent)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/privacy"
+)
+
+// ExportPatientData retrieves every sample of the patient's examinations, for a patient data export.
+func (s *SampleService) ExportPatientData(req privacy.Request) ([]models.Sample, error) {
+	if len(req.ExaminationIDs) == 0 {
+		return []models.Sample{}, nil
+	}
+	samples := []models.Sample{}
+	result := s.DB.Unscoped().Where("examination_id IN ?", req.ExaminationIDs).Order("id").Find(&samples)
+	return samples, result.Error
+}
+
+// ErasePatientData anonymises the samples of the patient's examinations by removing their results.
+// Structured data is kept so statistics and references stay intact.
+func (s *SampleService) ErasePatientData(req privacy.Request) (int, error) {
+	if len(req.ExaminationIDs) == 0 {
+		return 0, nil
+	}
+	result := audit.Redacted(s.DB).Unscoped().Model(&models.Sample{}).Where("examination_id IN ?", req.ExaminationIDs).
+		Updates(map[string]interface{}{"result": privacy.ErasedText})
+	return int(result.RowsAffected), result.Error
+}
@@ -3,9 +3,13 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/fitnis/prescription-service/services"
+	"github.com/fitnis/shared/etag"
 	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/query"
+	"github.com/fitnis/shared/references"
 	"gorm.io/gorm"
 )
 
@@ -13,6 +17,9 @@ import (
 type SampleService struct {
 	DB                  *gorm.DB
 	PrescriptionService *services.PrescriptionService // Inject PrescriptionService
+
+	// References checks that new samples reference an existing examination
+	References references.Checker
 }
 
 // NewSampleService creates a new SampleService.
@@ -21,12 +28,26 @@ func NewSampleService(db *gorm.DB, ps *services.PrescriptionService) *SampleServ
 }
 
 // CreateSample creates a sample, triggers evaluation, and generates a prescription.
-func (s *SampleService) CreateSample(examinationID uint, sampleType, result string) (models.Sample, error) {
+// examinationID must reference an existing examination; see references.Require.
+// orderID and orderItemID are optional; a retried order fulfilment gets back the sample already created for the item.
+func (s *SampleService) CreateSample(examinationID uint, sampleType, result string, orderID, orderItemID *uint) (models.Sample, error) {
+	if orderItemID != nil {
+		existing, found, err := s.sampleForOrderItem(*orderItemID)
+		if err != nil || found {
+			return existing, err
+		}
+	}
+	if err := references.Require(s.References, references.Examinations, examinationID); err != nil {
+		return models.Sample{}, fmt.Errorf("examination: %w", err)
+	}
+
 	// Create the sample
 	sample := models.Sample{
 		ExaminationID: examinationID,
 		SampleType:    sampleType,
 		Result:        result, // Initial result if provided
+		OrderID:       orderID,
+		OrderItemID:   orderItemID,
 	}
 
 	// Use transaction to ensure atomicity
@@ -38,6 +59,12 @@ func (s *SampleService) CreateSample(examinationID uint, sampleType, result stri
 	// Save sample within transaction
 	if err := tx.Create(&sample).Error; err != nil {
 		tx.Rollback()
+		// A concurrent retry of the same order item may have won the unique index
+		if orderItemID != nil {
+			if existing, found, findErr := s.sampleForOrderItem(*orderItemID); findErr == nil && found {
+				return existing, nil
+			}
+		}
 		return models.Sample{}, fmt.Errorf("failed to create sample: %w", err)
 	}
 
@@ -66,11 +93,45 @@ func (s *SampleService) CreateSample(examinationID uint, sampleType, result stri
 	return sample, nil
 }
 
-// GetSamples retrieves all samples.
-func (s *SampleService) GetSamples() ([]models.Sample, error) {
-	var samples []models.Sample
-	result := s.DB.Find(&samples)
-	return samples, result.Error
+// sampleForOrderItem returns the live sample already created for an order item, if any.
+func (s *SampleService) sampleForOrderItem(orderItemID uint) (models.Sample, bool, error) {
+	var existing models.Sample
+	err := s.DB.Where("order_item_id = ?", orderItemID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Sample{}, false, nil
+	}
+	if err != nil {
+		return models.Sample{}, false, err
+	}
+	return existing, true, nil
+}
+
+// sampleQuery is the allow-list for listing samples.
+var sampleQuery = query.Spec{
+	Filters: map[string]query.Filter{
+		"examinationId": {Column: "examination_id", Kind: query.Int},
+		"orderId":       {Column: "order_id", Kind: query.Int},
+		"sampleType":    {Column: "sample_type"},
+		"resulted":      {Apply: filterResulted},
+	},
+}
+
+// GetSamples retrieves one page of samples.
+// Filters: examinationId, orderId, sampleType and resulted (true once a result is recorded).
+func (s *SampleService) GetSamples(params query.Params) (query.Page[models.Sample], error) {
+	return query.Find[models.Sample](s.DB, sampleQuery, params)
+}
+
+// filterResulted matches samples with or without a recorded result.
+func filterResulted(db *gorm.DB, value string) (*gorm.DB, error) {
+	resulted, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("must be true or false")
+	}
+	if resulted {
+		return db.Where("result <> ''"), nil
+	}
+	return db.Where("result = '' OR result IS NULL"), nil
 }
 
 // GetSampleByID retrieves a sample by ID.
@@ -94,7 +155,8 @@ func (s *SampleService) GetSamplesByExaminationID(examinationID uint) ([]models.
 }
 
 // UpdateSample updates an existing sample.
-func (s *SampleService) UpdateSample(id uint, sampleType, result string) (models.Sample, error) {
+// It fails with etag.ErrMismatch unless the sample is still at the given version.
+func (s *SampleService) UpdateSample(id, version uint, sampleType, result string) (models.Sample, error) {
 	sample, err := s.GetSampleByID(id)
 	if err != nil {
 		return models.Sample{}, err
@@ -106,23 +168,23 @@ func (s *SampleService) UpdateSample(id uint, sampleType, result string) (models
 	// Allow updating/clearing result
 	sample.Result = result
 
-	dbResult := s.DB.Save(&sample)
+	dbResult := etag.Expect(s.DB, version).Save(&sample)
 	return sample, dbResult.Error
 }
 
-// DeleteSample removes a sample from the database.
-func (s *SampleService) DeleteSample(id uint) error {
-	result := s.DB.Delete(&models.Sample{}, id)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("sample not found or already deleted")
+// DeleteSample soft-deletes a sample; it can be restored until it is purged. It fails with
+// etag.ErrMismatch unless the sample is still at the given version.
+func (s *SampleService) DeleteSample(id, version uint) error {
+	if _, err := s.GetSampleByID(id); err != nil {
+		if err.Error() == "sample not found" {
+			return errors.New("sample not found or already deleted")
+		}
+		return err
 	}
-	return nil
+	return etag.Expect(s.DB, version).Delete(&models.Sample{}, id).Error
 }
 
-// evaluateSample (private helper) evaluates a sample and returns analysis results.
+// evaluateSample evaluates a sample and returns analysis results.
 func (s *SampleService) evaluateSample(sample models.Sample) string {
 	// Mock evaluation process
 	var result string
@@ -139,7 +201,7 @@ func (s *SampleService) evaluateSample(sample models.Sample) string {
 	return result
 }
 
-// generateAutomaticPrescription (private helper) creates a prescription based on evaluation.
+// generateAutomaticPrescription creates a prescription based on evaluation.
 // It now accepts a *gorm.DB (potentially a transaction) to ensure atomicity.
 func (s *SampleService) generateAutomaticPrescription(db *gorm.DB, examinationID uint, evaluationResult string) (models.Prescription, error) {
 	// Mock prescription generation logic
@@ -164,5 +226,7 @@ func (s *SampleService) generateAutomaticPrescription(db *gorm.DB, examinationID
 
 	// Use the injected PrescriptionService, passing the transaction DB
 	tempPrescriptionService := services.NewPrescriptionService(db) // Use the transaction DB
-	return tempPrescriptionService.CreatePrescription(examinationID, medication, dosage, instructions)
+	// The sample's examination was just checked, so checking it again hits the cache
+	tempPrescriptionService.References = s.References
+	return tempPrescriptionService.CreatePrescription(examinationID, medication, dosage, instructions, "", nil)
 }
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/references"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// activeRecords answers every reference check with an active record.
+type activeRecords struct{}
+
+func (activeRecords) Check(service string, id uint) (references.Result, error) {
+	return references.Result{Exists: true, Active: true}, nil
+}
+
+func newTestService(t *testing.T) *SampleService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Sample{}, &models.Prescription{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	s := NewSampleService(db, nil)
+	s.References = activeRecords{}
+	return s
+}
+
+func TestCreateSampleOncePerOrderItem(t *testing.T) {
+	s := newTestService(t)
+	orderID, itemID := uint(3), uint(4)
+
+	first, err := s.CreateSample(1, "blood", "", &orderID, &itemID)
+	if err != nil {
+		t.Fatalf("CreateSample: %v", err)
+	}
+	// A retried fulfilment gets the same sample back, without another automatic prescription
+	retried, err := s.CreateSample(1, "blood", "", &orderID, &itemID)
+	if err != nil {
+		t.Fatalf("retried CreateSample: %v", err)
+	}
+	if retried.ID != first.ID {
+		t.Errorf("retry created sample %d, want %d", retried.ID, first.ID)
+	}
+	var samples, prescriptions int64
+	s.DB.Model(&models.Sample{}).Count(&samples)
+	s.DB.Model(&models.Prescription{}).Count(&prescriptions)
+	if samples != 1 || prescriptions != 1 {
+		t.Errorf("%d samples and %d prescriptions, want 1 of each", samples, prescriptions)
+	}
+
+	// Once the sample is deleted, the item can be collected again
+	s.DB.Delete(&models.Sample{}, first.ID)
+	again, err := s.CreateSample(1, "blood", "", &orderID, &itemID)
+	if err != nil {
+		t.Fatalf("CreateSample after delete: %v", err)
+	}
+	if again.ID == first.ID {
+		t.Error("got the deleted sample back")
+	}
+
+	// Samples outside orders are never de-duplicated
+	a, _ := s.CreateSample(1, "urine", "", nil, nil)
+	b, _ := s.CreateSample(1, "urine", "", nil, nil)
+	if a.ID == b.ID {
+		t.Error("samples without an order item were merged")
+	}
+}
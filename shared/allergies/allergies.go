@@ -0,0 +1,87 @@
+package allergies
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/models"
+)
+
+var (
+	// ErrPatientNotFound means the patient does not exist
+	ErrPatientNotFound = errors.New("patient not found")
+	// ErrUnavailable means the patient-service could not be reached
+	ErrUnavailable = errors.New("allergy registry unavailable")
+)
+
+// Registry looks up the allergies recorded for a patient
+type Registry interface {
+	ActiveAllergies(patientID uint) ([]models.Allergy, error)
+}
+
+// KafkaRegistry asks the patient-service over Kafka
+type KafkaRegistry struct {
+	Timeout time.Duration
+}
+
+// NewKafkaRegistry creates a registry client with a default timeout
+func NewKafkaRegistry() *KafkaRegistry {
+	return &KafkaRegistry{Timeout: 10 * time.Second}
+}
+
+// ActiveAllergies fetches a patient's active allergies, leaving out refuted ones
+func (r *KafkaRegistry) ActiveAllergies(patientID uint) ([]models.Allergy, error) {
+	var allergies []models.Allergy
+	params := url.Values{"status": {"active"}, "limit": {"200"}}
+	for {
+		resp, err := kafka.SendRequest("patients", kafka.KafkaRequest{
+			Method: "GET",
+			Path:   fmt.Sprintf("/%d/allergies?%s", patientID, params.Encode()),
+		}, r.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, fmt.Errorf("%w: %d", ErrPatientNotFound, patientID)
+		case resp.StatusCode != http.StatusOK:
+			return nil, fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+		}
+
+		var page struct {
+			Items      []models.Allergy `json:"items"`
+			NextCursor string           `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(resp.Body, &page); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		for _, allergy := range page.Items {
+			if allergy.Verification != "refuted" {
+				allergies = append(allergies, allergy)
+			}
+		}
+		if page.NextCursor == "" {
+			return allergies, nil
+		}
+		params.Set("cursor", page.NextCursor)
+	}
+}
+
+// AllergiesForPatient lists the substances a patient is allergic to, for safety checks
+func (r *KafkaRegistry) AllergiesForPatient(patientID uint) ([]string, error) {
+	allergies, err := r.ActiveAllergies(patientID)
+	if err != nil {
+		return nil, err
+	}
+	substances := make([]string, 0, len(allergies))
+	for _, allergy := range allergies {
+		substances = append(substances, allergy.Substance)
+	}
+	return substances, nil
+}
@@ -0,0 +1,610 @@
+// Package audit keeps an append-only, hash-chained log of who read or changed stored data.
+// Changes are captured by GORM callbacks with the fields they changed and hashes of the values
+// before and after, so the log holds no patient data itself; reads are captured by wrapping a
+// service's Kafka handler. Models that need their earlier states as
+// evidence also keep a version per change.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Actions.
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// HeaderSourceIP carries the client's address. The API gateway sets it on every request.
+const HeaderSourceIP = "X-Source-Ip"
+
+// ErrAppendOnly is returned when changing or deleting audit entries.
+var ErrAppendOnly = errors.New("audit log is append-only")
+
+// beforeKey is where the rows about to be changed are kept between callbacks.
+const beforeKey = "audit:before"
+
+// redactKey marks a statement whose changed values are left out of the audit log.
+const redactKey = "audit:redact"
+
+// appendAttempts is how often an entry is written before giving up. Services share the log,
+// so another service may take the next sequence number first.
+const appendAttempts = 3
+
+// appendSavePoint is where a failed append inside a change's transaction is rolled back to.
+const appendSavePoint = "audit_append"
+
+// requestKey is the context key of the caller a statement carries itself; see System.
+type requestKey struct{}
+
+var auditEntryType = reflect.TypeOf(models.AuditEntry{})
+
+// recordVersionType is not audited itself: versions repeat the entries they are written from.
+var recordVersionType = reflect.TypeOf(models.RecordVersion{})
+
+// request is the caller of the request being handled
+type request struct {
+	id       string
+	actor    string
+	role     string
+	sourceIP string
+	path     string
+}
+
+// Recorder writes the audit entries of one service.
+type Recorder struct {
+	DB      *gorm.DB
+	Service string
+
+	mu        sync.Mutex
+	current   *request              // the request being handled, nil outside one
+	versioned map[reflect.Type]bool // models that keep versions
+}
+
+// Register installs the audit callbacks on db. Every create, update and delete made through
+// it is then recorded in the same transaction as the change; a change whose entry cannot be
+// written fails. Audit entries themselves cannot be updated or deleted.
+func Register(db *gorm.DB, service string) (*Recorder, error) {
+	r := &Recorder{DB: db, Service: service}
+	callbacks := db.Callback()
+	return r, errors.Join(
+		callbacks.Create().After("gorm:create").Before("gorm:save_after_associations").Register("audit:after_create", r.afterCreate),
+		callbacks.Update().After("gorm:begin_transaction").Before("gorm:update").Register("audit:before_update", r.beforeChange),
+		callbacks.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("audit:after_update", func(db *gorm.DB) {
+			r.afterChange(db, ActionUpdate)
+		}),
+		callbacks.Delete().After("gorm:begin_transaction").Before("gorm:delete").Register("audit:before_delete", r.beforeChange),
+		callbacks.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("audit:after_delete", func(db *gorm.DB) {
+			r.afterChange(db, ActionDelete)
+		}),
+	)
+}
+
+// System returns db with its changes attributed to a background job of the service, such as
+// "purge", recorded as the actor "system:<job>". Jobs running beside the Kafka consumer must
+// use it: otherwise their changes are attributed to whichever request is being handled.
+func System(db *gorm.DB, job string) *gorm.DB {
+	return db.WithContext(context.WithValue(db.Statement.Context, requestKey{}, &request{actor: "system:" + job}))
+}
+
+// Redacted returns db with the values of its changes left out of audit entries and record
+// versions: only the fields that changed are recorded, and no baseline version is kept.
+// Erasures use it so the data they remove does not live on in the log.
+func Redacted(db *gorm.DB) *gorm.DB {
+	return db.Set(redactKey, true)
+}
+
+// isRedacted reports whether the statement's changed values are left out of the log.
+func isRedacted(db *gorm.DB) bool {
+	_, ok := db.Get(redactKey)
+	return ok
+}
+
+// Wrap records the reads made through a Kafka handler and attributes the changes made while
+// handling a request to its caller. The Kafka consumer handles one request at a time, so
+// every change made in between belongs to that request, except changes whose statement
+// carries its own caller; see System.
+func (r *Recorder) Wrap(next kafka.ServiceHandler) kafka.ServiceHandler {
+	return func(req kafka.KafkaRequest) kafka.KafkaResponse {
+		info := r.requestFrom(req)
+		r.mu.Lock()
+		r.current = &info
+		r.mu.Unlock()
+
+		resp := next(req)
+
+		r.mu.Lock()
+		r.current = nil
+		r.mu.Unlock()
+
+		if req.Method == http.MethodGet {
+			resourceType, resourceID := resourceFromPath(info.path)
+			entry := r.newEntry(&info, ActionRead, resourceType, resourceID)
+			entry.StatusCode = resp.StatusCode
+			if err := r.appendWithRetry([]models.AuditEntry{entry}); err != nil {
+				log.Printf("Failed to record audit entry for %s %s: %v", req.Method, req.Path, err)
+			}
+		}
+		return resp
+	}
+}
+
+// requestFrom reads the caller of a Kafka request from its headers.
+func (r *Recorder) requestFrom(req kafka.KafkaRequest) request {
+	header := make(http.Header, len(req.Headers))
+	for key, value := range req.Headers {
+		header.Set(key, value)
+	}
+	who := consent.IdentityFromHeaders(header)
+
+	// The service path includes the service name, e.g. /patients/12
+	path, _, _ := strings.Cut(req.ServicePath, "?")
+	if path == "" {
+		path, _, _ = strings.Cut(req.Path, "?")
+		path = "/" + r.Service + path
+	}
+	return request{
+		id:       req.RequestID,
+		actor:    who.UserID,
+		role:     who.Role,
+		sourceIP: strings.TrimSpace(header.Get(HeaderSourceIP)),
+		path:     path,
+	}
+}
+
+// resourceFromPath takes the first collection followed by a record ID from a
+// path, e.g. patients and 12 from /patients/12/allergies or chart and 5 from /records/chart/5.
+// Collection reads have no ID and are recorded against the service.
+func resourceFromPath(path string) (string, string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if _, err := strconv.ParseUint(parts[i+1], 10, 64); err == nil {
+			return parts[i], parts[i+1]
+		}
+	}
+	return parts[0], ""
+}
+
+// requestFor returns the caller a statement's changes are attributed to: the one its context
+// carries, else the request being handled, or nil for changes made outside one, such as at startup.
+func (r *Recorder) requestFor(db *gorm.DB) *request {
+	if ctx := db.Statement.Context; ctx != nil {
+		if req, ok := ctx.Value(requestKey{}).(*request); ok {
+			return req
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// newEntry starts an entry attributed to the caller of req, if any.
+func (r *Recorder) newEntry(req *request, action, resourceType, resourceID string) models.AuditEntry {
+	entry := models.AuditEntry{
+		Timestamp:    time.Now().UTC().Truncate(time.Microsecond),
+		Service:      r.Service,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+	}
+	if req != nil {
+		entry.RequestID = req.id
+		entry.Actor = req.actor
+		entry.Role = req.role
+		entry.SourceIP = req.sourceIP
+		entry.Path = req.path
+	}
+	return entry
+}
+
+// beforeChange loads the rows an update or delete is about to change.
+func (r *Recorder) beforeChange(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	if db.Statement.Schema.ModelType == auditEntryType {
+		db.AddError(ErrAppendOnly)
+		return
+	}
+	if db.Statement.Schema.ModelType == recordVersionType {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return
+	}
+	conditions := targetConditions(db.Statement, pk)
+	if len(conditions) == 0 {
+		// GORM refuses updates and deletes without conditions
+		return
+	}
+	rows, err := loadRows(db, conditions)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	db.InstanceSet(beforeKey, rows)
+
+	if r.isVersioned(db.Statement.Schema) && len(rows) > 0 && !isRedacted(db) {
+		snapshots, err := loadSnapshots(db, rowIDs(rows, pk))
+		if err != nil {
+			db.AddError(fmt.Errorf("audit: %w", err))
+			return
+		}
+		db.InstanceSet(snapshotsKey, snapshots)
+	}
+}
+
+// afterChange records the fields an update or delete changed in each row.
+// Rows that are gone are recorded with their last values.
+func (r *Recorder) afterChange(db *gorm.DB, action string) {
+	if db.Error != nil {
+		return
+	}
+	value, ok := db.InstanceGet(beforeKey)
+	if !ok {
+		return
+	}
+	before := value.([]map[string]interface{})
+	if len(before) == 0 {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	ids := rowIDs(before, pk)
+	rows, err := loadRows(db, []clause.Expression{clause.IN{Column: clause.Column{Name: pk.DBName}, Values: ids}})
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	after := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		after[fmt.Sprint(row[pk.DBName])] = row
+	}
+
+	req := r.requestFor(db)
+	var entries []models.AuditEntry
+	for _, row := range before {
+		id := fmt.Sprint(row[pk.DBName])
+		changes := diff(db.Statement.Schema.DBNames, row, after[id])
+		if len(changes) == 0 {
+			continue
+		}
+		if isRedacted(db) {
+			redact(changes)
+		}
+		entry := r.newEntry(req, action, db.Statement.Table, id)
+		entry.Changes = changes
+		entries = append(entries, entry)
+	}
+	if err := r.appendInTx(db.Session(&gorm.Session{NewDB: true}), entries); err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+
+	if r.isVersioned(db.Statement.Schema) {
+		baselines, _ := db.InstanceGet(snapshotsKey)
+		snapshots, _ := baselines.(map[string]json.RawMessage)
+		if err := r.recordVersions(db, ids, entries, snapshots); err != nil {
+			db.AddError(fmt.Errorf("audit: %w", err))
+		}
+	}
+}
+
+// afterCreate records created rows with their stored values.
+func (r *Recorder) afterCreate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	if t := db.Statement.Schema.ModelType; t == auditEntryType || t == recordVersionType {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return
+	}
+	ids := primaryKeys(db.Statement, db.Statement.ReflectValue, pk)
+	if len(ids) == 0 {
+		return
+	}
+	rows, err := loadRows(db, []clause.Expression{clause.IN{Column: clause.Column{Name: pk.DBName}, Values: ids}})
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+
+	req := r.requestFor(db)
+	entries := make([]models.AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := r.newEntry(req, ActionCreate, db.Statement.Table, fmt.Sprint(row[pk.DBName]))
+		entry.Changes = diff(db.Statement.Schema.DBNames, nil, row)
+		if isRedacted(db) {
+			redact(entry.Changes)
+		}
+		entries = append(entries, entry)
+	}
+	if err := r.appendInTx(db.Session(&gorm.Session{NewDB: true}), entries); err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+
+	if r.isVersioned(db.Statement.Schema) {
+		if err := r.recordVersions(db, ids, entries, nil); err != nil {
+			db.AddError(fmt.Errorf("audit: %w", err))
+		}
+	}
+}
+
+// targetConditions is the WHERE clause of an update or delete, plus the
+// primary keys of the records it was given.
+func targetConditions(stmt *gorm.Statement, pk *schema.Field) []clause.Expression {
+	var conditions []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			for _, expr := range where.Exprs {
+				conditions = append(conditions, resolvePrimaryKey(expr, pk))
+			}
+		}
+	}
+	ids := primaryKeys(stmt, stmt.ReflectValue, pk)
+	if len(ids) == 0 && stmt.Model != nil {
+		ids = primaryKeys(stmt, reflect.ValueOf(stmt.Model), pk)
+	}
+	if len(ids) > 0 {
+		conditions = append(conditions, clause.IN{Column: clause.Column{Name: pk.DBName}, Values: ids})
+	}
+	return conditions
+}
+
+// resolvePrimaryKey names the primary key column in conditions given as
+// inline IDs, e.g. Delete(&models.Examination{}, id), which refer to it by placeholder.
+func resolvePrimaryKey(expr clause.Expression, pk *schema.Field) clause.Expression {
+	column := clause.Column{Name: pk.DBName}
+	switch e := expr.(type) {
+	case clause.IN:
+		if c, ok := e.Column.(clause.Column); ok && c.Name == clause.PrimaryKey {
+			e.Column = column
+		}
+		return e
+	case clause.Eq:
+		if c, ok := e.Column.(clause.Column); ok && c.Name == clause.PrimaryKey {
+			e.Column = column
+		}
+		return e
+	}
+	return expr
+}
+
+// rowIDs collects the primary keys of loaded rows.
+func rowIDs(rows []map[string]interface{}, pk *schema.Field) []interface{} {
+	ids := make([]interface{}, len(rows))
+	for i, row := range rows {
+		ids[i] = row[pk.DBName]
+	}
+	return ids
+}
+
+// primaryKeys collects the non-zero primary keys of a record or slice of records.
+func primaryKeys(stmt *gorm.Statement, value reflect.Value, pk *schema.Field) []interface{} {
+	value = reflect.Indirect(value)
+	var ids []interface{}
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() == stmt.Schema.ModelType {
+			if id, zero := pk.ValueOf(stmt.Context, value); !zero {
+				ids = append(ids, id)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			ids = append(ids, primaryKeys(stmt, value.Index(i), pk)...)
+		}
+	}
+	return ids
+}
+
+// loadRows reads the matching rows of the statement's table as column maps,
+// within the statement's transaction.
+func loadRows(db *gorm.DB, conditions []clause.Expression) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	err := db.Session(&gorm.Session{NewDB: true}).Table(db.Statement.Table).
+		Clauses(clause.Where{Exprs: conditions}).Find(&rows).Error
+	return rows, err
+}
+
+// diff lists the columns whose values differ between two versions of a row, with hashes of
+// the values. A nil version is a row that does not exist; its counterpart's empty values are left out.
+func diff(columns []string, before, after map[string]interface{}) []models.FieldChange {
+	var changes []models.FieldChange
+	for _, column := range columns {
+		b, a := jsonValue(before, column), jsonValue(after, column)
+		if bytes.Equal(b, a) {
+			continue
+		}
+		if (before == nil && isEmpty(a)) || (after == nil && isEmpty(b)) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: column, Before: digest(b), After: digest(a)})
+	}
+	return changes
+}
+
+// jsonValue encodes a column of a row, or returns nil if the row is nil.
+func jsonValue(row map[string]interface{}, column string) json.RawMessage {
+	if row == nil {
+		return nil
+	}
+	value, ok := row[column]
+	if !ok {
+		return nil
+	}
+	switch v := value.(type) {
+	case []byte:
+		value = string(v)
+	case time.Time:
+		value = v.UTC()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return encoded
+}
+
+// digest hashes an encoded value, so that the log shows a field changed and can confirm a
+// value it is shown without holding the value itself.
+func digest(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	sum := sha256.Sum256(value)
+	encoded, _ := json.Marshal("sha256:" + hex.EncodeToString(sum[:]))
+	return encoded
+}
+
+// redact removes the values from changes, keeping the fields.
+func redact(changes []models.FieldChange) {
+	for i := range changes {
+		changes[i].Before, changes[i].After = nil, nil
+	}
+}
+
+// isEmpty reports whether an encoded value is null or an empty string.
+func isEmpty(value json.RawMessage) bool {
+	return string(value) == "null" || string(value) == `""`
+}
+
+// append chains entries onto the log within tx.
+func (r *Recorder) append(tx *gorm.DB, entries []models.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var last models.AuditEntry
+	if err := tx.Select("sequence", "hash").Order("sequence DESC").Limit(1).Find(&last).Error; err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].ID = 0
+		entries[i].Sequence = last.Sequence + 1
+		entries[i].PrevHash = last.Hash
+		entries[i].Hash = Hash(entries[i])
+		last = entries[i]
+	}
+	return tx.Create(&entries).Error
+}
+
+// appendInTx appends entries within the transaction of the change they record. When another
+// service takes the next sequence number first, the unique index turns that into an error;
+// the append is rolled back to a savepoint and retried, so the change itself goes through.
+func (r *Recorder) appendInTx(tx *gorm.DB, entries []models.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var err error
+	for attempt := 0; attempt < appendAttempts; attempt++ {
+		if err := tx.SavePoint(appendSavePoint).Error; err != nil {
+			return err
+		}
+		if err = r.append(tx, entries); err == nil {
+			return nil
+		}
+		if rollbackErr := tx.RollbackTo(appendSavePoint).Error; rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+	}
+	return err
+}
+
+// appendWithRetry appends entries in their own transaction, retrying like appendInTx.
+func (r *Recorder) appendWithRetry(entries []models.AuditEntry) error {
+	var err error
+	for attempt := 0; attempt < appendAttempts; attempt++ {
+		err = r.DB.Transaction(func(tx *gorm.DB) error {
+			return r.append(tx, entries)
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Hash computes an entry's hash from its contents and the previous entry's hash.
+func Hash(e models.AuditEntry) string {
+	changes, _ := json.Marshal(e.Changes)
+	h := sha256.New()
+	for _, part := range []string{
+		e.PrevHash, strconv.FormatUint(e.Sequence, 10), e.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.Service, e.Actor, e.Role, e.Action, e.ResourceType, e.ResourceID, e.RequestID,
+		e.SourceIP, e.Path, strconv.Itoa(e.StatusCode), string(changes),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verification is the result of checking the hash chain.
+type Verification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`            // entries that matched
+	Head     string `json:"head,omitempty"`     // hash of the last entry; keep a copy elsewhere to detect truncation
+	BrokenAt uint64 `json:"brokenAt,omitempty"` // sequence of the first entry that does not match
+	Problem  string `json:"problem,omitempty"`
+}
+
+// Verify walks the whole chain and reports the first entry that was changed, removed or
+// inserted out of place.
+func Verify(db *gorm.DB) (Verification, error) {
+	const batchSize = 500
+	var result Verification
+	var prev models.AuditEntry
+	for {
+		var batch []models.AuditEntry
+		err := db.Where("sequence > ?", prev.Sequence).Order("sequence").Limit(batchSize).Find(&batch).Error
+		if err != nil {
+			return Verification{}, err
+		}
+		for _, e := range batch {
+			switch {
+			case e.Sequence != prev.Sequence+1:
+				result.BrokenAt, result.Problem = prev.Sequence+1, "entry is missing"
+			case e.PrevHash != prev.Hash:
+				result.BrokenAt, result.Problem = e.Sequence, "previous hash does not match"
+			case e.Hash != Hash(e):
+				result.BrokenAt, result.Problem = e.Sequence, "entry was modified"
+			}
+			if result.BrokenAt != 0 {
+				return result, nil
+			}
+			result.Checked++
+			result.Head = e.Hash
+			prev = e
+		}
+		if len(batch) < batchSize {
+			result.Valid = true
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an empty database with the audit callbacks installed and writes three
+// entries: a create, an update and a delete of a condition.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditEntry{}, &models.Condition{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := Register(db, "test"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	condition := models.Condition{PatientID: 1, Description: "Asthma"}
+	if err := db.Create(&condition).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := db.Model(&condition).Update("description", "Severe asthma").Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := db.Delete(&condition).Error; err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	return db
+}
+
+func TestVerifyIntactChain(t *testing.T) {
+	db := newTestDB(t)
+
+	result, err := Verify(db)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !result.Valid || result.Checked != 3 || result.Head == "" {
+		t.Fatalf("got %+v, want a valid chain of 3 entries", result)
+	}
+
+	var entries []models.AuditEntry
+	db.Order("sequence").Find(&entries)
+	for i, action := range []string{ActionCreate, ActionUpdate, ActionDelete} {
+		if entries[i].Action != action {
+			t.Errorf("entry %d action = %s, want %s", i+1, entries[i].Action, action)
+		}
+	}
+	if entries[2].Hash != result.Head {
+		t.Errorf("head = %s, want the last entry's hash %s", result.Head, entries[2].Hash)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	// Each tamper writes with raw SQL, which bypasses the append-only callbacks
+	exec := func(sql string) func(*gorm.DB) error {
+		return func(db *gorm.DB) error { return db.Exec(sql).Error }
+	}
+	tests := []struct {
+		name         string
+		tamper       func(db *gorm.DB) error
+		wantBrokenAt uint64
+		wantProblem  string
+	}{
+		{"modified", exec("UPDATE audit_entries SET actor = 'someone-else' WHERE sequence = 2"), 2, "entry was modified"},
+		{"removed", exec("DELETE FROM audit_entries WHERE sequence = 2"), 2, "entry is missing"},
+		{"rewritten with a new hash", func(db *gorm.DB) error {
+			var first models.AuditEntry
+			db.Where("sequence = 1").First(&first)
+			first.Actor = "someone-else"
+			return db.Exec("UPDATE audit_entries SET actor = ?, hash = ? WHERE sequence = 1", first.Actor, Hash(first)).Error
+		}, 2, "previous hash does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := tt.tamper(db); err != nil {
+				t.Fatalf("tamper: %v", err)
+			}
+
+			result, err := Verify(db)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if result.Valid || result.BrokenAt != tt.wantBrokenAt || result.Problem != tt.wantProblem {
+				t.Errorf("got %+v, want broken at %d: %s", result, tt.wantBrokenAt, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestEntriesAreAppendOnly(t *testing.T) {
+	db := newTestDB(t)
+
+	var entry models.AuditEntry
+	db.First(&entry)
+	if err := db.Model(&entry).Update("actor", "someone-else").Error; !errors.Is(err, ErrAppendOnly) {
+		t.Errorf("update: got %v, want ErrAppendOnly", err)
+	}
+	if err := db.Delete(&entry).Error; !errors.Is(err, ErrAppendOnly) {
+		t.Errorf("delete: got %v, want ErrAppendOnly", err)
+	}
+	if result, _ := Verify(db); !result.Valid {
+		t.Errorf("chain broken after refused changes: %+v", result)
+	}
+}
+
+func TestChangesHoldHashesNotValues(t *testing.T) {
+	db := newTestDB(t)
+
+	var entries []models.AuditEntry
+	db.Order("sequence").Find(&entries)
+	for _, entry := range entries {
+		for _, change := range entry.Changes {
+			for _, value := range []string{string(change.Before), string(change.After)} {
+				if value != "" && !strings.HasPrefix(value, `"sha256:`) {
+					t.Errorf("%s of %s recorded %s, want a hash", entry.Action, change.Field, value)
+				}
+			}
+		}
+	}
+	// The update's hashes match the old description and the new one
+	update := entries[1].Changes
+	if len(update) == 0 || update[0].Field != "description" {
+		t.Fatalf("update changes = %+v, want description first", update)
+	}
+	if string(update[0].Before) != string(digest([]byte(`"Asthma"`))) || string(update[0].After) != string(digest([]byte(`"Severe asthma"`))) {
+		t.Errorf("update = %s -> %s, want the hashes of the old and new descriptions", update[0].Before, update[0].After)
+	}
+}
+
+func TestSystemActor(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditEntry{}, &models.Condition{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	r, err := Register(db, "test")
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	// A request is being handled while a background job changes data
+	r.current = &request{actor: "dr-house", role: "physician"}
+
+	db.Create(&models.Condition{PatientID: 1, Description: "Asthma"})
+	if err := System(db, "purge").Transaction(func(tx *gorm.DB) error {
+		return tx.Where("patient_id = ?", 1).Delete(&models.Condition{}).Error
+	}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	var actors []string
+	db.Model(&models.AuditEntry{}).Order("sequence").Pluck("actor", &actors)
+	if len(actors) != 2 || actors[0] != "dr-house" || actors[1] != "system:purge" {
+		t.Errorf("actors = %v, want the request's caller for the create and system:purge for the delete", actors)
+	}
+}
+
+func TestChangeAppendIsRetried(t *testing.T) {
+	db := newTestDB(t)
+	// The first write of the next entry fails as if another service had taken its sequence number
+	failed := false
+	err := db.Callback().Create().Before("gorm:create").Register("test:conflict", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.(*[]models.AuditEntry); ok && !failed {
+			failed = true
+			tx.AddError(errors.New("UNIQUE constraint failed: audit_entries.sequence"))
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	if err := db.Create(&models.Condition{PatientID: 2, Description: "Migraine"}).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !failed {
+		t.Fatal("the conflict was not injected")
+	}
+	var count int64
+	db.Model(&models.Condition{}).Where("patient_id = ?", 2).Count(&count)
+	if result, _ := Verify(db); !result.Valid || result.Checked != 4 || count != 1 {
+		t.Errorf("got %+v and %d conditions, want the change and its entry written on the second attempt", result, count)
+	}
+}
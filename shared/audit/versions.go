@@ -0,0 +1,246 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ActionBaseline marks the version holding a record's state from before versioning began,
+// written when such a record first changes.
+const ActionBaseline = "baseline"
+
+// ErrNoVersion is returned when a record did not exist at the requested time.
+var ErrNoVersion = errors.New("no version of the record at that time")
+
+// snapshotsKey is where the versioned records about to be changed are kept between callbacks.
+const snapshotsKey = "audit:snapshots"
+
+// Version keeps every state of the given models: each change also stores a version with the
+// whole record, so earlier states can be retrieved. Call it before handling requests.
+func (r *Recorder) Version(values ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.versioned == nil {
+		r.versioned = make(map[reflect.Type]bool)
+	}
+	for _, value := range values {
+		r.versioned[reflect.Indirect(reflect.ValueOf(value)).Type()] = true
+	}
+}
+
+// isVersioned reports whether changes to the model keep versions.
+func (r *Recorder) isVersioned(s *schema.Schema) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.versioned[s.ModelType]
+}
+
+// loadSnapshots encodes the statement's records with the given primary keys
+// as JSON, keyed by primary key. Associations are left out; they keep their own versions.
+func loadSnapshots(db *gorm.DB, ids []interface{}) (map[string]json.RawMessage, error) {
+	s := db.Statement.Schema
+	pk := s.PrioritizedPrimaryField
+	records := reflect.New(reflect.SliceOf(s.ModelType))
+	err := db.Session(&gorm.Session{NewDB: true}).Table(db.Statement.Table).
+		Clauses(clause.Where{Exprs: []clause.Expression{clause.IN{Column: clause.Column{Name: pk.DBName}, Values: ids}}}).
+		Find(records.Interface()).Error
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make(map[string]json.RawMessage, records.Elem().Len())
+	for i := 0; i < records.Elem().Len(); i++ {
+		record := records.Elem().Index(i)
+		id, _ := pk.ValueOf(db.Statement.Context, record)
+		encoded, err := encodeSnapshot(s, record.Interface())
+		if err != nil {
+			return nil, err
+		}
+		snapshots[fmt.Sprint(id)] = encoded
+	}
+	return snapshots, nil
+}
+
+// encodeSnapshot encodes a record as JSON without its associations.
+func encodeSnapshot(s *schema.Schema, record interface{}) (json.RawMessage, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for _, relationship := range s.Relationships.Relations {
+		name, _, _ := strings.Cut(relationship.Field.Tag.Get("json"), ",")
+		if name == "" {
+			name = relationship.Field.Name
+		}
+		delete(fields, name)
+	}
+	return json.Marshal(fields)
+}
+
+// recordVersions stores a version for each record changed by the statement,
+// from its audit entry. ids are the primary keys the statement touched; baselines holds the
+// records' states before an update or delete, for records that have no versions yet.
+func (r *Recorder) recordVersions(db *gorm.DB, ids []interface{}, entries []models.AuditEntry, baselines map[string]json.RawMessage) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	snapshots, err := loadSnapshots(db, ids)
+	if err != nil {
+		return err
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true})
+	for _, entry := range entries {
+		var latest int
+		err := tx.Model(&models.RecordVersion{}).Where("resource_type = ? AND resource_id = ?", entry.ResourceType, entry.ResourceID).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error
+		if err != nil {
+			return err
+		}
+		versions := []models.RecordVersion{}
+		if baseline, ok := baselines[entry.ResourceID]; ok && latest == 0 {
+			latest++
+			versions = append(versions, models.RecordVersion{
+				ResourceType: entry.ResourceType,
+				ResourceID:   entry.ResourceID,
+				Version:      latest,
+				Action:       ActionBaseline,
+				Snapshot:     baseline,
+				ChangedAt:    entry.Timestamp,
+			})
+		}
+		versions = append(versions, models.RecordVersion{
+			ResourceType: entry.ResourceType,
+			ResourceID:   entry.ResourceID,
+			Version:      latest + 1,
+			Action:       entry.Action,
+			Snapshot:     snapshots[entry.ResourceID], // none once deleted
+			Changes:      entry.Changes,
+			ChangedBy:    entry.Actor,
+			RequestID:    entry.RequestID,
+			ChangedAt:    entry.Timestamp,
+		})
+		if err := tx.Create(&versions).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History retrieves every version of a record, oldest first.
+func History(db *gorm.DB, resourceType string, id uint) ([]models.RecordVersion, error) {
+	versions := []models.RecordVersion{}
+	result := db.Where("resource_type = ? AND resource_id = ?", resourceType, fmt.Sprint(id)).Order("version").Find(&versions)
+	return versions, result.Error
+}
+
+// AsOf retrieves the version of a record that was current at the given time. A record's
+// baseline stands for its state at any time before its first recorded change.
+func AsOf(db *gorm.DB, resourceType string, id uint, at time.Time) (models.RecordVersion, error) {
+	var version models.RecordVersion
+	record := db.Where("resource_type = ? AND resource_id = ?", resourceType, fmt.Sprint(id)).Session(&gorm.Session{})
+	result := record.Where("changed_at <= ?", at.UTC()).Order("version DESC").Limit(1).Find(&version)
+	if result.Error != nil {
+		return models.RecordVersion{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		result = record.Where("action = ?", ActionBaseline).Limit(1).Find(&version)
+		if result.Error != nil {
+			return models.RecordVersion{}, result.Error
+		}
+	}
+	if result.RowsAffected == 0 || version.Snapshot == nil {
+		return models.RecordVersion{}, ErrNoVersion
+	}
+	return version, nil
+}
+
+// ScrubVersions overwrites columns in every stored version of the model's records with the
+// given values, for erasures: snapshots then hold the erased values, and changes to the
+// columns keep no hashes. Versions are rewritten in place rather than versioned again.
+// It returns how many versions were rewritten.
+func ScrubVersions(db *gorm.DB, model interface{}, ids []uint, values map[string]interface{}) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	// Snapshots are keyed by JSON name, changes by column
+	keys := make(map[string]json.RawMessage, len(values))
+	for column, value := range values {
+		field := stmt.Schema.LookUpField(column)
+		if field == nil {
+			return 0, fmt.Errorf("%s has no column %s", stmt.Schema.Table, column)
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return 0, err
+		}
+		keys[name] = encoded
+	}
+
+	resourceIDs := make([]string, len(ids))
+	for i, id := range ids {
+		resourceIDs[i] = fmt.Sprint(id)
+	}
+	var versions []models.RecordVersion
+	err := db.Where("resource_type = ? AND resource_id IN ?", stmt.Schema.Table, resourceIDs).Order("id").Find(&versions).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, version := range versions {
+		snapshot := version.Snapshot
+		if snapshot != nil {
+			fields := map[string]json.RawMessage{}
+			if err := json.Unmarshal(snapshot, &fields); err != nil {
+				return 0, err
+			}
+			for key, value := range keys {
+				if _, ok := fields[key]; ok {
+					fields[key] = value
+				}
+			}
+			if snapshot, err = json.Marshal(fields); err != nil {
+				return 0, err
+			}
+		}
+		for i, change := range version.Changes {
+			if _, ok := values[change.Field]; ok {
+				version.Changes[i].Before, version.Changes[i].After = nil, nil
+			}
+		}
+		var changes interface{} // NULL, as the serializer stores no changes
+		if len(version.Changes) > 0 {
+			encoded, err := json.Marshal(version.Changes)
+			if err != nil {
+				return 0, err
+			}
+			changes = string(encoded)
+		}
+		// Raw SQL: record versions are not themselves versioned or audited
+		err = db.Exec("UPDATE record_versions SET snapshot = ?, changes = ? WHERE id = ?", []byte(snapshot), changes, version.ID).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(versions), nil
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestScrubVersions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditEntry{}, &models.RecordVersion{}, &models.Condition{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	r, err := Register(db, "test")
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	r.Version(&models.Condition{})
+
+	kept := models.Condition{PatientID: 2, Description: "Gout"}
+	erased := models.Condition{PatientID: 1, Description: "Asthma", Status: "active"}
+	for _, c := range []*models.Condition{&kept, &erased} {
+		if err := db.Create(c).Error; err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	db.Model(&erased).Updates(map[string]interface{}{"description": "Severe asthma", "status": "remission"})
+
+	n, err := ScrubVersions(db, &models.Condition{}, []uint{erased.ID}, map[string]interface{}{"description": "[erased]"})
+	if err != nil || n != 2 {
+		t.Fatalf("ScrubVersions = %d, %v; want 2 versions", n, err)
+	}
+
+	history, _ := History(db, "conditions", erased.ID)
+	for _, version := range history {
+		if !strings.Contains(string(version.Snapshot), `"description":"[erased]"`) || !strings.Contains(string(version.Snapshot), `"status":"`) {
+			t.Errorf("version %d = %s, want the description erased and the rest kept", version.Version, version.Snapshot)
+		}
+		for _, change := range version.Changes {
+			if change.Field == "description" && (change.Before != nil || change.After != nil) {
+				t.Errorf("version %d kept the hashes of the description", version.Version)
+			}
+			if change.Field == "status" && change.After == nil {
+				t.Errorf("version %d lost the hash of the status", version.Version)
+			}
+		}
+	}
+	if others, _ := History(db, "conditions", kept.ID); !strings.Contains(string(others[0].Snapshot), "Gout") {
+		t.Errorf("another record's version was scrubbed: %s", others[0].Snapshot)
+	}
+}
@@ -0,0 +1,223 @@
+package consent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/references"
+	"gorm.io/gorm"
+)
+
+// Headers carrying the caller's identity. The API gateway drops them from client requests;
+// services calling each other set them on the Kafka request.
+const (
+	HeaderUserID  = "X-User-Id"
+	HeaderRole    = "X-User-Role"
+	HeaderPurpose = "X-Purpose-Of-Use"
+)
+
+// Decisions.
+const (
+	Permit = "permit"
+	Deny   = "deny"
+)
+
+// Scopes: the parts of a patient's record a consent covers.
+const (
+	ScopeAll          = "*"
+	ScopeDemographics = "demographics" // the patient record, identifiers and emergency contacts
+	ScopeConditions   = "conditions"
+	ScopeExaminations = "examinations"
+	ScopeChart        = "chart"
+)
+
+// Reason codes returned with a denied read.
+const (
+	// ReasonIdentityRequired means the record is restricted and the request carried no identity
+	ReasonIdentityRequired = "IDENTITY_REQUIRED"
+	// ReasonConsentDenied means a deny consent matches the caller
+	ReasonConsentDenied = "CONSENT_DENIED"
+	// ReasonConsentRequired means the record is restricted to permitted grantees and the caller is not one
+	ReasonConsentRequired = "CONSENT_REQUIRED"
+)
+
+// ErrDenied is matched by every *DeniedError.
+var ErrDenied = errors.New("access denied by patient consent")
+
+// DeniedError reports why a read was refused.
+type DeniedError struct {
+	Reason    string `json:"reason"`
+	PatientID uint   `json:"patientId"`
+	Scope     string `json:"scope"`
+	ConsentID uint   `json:"consentId,omitempty"` // the deny consent that matched, if any
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%v: %s (patient %d, scope %s)", ErrDenied, e.Reason, e.PatientID, e.Scope)
+}
+
+// Is lets errors.Is match ErrDenied.
+func (e *DeniedError) Is(target error) bool {
+	return target == ErrDenied
+}
+
+// Identity is the caller a read is made for.
+type Identity struct {
+	UserID  string
+	Role    string
+	Purpose string
+}
+
+// IdentityFromHeaders reads the caller's identity from request headers.
+func IdentityFromHeaders(h http.Header) Identity {
+	return Identity{
+		UserID:  strings.TrimSpace(h.Get(HeaderUserID)),
+		Role:    strings.ToLower(strings.TrimSpace(h.Get(HeaderRole))),
+		Purpose: strings.ToLower(strings.TrimSpace(h.Get(HeaderPurpose))),
+	}
+}
+
+// Anonymous reports whether no identity was given.
+func (id Identity) Anonymous() bool {
+	return id.UserID == "" && id.Role == ""
+}
+
+// IsValidScope reports whether s is a known scope.
+func IsValidScope(s string) bool {
+	return s == ScopeAll || s == ScopeDemographics || s == ScopeConditions || s == ScopeExaminations || s == ScopeChart
+}
+
+// Enforcer checks reads of patient records against the consents in force.
+//
+// A patient without consents in force for a scope is unrestricted. Otherwise the caller must
+// identify themselves; a matching deny consent refuses the read, and when permit consents
+// exist the caller must match one of them.
+type Enforcer struct {
+	DB *gorm.DB
+}
+
+// NewEnforcer creates an enforcer reading consents from db.
+func NewEnforcer(db *gorm.DB) *Enforcer {
+	return &Enforcer{DB: db}
+}
+
+// Check returns a *DeniedError if who may not read the scope of the patient's record.
+// A nil enforcer allows everything.
+func (e *Enforcer) Check(patientID uint, scope string, who Identity) error {
+	if e == nil {
+		return nil
+	}
+	consents, err := e.inForce([]uint{patientID}, scope)
+	if err != nil {
+		return err
+	}
+	return decide(patientID, scope, who, consents)
+}
+
+// CheckExamination checks who against the examinations consents of the patient an
+// examination belongs to, asking the examination service through checker. Records of an
+// examination that no longer exists have no patient to protect and are allowed. When the
+// examination service cannot say whose examination it is, the read fails with
+// references.ErrUnavailable. A nil enforcer allows everything without asking.
+func (e *Enforcer) CheckExamination(checker references.Checker, examinationID uint, who Identity) error {
+	if e == nil {
+		return nil
+	}
+	result, err := references.Lookup(checker, references.Examinations, examinationID)
+	switch {
+	case errors.Is(err, references.ErrNotFound):
+		return nil
+	case err != nil && !errors.Is(err, references.ErrInactive):
+		return err
+	case result.PatientID == 0:
+		// A fallback let the lookup through unchecked
+		return fmt.Errorf("%w: patient of examination %d is unknown", references.ErrUnavailable, examinationID)
+	}
+	return e.Check(result.PatientID, ScopeExaminations, who)
+}
+
+// Refused returns the patients who may not read within scope, for lists to leave out in
+// their query so that pages stay full. Only patients with consents in force are considered.
+// A nil enforcer refuses no one.
+func (e *Enforcer) Refused(scope string, who Identity) ([]uint, error) {
+	if e == nil {
+		return nil, nil
+	}
+	consents, err := e.inForce(nil, scope)
+	if err != nil {
+		return nil, err
+	}
+	byPatient := make(map[uint][]models.Consent)
+	var patientIDs []uint
+	for _, c := range consents {
+		if _, seen := byPatient[c.PatientID]; !seen {
+			patientIDs = append(patientIDs, c.PatientID)
+		}
+		byPatient[c.PatientID] = append(byPatient[c.PatientID], c)
+	}
+	var refused []uint
+	for _, id := range patientIDs {
+		if decide(id, scope, who, byPatient[id]) != nil {
+			refused = append(refused, id)
+		}
+	}
+	return refused, nil
+}
+
+// inForce loads the unrevoked, currently valid consents covering scope,
+// for the given patients or, when patientIDs is nil, for every patient.
+func (e *Enforcer) inForce(patientIDs []uint, scope string) ([]models.Consent, error) {
+	now := time.Now()
+	db := e.DB.Where("scope IN ? AND revoked_at IS NULL", []string{scope, ScopeAll}).
+		Where("valid_from <= ? AND (valid_until IS NULL OR valid_until > ?)", now, now)
+	if patientIDs != nil {
+		db = db.Where("patient_id IN ?", patientIDs)
+	}
+	var consents []models.Consent
+	err := db.Order("id").Find(&consents).Error
+	return consents, err
+}
+
+// decide applies a patient's consents in force to a caller.
+func decide(patientID uint, scope string, who Identity, consents []models.Consent) error {
+	if len(consents) == 0 {
+		return nil
+	}
+	if who.Anonymous() {
+		return &DeniedError{Reason: ReasonIdentityRequired, PatientID: patientID, Scope: scope}
+	}
+
+	restricted, permitted := false, false
+	for _, c := range consents {
+		applies := matchesGrantee(c.Grantee, who) && (c.Purpose == "" || strings.EqualFold(c.Purpose, who.Purpose))
+		switch c.Decision {
+		case Deny:
+			if applies {
+				return &DeniedError{Reason: ReasonConsentDenied, PatientID: patientID, Scope: scope, ConsentID: c.ID}
+			}
+		case Permit:
+			restricted = true
+			permitted = permitted || applies
+		}
+	}
+	if restricted && !permitted {
+		return &DeniedError{Reason: ReasonConsentRequired, PatientID: patientID, Scope: scope}
+	}
+	return nil
+}
+
+// matchesGrantee reports whether a consent's grantee covers the caller.
+func matchesGrantee(grantee string, who Identity) bool {
+	switch {
+	case grantee == "*":
+		return true
+	case strings.HasPrefix(grantee, "role:"):
+		return who.Role != "" && strings.EqualFold(strings.TrimPrefix(grantee, "role:"), who.Role)
+	default:
+		return who.UserID != "" && grantee == who.UserID
+	}
+}
@@ -0,0 +1,189 @@
+package consent
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/models"
+	"github.com/fitnis/shared/references"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// examinations is a fake references.Checker answering for examinations from a map; 99 is unavailable.
+type examinations map[uint]references.Result
+
+func (e examinations) Check(service string, id uint) (references.Result, error) {
+	result, ok := e[id]
+	switch {
+	case !ok:
+		return references.Result{}, references.ErrNotFound
+	case id == 99:
+		return references.Result{}, references.ErrUnavailable
+	case !result.Active && result.Exists:
+		return result, references.ErrInactive
+	}
+	return result, nil
+}
+
+var (
+	doctor     = Identity{UserID: "dr-house", Role: "physician", Purpose: "treatment"}
+	researcher = Identity{UserID: "r-1", Role: "researcher", Purpose: "research"}
+	nurse      = Identity{UserID: "n-1", Role: "nurse", Purpose: "treatment"}
+)
+
+func TestDecide(t *testing.T) {
+	permit := func(grantee, purpose string) models.Consent {
+		return models.Consent{ID: 1, Decision: Permit, Grantee: grantee, Purpose: purpose}
+	}
+	deny := func(grantee, purpose string) models.Consent {
+		return models.Consent{ID: 2, Decision: Deny, Grantee: grantee, Purpose: purpose}
+	}
+	tests := []struct {
+		name       string
+		consents   []models.Consent
+		who        Identity
+		wantReason string // "" when the read is allowed
+	}{
+		{"no consents allows anyone", nil, Identity{}, ""},
+		{"restricted record needs an identity", []models.Consent{permit("*", "")}, Identity{}, ReasonIdentityRequired},
+		{"permit by role", []models.Consent{permit("role:physician", "")}, doctor, ""},
+		{"permit by role is case-insensitive", []models.Consent{permit("role:Physician", "")}, doctor, ""},
+		{"not a permitted grantee", []models.Consent{permit("role:physician", "")}, nurse, ReasonConsentRequired},
+		{"permit by user", []models.Consent{permit("n-1", "")}, nurse, ""},
+		{"permit limited to a purpose", []models.Consent{permit("*", "treatment")}, researcher, ReasonConsentRequired},
+		{"deny wins over permit", []models.Consent{permit("*", ""), deny("role:researcher", "")}, researcher, ReasonConsentDenied},
+		{"deny for another purpose does not apply", []models.Consent{deny("*", "research")}, doctor, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decide(7, ScopeExaminations, tt.who, tt.consents)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("got %v, want the read allowed", err)
+				}
+				return
+			}
+			var denied *DeniedError
+			if !errors.As(err, &denied) || !errors.Is(err, ErrDenied) {
+				t.Fatalf("got %v, want a *DeniedError", err)
+			}
+			if denied.Reason != tt.wantReason || denied.PatientID != 7 {
+				t.Errorf("got %+v, want reason %s for patient 7", denied, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestEnforcerConsentsInForce(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Consent{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	for _, c := range []models.Consent{
+		// Patient 1 refuses researchers everything
+		{PatientID: 1, Decision: Deny, Scope: ScopeAll, Grantee: "role:researcher", ValidFrom: past},
+		// Patient 2's examinations are for physicians only
+		{PatientID: 2, Decision: Permit, Scope: ScopeExaminations, Grantee: "role:physician", ValidFrom: past},
+		// Patient 3's restrictions are revoked, expired, not yet valid or for another scope
+		{PatientID: 3, Decision: Deny, Scope: ScopeAll, Grantee: "*", ValidFrom: past, RevokedAt: &now},
+		{PatientID: 3, Decision: Deny, Scope: ScopeAll, Grantee: "*", ValidFrom: past.Add(-time.Hour), ValidUntil: &past},
+		{PatientID: 3, Decision: Deny, Scope: ScopeAll, Grantee: "*", ValidFrom: future},
+		{PatientID: 3, Decision: Deny, Scope: ScopeChart, Grantee: "*", ValidFrom: past},
+	} {
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatalf("create consent: %v", err)
+		}
+	}
+	enforcer := NewEnforcer(db)
+
+	tests := []struct {
+		who  Identity
+		want []uint
+	}{
+		{doctor, nil},
+		{researcher, []uint{1, 2}},
+		{nurse, []uint{2}},
+		{Identity{}, []uint{1, 2}},
+	}
+	for _, tt := range tests {
+		refused, err := enforcer.Refused(ScopeExaminations, tt.who)
+		if err != nil {
+			t.Fatalf("Refused: %v", err)
+		}
+		if len(refused) != len(tt.want) || (len(refused) > 0 && !reflect.DeepEqual(refused, tt.want)) {
+			t.Errorf("Refused(%+v) = %v, want %v", tt.who, refused, tt.want)
+		}
+		for _, patientID := range []uint{1, 2, 3} {
+			err := enforcer.Check(patientID, ScopeExaminations, tt.who)
+			wantDenied := false
+			for _, id := range tt.want {
+				wantDenied = wantDenied || id == patientID
+			}
+			if (err != nil) != wantDenied {
+				t.Errorf("Check(%d, %+v) = %v, want denied %v", patientID, tt.who, err, wantDenied)
+			}
+		}
+	}
+
+	var nilEnforcer *Enforcer
+	if err := nilEnforcer.Check(1, ScopeExaminations, researcher); err != nil {
+		t.Errorf("nil enforcer Check = %v, want nil", err)
+	}
+}
+
+func TestCheckExamination(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Consent{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Patient 2's examinations are for physicians only
+	db.Create(&models.Consent{PatientID: 2, Decision: Permit, Scope: ScopeExaminations, Grantee: "role:physician", ValidFrom: time.Now().Add(-time.Hour)})
+	enforcer := NewEnforcer(db)
+	checker := examinations{
+		1:  {Exists: true, Active: true, PatientID: 2},
+		2:  {Exists: true, Reason: "examination deleted", PatientID: 2},
+		3:  {Exists: true, Active: true, PatientID: 3},
+		4:  {Exists: true, Active: true}, // let through unchecked by a fallback
+		99: {},
+	}
+
+	tests := []struct {
+		name          string
+		examinationID uint
+		who           Identity
+		wantErr       error
+	}{
+		{"permitted caller", 1, doctor, nil},
+		{"refused caller", 1, nurse, ErrDenied},
+		{"deleted examinations still protect their patient", 2, nurse, ErrDenied},
+		{"unrestricted patient", 3, nurse, nil},
+		{"examination that does not exist", 5, nurse, nil},
+		{"patient unknown", 4, doctor, references.ErrUnavailable},
+		{"examination service unavailable", 99, doctor, references.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := enforcer.CheckExamination(checker, tt.examinationID, tt.who)
+			if (tt.wantErr == nil && err != nil) || !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	var nilEnforcer *Enforcer
+	if err := nilEnforcer.CheckExamination(nil, 1, nurse); err != nil {
+		t.Errorf("nil enforcer CheckExamination = %v, want nil", err)
+	}
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"log"
 
+	"github.com/fitnis/shared/etag"
 	"github.com/fitnis/shared/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -23,15 +24,44 @@ func InitDB() {
 	log.Println("Running database migrations...")
 	err = DB.AutoMigrate(
 		&models.Patient{},
+		&models.PatientIdentifier{},
+		&models.PatientMerge{},
+		&models.EmergencyContact{},
+		&models.Allergy{},
+		&models.Condition{},
+		&models.Consent{},
+		&models.RetentionHold{},
+		&models.PatientErasure{},
 		&models.Examination{},
 		&models.Sample{},
 		&models.Prescription{},
 		&models.Referral{},
+		&models.ReferralStatusChange{},
+		&models.FormularyItem{},
+		&models.DispenseEvent{},
+		&models.Practitioner{},
+		&models.PractitionerSpecialty{},
+		&models.PractitionerAvailability{},
+		&models.AppointmentSlot{},
+		&models.Appointment{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.Admission{},
+		&models.AdmissionTransfer{},
+		&models.ChartNote{},
+		&models.AuditEntry{},
+		&models.RecordVersion{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
 	log.Println("Database migration completed.")
+
+	// Raise record versions on every update, for ETags
+	if err := etag.Register(DB); err != nil {
+		log.Fatalf("Failed to register version callbacks: %v", err)
+	}
+
 	log.Println("Database connection established.")
 }
@@ -0,0 +1,360 @@
+// Package deletion soft-deletes clinical records across services. Deleting a record applies a
+// rule to each dataset holding records that reference it: block the delete while such records
+// remain, soft-delete them along with it, or leave them as orphans. Records deleted along with
+// another carry its deletion time, which is how restoring it finds them again. Soft-deleted
+// records are purged once the retention period has passed, unless their patient is under a
+// retention hold covering them.
+package deletion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/fitnis/shared/audit"
+	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/models"
+	"gorm.io/gorm"
+)
+
+// Paths served by every service holding records that reference records of another
+const (
+	CheckPath   = "/deletion/check"
+	DeletePath  = "/deletion/delete"
+	RestorePath = "/deletion/restore"
+)
+
+// Datasets, each named after the service that owns it
+const (
+	Patients      = "patients"
+	Examinations  = "examinations"
+	Samples       = "samples"
+	Prescriptions = "prescriptions"
+	Referrals     = "referrals"
+	Orders        = "orders"
+	Appointments  = "appointments"
+	ChartNotes    = "records" // held by the records service
+	Practitioners = "practitioners"
+)
+
+// What deleting a record does to the records referencing it
+const (
+	Block   = "block"   // the delete is refused while any remain
+	Cascade = "cascade" // they are soft-deleted along with it
+	Orphan  = "orphan"  // they are kept, pointing at the deleted record
+)
+
+// Retention defaults, overridden by SOFT_DELETE_RETENTION and PURGE_INTERVAL
+const (
+	DefaultRetention     = 90 * 24 * time.Hour
+	DefaultPurgeInterval = 24 * time.Hour
+)
+
+var (
+	// ErrBlocked means records still reference the record being deleted
+	ErrBlocked = errors.New("record is still referenced")
+	// ErrUnknownParent is returned for a request naming a dataset the service's records do not reference
+	ErrUnknownParent = errors.New("records do not reference that dataset")
+	// ErrNotDeleted is returned when restoring a record that was not deleted
+	ErrNotDeleted = errors.New("record is not deleted")
+	// ErrUnavailable means a service holding referencing records could not be reached
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// Rule says what deleting a record of the parent dataset does to the dependent dataset's records
+type Rule struct {
+	Parent    string `json:"parent"`
+	Dependent string `json:"dependent"`
+	Action    string `json:"action"` // Block, Cascade or Orphan
+}
+
+// DefaultRules apply unless a service is configured otherwise
+var DefaultRules = []Rule{
+	{Parent: Patients, Dependent: Examinations, Action: Cascade},
+	{Parent: Patients, Dependent: Appointments, Action: Cascade},
+	{Parent: Patients, Dependent: ChartNotes, Action: Cascade},
+	// Samples mean nothing without their examination
+	{Parent: Examinations, Dependent: Samples, Action: Cascade},
+	// Prescriptions are legal records; they must be deleted on their own first
+	{Parent: Examinations, Dependent: Prescriptions, Action: Block},
+	// A referral may already be with the receiving provider
+	{Parent: Examinations, Dependent: Referrals, Action: Orphan},
+	// Orders mean nothing without their examination either
+	{Parent: Examinations, Dependent: Orders, Action: Cascade},
+	// A note belongs to the patient's chart; it may outlive the examination it was written for
+	{Parent: Examinations, Dependent: ChartNotes, Action: Orphan},
+	// Appointments, orders and notes keep naming the practitioner who made them
+	{Parent: Practitioners, Dependent: Appointments, Action: Orphan},
+	{Parent: Practitioners, Dependent: Orders, Action: Orphan},
+	{Parent: Practitioners, Dependent: ChartNotes, Action: Orphan},
+}
+
+// Request names the parent records whose dependents a service checks, deletes or restores
+type Request struct {
+	Parent    string    `json:"parent"`
+	ParentIDs []uint    `json:"parentIds"`
+	DeletedAt time.Time `json:"deletedAt"` // deletion time of the parents; unused by checks
+}
+
+// Result is a service's reply: how many dependents it holds, deleted or restored
+type Result struct {
+	Count int `json:"count"`
+}
+
+// Client checks, deletes and restores dependents held by other services
+type Client interface {
+	Check(service string, req Request) (int, error)
+	Delete(service string, req Request) (int, error)
+	Restore(service string, req Request) (int, error)
+}
+
+// KafkaClient reaches the services holding dependents over Kafka
+type KafkaClient struct {
+	Timeout time.Duration
+}
+
+// NewKafkaClient creates a client with a default timeout
+func NewKafkaClient() *KafkaClient {
+	return &KafkaClient{Timeout: 30 * time.Second}
+}
+
+// Check counts the service's live records referencing the parents. It fails with ErrBlocked
+// when the service would refuse to delete them.
+func (k *KafkaClient) Check(service string, req Request) (int, error) {
+	return k.send(service, CheckPath, req)
+}
+
+// Delete soft-deletes the service's records referencing the parents and returns how many it deleted
+func (k *KafkaClient) Delete(service string, req Request) (int, error) {
+	return k.send(service, DeletePath, req)
+}
+
+// Restore brings back the service's records deleted along with the parents
+func (k *KafkaClient) Restore(service string, req Request) (int, error) {
+	return k.send(service, RestorePath, req)
+}
+
+// send posts a deletion request to a service and returns the count it reports.
+func (k *KafkaClient) send(service, path string, req Request) (int, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := kafka.SendRequest(service, kafka.KafkaRequest{
+		Method:  "POST",
+		Path:    path,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    body,
+	}, k.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrUnavailable, service, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		var reply struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(resp.Body, &reply)
+		return 0, fmt.Errorf("%w: %s: %s", ErrBlocked, service, reply.Error)
+	case resp.StatusCode != http.StatusOK:
+		return 0, fmt.Errorf("%w: %s returned status %d: %s", ErrUnavailable, service, resp.StatusCode, resp.Body)
+	}
+	var result Result
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrUnavailable, service, err)
+	}
+	return result.Count, nil
+}
+
+// Cascader applies the rules for deleting records of one dataset to their dependents
+type Cascader struct {
+	Dataset string
+	Rules   []Rule
+	Client  Client
+}
+
+// NewCascader creates a cascader for the dataset with the default rules
+func NewCascader(dataset string, client Client) *Cascader {
+	return &Cascader{Dataset: dataset, Rules: DefaultRules, Client: client}
+}
+
+// Check fails with ErrBlocked when the records may not be deleted: a blocking dataset still
+// references them, or a cascading one refuses to delete its own records.
+func (c *Cascader) Check(ids []uint) error {
+	req := Request{Parent: c.Dataset, ParentIDs: ids}
+	for _, rule := range c.rules() {
+		if rule.Action == Orphan {
+			continue
+		}
+		if c.Client == nil {
+			return fmt.Errorf("%w: no deletion client configured", ErrUnavailable)
+		}
+		count, err := c.Client.Check(rule.Dependent, req)
+		if err != nil {
+			return err
+		}
+		if rule.Action == Block && count > 0 {
+			return fmt.Errorf("%w: %d %s must be deleted first", ErrBlocked, count, rule.Dependent)
+		}
+	}
+	return nil
+}
+
+// Delete soft-deletes the cascading dependents of the records, stamped with the records' deletion
+// time. When a dataset fails, the ones already deleted are restored before the error is returned.
+func (c *Cascader) Delete(ids []uint, at time.Time) error {
+	req := Request{Parent: c.Dataset, ParentIDs: ids, DeletedAt: at}
+	var deleted []string
+	for _, rule := range c.rules() {
+		if rule.Action != Cascade {
+			continue
+		}
+		if c.Client == nil {
+			return fmt.Errorf("%w: no deletion client configured", ErrUnavailable)
+		}
+		if _, err := c.Client.Delete(rule.Dependent, req); err != nil {
+			for _, dataset := range deleted {
+				if _, undoErr := c.Client.Restore(dataset, req); undoErr != nil {
+					log.Printf("Failed to restore %s after a failed delete: %v", dataset, undoErr)
+				}
+			}
+			return err
+		}
+		deleted = append(deleted, rule.Dependent)
+	}
+	return nil
+}
+
+// Restore brings back the dependents deleted along with the records at the given time.
+func (c *Cascader) Restore(ids []uint, at time.Time) error {
+	req := Request{Parent: c.Dataset, ParentIDs: ids, DeletedAt: at}
+	for _, rule := range c.rules() {
+		if rule.Action != Cascade {
+			continue
+		}
+		if c.Client == nil {
+			return fmt.Errorf("%w: no deletion client configured", ErrUnavailable)
+		}
+		if _, err := c.Client.Restore(rule.Dependent, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rules returns the rules for deleting records of the cascader's dataset.
+func (c *Cascader) rules() []Rule {
+	var rules []Rule
+	for _, rule := range c.Rules {
+		if rule.Parent == c.Dataset {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// Stamp returns a deletion time that is stored and sent as JSON without losing precision, so
+// that records deleted together can be matched on it.
+func Stamp() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// At returns a session whose soft deletes are stamped with the given time.
+func At(db *gorm.DB, at time.Time) *gorm.DB {
+	return db.Session(&gorm.Session{NowFunc: func() time.Time { return at }})
+}
+
+// CountLive counts the live records of model whose column references one of the ids.
+func CountLive(db *gorm.DB, model interface{}, column string, ids []uint) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	var count int64
+	err := db.Model(model).Where(column+" IN ?", ids).Count(&count).Error
+	return int(count), err
+}
+
+// SoftDelete deletes the live records of model whose column references one of the ids,
+// stamped with the given time, and returns how many it deleted.
+func SoftDelete(db *gorm.DB, model interface{}, column string, ids []uint, at time.Time) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := At(db, at).Where(column+" IN ?", ids).Delete(model)
+	return int(result.RowsAffected), result.Error
+}
+
+// Restore brings back the records of model whose column references one of the ids and that
+// were deleted at the given time, and returns how many it restored.
+func Restore(db *gorm.DB, model interface{}, column string, ids []uint, at time.Time) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := db.Unscoped().Model(model).Where(column+" IN ? AND deleted_at = ?", ids, at).Update("deleted_at", nil)
+	return int(result.RowsAffected), result.Error
+}
+
+// Purge permanently deletes the records of model soft-deleted before the cutoff, except those
+// whose column holds an ID returned by the held subquery; see HeldPatients and HeldExaminations.
+// The deletes are audited as the purge job's.
+func Purge(db *gorm.DB, cutoff time.Time, model interface{}, column string, held *gorm.DB) (int, error) {
+	result := audit.System(db, PurgeJob).Unscoped().Where("deleted_at < ? AND "+column+" NOT IN (?)", cutoff, held).Delete(model)
+	return int(result.RowsAffected), result.Error
+}
+
+// HeldPatients returns a subquery of the patients with a retention hold in force on the scope,
+// a dataset name, or on everything. Purges must keep their records.
+func HeldPatients(db *gorm.DB, scope string) *gorm.DB {
+	return db.Model(&models.RetentionHold{}).Select("patient_id").
+		Where("scope IN ? AND released_at IS NULL AND (until IS NULL OR until > ?)", []string{"*", scope}, time.Now())
+}
+
+// HeldExaminations returns a subquery of the examinations, deleted or not, of the patients with a
+// retention hold in force on the scope, for purging records that belong to a patient through an examination.
+func HeldExaminations(db *gorm.DB, scope string) *gorm.DB {
+	return db.Unscoped().Model(&models.Examination{}).Select("id").Where("patient_id IN (?)", HeldPatients(db, scope))
+}
+
+// PurgeJob names the purge in the audit log; its deletes are made by the actor "system:purge".
+const PurgeJob = "purge"
+
+// StartPurge calls purge in the background every interval, with the cutoff for records
+// soft-deleted longer than the retention period.
+func StartPurge(retention, interval time.Duration, purge func(cutoff time.Time) (int, error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := purge(time.Now().Add(-retention)); err != nil {
+				log.Printf("Failed to purge deleted records: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d deleted records", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RetentionFromEnv reads the retention period and purge interval, such as "2160h", from
+// SOFT_DELETE_RETENTION and PURGE_INTERVAL, falling back to the defaults.
+func RetentionFromEnv() (retention, interval time.Duration) {
+	return durationEnv("SOFT_DELETE_RETENTION", DefaultRetention), durationEnv("PURGE_INTERVAL", DefaultPurgeInterval)
+}
+
+// durationEnv reads a positive duration from the environment.
+func durationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,117 @@
+package deletion
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeClient records the calls a Cascader makes and answers from its fields.
+type fakeClient struct {
+	counts   map[string]int   // Check replies by service
+	failures map[string]error // Delete failures by service
+	calls    []string         // "delete samples", "restore samples", ...
+}
+
+func (f *fakeClient) Check(service string, req Request) (int, error) {
+	f.calls = append(f.calls, "check "+service)
+	return f.counts[service], nil
+}
+
+func (f *fakeClient) Delete(service string, req Request) (int, error) {
+	f.calls = append(f.calls, "delete "+service)
+	return 0, f.failures[service]
+}
+
+func (f *fakeClient) Restore(service string, req Request) (int, error) {
+	f.calls = append(f.calls, "restore "+service)
+	return 0, nil
+}
+
+func TestCascaderCheckBlocks(t *testing.T) {
+	client := &fakeClient{counts: map[string]int{Samples: 2, Prescriptions: 1}}
+	cascader := NewCascader(Examinations, client)
+
+	err := cascader.Check([]uint{1})
+	if !errors.Is(err, ErrBlocked) {
+		t.Fatalf("got %v, want ErrBlocked for the remaining prescription", err)
+	}
+	// Orphaned referrals are never asked about
+	want := []string{"check samples", "check prescriptions"}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+
+	client.counts[Prescriptions] = 0
+	if err := cascader.Check([]uint{1}); err != nil {
+		t.Errorf("without prescriptions: %v", err)
+	}
+}
+
+func TestCascaderDeleteRollsBack(t *testing.T) {
+	failure := errors.New("unreachable")
+	client := &fakeClient{failures: map[string]error{"notes": failure}}
+	cascader := &Cascader{
+		Dataset: Patients,
+		Rules: []Rule{
+			{Parent: Patients, Dependent: Examinations, Action: Cascade},
+			{Parent: Patients, Dependent: "notes", Action: Cascade},
+			{Parent: Examinations, Dependent: Samples, Action: Cascade},
+		},
+		Client: client,
+	}
+
+	if err := cascader.Delete([]uint{1}, Stamp()); !errors.Is(err, failure) {
+		t.Fatalf("got %v, want the failure of the second dataset", err)
+	}
+	want := []string{"delete examinations", "delete notes", "restore examinations"}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+}
+
+func TestCascaderWithoutClient(t *testing.T) {
+	cascader := NewCascader(Examinations, nil)
+	if err := cascader.Delete([]uint{1}, Stamp()); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("got %v, want ErrUnavailable", err)
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Sample{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, examinationID := range []uint{1, 1, 2} {
+		db.Create(&models.Sample{ExaminationID: examinationID})
+	}
+	// A sample deleted earlier on its own must stay deleted when examination 1 is restored
+	var earlier models.Sample
+	db.Create(&models.Sample{ExaminationID: 1})
+	db.Last(&earlier)
+	SoftDelete(db, &models.Sample{}, "id", []uint{earlier.ID}, Stamp().Add(-time.Hour))
+
+	at := Stamp()
+	if n, err := SoftDelete(db, &models.Sample{}, "examination_id", []uint{1}, at); err != nil || n != 2 {
+		t.Fatalf("SoftDelete = %d, %v; want 2", n, err)
+	}
+	if n, _ := CountLive(db, &models.Sample{}, "examination_id", []uint{1, 2}); n != 1 {
+		t.Errorf("CountLive after delete = %d, want 1", n)
+	}
+
+	if n, err := Restore(db, &models.Sample{}, "examination_id", []uint{1}, at); err != nil || n != 2 {
+		t.Fatalf("Restore = %d, %v; want 2", n, err)
+	}
+	if n, _ := CountLive(db, &models.Sample{}, "examination_id", []uint{1}); n != 2 {
+		t.Errorf("CountLive after restore = %d, want 2", n)
+	}
+}
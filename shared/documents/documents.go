@@ -0,0 +1,208 @@
+package documents
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"embed"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/fitnis/shared/consent"
+)
+
+// Document kinds with bundled templates.
+const (
+	KindPrescription = "prescription"
+	KindReferral     = "referral"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// developmentSigningKey signs documents when DOCUMENT_SIGNING_DEV is set instead of a key.
+const developmentSigningKey = "fitnis-development-signing-key"
+
+// ErrNoSigningKey is returned when neither a signing key nor development signing is configured.
+var ErrNoSigningKey = errors.New("DOCUMENT_SIGNING_KEY is not set; set DOCUMENT_SIGNING_DEV=true to use the development key")
+
+// Signed is the part of a record a verification code covers: who a document is for, what it
+// orders, who issued it and when. Other changes, such as a prescription being sent, leave
+// printed documents valid.
+type Signed struct {
+	PatientID uint
+	Subject   string // what is ordered: the medication, or the specialist referred to
+	Details   string // how: the dosage, or the reason for the referral
+	Issuer    string // the prescriber, or the referring practitioner
+	IssuedAt  time.Time
+}
+
+// Context is what a document template is executed with.
+type Context struct {
+	Issuer           string
+	GeneratedAt      time.Time
+	VerificationCode string
+	Data             any // the record being printed, e.g. a prescription with its examination and patient
+}
+
+// Generator renders printable documents from text templates.
+//
+// Templates are plain text; each output line is laid out according to its prefix:
+// "# " heading, "## " section title, "---" horizontal rule, "@code " monospaced, anything else body text.
+type Generator struct {
+	TemplateDir string // Optional: <kind>.tmpl files here replace the bundled templates
+	SigningKey  []byte
+	Issuer      string
+
+	// Consent is checked before a document is rendered; documents are part of the patient's
+	// examinations. Nil allows every read.
+	Consent *consent.Enforcer
+}
+
+// NewGeneratorFromEnv creates a Generator configured from DOCUMENT_TEMPLATE_DIR,
+// DOCUMENT_SIGNING_KEY and DOCUMENT_ISSUER. Without a signing key it fails with ErrNoSigningKey,
+// unless DOCUMENT_SIGNING_DEV=true allows the development key, which anyone can read here.
+func NewGeneratorFromEnv() (*Generator, error) {
+	key := os.Getenv("DOCUMENT_SIGNING_KEY")
+	if key == "" {
+		if os.Getenv("DOCUMENT_SIGNING_DEV") != "true" {
+			return nil, ErrNoSigningKey
+		}
+		log.Println("DOCUMENT_SIGNING_KEY not set, using the development signing key")
+		key = developmentSigningKey
+	}
+	issuer := os.Getenv("DOCUMENT_ISSUER")
+	if issuer == "" {
+		issuer = "Fitnis Clinic"
+	}
+	return &Generator{
+		TemplateDir: os.Getenv("DOCUMENT_TEMPLATE_DIR"),
+		SigningKey:  []byte(key),
+		Issuer:      issuer,
+	}, nil
+}
+
+// Generate renders the document of the given kind for a record and returns the PDF bytes
+// together with the verification code printed on it, which covers signed. It fails with a
+// *consent.DeniedError when the patient's consents refuse who, and with ErrUnsupportedText when
+// the record has text the document fonts cannot show.
+func (g *Generator) Generate(kind string, id uint, data any, signed Signed, who consent.Identity) ([]byte, string, error) {
+	if err := g.Consent.Check(signed.PatientID, consent.ScopeExaminations, who); err != nil {
+		return nil, "", err
+	}
+
+	tmpl, err := g.loadTemplate(kind)
+	if err != nil {
+		return nil, "", err
+	}
+
+	code := g.VerificationCode(kind, id, signed)
+
+	var out bytes.Buffer
+	ctx := Context{Issuer: g.Issuer, GeneratedAt: time.Now(), VerificationCode: code, Data: data}
+	if err := tmpl.Execute(&out, ctx); err != nil {
+		return nil, "", fmt.Errorf("failed to render %s template: %w", kind, err)
+	}
+
+	pdf := NewPDF(fmt.Sprintf("%s %d", kind, id))
+	for _, line := range strings.Split(out.String(), "\n") {
+		line = strings.TrimRight(line, " \r")
+		switch {
+		case strings.HasPrefix(line, "# "):
+			pdf.Heading(strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, "## "):
+			pdf.Subheading(strings.TrimPrefix(line, "## "))
+		case line == "---":
+			pdf.Rule()
+		case strings.HasPrefix(line, "@code "):
+			pdf.Code(strings.TrimPrefix(line, "@code "))
+		case line == "":
+			pdf.Space(6)
+		default:
+			pdf.Text(line)
+		}
+	}
+	content, err := pdf.Bytes()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to render %s %d: %w", kind, id, err)
+	}
+	return content, code, nil
+}
+
+// VerificationCode derives the code printed on a document. It is an HMAC over the record's
+// kind, ID and signed fields, so it only verifies while those are unchanged since the document
+// was issued.
+func (g *Generator) VerificationCode(kind string, id uint, signed Signed) string {
+	mac := hmac.New(sha256.New, g.SigningKey)
+	// Strings are quoted so that no field can run into the next
+	fmt.Fprintf(mac, "%s:%d:%d:%q:%q:%q:%s", kind, id, signed.PatientID, signed.Subject, signed.Details,
+		signed.Issuer, signed.IssuedAt.UTC().Format(time.RFC3339))
+	sum := base32.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	// 16 characters in groups of four, e.g. ABCD-EFGH-IJKL-MNOP
+	return sum[0:4] + "-" + sum[4:8] + "-" + sum[8:12] + "-" + sum[12:16]
+}
+
+// Verify reports whether a code matches the current signed fields of a record.
+func (g *Generator) Verify(kind string, id uint, signed Signed, code string) bool {
+	expected := g.VerificationCode(kind, id, signed)
+	return hmac.Equal([]byte(expected), []byte(strings.ToUpper(strings.TrimSpace(code))))
+}
+
+func (g *Generator) loadTemplate(kind string) (*template.Template, error) {
+	name := kind + ".tmpl"
+	funcs := template.FuncMap{
+		"date":    formatDate,
+		"default": defaultString,
+	}
+
+	if g.TemplateDir != "" {
+		path := filepath.Join(g.TemplateDir, name)
+		if _, err := os.Stat(path); err == nil {
+			tmpl, err := template.New(name).Funcs(funcs).ParseFiles(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+			}
+			return tmpl, nil
+		}
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).ParseFS(defaultTemplates, "templates/"+name)
+	if err != nil {
+		return nil, fmt.Errorf("no template for document kind %q: %w", kind, err)
+	}
+	return tmpl, nil
+}
+
+// formatDate renders time.Time and *time.Time values, with "-" for missing dates.
+func formatDate(v any) string {
+	switch t := v.(type) {
+	case time.Time:
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02")
+	case *time.Time:
+		if t == nil || t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02")
+	default:
+		return "-"
+	}
+}
+
+// defaultString returns value, or fallback when value is blank.
+func defaultString(fallback, value string) string {
+	if strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return value
+}
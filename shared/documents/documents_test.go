@@ -0,0 +1,94 @@
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/consent"
+	"github.com/fitnis/shared/models"
+)
+
+var signed = Signed{
+	PatientID: 7,
+	Subject:   "Cardiology",
+	Details:   "Chest pain on exertion",
+	Issuer:    "Dr. Grey",
+	IssuedAt:  time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC),
+}
+
+func TestVerify(t *testing.T) {
+	g := &Generator{SigningKey: []byte("test-key")}
+	code := g.VerificationCode(KindReferral, 3, signed)
+
+	changed := func(change func(*Signed)) Signed {
+		s := signed
+		change(&s)
+		return s
+	}
+	tests := []struct {
+		name   string
+		g      *Generator
+		kind   string
+		id     uint
+		signed Signed
+		code   string
+		want   bool
+	}{
+		{"unchanged", g, KindReferral, 3, signed, code, true},
+		{"lower case with spaces", g, KindReferral, 3, signed, " " + strings.ToLower(code) + "\n", true},
+		{"same time in another zone", g, KindReferral, 3, changed(func(s *Signed) { s.IssuedAt = s.IssuedAt.In(time.FixedZone("CET", 3600)) }), code, true},
+		{"another kind", g, KindPrescription, 3, signed, code, false},
+		{"another record", g, KindReferral, 4, signed, code, false},
+		{"another patient", g, KindReferral, 3, changed(func(s *Signed) { s.PatientID = 8 }), code, false},
+		{"edited details", g, KindReferral, 3, changed(func(s *Signed) { s.Details = "Chest pain" }), code, false},
+		{"fields run together", g, KindReferral, 3, changed(func(s *Signed) { s.Subject, s.Details = "Cardiology:Chest", "pain on exertion" }), code, false},
+		{"another key", &Generator{SigningKey: []byte("other-key")}, KindReferral, 3, signed, code, false},
+		{"empty code", g, KindReferral, 3, signed, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.g.Verify(tt.kind, tt.id, tt.signed, tt.code); got != tt.want {
+				t.Errorf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testReferral(reason string) models.Referral {
+	return models.Referral{
+		ID:          3,
+		Specialist:  "Cardiology",
+		Reason:      reason,
+		ReferredBy:  "Dr. Grey",
+		Examination: models.Examination{ID: 5, Patient: models.Patient{ID: 7, FirstName: "Zoë", LastName: "O’Brien"}},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	g := &Generator{SigningKey: []byte("test-key"), Issuer: "Test Clinic"}
+
+	pdf, code, err := g.Generate(KindReferral, 3, testReferral("Chest pain – 2 weeks"), signed, consent.Identity{})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if !g.Verify(KindReferral, 3, signed, code) {
+		t.Errorf("returned code %s does not verify", code)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.Contains(pdf, []byte("("+code+")")) {
+		t.Error("document is not a PDF showing the verification code")
+	}
+	// Latin-1 and WinAnsi punctuation are written in the fonts' encoding
+	for _, text := range []string{"Zo\xeb O\x92Brien", "Chest pain \x96 2 weeks"} {
+		if !bytes.Contains(pdf, []byte(text)) {
+			t.Errorf("document does not contain %q", text)
+		}
+	}
+
+	_, _, err = g.Generate(KindReferral, 3, testReferral("Боль в груди"), signed, consent.Identity{})
+	if !errors.Is(err, ErrUnsupportedText) {
+		t.Errorf("Cyrillic reason: got %v, want ErrUnsupportedText", err)
+	}
+}
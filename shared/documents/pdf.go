@@ -0,0 +1,227 @@
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Page geometry in PDF points (A4).
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	marginLeft   = 56
+	marginTop    = 64
+	marginBottom = 64
+)
+
+// Font resources used by the generated documents.
+const (
+	fontRegular = "F1" // Helvetica
+	fontBold    = "F2" // Helvetica-Bold
+	fontMono    = "F3" // Courier-Bold, used for the verification code
+)
+
+// ErrUnsupportedText is returned for text the standard fonts cannot show, such as Cyrillic or
+// CJK characters: those documents are refused rather than printed with characters missing.
+var ErrUnsupportedText = errors.New("text contains characters the document fonts cannot show")
+
+// winAnsi maps the characters WinAnsiEncoding places outside Latin-1 to their codes.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+	'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// textLine is one positioned run of text on a page.
+type textLine struct {
+	font string
+	size float64
+	y    float64
+	text string
+	rule bool // draw a horizontal rule instead of text
+}
+
+// PDF builds a simple text-only PDF document using the standard 14 fonts,
+// so no font files or external libraries are needed.
+type PDF struct {
+	title string
+	pages [][]textLine
+	y     float64
+}
+
+// NewPDF creates an empty PDF with the given document title.
+func NewPDF(title string) *PDF {
+	p := &PDF{title: title}
+	p.newPage()
+	return p
+}
+
+func (p *PDF) newPage() {
+	p.pages = append(p.pages, nil)
+	p.y = pageHeight - marginTop
+}
+
+func (p *PDF) add(font string, size float64, text string) {
+	lineHeight := size * 1.45
+	if p.y-lineHeight < marginBottom {
+		p.newPage()
+	}
+	p.y -= lineHeight
+	last := len(p.pages) - 1
+	p.pages[last] = append(p.pages[last], textLine{font: font, size: size, y: p.y, text: text})
+}
+
+// Heading writes a large bold line.
+func (p *PDF) Heading(text string) {
+	p.add(fontBold, 16, text)
+	p.Space(4)
+}
+
+// Subheading writes a bold section title.
+func (p *PDF) Subheading(text string) {
+	p.Space(6)
+	p.add(fontBold, 11.5, text)
+}
+
+// Text writes body text, wrapping long lines.
+func (p *PDF) Text(text string) {
+	for _, line := range wrap(text, 92) {
+		p.add(fontRegular, 10, line)
+	}
+}
+
+// Code writes a line in a monospaced bold font.
+func (p *PDF) Code(text string) {
+	p.add(fontMono, 12, text)
+}
+
+// Rule draws a horizontal line across the page.
+func (p *PDF) Rule() {
+	p.Space(4)
+	last := len(p.pages) - 1
+	p.pages[last] = append(p.pages[last], textLine{y: p.y, rule: true})
+	p.Space(6)
+}
+
+// Space adds vertical whitespace.
+func (p *PDF) Space(points float64) {
+	p.y -= points
+}
+
+// Bytes renders the document to PDF 1.4. It fails with ErrUnsupportedText when the title or
+// any line has a character outside WinAnsiEncoding.
+func (p *PDF) Bytes() ([]byte, error) {
+	if _, err := escape(p.title); err != nil {
+		return nil, err
+	}
+	for _, lines := range p.pages {
+		for _, l := range lines {
+			if _, err := escape(l.text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+
+	writeObj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Object numbers: 1 catalog, 2 pages, 3-5 fonts, 6 info, then a page and content stream per page
+	const firstPageObj = 7
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObj+2*i)
+	}
+
+	writeObj("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	writeObj(fmt.Sprintf("<< /Title (%s) /Producer (fitnis) >>", mustEscape(p.title)))
+
+	for i, lines := range p.pages {
+		var content bytes.Buffer
+		for _, l := range lines {
+			if l.rule {
+				fmt.Fprintf(&content, "0.5 w %d %.1f m %d %.1f l S\n", marginLeft, l.y, pageWidth-marginLeft, l.y)
+				continue
+			}
+			fmt.Fprintf(&content, "BT /%s %.1f Tf %d %.1f Td (%s) Tj ET\n", l.font, l.size, marginLeft, l.y, mustEscape(l.text))
+		}
+		// Page number footer
+		fmt.Fprintf(&content, "BT /%s 8 Tf %d %d Td (Page %d of %d) Tj ET\n", fontRegular, marginLeft, marginBottom/2, i+1, len(p.pages))
+
+		writeObj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, firstPageObj+2*i+1))
+		writeObj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes(), nil
+}
+
+// escape converts text to WinAnsi bytes and escapes PDF string delimiters.
+func escape(s string) (string, error) {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			sb.WriteByte('\\')
+			sb.WriteByte(byte(r))
+		case r == '\t':
+			sb.WriteString("    ")
+		case r < 0x20:
+			// Drop control characters
+		case r < 0x80 || (r >= 0xA0 && r < 0x100):
+			// Latin-1 matches WinAnsi outside the 0x80-0x9F block
+			sb.WriteByte(byte(r))
+		case winAnsi[r] != 0:
+			sb.WriteByte(winAnsi[r])
+		default:
+			return "", fmt.Errorf("%w: %q", ErrUnsupportedText, r)
+		}
+	}
+	return sb.String(), nil
+}
+
+// mustEscape escapes text that Bytes has already checked.
+func mustEscape(s string) string {
+	escaped, _ := escape(s)
+	return escaped
+}
+
+// wrap splits text into lines of at most width characters, breaking on spaces.
+func wrap(text string, width int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	current := words[0]
+	for _, w := range words[1:] {
+		if len([]rune(current))+1+len([]rune(w)) > width {
+			lines = append(lines, current)
+			current = w
+			continue
+		}
+		current += " " + w
+	}
+	return append(lines, current)
+}
@@ -0,0 +1,144 @@
+// Package etag guards records against lost updates. Every stored record carries a version
+// that each update raises. Services send it as the record's ETag, and clients send it back in
+// If-Match so that an update or delete only applies to the version they read.
+package etag
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Headers carrying record versions.
+const (
+	HeaderETag    = "ETag"
+	HeaderIfMatch = "If-Match"
+)
+
+var (
+	// ErrMissing is returned when an update or delete carries no If-Match header
+	ErrMissing = errors.New("an If-Match header with the record's ETag is required")
+	// ErrInvalid is returned when If-Match does not hold a single ETag of this API
+	ErrInvalid = errors.New("If-Match must hold a single ETag returned by this API")
+	// ErrMismatch is returned when the record was changed since the expected version was read
+	ErrMismatch = errors.New("record has been changed since it was read")
+)
+
+// versionField is the field of a model holding the record's version.
+const versionField = "Version"
+
+// expectKey is where Expect keeps the expected version for the callbacks.
+const expectKey = "etag:expected"
+
+// Format returns the ETag of a record version.
+func Format(version uint) string {
+	return fmt.Sprintf("%q", strconv.FormatUint(uint64(version), 10))
+}
+
+// IfMatch reads the record version a request expects from its If-Match header.
+// Weak ETags are refused: an update needs the exact version.
+func IfMatch(h http.Header) (uint, error) {
+	value := strings.TrimSpace(h.Get(HeaderIfMatch))
+	if value == "" {
+		return 0, ErrMissing
+	}
+	unquoted, err := strconv.Unquote(value)
+	if err != nil || !strings.HasPrefix(value, `"`) {
+		return 0, ErrInvalid
+	}
+	version, err := strconv.ParseUint(unquoted, 10, 32)
+	if err != nil || version == 0 {
+		return 0, ErrInvalid
+	}
+	return uint(version), nil
+}
+
+// Expect returns a session whose updates and deletes apply only to records still at the
+// given version. When no record is, they fail with ErrMismatch.
+func Expect(db *gorm.DB, version uint) *gorm.DB {
+	return db.Set(expectKey, version)
+}
+
+// Register adds the GORM callbacks that raise versions on update and enforce Expect.
+func Register(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Update().Before("gorm:update").Register("etag:before_update", beforeUpdate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("etag:after_update", afterChange); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("etag:before_delete", beforeDelete); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register("etag:after_delete", afterChange)
+}
+
+// beforeUpdate raises the version of the records an update changes. A
+// loaded record moves to the version after its own; other updates given as maps raise the
+// stored versions. Struct updates of records that were not loaded leave versions alone.
+func beforeUpdate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	field := db.Statement.Schema.LookUpField(versionField)
+	if field == nil {
+		return
+	}
+
+	if expected, ok := expectedVersion(db); ok {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: expected}}})
+		db.Statement.SetColumn(field.DBName, expected+1)
+		return
+	}
+	if record := db.Statement.ReflectValue; record.Kind() == reflect.Struct {
+		if current, zero := field.ValueOf(db.Statement.Context, record); !zero {
+			db.Statement.SetColumn(field.DBName, current.(uint)+1)
+			return
+		}
+	}
+	switch db.Statement.Dest.(type) {
+	case map[string]interface{}, []map[string]interface{}:
+		db.Statement.SetColumn(field.DBName, gorm.Expr(field.DBName+" + 1"))
+	}
+}
+
+// beforeDelete limits a delete to the expected version.
+func beforeDelete(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	field := db.Statement.Schema.LookUpField(versionField)
+	if field == nil {
+		return
+	}
+	if expected, ok := expectedVersion(db); ok {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: expected}}})
+	}
+}
+
+// afterChange fails an update or delete limited to a version that no record had.
+func afterChange(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.LookUpField(versionField) == nil {
+		return
+	}
+	if _, ok := expectedVersion(db); ok && db.RowsAffected == 0 {
+		db.AddError(ErrMismatch)
+	}
+}
+
+// expectedVersion is the version set by Expect, if any.
+func expectedVersion(db *gorm.DB) (uint, bool) {
+	value, ok := db.Get(expectKey)
+	if !ok {
+		return 0, false
+	}
+	version, ok := value.(uint)
+	return version, ok
+}
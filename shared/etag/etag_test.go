@@ -0,0 +1,100 @@
+package etag
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/fitnis/shared/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    uint
+		wantErr error
+	}{
+		{"", 0, ErrMissing},
+		{`"3"`, 3, nil},
+		{Format(12), 12, nil},
+		{`W/"3"`, 0, ErrInvalid},
+		{`3`, 0, ErrInvalid},
+		{`"0"`, 0, ErrInvalid},
+		{`"abc"`, 0, ErrInvalid},
+		{`"1", "2"`, 0, ErrInvalid},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.header != "" {
+			h.Set(HeaderIfMatch, tt.header)
+		}
+		got, err := IfMatch(h)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("IfMatch(%q) = %d, %v; want %d, %v", tt.header, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// newTestDB opens an empty database with the etag callbacks installed.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Condition{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := Register(db); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	return db
+}
+
+func TestExpectUpdate(t *testing.T) {
+	db := newTestDB(t)
+	condition := models.Condition{PatientID: 1, Description: "Asthma"}
+	db.Create(&condition)
+
+	// Updating the version that was read raises it
+	err := Expect(db, 1).Model(&models.Condition{}).Where("id = ?", condition.ID).
+		Updates(map[string]interface{}{"description": "Severe asthma"}).Error
+	if err != nil {
+		t.Fatalf("update at the current version: %v", err)
+	}
+
+	// A second writer still holding version 1 is refused and changes nothing
+	err = Expect(db, 1).Model(&models.Condition{}).Where("id = ?", condition.ID).
+		Updates(map[string]interface{}{"description": "Mild asthma"}).Error
+	if !errors.Is(err, ErrMismatch) {
+		t.Fatalf("stale update: got %v, want ErrMismatch", err)
+	}
+
+	var stored models.Condition
+	db.First(&stored, condition.ID)
+	if stored.Version != 2 || stored.Description != "Severe asthma" {
+		t.Errorf("stored version %d %q, want version 2 \"Severe asthma\"", stored.Version, stored.Description)
+	}
+}
+
+func TestExpectDelete(t *testing.T) {
+	db := newTestDB(t)
+	condition := models.Condition{PatientID: 1, Description: "Asthma"}
+	db.Create(&condition)
+	db.Model(&condition).Update("description", "Severe asthma")
+
+	if err := Expect(db, 1).Delete(&models.Condition{}, condition.ID).Error; !errors.Is(err, ErrMismatch) {
+		t.Fatalf("stale delete: got %v, want ErrMismatch", err)
+	}
+	if err := Expect(db, 2).Delete(&models.Condition{}, condition.ID).Error; err != nil {
+		t.Fatalf("delete at the current version: %v", err)
+	}
+	var count int64
+	db.Model(&models.Condition{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d conditions left, want 0", count)
+	}
+}
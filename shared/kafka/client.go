@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Request and response topics per service, matching the API gateway's topic maps
+var serviceRequestTopics = map[string]string{
+	"patients":      "patient-requests",
+	"prescriptions": "prescription-requests",
+	"referrals":     "referral-requests",
+	"examinations":  "examination-requests",
+	"samples":       "sample-requests",
+	"practitioners": "practitioner-requests",
+	"appointments":  "appointment-requests",
+	"orders":        "order-requests",
+	"records":       "record-requests",
+}
+
+var serviceResponseTopics = map[string]string{
+	"patients":      "patient-responses",
+	"prescriptions": "prescription-responses",
+	"referrals":     "referral-responses",
+	"examinations":  "examination-responses",
+	"samples":       "sample-responses",
+	"practitioners": "practitioner-responses",
+	"appointments":  "appointment-responses",
+	"orders":        "order-responses",
+	"records":       "record-responses",
+}
+
+// SendRequest sends a request to another service over Kafka and waits up to timeout for its response.
+// It lets services talk to each other the same way the API gateway talks to them.
+func SendRequest(service string, req KafkaRequest, timeout time.Duration) (KafkaResponse, error) {
+	topic, ok := serviceRequestTopics[service]
+	if !ok {
+		return KafkaResponse{}, fmt.Errorf("unknown service: %s", service)
+	}
+	responseTopic := serviceResponseTopics[service]
+
+	if req.RequestID == "" {
+		req.RequestID = NewRequestID()
+	}
+	if req.ServicePath == "" {
+		req.ServicePath = "/" + service + req.Path
+	}
+
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return KafkaResponse{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	brokerAddress := getKafkaBrokerAddress()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Start reading from the end of the response topic before sending, so we don't miss a fast reply
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{brokerAddress},
+		Topic:     responseTopic,
+		MinBytes:  1,
+		MaxBytes:  10e6, // 10MB
+		MaxWait:   500 * time.Millisecond,
+		Partition: 0,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(kafka.LastOffset); err != nil {
+		return KafkaResponse{}, fmt.Errorf("failed to position response reader: %w", err)
+	}
+
+	writer := kafka.Writer{
+		Addr:     kafka.TCP(brokerAddress),
+		Topic:    topic,
+		Balancer: &kafka.LeastBytes{},
+	}
+	defer writer.Close()
+
+	err = writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(req.RequestID),
+		Value: reqBytes,
+	})
+	if err != nil {
+		return KafkaResponse{}, fmt.Errorf("failed to write message: %w", err)
+	}
+
+	// Read messages until we find our response or time out
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return KafkaResponse{}, fmt.Errorf("failed to read response from %s: %w", service, err)
+		}
+
+		var resp KafkaResponse
+		if err := json.Unmarshal(msg.Value, &resp); err != nil {
+			log.Printf("Error unmarshaling response: %v", err)
+			continue
+		}
+		if resp.RequestID == req.RequestID {
+			return resp, nil
+		}
+	}
+}
+
+// NewRequestID creates a unique request ID
+func NewRequestID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
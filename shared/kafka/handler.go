@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -28,6 +30,16 @@ type KafkaResponse struct {
 	Body       []byte            `json:"body"`
 }
 
+// ResponseHeaders converts the headers a handler wrote into response headers for the gateway,
+// joining repeated values with commas.
+func ResponseHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for key, values := range h {
+		headers[key] = strings.Join(values, ",")
+	}
+	return headers
+}
+
 // ServiceHandler defines the function signature for service request handlers
 type ServiceHandler func(KafkaRequest) KafkaResponse
 
@@ -22,6 +22,14 @@ var requiredTopics = []string{
 	"examination-responses",
 	"sample-requests",
 	"sample-responses",
+	"practitioner-requests",
+	"practitioner-responses",
+	"appointment-requests",
+	"appointment-responses",
+	"order-requests",
+	"order-responses",
+	"record-requests",
+	"record-responses",
 }
 
 // EnsureTopicsExist makes sure all required Kafka topics exist
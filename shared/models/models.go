@@ -1,28 +1,251 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Patient model
 type Patient struct {
-	ID        uint       `json:"id" gorm:"primaryKey"`
-	FirstName string     `json:"firstName"`
-	LastName  string     `json:"lastName"`
-	BirthDate *time.Time `json:"birthDate"`
-	Details   string     `json:"details"`
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Version   uint           `json:"version" gorm:"not null;default:1"` // raised by every update; sent as the ETag and expected back in If-Match
+	DeletedAt gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`  // set by a soft delete; purged after the retention period
+	MRN       string         `json:"mrn" gorm:"uniqueIndex"`            // medical record number, generated with a check digit
+	FirstName string         `json:"firstName"`
+	LastName  string         `json:"lastName"`
+	BirthDate *time.Time     `json:"birthDate"`
+	Details   string         `json:"details"`
+
+	// Demographics and contact details
+	Sex               string  `json:"sex,omitempty"`    // administrative sex: female, male, other or unknown
+	Gender            string  `json:"gender,omitempty"` // gender identity as stated by the patient
+	Address           Address `json:"address" gorm:"embedded;embeddedPrefix:address_"`
+	Phone             string  `json:"phone,omitempty"` // stored as digits with an optional leading +
+	Email             string  `json:"email,omitempty"`
+	PreferredLanguage string  `json:"preferredLanguage,omitempty"` // language tag, e.g. "en" or "de-AT"
+
+	// Set when this record was merged into another as a duplicate; the survivor holds its examinations
+	MergedIntoID *uint `json:"mergedIntoId,omitempty" gorm:"index"`
+
+	// Set when the patient's personal data was erased; the record is kept, anonymised, for references
+	ErasedAt *time.Time `json:"erasedAt,omitempty"`
 
 	// One-to-many relationship: a patient can have multiple examinations
 	Examinations []Examination `json:"examinations,omitempty"`
+
+	// External identifiers such as national ID or insurance numbers
+	Identifiers []PatientIdentifier `json:"identifiers,omitempty"`
+
+	// People to contact in an emergency, in call order
+	EmergencyContacts []EmergencyContact `json:"emergencyContacts,omitempty"`
+}
+
+// Address is a postal address, embedded in the records that have one
+type Address struct {
+	Line1      string `json:"line1,omitempty"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Region     string `json:"region,omitempty"`
+	Country    string `json:"country,omitempty"` // ISO 3166-1 alpha-2 code
+}
+
+// EmergencyContact model: a person to contact on a patient's behalf
+type EmergencyContact struct {
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	Version      uint   `json:"version" gorm:"not null;default:1"`
+	PatientID    uint   `json:"patientId" gorm:"index"` // foreign key for Patient
+	Name         string `json:"name"`
+	Relationship string `json:"relationship"` // e.g. "spouse", "parent"
+	Phone        string `json:"phone"`
+	Email        string `json:"email,omitempty"`
+	Priority     int    `json:"priority"` // call order; 1 is called first
+}
+
+// PatientIdentifier model: an identifier issued to a patient by another system.
+// A value is unique within its system.
+type PatientIdentifier struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Version   uint      `json:"version" gorm:"not null;default:1"`
+	PatientID uint      `json:"patientId" gorm:"index"`                                         // foreign key for Patient
+	Type      string    `json:"type"`                                                           // national-id, insurance, passport or other
+	System    string    `json:"system" gorm:"uniqueIndex:idx_patient_identifiers_system_value"` // namespace of the value, e.g. a national registry URI
+	Value     string    `json:"value" gorm:"uniqueIndex:idx_patient_identifiers_system_value"`
+	Issuer    string    `json:"issuer"` // organisation that issued the identifier
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PatientMerge model: a duplicate patient record merged into a survivor. It lists what
+// was moved so the merge can be undone.
+type PatientMerge struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Version        uint       `json:"version" gorm:"not null;default:1"`
+	SurvivorID     uint       `json:"survivorId" gorm:"index"`  // references Patient
+	DuplicateID    uint       `json:"duplicateId" gorm:"index"` // references Patient
+	Reason         string     `json:"reason"`
+	MergedBy       string     `json:"mergedBy"`
+	ExaminationIDs []uint     `json:"examinationIds" gorm:"serializer:json"` // examinations moved to the survivor
+	AppointmentIDs []uint     `json:"appointmentIds" gorm:"serializer:json"` // appointments moved to the survivor
+	ChartNoteIDs   []uint     `json:"chartNoteIds" gorm:"serializer:json"`   // chart notes moved to the survivor
+	IdentifierIDs  []uint     `json:"identifierIds" gorm:"serializer:json"`  // identifiers moved to the survivor
+	ContactIDs     []uint     `json:"contactIds" gorm:"serializer:json"`     // emergency contacts moved to the survivor
+	AllergyIDs     []uint     `json:"allergyIds" gorm:"serializer:json"`     // allergies moved to the survivor
+	ConditionIDs   []uint     `json:"conditionIds" gorm:"serializer:json"`   // conditions moved to the survivor
+	ConsentIDs     []uint     `json:"consentIds" gorm:"serializer:json"`     // consents moved to the survivor
+	AdmissionIDs   []uint     `json:"admissionIds" gorm:"serializer:json"`   // admissions, with their transfers, moved to the survivor
+	MergedAt       time.Time  `json:"mergedAt"`
+	UndoneAt       *time.Time `json:"undoneAt,omitempty"`
+	UndoneBy       string     `json:"undoneBy,omitempty"`
+}
+
+// RetentionHold model: a legal or regulatory hold that keeps part of a patient's data from
+// being erased. A hold is in force until released or until its end date.
+type RetentionHold struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Version    uint       `json:"version" gorm:"not null;default:1"`
+	PatientID  uint       `json:"patientId" gorm:"index"` // foreign key for Patient
+	Scope      string     `json:"scope"`                  // a dataset, e.g. patient, examinations or chart, or * for everything
+	Reason     string     `json:"reason"`                 // e.g. litigation, statutory retention period
+	PlacedBy   string     `json:"placedBy"`
+	PlacedAt   time.Time  `json:"placedAt"`
+	Until      *time.Time `json:"until,omitempty"`
+	ReleasedAt *time.Time `json:"releasedAt,omitempty"`
+	ReleasedBy string     `json:"releasedBy,omitempty"`
+}
+
+// PatientErasure model: the completion record of a request to erase a patient's data,
+// listing what happened to each dataset
+type PatientErasure struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	Version     uint          `json:"version" gorm:"not null;default:1"`
+	PatientID   uint          `json:"patientId" gorm:"index"` // foreign key for Patient
+	RequestedBy string        `json:"requestedBy"`
+	Reason      string        `json:"reason"`
+	Status      string        `json:"status"` // completed, partial (some data retained), retained (all data retained) or failed
+	Steps       []ErasureStep `json:"steps" gorm:"serializer:json"`
+	RequestedAt time.Time     `json:"requestedAt"`
+	CompletedAt *time.Time    `json:"completedAt,omitempty"`
+}
+
+// ErasureStep is the outcome of an erasure for one dataset
+type ErasureStep struct {
+	Dataset string `json:"dataset"` // e.g. patient, admissions, examinations or chart
+	Status  string `json:"status"`  // erased, retained or failed
+	Records int    `json:"records"` // records anonymised
+	HoldIDs []uint `json:"holdIds,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Allergy model: a substance a patient reacts to
+type Allergy struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Version      uint       `json:"version" gorm:"not null;default:1"`
+	PatientID    uint       `json:"patientId" gorm:"index"` // foreign key for Patient
+	Substance    string     `json:"substance"`              // medication, class or other substance, e.g. "penicillin"
+	Reaction     string     `json:"reaction"`               // e.g. "rash", "anaphylaxis"
+	Severity     string     `json:"severity"`               // mild, moderate, severe or unknown
+	Verification string     `json:"verification"`           // unconfirmed, confirmed or refuted
+	Status       string     `json:"status"`                 // active or inactive
+	OnsetDate    *time.Time `json:"onsetDate,omitempty"`
+	RecordedBy   string     `json:"recordedBy"`
+	Notes        string     `json:"notes,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// Consent model: a patient's directive on who may read which part of their record.
+// A consent is in force from ValidFrom until ValidUntil, unless revoked earlier.
+type Consent struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	Version          uint       `json:"version" gorm:"not null;default:1"`
+	PatientID        uint       `json:"patientId" gorm:"index"` // foreign key for Patient
+	Decision         string     `json:"decision"`               // permit or deny
+	Scope            string     `json:"scope"`                  // demographics, conditions, examinations, chart, or * for the whole record
+	Purpose          string     `json:"purpose,omitempty"`      // e.g. treatment, research; empty applies to any purpose
+	Grantee          string     `json:"grantee"`                // a user ID, "role:<role>", or * for anyone
+	ValidFrom        time.Time  `json:"validFrom"`
+	ValidUntil       *time.Time `json:"validUntil,omitempty"`
+	RecordedBy       string     `json:"recordedBy"`
+	RevokedAt        *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy        string     `json:"revokedBy,omitempty"`
+	RevocationReason string     `json:"revocationReason,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+// Condition model: an entry on a patient's problem list
+type Condition struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Version      uint       `json:"version" gorm:"not null;default:1"`
+	PatientID    uint       `json:"patientId" gorm:"index"` // foreign key for Patient
+	Code         string     `json:"code"`                   // e.g. an ICD-10 or SNOMED CT code
+	CodeSystem   string     `json:"codeSystem,omitempty"`   // e.g. "icd-10"
+	Description  string     `json:"description"`
+	Status       string     `json:"status"` // active, recurrence, remission or resolved
+	OnsetDate    *time.Time `json:"onsetDate,omitempty"`
+	ResolvedDate *time.Time `json:"resolvedDate,omitempty"`
+	RecordedBy   string     `json:"recordedBy"`
+	Notes        string     `json:"notes,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// Practitioner model: a clinician in the practitioner directory
+type Practitioner struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Version       uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt     gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	FirstName     string         `json:"firstName"`
+	LastName      string         `json:"lastName"`
+	Title         string         `json:"title"` // e.g. "Dr."
+	LicenceNumber string         `json:"licenceNumber" gorm:"uniqueIndex"`
+	Department    string         `json:"department" gorm:"index"`
+	Email         string         `json:"email"`
+	Phone         string         `json:"phone"`
+	Active        bool           `json:"active" gorm:"default:true"`
+
+	// One-to-many relationships
+	Specialties  []PractitionerSpecialty    `json:"specialties,omitempty"`
+	Availability []PractitionerAvailability `json:"availability,omitempty"`
+}
+
+// PractitionerSpecialty model
+type PractitionerSpecialty struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	Version        uint   `json:"version" gorm:"not null;default:1"`
+	PractitionerID uint   `json:"practitionerId" gorm:"index"` // foreign key for Practitioner
+	Name           string `json:"name" gorm:"index"`
+}
+
+// PractitionerAvailability model: a recurring weekly window in which the practitioner works
+type PractitionerAvailability struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	Version        uint   `json:"version" gorm:"not null;default:1"`
+	PractitionerID uint   `json:"practitionerId" gorm:"index"` // foreign key for Practitioner
+	Weekday        int    `json:"weekday"`                     // 0 = Sunday ... 6 = Saturday
+	StartTime      string `json:"startTime"`                   // "HH:MM"
+	EndTime        string `json:"endTime"`                     // "HH:MM"
+}
+
+// FullName returns the practitioner's display name, e.g. "Dr. Ana Horvat".
+func (p Practitioner) FullName() string {
+	name := p.FirstName + " " + p.LastName
+	if p.Title != "" {
+		name = p.Title + " " + name
+	}
+	return name
 }
 
 // Examination model
 type Examination struct {
-	ID        uint       `json:"id" gorm:"primaryKey"`
-	PatientID uint       `json:"patientId"` // foreign key for Patient
-	ExamDate  *time.Time `json:"examDate" gorm:"not null"`
-	Anamnesis string     `json:"anamnesis"`
-	Diagnosis string     `json:"diagnosis"`
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Version   uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	PatientID uint           `json:"patientId"` // foreign key for Patient
+	ExamDate  *time.Time     `json:"examDate" gorm:"not null"`
+	Anamnesis string         `json:"anamnesis"`
+	Diagnosis string         `json:"diagnosis"`
 
 	// Belongs to
 	Patient Patient `json:"patient,omitempty"`
@@ -35,10 +258,14 @@ type Examination struct {
 
 // Sample model
 type Sample struct {
-	ID            uint   `json:"id" gorm:"primaryKey"`
-	ExaminationID uint   `json:"examinationId"` // foreign key for Examination
-	SampleType    string `json:"sampleType"`
-	Result        string `json:"result"`
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Version       uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt     gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	ExaminationID uint           `json:"examinationId"` // foreign key for Examination
+	SampleType    string         `json:"sampleType"`
+	Result        string         `json:"result"`
+	OrderID       *uint          `json:"orderId,omitempty" gorm:"index"`                                                                      // set when the sample fulfils an order
+	OrderItemID   *uint          `json:"orderItemId,omitempty" gorm:"index;uniqueIndex:idx_samples_live_order_item,where:deleted_at IS NULL"` // at most one live sample per order item
 
 	// Belongs to
 	Examination Examination `json:"examination,omitempty"`
@@ -46,25 +273,274 @@ type Sample struct {
 
 // Prescription model
 type Prescription struct {
-	ID            uint   `json:"id" gorm:"primaryKey"`
-	ExaminationID uint   `json:"examinationId"` // foreign key for Examination
-	Medication    string `json:"medication"`
-	Dosage        string `json:"dosage"`
-	Instructions  string `json:"instructions"`
-	Validated     bool   `json:"validated"`
-	Sent          bool   `json:"sent"`
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Version       uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt     gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	ExaminationID uint           `json:"examinationId"` // foreign key for Examination
+	Medication    string         `json:"medication"`
+	Dosage        string         `json:"dosage"`
+	Instructions  string         `json:"instructions"`
+	Validated     bool           `json:"validated"`
+	Sent          bool           `json:"sent"`
+	Prescriber    string         `json:"prescriber"`
+	PrescriberID  *uint          `json:"prescriberId,omitempty"` // references Practitioner
+	CreatedAt     time.Time      `json:"createdAt"`
+
+	// Structured, coded dosing; Dosage holds the rendered sig when these are set
+	StructuredDosage `gorm:"embedded"`
+
+	// Refill tracking; RenewedFromID links a renewal to the prescription it repeats
+	RefillsRemaining int   `json:"refillsRemaining"`
+	RenewedFromID    *uint `json:"renewedFromId,omitempty"`
+
+	// Reason given by the clinician for validating despite safety warnings
+	ValidationOverrideReason string `json:"validationOverrideReason,omitempty"`
+
+	// Pharmacy transmission details, set once the pharmacy acknowledges the prescription
+	PharmacyAckID string     `json:"pharmacyAckId,omitempty"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
 
 	// Belongs to
 	Examination Examination `json:"examination,omitempty"`
 }
 
+// DispenseEvent model: a refill dispensed against a prescription
+type DispenseEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Version        uint      `json:"version" gorm:"not null;default:1"`
+	PrescriptionID uint      `json:"prescriptionId" gorm:"index"` // foreign key for Prescription
+	DispensedAt    time.Time `json:"dispensedAt"`
+	Quantity       int       `json:"quantity"`
+	Pharmacy       string    `json:"pharmacy"`
+}
+
+// StructuredDosage describes a coded medication and how it is to be taken
+type StructuredDosage struct {
+	MedicationCode string  `json:"medicationCode,omitempty"` // code from the formulary table
+	Strength       string  `json:"strength,omitempty"`       // e.g. "500 mg"
+	Form           string  `json:"form,omitempty"`           // e.g. "tablet"
+	Route          string  `json:"route,omitempty"`          // e.g. "oral"
+	DoseAmount     float64 `json:"doseAmount,omitempty"`     // units of Form per administration
+	Frequency      string  `json:"frequency,omitempty"`      // e.g. "BID"
+	DurationDays   int     `json:"durationDays,omitempty"`
+	Quantity       int     `json:"quantity,omitempty"` // units to dispense
+	Refills        int     `json:"refills"`
+}
+
+// FormularyItem model: an entry in the local medication formulary
+type FormularyItem struct {
+	Code     string `json:"code" gorm:"primaryKey"`
+	Version  uint   `json:"version" gorm:"not null;default:1"`
+	Name     string `json:"name" gorm:"index"`
+	Strength string `json:"strength"`
+	Form     string `json:"form"`
+	Route    string `json:"route"`
+}
+
 // Referral model
 type Referral struct {
-	ID            uint   `json:"id" gorm:"primaryKey"`
-	ExaminationID uint   `json:"examinationId"` // foreign key for Examination
-	Specialist    string `json:"specialist"`
-	Reason        string `json:"reason"`
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Version       uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt     gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	ExaminationID uint           `json:"examinationId"` // foreign key for Examination
+	Specialist    string         `json:"specialist"`
+	Reason        string         `json:"reason"`
+	ReferredBy    string         `json:"referredBy"`
+	SpecialistID  *uint          `json:"specialistId,omitempty"` // references Practitioner
+	ReferrerID    *uint          `json:"referrerId,omitempty"`   // references Practitioner
+
+	// Workflow state
+	Status       string     `json:"status" gorm:"default:sent;index"`      // sent, accepted, declined, scheduled, completed
+	Priority     string     `json:"priority" gorm:"default:routine;index"` // routine, urgent, emergency
+	StatusNote   string     `json:"statusNote,omitempty"`                  // note from the latest change; History keeps them all
+	CreatedAt    time.Time  `json:"createdAt"`
+	AcceptedAt   *time.Time `json:"acceptedAt,omitempty"`
+	ScheduledFor *time.Time `json:"scheduledFor,omitempty"`
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+	SLABreached  bool       `json:"slaBreached" gorm:"-"` // computed on read, not stored
+
+	// One-to-many relationship: the referral's status changes, oldest first
+	History []ReferralStatusChange `json:"history,omitempty" gorm:"foreignKey:ReferralID"`
 
 	// Belongs to
 	Examination Examination `json:"examination,omitempty"`
 }
+
+// ReferralStatusChange model: a referral moving from one status to the next, with the note given
+type ReferralStatusChange struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Version    uint      `json:"version" gorm:"not null;default:1"`
+	ReferralID uint      `json:"referralId" gorm:"index"` // foreign key for Referral
+	FromStatus string    `json:"fromStatus"`              // empty for the referral being sent
+	ToStatus   string    `json:"toStatus"`
+	Note       string    `json:"note,omitempty"`
+	ChangedAt  time.Time `json:"changedAt"`
+}
+
+// AppointmentSlot model: a bookable block of time in a practitioner's calendar
+type AppointmentSlot struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Version        uint      `json:"version" gorm:"not null;default:1"`
+	PractitionerID uint      `json:"practitionerId" gorm:"index"` // references Practitioner
+	StartTime      time.Time `json:"startTime" gorm:"index"`
+	EndTime        time.Time `json:"endTime"`
+	AppointmentID  *uint     `json:"appointmentId,omitempty"` // set while the slot is booked
+
+	// Belongs to
+	Appointment *Appointment `json:"appointment,omitempty" gorm:"foreignKey:AppointmentID"`
+}
+
+// Appointment model
+type Appointment struct {
+	ID                 uint           `json:"id" gorm:"primaryKey"`
+	Version            uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt          gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	PatientID          uint           `json:"patientId" gorm:"index"`      // foreign key for Patient
+	PractitionerID     uint           `json:"practitionerId" gorm:"index"` // references Practitioner
+	SlotID             uint           `json:"slotId"`
+	StartTime          time.Time      `json:"startTime"`
+	EndTime            time.Time      `json:"endTime"`
+	Reason             string         `json:"reason"`
+	Status             string         `json:"status" gorm:"default:scheduled;index"` // scheduled, cancelled, rescheduled, completed
+	CancellationReason string         `json:"cancellationReason,omitempty"`
+	RescheduledFromID  *uint          `json:"rescheduledFromId,omitempty"`
+	ExaminationID      *uint          `json:"examinationId,omitempty"` // examination produced by a completed appointment
+	CreatedAt          time.Time      `json:"createdAt"`
+	CompletedAt        *time.Time     `json:"completedAt,omitempty"`
+}
+
+// Order model: lab and imaging tests ordered for an examination
+type Order struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Version       uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt     gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	ExaminationID uint           `json:"examinationId" gorm:"index"` // foreign key for Examination
+	OrderedBy     string         `json:"orderedBy"`
+	OrderedByID   *uint          `json:"orderedById,omitempty"`                 // references Practitioner
+	Priority      string         `json:"priority" gorm:"default:routine;index"` // routine, urgent, stat
+	Status        string         `json:"status" gorm:"default:ordered;index"`   // ordered, in-progress, completed, cancelled
+	Notes         string         `json:"notes"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	CompletedAt   *time.Time     `json:"completedAt,omitempty"`
+
+	// One-to-many relationship
+	Items []OrderItem `json:"items,omitempty"`
+}
+
+// OrderItem model: a single test within an order
+type OrderItem struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Version     uint   `json:"version" gorm:"not null;default:1"`
+	OrderID     uint   `json:"orderId" gorm:"index"` // foreign key for Order
+	Category    string `json:"category"`             // lab or imaging
+	Code        string `json:"code"`                 // e.g. "CBC", "XR-CHEST"
+	Description string `json:"description"`
+	SampleType  string `json:"sampleType,omitempty"`                // lab items only, e.g. "blood"
+	Status      string `json:"status" gorm:"default:pending;index"` // pending, collected, resulted, cancelled
+	SampleID    *uint  `json:"sampleId,omitempty"`                  // sample created on fulfilment
+	Result      string `json:"result,omitempty"`
+}
+
+// Admission model: an inpatient stay. An admission is open until DischargedAt is set,
+// and a patient can hold only one open admission at a time.
+type Admission struct {
+	ID                      uint           `json:"id" gorm:"primaryKey"`
+	Version                 uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt               gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	PatientID               uint           `json:"patientId" gorm:"index;uniqueIndex:idx_admissions_open_patient,where:discharged_at IS NULL"` // foreign key for Patient
+	Ward                    string         `json:"ward" gorm:"index"`
+	Bed                     string         `json:"bed"`
+	AdmittingPractitionerID *uint          `json:"admittingPractitionerId,omitempty"` // references Practitioner
+	AdmittedBy              string         `json:"admittedBy"`
+	Reason                  string         `json:"reason"`
+	AdmittedAt              time.Time      `json:"admittedAt"`
+	DischargedAt            *time.Time     `json:"dischargedAt,omitempty" gorm:"index"`
+	DischargeSummary        string         `json:"dischargeSummary,omitempty"`
+
+	// Belongs to
+	Patient Patient `json:"patient,omitempty"`
+
+	// One-to-many relationship: ward/bed moves during the stay
+	Transfers []AdmissionTransfer `json:"transfers,omitempty"`
+}
+
+// AdmissionTransfer model: a move between wards or beds during an admission
+type AdmissionTransfer struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Version       uint      `json:"version" gorm:"not null;default:1"`
+	AdmissionID   uint      `json:"admissionId" gorm:"index"` // foreign key for Admission
+	FromWard      string    `json:"fromWard"`
+	FromBed       string    `json:"fromBed"`
+	ToWard        string    `json:"toWard"`
+	ToBed         string    `json:"toBed"`
+	Reason        string    `json:"reason"`
+	TransferredAt time.Time `json:"transferredAt"`
+}
+
+// ChartNote model: a narrative note in a patient's chart. Signing locks the note;
+// corrections are made with addenda that reference the original note.
+type ChartNote struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Version       uint           `json:"version" gorm:"not null;default:1"`
+	DeletedAt     gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	PatientID     uint           `json:"patientId" gorm:"index"`               // foreign key for Patient
+	ExaminationID *uint          `json:"examinationId,omitempty" gorm:"index"` // optional foreign key for Examination
+	NoteType      string         `json:"noteType" gorm:"index"`                // progress, nursing, admission, discharge, consult, procedure
+	Author        string         `json:"author"`
+	AuthorID      *uint          `json:"authorId,omitempty"` // references Practitioner
+	Content       string         `json:"content"`
+	AddendumToID  *uint          `json:"addendumToId,omitempty" gorm:"index"` // set on addenda
+	SignedAt      *time.Time     `json:"signedAt,omitempty"`
+	SignedBy      string         `json:"signedBy,omitempty"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+
+	// One-to-many relationship: addenda to this note
+	Addenda []ChartNote `json:"addenda,omitempty" gorm:"foreignKey:AddendumToID"`
+}
+
+// AuditEntry model: one read or change of stored data. Entries are append-only and chained:
+// each hash covers the entry and the previous entry's hash, so an edited or removed entry
+// breaks the chain from that point on.
+type AuditEntry struct {
+	ID           uint          `json:"id" gorm:"primaryKey"`
+	Sequence     uint64        `json:"sequence" gorm:"uniqueIndex"` // position in the chain, from 1
+	Timestamp    time.Time     `json:"timestamp" gorm:"index"`
+	Service      string        `json:"service"`                                      // the service that handled the request
+	Actor        string        `json:"actor" gorm:"index"`                           // user ID from the request, system:<job> for background jobs, empty for other system changes
+	Role         string        `json:"role,omitempty"`                               // the actor's role
+	Action       string        `json:"action" gorm:"index"`                          // read, create, update or delete
+	ResourceType string        `json:"resourceType" gorm:"index:idx_audit_resource"` // table for changes, collection for reads
+	ResourceID   string        `json:"resourceId,omitempty" gorm:"index:idx_audit_resource"`
+	RequestID    string        `json:"requestId,omitempty" gorm:"index"`
+	SourceIP     string        `json:"sourceIp,omitempty"`
+	Path         string        `json:"path,omitempty"`       // path of the request the entry was made in
+	StatusCode   int           `json:"statusCode,omitempty"` // response status, for reads
+	Changes      []FieldChange `json:"changes,omitempty" gorm:"serializer:json"`
+	PrevHash     string        `json:"prevHash"`
+	Hash         string        `json:"hash"` // hex SHA-256
+}
+
+// FieldChange is one column a change touched, with SHA-256 hashes ("sha256:<hex>") of its
+// JSON-encoded value before and after; creates have no before and deletes no after. Erasures
+// record neither.
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// RecordVersion model: the state of a record after one change. Versions are kept for records
+// whose earlier states are evidence, such as examinations and prescriptions.
+type RecordVersion struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	ResourceType string          `json:"resourceType" gorm:"uniqueIndex:idx_record_version"` // table, e.g. examinations
+	ResourceID   string          `json:"resourceId" gorm:"uniqueIndex:idx_record_version"`
+	Version      int             `json:"version" gorm:"uniqueIndex:idx_record_version"` // from 1
+	Action       string          `json:"action"`                                        // create, update, delete, or baseline for the state found when versioning began
+	Snapshot     json.RawMessage `json:"snapshot,omitempty"`                            // the record after the change; empty once deleted
+	Changes      []FieldChange   `json:"changes,omitempty" gorm:"serializer:json"`      // against the previous version
+	ChangedBy    string          `json:"changedBy,omitempty"`                           // who made the change, as in its audit entry's actor
+	RequestID    string          `json:"requestId,omitempty"`
+	ChangedAt    time.Time       `json:"changedAt" gorm:"index"`
+}
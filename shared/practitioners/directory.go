@@ -0,0 +1,79 @@
+package practitioners
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fitnis/shared/kafka"
+	"github.com/fitnis/shared/models"
+)
+
+var (
+	// ErrNotFound means the referenced practitioner does not exist
+	ErrNotFound = errors.New("practitioner not found")
+	// ErrInactive means the practitioner exists but is no longer active
+	ErrInactive = errors.New("practitioner is inactive")
+	// ErrUnavailable means the practitioner directory could not be reached
+	ErrUnavailable = errors.New("practitioner directory unavailable")
+)
+
+// Directory looks up practitioners by ID
+type Directory interface {
+	Get(id uint) (models.Practitioner, error)
+}
+
+// KafkaDirectory asks the practitioner-service over Kafka
+type KafkaDirectory struct {
+	Timeout time.Duration
+}
+
+// NewKafkaDirectory creates a directory client with a default timeout
+func NewKafkaDirectory() *KafkaDirectory {
+	return &KafkaDirectory{Timeout: 10 * time.Second}
+}
+
+// Get fetches a single practitioner from the practitioner-service
+func (d *KafkaDirectory) Get(id uint) (models.Practitioner, error) {
+	resp, err := kafka.SendRequest("practitioners", kafka.KafkaRequest{
+		Method: "GET",
+		Path:   fmt.Sprintf("/%d", id),
+	}, d.Timeout)
+	if err != nil {
+		return models.Practitioner{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return models.Practitioner{}, fmt.Errorf("%w: %d", ErrNotFound, id)
+	case resp.StatusCode != http.StatusOK:
+		return models.Practitioner{}, fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var practitioner models.Practitioner
+	if err := json.Unmarshal(resp.Body, &practitioner); err != nil {
+		return models.Practitioner{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return practitioner, nil
+}
+
+// Resolve checks that an optional practitioner reference points at an active practitioner.
+// A nil id resolves to nil without a lookup.
+func Resolve(dir Directory, id *uint) (*models.Practitioner, error) {
+	if id == nil {
+		return nil, nil
+	}
+	if dir == nil {
+		return nil, fmt.Errorf("%w: no directory configured", ErrUnavailable)
+	}
+	practitioner, err := dir.Get(*id)
+	if err != nil {
+		return nil, err
+	}
+	if !practitioner.Active {
+		return nil, fmt.Errorf("%w: %d", ErrInactive, *id)
+	}
+	return &practitioner, nil
+}
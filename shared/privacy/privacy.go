@@ -0,0 +1,91 @@
+package privacy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fitnis/shared/kafka"
+)
+
+// Paths served by every service holding patient data, for the patient-service to gather and erase it
+const (
+	ExportPath = "/privacy/export"
+	ErasePath  = "/privacy/erase"
+)
+
+// ErasedText replaces free text removed by an erasure
+const ErasedText = "[erased]"
+
+// ErrUnavailable means a service could not export or erase its data
+var ErrUnavailable = errors.New("service unavailable")
+
+// Request identifies one patient's data in a service. Services whose records hang off
+// examinations use ExaminationIDs; the others use PatientID.
+type Request struct {
+	PatientID      uint   `json:"patientId"`
+	ExaminationIDs []uint `json:"examinationIds"`
+}
+
+// ErasureResult is a service's reply to an erasure request
+type ErasureResult struct {
+	Erased int `json:"erased"` // records anonymised
+}
+
+// KafkaClient exports and erases patient data in other services over Kafka
+type KafkaClient struct {
+	Timeout time.Duration
+}
+
+// NewKafkaClient creates a client with a default timeout
+func NewKafkaClient() *KafkaClient {
+	return &KafkaClient{Timeout: 30 * time.Second}
+}
+
+// Export returns the service's records for the patient as a JSON array
+func (k *KafkaClient) Export(service string, req Request) (json.RawMessage, error) {
+	body, err := k.send(service, ExportPath, req)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%w: %s returned an invalid export", ErrUnavailable, service)
+	}
+	return body, nil
+}
+
+// Erase anonymises the service's records for the patient and returns how many were changed
+func (k *KafkaClient) Erase(service string, req Request) (int, error) {
+	body, err := k.send(service, ErasePath, req)
+	if err != nil {
+		return 0, err
+	}
+	var result ErasureResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrUnavailable, service, err)
+	}
+	return result.Erased, nil
+}
+
+// send posts a privacy request to a service and returns the response body.
+func (k *KafkaClient) send(service, path string, req Request) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := kafka.SendRequest(service, kafka.KafkaRequest{
+		Method:  "POST",
+		Path:    path,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    body,
+	}, k.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUnavailable, service, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned status %d: %s", ErrUnavailable, service, resp.StatusCode, resp.Body)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,372 @@
+// Package query parses list parameters (limit, offset, cursor, sort and field filters)
+// and applies them to GORM queries against a per-endpoint allow-list.
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Default page sizes, used when a Spec does not set its own.
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrInvalidQuery is returned for malformed list parameters, such as an unknown sort field,
+// a filter value of the wrong type or a cursor from a different query.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Kind is the type a filter value is parsed as.
+type Kind int
+
+const (
+	String Kind = iota
+	Bool
+	Int
+	Time // "2006-01-02" or RFC 3339
+)
+
+// Op is the comparison a filter applies.
+type Op int
+
+const (
+	Eq       Op = iota
+	Gte         // column >= value
+	Lte         // column <= value; a bare date includes the whole day
+	Prefix      // case-insensitive LIKE 'value%'
+	Contains    // case-insensitive LIKE '%value%'
+)
+
+// Filter describes one allowed filter parameter.
+type Filter struct {
+	Column string
+	Kind   Kind
+	Op     Op
+
+	// Apply, when set, replaces the column comparison for filters that need custom SQL.
+	Apply func(db *gorm.DB, value string) (*gorm.DB, error)
+}
+
+// Spec is the allow-list for one collection endpoint.
+type Spec struct {
+	Filters map[string]Filter // query parameter -> filter
+	// Sorts maps sort fields to columns or SQL expressions. Expressions must not be NULL
+	// (wrap nullable columns in COALESCE) so cursors can compare them.
+	Sorts        map[string]string
+	DefaultSort  string // e.g. "-createdAt"; "id" when empty
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// Params are the list parameters from a request.
+type Params struct {
+	Limit   int
+	Offset  int    // ignored when Cursor is set
+	Cursor  string // NextCursor from the previous page
+	Sort    string // field name, "-" prefix for descending
+	Filters map[string]string
+}
+
+// Page is the standard list envelope.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// reserved are the paging parameters; every other query parameter is treated as a filter.
+var reserved = map[string]bool{"limit": true, "offset": true, "cursor": true, "sort": true}
+
+// FromValues reads list parameters from a URL query string.
+// Filters are only checked against an allow-list when the Params are applied.
+func FromValues(values url.Values) (Params, error) {
+	params := Params{
+		Cursor:  values.Get("cursor"),
+		Sort:    values.Get("sort"),
+		Filters: map[string]string{},
+	}
+	var err error
+	if params.Limit, err = intValue(values, "limit"); err != nil {
+		return Params{}, err
+	}
+	if params.Offset, err = intValue(values, "offset"); err != nil {
+		return Params{}, err
+	}
+	if params.Offset < 0 {
+		return Params{}, fmt.Errorf("%w: offset must not be negative", ErrInvalidQuery)
+	}
+	for key := range values {
+		if !reserved[key] {
+			params.Filters[key] = values.Get(key)
+		}
+	}
+	return params, nil
+}
+
+// Find runs db with the spec's filters, sort and paging applied, and returns one page.
+// db may already carry conditions and preloads; T must have an ID uint field.
+func Find[T any](db *gorm.DB, spec Spec, params Params) (Page[T], error) {
+	sort := params.Sort
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	if sort == "" {
+		sort = "id"
+	}
+	field, desc := strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	column := "id"
+	if field != "id" {
+		var ok bool
+		if column, ok = spec.Sorts[field]; !ok {
+			return Page[T]{}, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, field)
+		}
+	}
+
+	limit := params.Limit
+	maxLimit := spec.MaxLimit
+	if maxLimit == 0 {
+		maxLimit = MaxLimit
+	}
+	if limit <= 0 {
+		limit = spec.DefaultLimit
+		if limit == 0 {
+			limit = DefaultLimit
+		}
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	filtered, err := spec.apply(db, params.Filters)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	var total int64
+	if err := filtered.Session(&gorm.Session{}).Model(new(T)).Count(&total).Error; err != nil {
+		return Page[T]{}, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+	offset := params.Offset
+	pageQuery := filtered.Session(&gorm.Session{})
+	if params.Cursor != "" {
+		key, err := decodeCursor(params.Cursor)
+		if err != nil || key.Sort != sort {
+			return Page[T]{}, fmt.Errorf("%w: cursor does not match this query", ErrInvalidQuery)
+		}
+		if column == "id" {
+			pageQuery = pageQuery.Where("id "+comparison+" ?", key.ID)
+		} else {
+			value, err := key.value()
+			if err != nil {
+				return Page[T]{}, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+			}
+			pageQuery = pageQuery.Where("("+column+" "+comparison+" ? OR ("+column+" = ? AND id "+comparison+" ?))", value, value, key.ID)
+		}
+		offset = 0
+	}
+
+	pageQuery = pageQuery.Order(column + " " + direction)
+	if column != "id" {
+		pageQuery = pageQuery.Order("id " + direction)
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	var items []T
+	if err := pageQuery.Offset(offset).Limit(limit + 1).Find(&items).Error; err != nil {
+		return Page[T]{}, err
+	}
+	if items == nil {
+		items = []T{}
+	}
+
+	page := Page[T]{Items: items, Total: total, Limit: limit, Offset: offset}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		id := idOf(page.Items[limit-1])
+		key := cursorKey{Sort: sort, ID: id}
+		if column != "id" {
+			// Read the sort key back as the database stores it, so the next page compares like for like
+			var raw interface{}
+			row := db.Session(&gorm.Session{NewDB: true}).Model(new(T)).Select(column).Where("id = ?", id).Row()
+			if err := row.Scan(&raw); err != nil {
+				return Page[T]{}, err
+			}
+			if err := key.setValue(raw); err != nil {
+				return Page[T]{}, err
+			}
+		}
+		page.NextCursor = encodeCursor(key)
+	}
+	return page, nil
+}
+
+// apply adds the allow-listed filters to db. Unknown parameters are ignored.
+func (spec Spec) apply(db *gorm.DB, filters map[string]string) (*gorm.DB, error) {
+	for name, raw := range filters {
+		filter, ok := spec.Filters[name]
+		if !ok || raw == "" {
+			continue
+		}
+		if filter.Apply != nil {
+			var err error
+			if db, err = filter.Apply(db, raw); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, name, err)
+			}
+			continue
+		}
+
+		value, endOfDay, err := parseValue(filter.Kind, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, name, err)
+		}
+		switch filter.Op {
+		case Eq:
+			db = db.Where(filter.Column+" = ?", value)
+		case Gte:
+			db = db.Where(filter.Column+" >= ?", value)
+		case Lte:
+			if endOfDay {
+				db = db.Where(filter.Column+" < ?", value.(time.Time).AddDate(0, 0, 1))
+			} else {
+				db = db.Where(filter.Column+" <= ?", value)
+			}
+		case Prefix:
+			db = db.Where("LOWER("+filter.Column+") LIKE ? ESCAPE '\\'", EscapeLike(strings.ToLower(raw))+"%")
+		case Contains:
+			db = db.Where("LOWER("+filter.Column+") LIKE ? ESCAPE '\\'", "%"+EscapeLike(strings.ToLower(raw))+"%")
+		}
+	}
+	return db, nil
+}
+
+// EscapeLike escapes LIKE wildcards so user input matches literally (use with ESCAPE '\').
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ParseTime parses a "2006-01-02" date or an RFC 3339 time. dateOnly reports which form was used.
+func ParseTime(raw string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC(), false, nil
+	}
+	t, err = time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, false, errors.New("must be YYYY-MM-DD or an RFC 3339 time")
+	}
+	return t, true, nil
+}
+
+func parseValue(kind Kind, raw string) (value interface{}, endOfDay bool, err error) {
+	switch kind {
+	case Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, false, errors.New("must be true or false")
+		}
+		return b, false, nil
+	case Int:
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return nil, false, errors.New("must be a non-negative number")
+		}
+		return uint(n), false, nil
+	case Time:
+		t, dateOnly, err := ParseTime(raw)
+		return t, dateOnly, err
+	default:
+		return raw, false, nil
+	}
+}
+
+func intValue(values url.Values, key string) (int, error) {
+	v := values.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s must be a number", ErrInvalidQuery, key)
+	}
+	return n, nil
+}
+
+// idOf reads the ID field of a model.
+func idOf(item interface{}) uint {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	return uint(v.FieldByName("ID").Uint())
+}
+
+// cursorKey is the decoded form of Page.NextCursor: the sort key and ID of the last row.
+// The sort key keeps its database type so the next page binds it the same way.
+type cursorKey struct {
+	Sort  string `json:"s"`
+	Kind  string `json:"k,omitempty"` // i, f, s or t
+	Value string `json:"v,omitempty"`
+	ID    uint   `json:"id"`
+}
+
+func (k *cursorKey) setValue(raw interface{}) error {
+	switch v := raw.(type) {
+	case int64:
+		k.Kind, k.Value = "i", strconv.FormatInt(v, 10)
+	case float64:
+		k.Kind, k.Value = "f", strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		k.Kind, k.Value = "i", map[bool]string{false: "0", true: "1"}[v]
+	case string:
+		k.Kind, k.Value = "s", v
+	case []byte:
+		k.Kind, k.Value = "s", string(v)
+	case time.Time:
+		k.Kind, k.Value = "t", v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Errorf("sort key of type %T cannot be used in a cursor", raw)
+	}
+	return nil
+}
+
+func (k cursorKey) value() (interface{}, error) {
+	switch k.Kind {
+	case "i":
+		return strconv.ParseInt(k.Value, 10, 64)
+	case "f":
+		return strconv.ParseFloat(k.Value, 64)
+	case "s":
+		return k.Value, nil
+	case "t":
+		return time.Parse(time.RFC3339Nano, k.Value)
+	}
+	return nil, fmt.Errorf("unknown cursor kind %q", k.Kind)
+}
+
+func encodeCursor(k cursorKey) string {
+	raw, _ := json.Marshal(k)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (cursorKey, error) {
+	var k cursorKey
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return k, err
+	}
+	err = json.Unmarshal(raw, &k)
+	return k, err
+}
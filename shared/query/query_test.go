@@ -0,0 +1,277 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// item is a list row with a nullable name, a score with ties and a timestamp.
+type item struct {
+	ID      uint
+	Name    *string
+	Score   int
+	Active  bool
+	Created time.Time
+}
+
+var itemQuery = Spec{
+	Filters: map[string]Filter{
+		"score":   {Column: "score", Kind: Int},
+		"active":  {Column: "active", Kind: Bool},
+		"name":    {Column: "name", Op: Prefix},
+		"search":  {Column: "name", Op: Contains},
+		"from":    {Column: "created", Kind: Time, Op: Gte},
+		"to":      {Column: "created", Kind: Time, Op: Lte},
+		"minimum": {Apply: func(db *gorm.DB, value string) (*gorm.DB, error) { return db.Where("score >= ?", value), nil }},
+	},
+	Sorts: map[string]string{
+		"name":    "COALESCE(name, '')",
+		"score":   "score",
+		"created": "created",
+	},
+	DefaultLimit: 2,
+}
+
+// newTestDB opens a database with seven items. Scores tie in pairs and two items have no name.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	name := func(s string) *string { return &s }
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, it := range []item{
+		{Name: name("pear"), Score: 2, Active: true, Created: day},
+		{Name: name("apple"), Score: 1, Created: day.AddDate(0, 0, 1)},
+		{Name: nil, Score: 2, Active: true, Created: day.AddDate(0, 0, 2)},
+		{Name: name("100%_pure"), Score: 3, Created: day.AddDate(0, 0, 3)},
+		{Name: name("Apricot"), Score: 1, Active: true, Created: day.AddDate(0, 0, 4)},
+		{Name: nil, Score: 3, Created: day.AddDate(0, 0, 5)},
+		{Name: name("banana"), Score: 4, Created: day.AddDate(0, 0, 5).Add(time.Hour)},
+	} {
+		if err := db.Create(&it).Error; err != nil {
+			t.Fatalf("create item: %v", err)
+		}
+	}
+	return db
+}
+
+// allPages follows cursors from the first page and returns the IDs of every page.
+func allPages(t *testing.T, db *gorm.DB, params Params) [][]uint {
+	t.Helper()
+	var pages [][]uint
+	for {
+		page, err := Find[item](db, itemQuery, params)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		ids := []uint{}
+		for _, it := range page.Items {
+			ids = append(ids, it.ID)
+		}
+		pages = append(pages, ids)
+		if page.NextCursor == "" || len(pages) > 10 {
+			return pages
+		}
+		params.Cursor = page.NextCursor
+	}
+}
+
+func TestSortWithIDTieBreak(t *testing.T) {
+	db := newTestDB(t)
+	tests := []struct {
+		sort string
+		want [][]uint
+	}{
+		{"", [][]uint{{1, 2}, {3, 4}, {5, 6}, {7}}},
+		{"-id", [][]uint{{7, 6}, {5, 4}, {3, 2}, {1}}},
+		// Equal scores are ordered by ID, in the sort's direction, and no page repeats or skips one
+		{"score", [][]uint{{2, 5}, {1, 3}, {4, 6}, {7}}},
+		{"-score", [][]uint{{7, 6}, {4, 3}, {1, 5}, {2}}},
+		// Items without a name sort first, like an empty name
+		{"name", [][]uint{{3, 6}, {4, 5}, {2, 7}, {1}}},
+		{"created", [][]uint{{1, 2}, {3, 4}, {5, 6}, {7}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			if got := allPages(t, db, Params{Sort: tt.sort}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilters(t *testing.T) {
+	db := newTestDB(t)
+	tests := []struct {
+		filters map[string]string
+		want    []uint
+	}{
+		{map[string]string{"score": "2"}, []uint{1, 3}},
+		{map[string]string{"active": "true", "score": "1"}, []uint{5}},
+		{map[string]string{"name": "ap"}, []uint{2, 5}},
+		{map[string]string{"search": "%_"}, []uint{4}},
+		{map[string]string{"search": "_"}, []uint{4}},
+		{map[string]string{"from": "2026-03-05"}, []uint{5, 6, 7}},
+		{map[string]string{"to": "2026-03-02"}, []uint{1, 2}},
+		{map[string]string{"to": "2026-03-02T12:00:00Z"}, []uint{1, 2}},
+		{map[string]string{"minimum": "3"}, []uint{4, 6, 7}},
+		// Parameters outside the allow-list, and empty values, are ignored
+		{map[string]string{"id": "1", "score": ""}, []uint{1, 2, 3, 4, 5, 6, 7}},
+	}
+	for _, tt := range tests {
+		page, err := Find[item](db, itemQuery, Params{Limit: 10, Filters: tt.filters})
+		if err != nil {
+			t.Fatalf("Find(%v): %v", tt.filters, err)
+		}
+		got := []uint{}
+		for _, it := range page.Items {
+			got = append(got, it.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) || page.Total != int64(len(tt.want)) {
+			t.Errorf("Find(%v) = %v (total %d), want %v", tt.filters, got, page.Total, tt.want)
+		}
+	}
+}
+
+func TestInvalidQueries(t *testing.T) {
+	db := newTestDB(t)
+	first, err := Find[item](db, itemQuery, Params{Sort: "score"})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	tests := []struct {
+		name   string
+		params Params
+	}{
+		{"sort field not in the allow-list", Params{Sort: "active"}},
+		{"sort by a raw column", Params{Sort: "created; DROP TABLE items"}},
+		{"malformed number", Params{Filters: map[string]string{"score": "-1"}}},
+		{"malformed bool", Params{Filters: map[string]string{"active": "yes please"}}},
+		{"malformed date", Params{Filters: map[string]string{"from": "01/03/2026"}}},
+		{"cursor from another sort", Params{Sort: "-score", Cursor: first.NextCursor}},
+		{"garbled cursor", Params{Sort: "score", Cursor: "not a cursor!"}},
+		{"cursor with an unknown kind", Params{Sort: "score", Cursor: encodeCursor(cursorKey{Sort: "score", Kind: "x", Value: "1", ID: 2})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Find[item](db, itemQuery, tt.params); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("got %v, want ErrInvalidQuery", err)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	db := newTestDB(t)
+	tests := []struct {
+		spec      Spec
+		limit     int
+		wantLimit int
+	}{
+		{itemQuery, 0, 2},
+		{itemQuery, 5, 5},
+		{itemQuery, 1000, MaxLimit},
+		{Spec{MaxLimit: 3}, 1000, 3},
+		{Spec{}, 0, DefaultLimit},
+	}
+	for _, tt := range tests {
+		page, err := Find[item](db, tt.spec, Params{Limit: tt.limit})
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if page.Limit != tt.wantLimit {
+			t.Errorf("limit %d: got %d, want %d", tt.limit, page.Limit, tt.wantLimit)
+		}
+	}
+
+	// An offset pages without a cursor; a cursor replaces it
+	page, _ := Find[item](db, itemQuery, Params{Offset: 5})
+	if len(page.Items) != 2 || page.Items[0].ID != 6 || page.NextCursor != "" {
+		t.Errorf("offset 5 = %+v, want items 6 and 7 and no next page", page)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 30, 0, 123456789, time.UTC)
+	tests := []struct {
+		raw  interface{}
+		want interface{}
+	}{
+		{int64(-42), int64(-42)},
+		{float64(2.5), float64(2.5)},
+		{true, int64(1)},
+		{"O'Brien, Zoë", "O'Brien, Zoë"},
+		{[]byte("raw"), "raw"},
+		{at, at},
+	}
+	for _, tt := range tests {
+		key := cursorKey{Sort: "-name", ID: 9}
+		if err := key.setValue(tt.raw); err != nil {
+			t.Fatalf("setValue(%v): %v", tt.raw, err)
+		}
+		decoded, err := decodeCursor(encodeCursor(key))
+		if err != nil {
+			t.Fatalf("decodeCursor: %v", err)
+		}
+		value, err := decoded.value()
+		if err != nil {
+			t.Fatalf("value: %v", err)
+		}
+		if decoded.Sort != "-name" || decoded.ID != 9 || !reflect.DeepEqual(value, tt.want) {
+			t.Errorf("%v came back as %+v with value %v, want %v", tt.raw, decoded, value, tt.want)
+		}
+	}
+
+	var key cursorKey
+	if err := key.setValue(struct{}{}); err == nil {
+		t.Error("setValue accepted a struct")
+	}
+}
+
+func TestFromValues(t *testing.T) {
+	values, _ := url.ParseQuery("limit=10&offset=20&sort=-name&cursor=abc&name=ap&score=2")
+	params, err := FromValues(values)
+	if err != nil {
+		t.Fatalf("FromValues: %v", err)
+	}
+	want := Params{Limit: 10, Offset: 20, Cursor: "abc", Sort: "-name", Filters: map[string]string{"name": "ap", "score": "2"}}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got %+v, want %+v", params, want)
+	}
+
+	for _, raw := range []string{"limit=ten", "offset=-1"} {
+		values, _ := url.ParseQuery(raw)
+		if _, err := FromValues(values); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("FromValues(%s): got %v, want ErrInvalidQuery", raw, err)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"100%", `100\%`},
+		{"a_b", `a\_b`},
+		{`back\slash`, `back\\slash`},
+		{`\%_`, `\\\%\_`},
+	}
+	for _, tt := range tests {
+		if got := EscapeLike(tt.in); got != tt.want {
+			t.Errorf("EscapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Package references checks that the records a new record references exist, and may be
+// referenced, in the services that own them. Owners answer over Kafka; answers are cached for
+// a short while so that a burst of creates does not turn into a burst of lookups.
+//
+// A lookup waits at most Timeout for the owning service. When it does not answer in time, the
+// last answer for the record is used if it is no older than StaleTTL. Otherwise the fallback
+// applies: FallbackReject, the default, fails the create with ErrUnavailable; FallbackAccept
+// lets the reference through unchecked and logs it.
+package references
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fitnis/shared/kafka"
+)
+
+// CheckPath is served by every service owning records that others reference
+const CheckPath = "/references/check"
+
+// Services owning referenced records
+const (
+	Patients     = "patients"
+	Examinations = "examinations"
+)
+
+// What a lookup does when the owning service does not answer in time
+const (
+	FallbackReject = "reject"
+	FallbackAccept = "accept"
+)
+
+var (
+	// ErrNotFound means the referenced record does not exist
+	ErrNotFound = errors.New("referenced record not found")
+	// ErrInactive means the referenced record exists but may no longer be referenced
+	ErrInactive = errors.New("referenced record cannot be referenced")
+	// ErrUnavailable means the owning service could not be asked
+	ErrUnavailable = errors.New("reference check unavailable")
+)
+
+// Request asks the owning service about one record
+type Request struct {
+	ID uint `json:"id"`
+}
+
+// Result is the owning service's answer
+type Result struct {
+	Exists    bool   `json:"exists"`
+	Active    bool   `json:"active"`              // whether new records may reference it
+	Reason    string `json:"reason,omitempty"`    // why not, when it exists but is inactive
+	PatientID uint   `json:"patientId,omitempty"` // the patient an examination belongs to
+}
+
+// Checker checks references to records owned by other services
+type Checker interface {
+	// Check returns the owner's answer, failing with ErrNotFound or ErrInactive unless the
+	// record may be referenced. An unchecked reference let through by a fallback has a zero Result.
+	Check(service string, id uint) (Result, error)
+}
+
+// Require checks a reference with the checker. A nil checker fails with ErrUnavailable.
+func Require(checker Checker, service string, id uint) error {
+	_, err := Lookup(checker, service, id)
+	return err
+}
+
+// Lookup checks a reference like Require and returns the owner's answer.
+func Lookup(checker Checker, service string, id uint) (Result, error) {
+	if checker == nil {
+		return Result{}, fmt.Errorf("%w: no reference checker configured", ErrUnavailable)
+	}
+	return checker.Check(service, id)
+}
+
+// KafkaChecker asks the owning services over Kafka and caches the records they report
+type KafkaChecker struct {
+	Timeout  time.Duration // how long to wait for the owning service
+	TTL      time.Duration // how long an answer is used without asking again
+	StaleTTL time.Duration // how long an answer may stand in for a service that does not answer
+	Fallback string        // FallbackReject or FallbackAccept
+
+	mu    sync.Mutex
+	cache map[cacheKey]cached
+	send  func(service string, req kafka.KafkaRequest, timeout time.Duration) (kafka.KafkaResponse, error) // kafka.SendRequest when nil
+}
+
+// cacheKey identifies a record in its owning service.
+type cacheKey struct {
+	service string
+	id      uint
+}
+
+// cached is an answer and when it was given.
+type cached struct {
+	result Result
+	at     time.Time
+}
+
+// NewKafkaChecker creates a checker with the default timeout, cache lifetimes and fallback
+func NewKafkaChecker() *KafkaChecker {
+	return &KafkaChecker{
+		Timeout:  2 * time.Second,
+		TTL:      30 * time.Second,
+		StaleTTL: 10 * time.Minute,
+		Fallback: FallbackReject,
+		cache:    make(map[cacheKey]cached),
+	}
+}
+
+// NewKafkaCheckerFromEnv creates a checker configured by REFERENCE_CHECK_TIMEOUT,
+// REFERENCE_CHECK_TTL, REFERENCE_CHECK_STALE_TTL and REFERENCE_CHECK_FALLBACK.
+func NewKafkaCheckerFromEnv() *KafkaChecker {
+	k := NewKafkaChecker()
+	k.Timeout = durationEnv("REFERENCE_CHECK_TIMEOUT", k.Timeout)
+	k.TTL = durationEnv("REFERENCE_CHECK_TTL", k.TTL)
+	k.StaleTTL = durationEnv("REFERENCE_CHECK_STALE_TTL", k.StaleTTL)
+	switch fallback := os.Getenv("REFERENCE_CHECK_FALLBACK"); fallback {
+	case "":
+	case FallbackReject, FallbackAccept:
+		k.Fallback = fallback
+	default:
+		log.Printf("Invalid REFERENCE_CHECK_FALLBACK %q, using %s", fallback, k.Fallback)
+	}
+	return k
+}
+
+// Check fails with ErrNotFound or ErrInactive unless the service's record may be referenced.
+// Records that were not found are not cached, so one created moments later is found.
+func (k *KafkaChecker) Check(service string, id uint) (Result, error) {
+	key := cacheKey{service, id}
+	last, ok := k.lookup(key)
+	if ok && time.Since(last.at) < k.TTL {
+		return last.result, last.result.err(service, id)
+	}
+
+	result, err := k.ask(service, id)
+	if err != nil {
+		if ok && time.Since(last.at) < k.StaleTTL {
+			log.Printf("Using the last answer for %s %d: %v", service, id, err)
+			return last.result, last.result.err(service, id)
+		}
+		if k.Fallback == FallbackAccept {
+			log.Printf("Accepting unchecked reference to %s %d: %v", service, id, err)
+			return Result{}, nil
+		}
+		return Result{}, err
+	}
+
+	k.mu.Lock()
+	if result.Exists {
+		k.cache[key] = cached{result: result, at: time.Now()}
+	} else {
+		delete(k.cache, key)
+	}
+	k.mu.Unlock()
+	return result, result.err(service, id)
+}
+
+// lookup returns the cached answer for a record, if any.
+func (k *KafkaChecker) lookup(key cacheKey) (cached, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.cache == nil {
+		k.cache = make(map[cacheKey]cached)
+	}
+	entry, ok := k.cache[key]
+	return entry, ok
+}
+
+// ask asks the owning service about a record.
+func (k *KafkaChecker) ask(service string, id uint) (Result, error) {
+	body, err := json.Marshal(Request{ID: id})
+	if err != nil {
+		return Result{}, err
+	}
+	send := k.send
+	if send == nil {
+		send = kafka.SendRequest
+	}
+	resp, err := send(service, kafka.KafkaRequest{
+		Method:  "POST",
+		Path:    CheckPath,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    body,
+	}, k.Timeout)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %s: %v", ErrUnavailable, service, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("%w: %s returned status %d", ErrUnavailable, service, resp.StatusCode)
+	}
+	var result Result
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return Result{}, fmt.Errorf("%w: %s: %v", ErrUnavailable, service, err)
+	}
+	return result, nil
+}
+
+// err turns an answer into the error for referencing the record, if any.
+func (r Result) err(service string, id uint) error {
+	switch {
+	case !r.Exists:
+		return fmt.Errorf("%w: %s %d", ErrNotFound, service, id)
+	case !r.Active:
+		return fmt.Errorf("%w: %s %d: %s", ErrInactive, service, id, r.Reason)
+	}
+	return nil
+}
+
+// durationEnv reads a positive duration such as "2s" from the environment.
+func durationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,127 @@
+package references
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fitnis/shared/kafka"
+)
+
+// fakeOwner answers reference checks with its result, or fails when down, counting the requests.
+type fakeOwner struct {
+	result Result
+	status int // replied with result when http.StatusOK
+	down   bool
+	asked  int
+}
+
+func (f *fakeOwner) send(service string, req kafka.KafkaRequest, timeout time.Duration) (kafka.KafkaResponse, error) {
+	f.asked++
+	if f.down {
+		return kafka.KafkaResponse{}, errors.New("timed out")
+	}
+	body, _ := json.Marshal(f.result)
+	return kafka.KafkaResponse{RequestID: req.RequestID, StatusCode: f.status, Body: body}, nil
+}
+
+// newTestChecker creates a checker asking the owner, with a TTL of a minute and a StaleTTL of an hour.
+func newTestChecker(owner *fakeOwner) *KafkaChecker {
+	k := NewKafkaChecker()
+	k.TTL = time.Minute
+	k.StaleTTL = time.Hour
+	k.send = owner.send
+	return k
+}
+
+// age makes the cached answer for patient 1 as old as given.
+func age(k *KafkaChecker, d time.Duration) {
+	key := cacheKey{Patients, 1}
+	entry := k.cache[key]
+	entry.at = time.Now().Add(-d)
+	k.cache[key] = entry
+}
+
+func TestCheckCachesAnswersForTTL(t *testing.T) {
+	owner := &fakeOwner{result: Result{Exists: true, Active: true}, status: http.StatusOK}
+	k := newTestChecker(owner)
+
+	for i := 0; i < 3; i++ {
+		if _, err := k.Check(Patients, 1); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+	}
+	if owner.asked != 1 {
+		t.Errorf("asked %d times within the TTL, want 1", owner.asked)
+	}
+
+	age(k, 2*time.Minute)
+	if _, err := k.Check(Patients, 1); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if owner.asked != 2 {
+		t.Errorf("asked %d times after the TTL, want 2", owner.asked)
+	}
+}
+
+func TestCheckDoesNotCacheMissingRecords(t *testing.T) {
+	owner := &fakeOwner{status: http.StatusOK}
+	k := newTestChecker(owner)
+
+	if _, err := k.Check(Patients, 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	owner.result = Result{Exists: true, Active: true}
+	if _, err := k.Check(Patients, 1); err != nil {
+		t.Errorf("record created since: %v", err)
+	}
+	if owner.asked != 2 {
+		t.Errorf("asked %d times, want 2", owner.asked)
+	}
+}
+
+func TestCheckWhenOwnerDoesNotAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		cached   *Result       // answer cached before the owner goes down
+		age      time.Duration // of the cached answer
+		fallback string
+		status   int // of the owner's reply; 0 when it does not reply at all
+		want     error
+		wantOK   bool // the result is the cached one
+	}{
+		{name: "no answer rejects", fallback: FallbackReject, want: ErrUnavailable},
+		{name: "error status rejects", fallback: FallbackReject, status: http.StatusInternalServerError, want: ErrUnavailable},
+		{name: "no answer accepts unchecked", fallback: FallbackAccept},
+		{name: "stale answer stands in", cached: &Result{Exists: true, Active: true, PatientID: 7}, age: 30 * time.Minute, fallback: FallbackReject, wantOK: true},
+		{name: "stale inactive answer still refuses", cached: &Result{Exists: true, Reason: "deceased"}, age: 30 * time.Minute, fallback: FallbackAccept, want: ErrInactive, wantOK: true},
+		{name: "answer past StaleTTL falls back", cached: &Result{Exists: true, Active: true}, age: 2 * time.Hour, fallback: FallbackReject, want: ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := &fakeOwner{status: http.StatusOK}
+			k := newTestChecker(owner)
+			k.Fallback = tt.fallback
+			if tt.cached != nil {
+				owner.result = *tt.cached
+				k.Check(Patients, 1)
+				age(k, tt.age)
+			}
+			owner.down = tt.status == 0
+			owner.status = tt.status
+
+			result, err := k.Check(Patients, 1)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			switch {
+			case tt.wantOK && result != *tt.cached:
+				t.Errorf("result = %+v, want the cached %+v", result, *tt.cached)
+			case !tt.wantOK && result != (Result{}):
+				t.Errorf("result = %+v, want none", result)
+			}
+		})
+	}
+}